@@ -0,0 +1,57 @@
+package goffkv_zk
+
+import (
+    "strings"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// WithACL sets the ACL of every node the client creates (world:anyone with all permissions by
+// default). For authenticated sessions, zk.AuthACL(zk.PermAll) grants access to the creator only.
+func WithACL(acl []zkapi.ACL) Option {
+    return func(c *Client) {
+        c.acl = acl
+    }
+}
+
+func isWorldACL(acl []zkapi.ACL) bool {
+    for _, entry := range acl {
+        if entry.Scheme == "world" && entry.ID == "anyone" {
+            return true
+        }
+    }
+    return false
+}
+
+// HardenPrefix replaces the ACL of each node of the prefix that is open to world:anyone (as
+// created by older versions of this package) with acl, parents first. Nodes with a different
+// ACL are left alone.
+func (c *Client) HardenPrefix(acl []zkapi.ACL) error {
+    return c.runOp("acl", "", true, func() error {
+        return c.hardenPrefix(acl)
+    })
+}
+
+func (c *Client) hardenPrefix(acl []zkapi.ACL) error {
+    for i := range c.prefixSegments {
+        path := "/" + strings.Join(c.prefixSegments[:i + 1], "/")
+        for {
+            current, stat, err := c.conn.GetACL(path)
+            if err != nil {
+                return convertError(err)
+            }
+            if !isWorldACL(current) {
+                break
+            }
+
+            _, err = c.conn.SetACL(path, acl, stat.Aversion)
+            if err == zkapi.ErrBadVersion {
+                continue
+            }
+            if err != nil {
+                return convertError(err)
+            }
+            break
+        }
+    }
+    return nil
+}
@@ -0,0 +1,80 @@
+package goffkv_zk
+
+import (
+    "testing"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+var testACL = zkapi.DigestACL(zkapi.PermAll, "user", "secret")
+
+// Returns the ACL of the node at path.
+func nodeACL(zk *fakeZK, path string) []zkapi.ACL {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    node, ok := zk.nodes[path]
+    if !ok {
+        zk.t.Fatalf("no node %s", path)
+    }
+    return node.acl
+}
+
+func TestWithACL(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithACL(testACL))
+    defer c.Close()
+
+    if _, err := c.Create("/k", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    for _, path := range []string{"/test", "/test/k"} {
+        if isWorldACL(nodeACL(zk, path)) {
+            t.Errorf("%s created with %v", path, nodeACL(zk, path))
+        }
+    }
+}
+
+func TestHardenPrefix(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c, err := Connect(zk.Addr(), "/a/b", WithLogger(quietLogger))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    if _, err := c.Create("/k", nil, false); err != nil {
+        t.Fatal(err)
+    }
+
+    // Someone else changes the ACL of the first node meanwhile.
+    failed := false
+    zk.Fail(func(op int32, path string) error {
+        if op == fzSetAcl && !failed {
+            failed = true
+            return zkapi.ErrBadVersion
+        }
+        return nil
+    })
+    if err := c.HardenPrefix(testACL); err != nil {
+        t.Fatal(err)
+    }
+    for _, path := range []string{"/a", "/a/b"} {
+        if isWorldACL(nodeACL(zk, path)) {
+            t.Errorf("%s left with %v", path, nodeACL(zk, path))
+        }
+    }
+    if !isWorldACL(nodeACL(zk, "/a/b/k")) {
+        t.Error("a node below the prefix hardened")
+    }
+
+    // Hardened nodes are left alone.
+    zk.Fail(nil)
+    acls := zk.Requests(fzSetAcl)
+    if err := c.HardenPrefix(zkapi.WorldACL(zkapi.PermAll)); err != nil {
+        t.Fatal(err)
+    }
+    if zk.Requests(fzSetAcl) != acls {
+        t.Error("ACL of a hardened node replaced")
+    }
+}
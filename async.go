@@ -0,0 +1,100 @@
+package goffkv_zk
+
+import (
+    "context"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Outcome of an asynchronous operation (CreateAsync, GetAsync...); only the fields of the
+// operation are set. Asynchronous operations return at once with a channel receiving their
+// outcome; their requests are pipelined on the connection with the ones of other operations
+// instead of waiting for them, so a single goroutine can keep the connection busy. No ordering
+// between them is guaranteed, unless the client has been created WithOrderedCommits: then writes
+// (and commits) touching related keys are applied in the order they were issued.
+type AsyncResult struct {
+    Ver goffkv.Version
+    Value []byte
+    Children []string
+    // Of CommitAsync.
+    Results []goffkv.TxnOpResult
+    Err error
+}
+
+// Runs op in the background, once the writes registered before t are done; the channel receives
+// its result and is closed.
+func (c *Client) async(t *commitTicket, op func() AsyncResult) <-chan AsyncResult {
+    result := make(chan AsyncResult, 1)
+    go func() {
+        defer close(result)
+        t.wait()
+        defer c.commits.leave(t)
+        result <- op()
+    }()
+    return result
+}
+
+// Registers a write of key, to order it after the related writes in progress, if ordered.
+func (c *Client) enterWrite(key string) *commitTicket {
+    return c.commits.enter(goffkv.Txn{Ops: []goffkv.Operation{{Key: key}}})
+}
+
+func (c *Client) CreateAsync(key string, value []byte, lease bool) <-chan AsyncResult {
+    return c.async(c.enterWrite(key), func() (r AsyncResult) {
+        r.Ver, r.Err = c.Create(key, value, lease)
+        return
+    })
+}
+
+func (c *Client) SetAsync(key string, value []byte) <-chan AsyncResult {
+    return c.async(c.enterWrite(key), func() (r AsyncResult) {
+        r.Ver, r.Err = c.Set(key, value)
+        return
+    })
+}
+
+func (c *Client) CasAsync(key string, value []byte, ver goffkv.Version) <-chan AsyncResult {
+    return c.async(c.enterWrite(key), func() (r AsyncResult) {
+        r.Ver, r.Err = c.Cas(key, value, ver)
+        return
+    })
+}
+
+func (c *Client) EraseAsync(key string, ver goffkv.Version) <-chan AsyncResult {
+    return c.async(c.enterWrite(key), func() (r AsyncResult) {
+        r.Err = c.Erase(key, ver)
+        return
+    })
+}
+
+func (c *Client) ExistsAsync(key string) <-chan AsyncResult {
+    return c.async(nil, func() (r AsyncResult) {
+        r.Ver, _, r.Err = c.Exists(key, false)
+        return
+    })
+}
+
+func (c *Client) GetAsync(key string) <-chan AsyncResult {
+    return c.async(nil, func() (r AsyncResult) {
+        r.Ver, r.Value, _, r.Err = c.Get(key, false)
+        return
+    })
+}
+
+func (c *Client) ChildrenAsync(key string) <-chan AsyncResult {
+    return c.async(nil, func() (r AsyncResult) {
+        r.Children, _, r.Err = c.Children(key, false)
+        return
+    })
+}
+
+func (c *Client) CommitAsync(txn goffkv.Txn) <-chan AsyncResult {
+    t := c.commits.enter(txn)
+    result := make(chan AsyncResult, 1)
+    go func() {
+        defer close(result)
+        var r AsyncResult
+        r.Results, r.Err = txnResults(c.commitTicketed(context.Background(), txn, t))
+        result <- r
+    }()
+    return result
+}
@@ -0,0 +1,68 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "testing"
+    goffkv "github.com/offscale/goffkv"
+)
+
+func TestAsync(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    created := c.CreateAsync("/k", []byte("v"), false)
+    r := <-created
+    if r.Err != nil || r.Ver != 1 {
+        t.Fatalf("CreateAsync: %+v", r)
+    }
+    if _, ok := <-created; ok {
+        t.Error("channel not closed after the result")
+    }
+
+    reads := []<-chan AsyncResult{c.GetAsync("/k"), c.ExistsAsync("/k"), c.ChildrenAsync("/k"), c.GetAsync("/missing")}
+    if r := <-reads[0]; r.Err != nil || string(r.Value) != "v" || r.Ver != 1 {
+        t.Errorf("GetAsync: %+v", r)
+    }
+    if r := <-reads[1]; r.Err != nil || r.Ver != 1 {
+        t.Errorf("ExistsAsync: %+v", r)
+    }
+    if r := <-reads[2]; r.Err != nil || len(r.Children) != 0 {
+        t.Errorf("ChildrenAsync: %+v", r)
+    }
+    if r := <-reads[3]; r.Err != goffkv.OpErrNoEntry {
+        t.Errorf("GetAsync of a missing key: %+v", r)
+    }
+
+    r = <-c.CommitAsync(goffkv.Txn{Ops: []goffkv.Operation{{What: goffkv.Set, Key: "/k", Value: []byte("w")}}})
+    if r.Err != nil || len(r.Results) != 1 || r.Results[0].Ver != 2 {
+        t.Errorf("CommitAsync: %+v", r)
+    }
+}
+
+// With ordered commits, writes of related keys apply in the order they were issued.
+func TestAsyncOrdered(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithOrderedCommits())
+    defer c.Close()
+
+    results := []<-chan AsyncResult{c.CreateAsync("/parent", nil, false)}
+    for i := 0; i < 20; i++ {
+        results = append(results, c.SetAsync("/parent", []byte(fmt.Sprint(i))))
+    }
+    results = append(results, c.CreateAsync("/parent/child", nil, false))
+    results = append(results, c.EraseAsync("/parent/child", 0))
+    for i, result := range results {
+        if r := <-result; r.Err != nil {
+            t.Fatalf("write %d: %v", i, r.Err)
+        }
+    }
+    if data, stat, _ := zk.Node("/test/parent"); string(data) != "19" || stat.Version != 20 {
+        t.Errorf("value %q at version %d after 20 ordered Sets", data, stat.Version)
+    }
+    if _, _, ok := zk.Node("/test/parent/child"); ok {
+        t.Error("child created after its erase")
+    }
+}
@@ -0,0 +1,41 @@
+package goffkv_zk
+
+import (
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Authenticates the session of a freshly connected client, before Connect returns.
+// Credentials added with conn.AddAuth are resubmitted by the driver after reconnects.
+//
+// Note that the underlying driver speaks no SASL, so GSSAPI/Kerberos can't be implemented
+// as an Authenticator; such ensembles need a SASL-terminating proxy, see WithDialer.
+type Authenticator interface {
+    Authenticate(conn *zkapi.Conn) error
+}
+
+type AuthFunc func(conn *zkapi.Conn) error
+
+func (f AuthFunc) Authenticate(conn *zkapi.Conn) error {
+    return f(conn)
+}
+
+// DigestAuth authenticates with the "digest" scheme.
+func DigestAuth(user string, password string) Authenticator {
+    return AuthFunc(func(conn *zkapi.Conn) error {
+        return conn.AddAuth("digest", []byte(user + ":" + password))
+    })
+}
+
+func WithAuth(auth Authenticator) Option {
+    return func(c *Client) {
+        c.auths = append(c.auths, auth)
+    }
+}
+
+// WithDialer replaces the way connections to ensemble members are established, e.g. to go
+// through a tunnel or a proxy.
+func WithDialer(dialer zkapi.Dialer) Option {
+    return func(c *Client) {
+        c.dialer = dialer
+    }
+}
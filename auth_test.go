@@ -0,0 +1,49 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "net"
+    "sync/atomic"
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestAuth(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+
+    c := newTestClient(t, zk, WithAuth(DigestAuth("user", "secret")))
+    defer c.Close()
+    if n := zk.Requests(fzSetAuth); n != 1 {
+        t.Errorf("%d auth requests by Connect, want 1", n)
+    }
+
+    errDenied := errors.New("denied")
+    var called bool
+    _, err := Connect(zk.Addr(), "/test", WithLogger(quietLogger), WithAuth(AuthFunc(func(conn *zkapi.Conn) error {
+        called = true
+        return errDenied
+    })))
+    if !called || err != errDenied {
+        t.Errorf("Connect with a failing authenticator: %v", err)
+    }
+}
+
+func TestDialer(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+
+    var dials int64
+    c := newTestClient(t, zk, WithDialer(func(network string, address string, timeout time.Duration) (net.Conn, error) {
+        atomic.AddInt64(&dials, 1)
+        return net.DialTimeout(network, address, timeout)
+    }))
+    defer c.Close()
+    if _, err := c.Set("/k", nil); err != nil {
+        t.Fatal(err)
+    }
+    if atomic.LoadInt64(&dials) == 0 {
+        t.Error("connected without the dialer")
+    }
+}
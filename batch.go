@@ -0,0 +1,147 @@
+package goffkv_zk
+
+import (
+    "context"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Groups concurrent Create and Set calls into Multis (see WithWriteBatching).
+type writeBatcher struct {
+    window time.Duration
+    maxOps int
+
+    mu sync.Mutex
+    pending []*batchedWrite
+    // Closed once the last batch taken is done, so that batches are applied in order.
+    last chan struct{}
+}
+
+type batchedWrite struct {
+    op goffkv.Operation
+    // ACL of a create, if not the one of the client.
+    acl []zkapi.ACL
+    done chan struct{}
+    ver goffkv.Version
+    err error
+}
+
+// WithWriteBatching delays every Create and Set by up to window, to send the ones issued
+// meanwhile (up to maxOps) by a single Multi instead of a request each. Each call still gets its
+// own result: if the Multi fails (e.g. one of the keys exists already, or a Set targets a missing
+// key), its writes are done one by one. Writes are applied in the order they were issued. Each
+// Multi is observed as a "batch" op, on top of the "create" or "set" of every write.
+func WithWriteBatching(window time.Duration, maxOps int) Option {
+    return func(c *Client) {
+        if maxOps < 1 {
+            maxOps = 1
+        }
+        last := make(chan struct{})
+        close(last)
+        c.batcher = &writeBatcher{window: window, maxOps: maxOps, last: last}
+    }
+}
+
+func (b *writeBatcher) submit(c *Client, op goffkv.Operation, acl []zkapi.ACL) (goffkv.Version, error) {
+    w := &batchedWrite{op: op, acl: acl, done: make(chan struct{})}
+
+    b.mu.Lock()
+    b.pending = append(b.pending, w)
+    switch {
+    case len(b.pending) >= b.maxOps:
+        batch, prev, done := b.take()
+        b.mu.Unlock()
+        c.flushWrites(batch, prev, done)
+    case len(b.pending) == 1:
+        b.mu.Unlock()
+        time.AfterFunc(b.window, func() {
+            b.mu.Lock()
+            batch, prev, done := b.take()
+            b.mu.Unlock()
+            c.flushWrites(batch, prev, done)
+        })
+    default:
+        b.mu.Unlock()
+    }
+
+    <-w.done
+    return w.ver, w.err
+}
+
+// Takes the pending writes, with the channel of the previous batch and the one of this batch;
+// called with mu held.
+func (b *writeBatcher) take() ([]*batchedWrite, chan struct{}, chan struct{}) {
+    if len(b.pending) == 0 {
+        return nil, nil, nil
+    }
+    batch := b.pending
+    b.pending = nil
+    prev := b.last
+    b.last = make(chan struct{})
+    return batch, prev, b.last
+}
+
+func (c *Client) flushWrites(batch []*batchedWrite, prev chan struct{}, done chan struct{}) {
+    if len(batch) == 0 {
+        return
+    }
+    <-prev
+    defer close(done)
+
+    start := time.Now()
+    txn := goffkv.Txn{Ops: make([]goffkv.Operation, len(batch))}
+    for i, w := range batch {
+        txn.Ops[i] = w.op
+    }
+    var (
+        results []OpResult
+        err error
+    )
+    // A Multi creates nodes with the ACL of the client only, and no TTL nodes.
+    single := len(batch) == 1
+    for _, w := range batch {
+        single = single || w.acl != nil || w.op.What == goffkv.Create && c.leaseFlags(w.op.Key, w.op.Lease) == zkapi.FlagTTL
+    }
+    if !single {
+        unlock := c.lockQueued(txnKeys(txn)...)
+        err = c.retry(context.Background(), true, func() (err error) {
+            results, err = c.commitOnce(txn)
+            return err
+        })
+        if err == nil {
+            for _, op := range txn.Ops {
+                c.queue.drop(op.Key, false)
+            }
+        }
+        unlock()
+        err = c.wrapError("batch", "", err)
+        c.observe("batch", "", start, err)
+        if err != nil {
+            c.logger.Printf("write batch of %d failed (%v), writing one by one", len(batch), err)
+        }
+    }
+    if err != nil || single {
+        // Let each write fail (or succeed) on its own.
+        for _, w := range batch {
+            if w.op.What == goffkv.Create {
+                w.ver, w.err = c.createNow(context.Background(), w.op.Key, w.op.Value, w.op.Lease, w.acl)
+            } else {
+                w.ver, w.err = c.setNow(context.Background(), w.op.Key, w.op.Value)
+            }
+            close(w.done)
+        }
+        return
+    }
+
+    for i, w := range batch {
+        w.ver = results[i].Ver
+        op := "create"
+        if w.op.What == goffkv.Set {
+            op = "set"
+        }
+        c.observe(op, w.op.Key, start, nil)
+        close(w.done)
+    }
+}
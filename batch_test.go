@@ -0,0 +1,66 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Issues writes concurrently, each creating /k<i> (or setting it if set[i]); returns their errors.
+func concurrentWrites(c *Client, set []bool) []error {
+    var wg sync.WaitGroup
+    errs := make([]error, len(set))
+    for i := range set {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            key := fmt.Sprintf("/k%d", i)
+            if set[i] {
+                _, errs[i] = c.Set(key, []byte("set"))
+            } else {
+                _, errs[i] = c.Create(key, []byte("created"), false)
+            }
+        }(i)
+    }
+    wg.Wait()
+    return errs
+}
+
+func TestWriteBatching(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithWriteBatching(50 * time.Millisecond, 3))
+    defer c.Close()
+
+    // A full batch goes at once.
+    start := time.Now()
+    for _, err := range concurrentWrites(c, []bool{false, true, false}) {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    if multis := zk.Requests(fzMulti); multis != 1 {
+        t.Errorf("%d Multis for a batch of 3", multis)
+    }
+    if elapsed := time.Since(start); elapsed > 40 * time.Millisecond {
+        t.Errorf("full batch sent after %v", elapsed)
+    }
+
+    // One conflict makes the others go on their own.
+    errs := concurrentWrites(c, []bool{false, false})
+    if errs[0] != goffkv.OpErrEntryExists || errs[1] != goffkv.OpErrEntryExists {
+        t.Errorf("creates of existing keys: %v", errs)
+    }
+    errs = concurrentWrites(c, []bool{true, false, false, false})
+    if errs[0] != nil || errs[1] != goffkv.OpErrEntryExists || errs[2] != goffkv.OpErrEntryExists || errs[3] != nil {
+        t.Errorf("writes of a failed batch: %v", errs)
+    }
+    if data, _, _ := zk.Node("/test/k0"); string(data) != "set" {
+        t.Errorf("value %q after a failed batch", data)
+    }
+    if _, _, ok := zk.Node("/test/k3"); !ok {
+        t.Error("create of a failed batch not done")
+    }
+}
@@ -0,0 +1,139 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    goffkv "github.com/offscale/goffkv"
+    "golang.org/x/sync/errgroup"
+)
+
+// Maximum number of requests of a bulk operation in flight at a time.
+const bulkConcurrency = 64
+
+var (
+    ErrLengthMismatch = errors.New("keys and values differ in length")
+)
+
+// Failure of a bulk operation on a single key.
+type KeyError struct {
+    Key string
+    Err error
+}
+
+func (e KeyError) Error() string {
+    return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
+
+func (e KeyError) Unwrap() error {
+    return e.Err
+}
+
+// All per-key failures of a bulk operation, in the order of the keys.
+// errors.Is(err, target) reports whether any of them matches target.
+type MultiError struct {
+    Errors []KeyError
+}
+
+func (e *MultiError) Error() string {
+    parts := make([]string, 0, len(e.Errors))
+    for _, keyErr := range e.Errors {
+        parts = append(parts, keyErr.Error())
+    }
+    return fmt.Sprintf("%d operation(s) failed: %s", len(e.Errors), strings.Join(parts, "; "))
+}
+
+func (e *MultiError) Is(target error) bool {
+    for _, keyErr := range e.Errors {
+        if errors.Is(keyErr.Err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+func (e *MultiError) Unwrap() []error {
+    result := make([]error, 0, len(e.Errors))
+    for _, keyErr := range e.Errors {
+        result = append(result, keyErr)
+    }
+    return result
+}
+
+// Runs op for every key concurrently, bulkConcurrency keys at a time, and collects the failures.
+func forEachKey(keys []string, op func(i int, key string) error) error {
+    errs := make([]error, len(keys))
+
+    var g errgroup.Group
+    g.SetLimit(bulkConcurrency)
+    for i, key := range keys {
+        i, key := i, key
+        g.Go(func() error {
+            // Failures are collected rather than cancelling the other keys.
+            errs[i] = op(i, key)
+            return nil
+        })
+    }
+    g.Wait()
+
+    var result MultiError
+    for i, err := range errs {
+        if err != nil {
+            result.Errors = append(result.Errors, KeyError{keys[i], err})
+        }
+    }
+    if len(result.Errors) == 0 {
+        return nil
+    }
+    return &result
+}
+
+// CreateMany creates keys[i] with values[i]; failures don't prevent the other keys from being created.
+// The returned versions are positional (0 for keys that failed). Fails with ErrLengthMismatch,
+// creating nothing, if there isn't a value per key.
+func (c *Client) CreateMany(keys []string, values [][]byte, lease bool) ([]goffkv.Version, error) {
+    if len(keys) != len(values) {
+        return nil, fmt.Errorf("CreateMany: %d keys, %d values: %w", len(keys), len(values), ErrLengthMismatch)
+    }
+
+    result := make([]goffkv.Version, len(keys))
+    err := forEachKey(keys, func(i int, key string) error {
+        var err error
+        result[i], err = c.Create(key, values[i], lease)
+        return err
+    })
+    return result, err
+}
+
+// GetMany reads every key; the returned entries are positional (zero for keys that failed).
+// The driver has no multi-read (ZooKeeper 3.6+), but the concurrent requests (up to 64) are
+// pipelined over the connection, so a batch takes about one round trip per 64 keys. Each entry
+// is consistent on its own; use GetConsistent to read all keys as of a single point in time.
+func (c *Client) GetMany(keys []string) ([]Entry, error) {
+    result := make([]Entry, len(keys))
+    err := forEachKey(keys, func(i int, key string) error {
+        var err error
+        result[i], err = c.GetEntry(key)
+        return err
+    })
+    return result, err
+}
+
+// ExistsMany returns the versions of keys (0 for missing ones), positionally, pipelined like
+// GetMany.
+func (c *Client) ExistsMany(keys []string) ([]goffkv.Version, error) {
+    result := make([]goffkv.Version, len(keys))
+    err := forEachKey(keys, func(i int, key string) error {
+        var err error
+        result[i], _, err = c.Exists(key, false)
+        return err
+    })
+    return result, err
+}
+
+// EraseMany erases every key (with its subtree) regardless of version.
+func (c *Client) EraseMany(keys []string) error {
+    return forEachKey(keys, func(i int, key string) error {
+        return c.Erase(key, 0)
+    })
+}
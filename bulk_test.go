@@ -0,0 +1,57 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "fmt"
+    "sync/atomic"
+    "testing"
+    goffkv "github.com/offscale/goffkv"
+)
+
+func TestForEachKeyBounded(t *testing.T) {
+    keys := make([]string, 4 * bulkConcurrency)
+    var running, peak int64
+    err := forEachKey(keys, func(i int, key string) error {
+        n := atomic.AddInt64(&running, 1)
+        for {
+            old := atomic.LoadInt64(&peak)
+            if n <= old || atomic.CompareAndSwapInt64(&peak, old, n) {
+                break
+            }
+        }
+        defer atomic.AddInt64(&running, -1)
+        if i % 2 == 1 {
+            return fmt.Errorf("failure %d", i)
+        }
+        return nil
+    })
+    if peak > bulkConcurrency {
+        t.Errorf("%d operations in flight, want at most %d", peak, bulkConcurrency)
+    }
+    var multiErr *MultiError
+    if !errors.As(err, &multiErr) || len(multiErr.Errors) != len(keys) / 2 {
+        t.Errorf("failures %v, want every other key", err)
+    }
+}
+
+func TestCreateMany(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    if _, err := c.CreateMany([]string{"/a", "/b"}, [][]byte{nil}, false); !errors.Is(err, ErrLengthMismatch) {
+        t.Errorf("CreateMany with a value missing: %v, want ErrLengthMismatch", err)
+    }
+    if _, err := c.Create("/b", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    vers, err := c.CreateMany([]string{"/a", "/b", "/c"}, [][]byte{nil, nil, nil}, false)
+    if vers[0] == 0 || vers[1] != 0 || vers[2] == 0 {
+        t.Errorf("versions %v", vers)
+    }
+    var multiErr *MultiError
+    if !errors.As(err, &multiErr) || len(multiErr.Errors) != 1 || multiErr.Errors[0].Key != "/b" || !errors.Is(err, goffkv.OpErrEntryExists) {
+        t.Errorf("CreateMany over an existing key: %v", err)
+    }
+}
@@ -0,0 +1,213 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    goffkv "github.com/offscale/goffkv"
+)
+
+type ChildrenOrder int
+
+const (
+    // Whatever order the server returns, i.e. none in particular.
+    ServerOrder ChildrenOrder = iota
+    // Lexicographic order of the child names.
+    ByName
+    // By the 10-digit sequence suffix ZooKeeper appends to sequential nodes (as used by locks,
+    // queues and elections); names without one go last, by name.
+    BySequence
+)
+
+// How ChildrenWith filters and orders children, on the client side: the server always sends
+// the whole list. Filters apply first, then the order, then Offset and Limit.
+type ChildrenOptions struct {
+    Order ChildrenOrder
+    // Reverses Order.
+    Descending bool
+    // Only children whose names start with NamePrefix are returned.
+    NamePrefix string
+    // Only children whose names match Pattern (a glob, as with path.Match) are returned.
+    Pattern string
+    // Skips the first Offset children, and returns at most Limit of them (all if 0). Paging
+    // through them only makes sense with an Order.
+    Offset int
+    Limit int
+}
+
+func (opts ChildrenOptions) match(name string) bool {
+    if !strings.HasPrefix(name, opts.NamePrefix) {
+        return false
+    }
+    if opts.Pattern != "" {
+        // Checked beforehand.
+        ok, _ := path.Match(opts.Pattern, name)
+        return ok
+    }
+    return true
+}
+
+// Returns the sequence number of a sequential node name, or -1.
+func sequenceOf(name string) int64 {
+    if len(name) < 10 {
+        return -1
+    }
+    seq, err := strconv.ParseInt(name[len(name) - 10:], 10, 64)
+    if err != nil {
+        return -1
+    }
+    return seq
+}
+
+func sortChildren(names []string, order ChildrenOrder) {
+    switch order {
+    case ByName:
+        sort.Strings(names)
+    case BySequence:
+        sort.SliceStable(names, func(i, j int) bool {
+            si, sj := sequenceOf(names[i]), sequenceOf(names[j])
+            switch {
+            case si < 0 && sj < 0:
+                return names[i] < names[j]
+            case si < 0 || sj < 0:
+                return sj < 0
+            case si != sj:
+                return si < sj
+            default:
+                return names[i] < names[j]
+            }
+        })
+    }
+}
+
+// ChildrenWith works like Children, but filters and orders the result according to opts.
+func (c *Client) ChildrenWith(key string, watch bool, opts ChildrenOptions) ([]string, goffkv.Watch, error) {
+    if _, err := path.Match(opts.Pattern, ""); err != nil {
+        return nil, nil, fmt.Errorf("children pattern %q: %w", opts.Pattern, err)
+    }
+    children, resultWatch, err := c.Children(key, watch)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    names := make([]string, 0, len(children))
+    for _, child := range children {
+        name := child[len(key) + 1:]
+        if opts.match(name) {
+            names = append(names, name)
+        }
+    }
+    sortChildren(names, opts.Order)
+    if opts.Descending {
+        for i, j := 0, len(names) - 1; i < j; i, j = i + 1, j - 1 {
+            names[i], names[j] = names[j], names[i]
+        }
+    }
+    if opts.Offset > 0 {
+        if opts.Offset > len(names) {
+            opts.Offset = len(names)
+        }
+        names = names[opts.Offset:]
+    }
+    if opts.Limit > 0 && len(names) > opts.Limit {
+        names = names[:opts.Limit]
+    }
+
+    result := make([]string, 0, len(names))
+    for _, name := range names {
+        result = append(result, key + "/" + name)
+    }
+    return result, resultWatch, nil
+}
+
+// WithMaxResponseSize raises the size of the largest reply the client can receive (1.5MB by
+// default), e.g. the children of a node with hundreds of thousands of them. Neither the driver
+// nor the server can page through children: lists that keep growing are better spread over
+// several parents (see Sharded).
+func WithMaxResponseSize(bytes int) Option {
+    return func(c *Client) {
+        c.maxResponseSize = bytes
+    }
+}
+
+// WalkChildren calls fn with the children of key (like ChildrenWith, but as names), pageSize at a
+// time, so that long lists can be processed piecewise. ZooKeeper has no server-side pagination:
+// the whole list is read once, by a single reply (see WithMaxResponseSize), and later changes
+// aren't reflected. An error of fn stops the walk and is returned.
+func (c *Client) WalkChildren(key string, pageSize int, opts ChildrenOptions, fn func(names []string) error) error {
+    if pageSize < 1 {
+        pageSize = 1
+    }
+    children, _, err := c.ChildrenWith(key, false, opts)
+    if err != nil {
+        return err
+    }
+
+    names := make([]string, len(children))
+    for i, child := range children {
+        names[i] = child[len(key) + 1:]
+    }
+    for len(names) != 0 {
+        n := pageSize
+        if n > len(names) {
+            n = len(names)
+        }
+        err = fn(names[:n])
+        if err != nil {
+            return err
+        }
+        names = names[n:]
+    }
+    return nil
+}
+
+// The children of a key, read once and served page by page (see ChildrenPages).
+type ChildrenPages struct {
+    key string
+    // Sorted.
+    names []string
+}
+
+// ChildrenPages reads the children of key, to serve them by pages. ZooKeeper has no server-side
+// pagination: the whole list is read at once, by a single reply (see WithMaxResponseSize), and
+// pages don't reflect later changes; reading it again is up to the caller.
+func (c *Client) ChildrenPages(key string) (*ChildrenPages, error) {
+    children, _, err := c.ChildrenWith(key, false, ChildrenOptions{Order: ByName})
+    if err != nil {
+        return nil, err
+    }
+
+    names := make([]string, len(children))
+    for i, child := range children {
+        names[i] = child[len(key) + 1:]
+    }
+    return &ChildrenPages{key: key, names: names}, nil
+}
+
+func (p *ChildrenPages) Len() int {
+    return len(p.names)
+}
+
+// Page returns up to limit children by name (all of them if limit < 1), starting after the name
+// after ("" for the first page), and the name to pass as after for the next page ("" after the
+// last one). A position given by name stays valid for a list read again in between.
+func (p *ChildrenPages) Page(after string, limit int) ([]string, string) {
+    i := sort.SearchStrings(p.names, after)
+    if i < len(p.names) && p.names[i] == after {
+        i++
+    }
+    names := p.names[i:]
+    next := ""
+    if limit >= 1 && len(names) > limit {
+        names = names[:limit]
+        next = names[limit - 1]
+    }
+
+    result := make([]string, len(names))
+    for j, name := range names {
+        result[j] = p.key + "/" + name
+    }
+    return result, next
+}
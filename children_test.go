@@ -0,0 +1,83 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+)
+
+func TestChildrenPages(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    var want []string
+    for i := 0; i < 5; i++ {
+        zk.Put(fmt.Sprintf("/test/list/%d", i), nil)
+        want = append(want, fmt.Sprintf("/list/%d", i))
+    }
+    reads := zk.Requests(fzGetChildren) + zk.Requests(fzGetChildren2)
+    pages, err := c.ChildrenPages("/list")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if pages.Len() != 5 {
+        t.Fatalf("Len %d", pages.Len())
+    }
+
+    var got []string
+    after := ""
+    for n := 0; ; n++ {
+        if n > 3 {
+            t.Fatal("too many pages")
+        }
+        page, next := pages.Page(after, 2)
+        got = append(got, page...)
+        if next == "" {
+            break
+        }
+        after = next
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("pages %v, want %v", got, want)
+    }
+    if n := zk.Requests(fzGetChildren) + zk.Requests(fzGetChildren2) - reads; n != 1 {
+        t.Errorf("%d children reads for all pages, want 1", n)
+    }
+
+    // A position survives a list read again after the last name seen is gone.
+    if err := c.Erase("/list/1", 0); err != nil {
+        t.Fatal(err)
+    }
+    pages, err = c.ChildrenPages("/list")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if page, _ := pages.Page("1", 1); !reflect.DeepEqual(page, []string{"/list/2"}) {
+        t.Errorf("page after an erased name: %v", page)
+    }
+}
+
+func TestWalkChildren(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    for i := 0; i < 5; i++ {
+        zk.Put(fmt.Sprintf("/test/list/%d", i), nil)
+    }
+    reads := zk.Requests(fzGetChildren) + zk.Requests(fzGetChildren2)
+    var sizes []int
+    err := c.WalkChildren("/list", 2, ChildrenOptions{Order: ByName}, func(names []string) error {
+        sizes = append(sizes, len(names))
+        return nil
+    })
+    if err != nil || !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+        t.Errorf("WalkChildren: pages of %v, %v", sizes, err)
+    }
+    if n := zk.Requests(fzGetChildren) + zk.Requests(fzGetChildren2) - reads; n != 1 {
+        t.Errorf("%d children reads for the walk, want 1", n)
+    }
+}
@@ -0,0 +1,258 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/url"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    chunksSegment = "chunks"
+    defaultChunkSize = 512 * 1024
+)
+
+var (
+    ErrValueChanged = errors.New("value changed while being read")
+
+    // Starts the value of a key whose actual value is split into chunk nodes.
+    chunkMagic = []byte("\x00goffkv-chunks\x00")
+)
+
+// Stored (after chunkMagic) in place of a chunked value. The chunks of a generation live in
+// "<prefix>/.goffkv/chunks/<escaped key>/<generation>/<index>", and are never modified: a new
+// value gets a new generation, 128 random bits.
+type chunkManifest struct {
+    Generation string `json:"generation"`
+    Chunks int `json:"chunks"`
+    Size int64 `json:"size"`
+}
+
+func parseManifest(data []byte) (chunkManifest, bool) {
+    if !bytes.HasPrefix(data, chunkMagic) {
+        return chunkManifest{}, false
+    }
+    var manifest chunkManifest
+    err := json.Unmarshal(data[len(chunkMagic):], &manifest)
+    return manifest, err == nil
+}
+
+// WithChunking splits values longer than chunkSize bytes (512 KiB if 0) into chunk nodes,
+// so that values over the maximum request size of the server (jute.maxbuffer, 1 MB by default)
+// can be stored. The key itself holds a small manifest, hence Cas and watches work as usual.
+// Chunked values are read back transparently by every client, chunking or not. The chunks of a
+// failed write are removed right away, but superseded chunks (and those of writes interrupted by
+// a connection loss) are left behind: run StartGC (or CollectGarbage) to remove them.
+func WithChunking(chunkSize int) Option {
+    return func(c *Client) {
+        if chunkSize <= 0 {
+            chunkSize = defaultChunkSize
+        }
+        c.chunkSize = chunkSize
+    }
+}
+
+// The segments of the chunks of key (a normalized key), relative to the prefix.
+func chunksSegments(key string) []string {
+    return []string{reservedSegment, chunksSegment, url.PathEscape(key)}
+}
+
+func (c *Client) chunkPath(key string, generation string, index int) string {
+    return fmt.Sprintf("%s/%s/%010d", c.assemblePath(chunksSegments(key)), generation, index)
+}
+
+// Stores value in chunks if it is too long; returns what to store in the node of key instead.
+func (c *Client) chunkValue(key string, value []byte) ([]byte, error) {
+    if c.chunkSize == 0 || len(value) <= c.chunkSize {
+        return value, nil
+    }
+
+    generation := make([]byte, 16)
+    _, err := rand.Read(generation)
+    if err != nil {
+        return nil, err
+    }
+    manifest := chunkManifest{
+        Generation: hex.EncodeToString(generation),
+        Chunks: (len(value) + c.chunkSize - 1) / c.chunkSize,
+        Size: int64(len(value)),
+    }
+    generationSegments := append(chunksSegments(key), manifest.Generation)
+    for attempt := 1; ; attempt++ {
+        err = c.createEachPrefix(append(append([]string{}, c.prefixSegments...), generationSegments...))
+        // The garbage collector may remove the directory of the key in between.
+        if err != zkapi.ErrNoNode || attempt == 3 {
+            break
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    for i := 0; i < manifest.Chunks; i++ {
+        end := (i + 1) * c.chunkSize
+        if end > len(value) {
+            end = len(value)
+        }
+        _, err = c.conn.Create(c.chunkPath(key, manifest.Generation, i), value[i * c.chunkSize:end], 0, c.acl)
+        if err != nil {
+            c.discardGeneration(key, manifest.Generation)
+            return nil, err
+        }
+    }
+
+    data, err := json.Marshal(manifest)
+    if err != nil {
+        return nil, err
+    }
+    return append(append([]byte{}, chunkMagic...), data...), nil
+}
+
+// Tells whether a write that failed with err has certainly not been applied, so that the chunks
+// written for it can be discarded; those of the other failed writes are swept by the garbage
+// collector once they are older than its grace period.
+func notWritten(err error) bool {
+    return err != nil && !IsTransient(err)
+}
+
+// Removes the chunks written for data (as returned by encodeValue for key), if it is a manifest.
+func (c *Client) discardChunks(key string, data []byte) {
+    if manifest, ok := parseManifest(data); ok {
+        c.discardGeneration(key, manifest.Generation)
+    }
+}
+
+// A value as written by encodeValue for key, possibly the manifest of chunks.
+type encodedValue struct {
+    key string
+    data []byte
+}
+
+func (c *Client) discardAllChunks(values []encodedValue) {
+    for _, value := range values {
+        c.discardChunks(value.key, value.data)
+    }
+}
+
+func (c *Client) discardGeneration(key string, generation string) {
+    _, err := c.eraseTree(append(chunksSegments(key), generation), 0, EraseOptions{Strategy: EraseStreaming})
+    if err != nil && err != goffkv.OpErrNoEntry {
+        c.logger.Printf("chunks of %s: %v", key, err)
+    }
+}
+
+// Returns the actual value if data (read from the node of key) is a manifest. Fails with
+// ErrValueChanged if the chunks have been collected in the meantime.
+func (c *Client) unchunkValue(key string, data []byte) ([]byte, error) {
+    manifest, ok := parseManifest(data)
+    if !ok {
+        return data, nil
+    }
+
+    result := bytes.NewBuffer(make([]byte, 0, manifest.Size))
+    _, err := io.Copy(result, &chunkReader{
+        c: c,
+        key: key,
+        manifest: manifest,
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.Bytes(), nil
+}
+
+// Works like conn.GetW, but reassembles chunked values.
+func (c *Client) getW(path string) ([]byte, *zkapi.Stat, <-chan zkapi.Event, error) {
+    for {
+        data, stat, ech, err := c.conn.GetW(path)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        value, err := c.decodeValue(c.keyOf(path), valueOf(data))
+        if err == ErrValueChanged {
+            continue
+        }
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        return value, stat, ech, nil
+    }
+}
+
+type chunkReader struct {
+    c *Client
+    key string
+    manifest chunkManifest
+    next int
+    current bytes.Reader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+    for r.current.Len() == 0 {
+        if r.next == r.manifest.Chunks {
+            return 0, io.EOF
+        }
+
+        data, _, err := r.c.conn.Get(r.c.chunkPath(r.key, r.manifest.Generation, r.next))
+        if err == zkapi.ErrNoNode {
+            // The generation has been replaced and collected.
+            return 0, ErrValueChanged
+        }
+        if err != nil {
+            return 0, convertError(err)
+        }
+        r.current.Reset(data)
+        r.next++
+    }
+    return r.current.Read(p)
+}
+
+func (r *chunkReader) Close() error {
+    return nil
+}
+
+// GetStream reads the value of key, fetching a chunked value one chunk at a time (and
+// decompressing it on the fly). Reading fails with ErrValueChanged if the value is replaced
+// before all of its chunks have been read.
+func (c *Client) GetStream(key string) (stream io.ReadCloser, err error) {
+    err = c.runOp("get", key, false, func() (err error) {
+        stream, err = c.getStream(key)
+        return err
+    })
+    return
+}
+
+func (c *Client) getStream(key string) (io.ReadCloser, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    data, _, err := c.conn.Get(c.assemblePath(segments))
+    if err != nil {
+        return nil, convertError(err)
+    }
+    data = valueOf(data)
+
+    var stream io.Reader = bytes.NewReader(data)
+    if manifest, ok := parseManifest(data); ok {
+        stream = &chunkReader{
+            c: c,
+            key: normalizeKey(segments),
+            manifest: manifest,
+        }
+    }
+
+    stream, err = c.decompressReader(stream)
+    if err != nil {
+        return nil, err
+    }
+    return ioutil.NopCloser(stream), nil
+}
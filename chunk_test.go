@@ -0,0 +1,107 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const chunksRoot = "/test/.goffkv/chunks/%2Fk"
+
+// Returns the chunk generations of /k.
+func generations(zk *fakeZK) []string {
+    var result []string
+    for _, p := range zk.Paths(chunksRoot) {
+        rest := strings.TrimPrefix(p, chunksRoot + "/")
+        if rest != p && !strings.Contains(rest, "/") {
+            result = append(result, rest)
+        }
+    }
+    return result
+}
+
+func TestChunking(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithChunking(4))
+    defer c.Close()
+
+    value := []byte("a value of several chunks")
+    if _, err := c.Set("/k", value); err != nil {
+        t.Fatal(err)
+    }
+    _, got, _, err := c.Get("/k", false)
+    if err != nil || !bytes.Equal(got, value) {
+        t.Fatalf("Get of a chunked value: %q, %v", got, err)
+    }
+    first := generations(zk)
+    if len(first) != 1 {
+        t.Fatalf("generations %v after a Set", first)
+    }
+
+    if _, err := c.Set("/k", value); err != nil {
+        t.Fatal(err)
+    }
+    if gens := generations(zk); len(gens) != 2 || gens[0] == gens[1] {
+        t.Errorf("generations %v after another Set", gens)
+    }
+}
+
+// Failed writes don't leave their chunks behind.
+func TestChunksOfFailedWrites(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithChunking(4))
+    defer c.Close()
+
+    ver, err := c.Create("/k", []byte("abc"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Create("/k", []byte("a value of several chunks"), false); !errors.Is(err, goffkv.OpErrEntryExists) {
+        t.Fatalf("Create of an existing key: %v", err)
+    }
+    if newVer, err := c.Cas("/k", []byte("a value of several chunks"), ver + 1); err != nil || newVer != 0 {
+        t.Fatalf("Cas of a stale version: %v, %v", newVer, err)
+    }
+    _, err = c.Commit(goffkv.Txn{
+        Checks: []goffkv.Check{{Key: "/k", Ver: ver + 1}},
+        Ops: []goffkv.Operation{{Key: "/k", What: goffkv.Set, Value: []byte("a value of several chunks")}},
+    })
+    var txnErr goffkv.TxnError
+    if !errors.As(err, &txnErr) {
+        t.Fatalf("Commit with a failing check: %v", err)
+    }
+    if gens := generations(zk); len(gens) != 0 {
+        t.Errorf("generations %v left by failed writes", gens)
+    }
+}
+
+// The chunks of writes interrupted by a connection loss are collected after the grace period.
+func TestChunksCollected(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithChunking(4))
+    defer c.Close()
+
+    if _, err := c.Set("/k", []byte("a value of several chunks")); err != nil {
+        t.Fatal(err)
+    }
+    current := generations(zk)
+    zk.Put(chunksRoot + "/orphan/0000000000", []byte("lost"))
+
+    removed, err := c.CollectGarbage(GCOptions{Grace: time.Hour})
+    if err != nil || removed != 0 {
+        t.Fatalf("CollectGarbage within the grace period removed %d, %v", removed, err)
+    }
+    removed, err = c.CollectGarbage(GCOptions{Grace: time.Nanosecond})
+    if err != nil || removed != 2 {
+        t.Fatalf("CollectGarbage removed %d, %v; want the orphaned generation", removed, err)
+    }
+    if gens := generations(zk); len(gens) != 1 || gens[0] != current[0] {
+        t.Errorf("generations %v after collection, want %v", gens, current)
+    }
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    goffkv "github.com/offscale/goffkv"
+    goffkv_zk "github.com/offscale/goffkv-zk"
+)
+
+type command struct {
+    usage string
+    run func(client *goffkv_zk.Client, args []string) error
+}
+
+var (
+    commands = map[string]command{
+        "stale-locks": {
+            usage: "[-max-age DURATION] [-check-sessions] [-remove] KEY",
+            run: staleLocks,
+        },
+        "import": {
+            usage: "[-format goffkv|zk-shell|zkdump] [-root PATH] [-mode overwrite|skip|fail] KEY FILE",
+            run: importDump,
+        },
+        "migrate": {
+            usage: "-from URL [-from-prefix PATH] KEY",
+            run: migrate,
+        },
+        "stats": {
+            usage: "",
+            run: serverStats,
+        },
+    }
+)
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "usage: %s -servers HOST:PORT[,HOST:PORT...] [-prefix PATH] COMMAND [ARGS]\n\ncommands:\n", os.Args[0])
+    for name, cmd := range commands {
+        fmt.Fprintf(os.Stderr, "  %s %s\n", name, cmd.usage)
+    }
+    flag.PrintDefaults()
+}
+
+func staleLocks(client *goffkv_zk.Client, args []string) error {
+    flags := flag.NewFlagSet("stale-locks", flag.ExitOnError)
+    var opts goffkv_zk.StaleLockOptions
+    flags.DurationVar(&opts.MaxAge, "max-age", 0, "report contenders older than this")
+    flags.BoolVar(&opts.CheckSessions, "check-sessions", false, "report contenders whose owner session is not connected")
+    remove := flags.Bool("remove", false, "erase the reported nodes")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return fmt.Errorf("stale-locks: expected a single key")
+    }
+
+    locks, err := client.FindStaleLocks(flags.Arg(0), opts)
+    if err != nil {
+        return err
+    }
+    for _, lock := range locks {
+        fmt.Printf("%s\towner=0x%x\tcreated=%s\t%s\n", lock.Key, lock.Owner, lock.Created.Format("2006-01-02T15:04:05Z07:00"), lock.Reason)
+    }
+
+    if *remove {
+        return client.RemoveStaleLocks(locks)
+    }
+    return nil
+}
+
+var importModes = map[string]goffkv_zk.ImportMode{
+    "overwrite": goffkv_zk.ImportOverwrite,
+    "skip": goffkv_zk.ImportSkipExisting,
+    "fail": goffkv_zk.ImportFailOnConflict,
+}
+
+// Restores a snapshot written by Export, or a dump of another ZooKeeper tool, at a key.
+func importDump(client *goffkv_zk.Client, args []string) error {
+    flags := flag.NewFlagSet("import", flag.ExitOnError)
+    format := flags.String("format", "goffkv", "format of the file: goffkv (Export), zk-shell (mirror to json://) or zkdump")
+    root := flags.String("root", "/", "ZooKeeper path of the dumped subtree to import (zk-shell and zkdump)")
+    modeName := flags.String("mode", "fail", "what to do with existing keys: overwrite, skip or fail")
+    flags.Parse(args)
+    if flags.NArg() != 2 {
+        return fmt.Errorf("import: expected a key and a file")
+    }
+    mode, ok := importModes[*modeName]
+    if !ok {
+        return fmt.Errorf("import: unknown mode %q", *modeName)
+    }
+
+    file, err := os.Open(flags.Arg(1))
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    var parse func(io.Reader) (goffkv_zk.Snapshot, error)
+    switch *format {
+    case "goffkv":
+        parse = func(r io.Reader) (snapshot goffkv_zk.Snapshot, err error) {
+            err = json.NewDecoder(r).Decode(&snapshot)
+            return
+        }
+    case "zk-shell":
+        parse = func(r io.Reader) (goffkv_zk.Snapshot, error) {
+            return goffkv_zk.ParseZKShell(r, *root)
+        }
+    case "zkdump":
+        parse = func(r io.Reader) (goffkv_zk.Snapshot, error) {
+            return goffkv_zk.ParseZKDump(r, *root)
+        }
+    default:
+        return fmt.Errorf("import: unknown format %q", *format)
+    }
+    snapshot, err := parse(file)
+    if err != nil {
+        return fmt.Errorf("import: %s: %v", flags.Arg(1), err)
+    }
+
+    result, err := client.Import(flags.Arg(0), snapshot, mode)
+    fmt.Printf("%d created, %d updated, %d skipped\n", len(result.Created), len(result.Updated), len(result.Skipped))
+    return err
+}
+
+// Copies a subtree from another goffkv backend (any registered with goffkv.Open) into the
+// ensemble.
+func migrate(client *goffkv_zk.Client, args []string) error {
+    flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+    from := flags.String("from", "", "URL of the source, e.g. zk://host:2181")
+    fromPrefix := flags.String("from-prefix", "", "goffkv prefix of the source")
+    flags.Parse(args)
+    if *from == "" || flags.NArg() != 1 {
+        return fmt.Errorf("migrate: expected -from and a single key")
+    }
+
+    src, err := goffkv.Open(*from, *fromPrefix)
+    if err != nil {
+        return err
+    }
+    defer src.Close()
+
+    result, err := goffkv_zk.Migrate(src, client, flags.Arg(0))
+    fmt.Printf("%d keys, %d bytes, sha256 %s\n", result.Keys, result.Bytes, result.Checksum)
+    return err
+}
+
+// Prints the state of every ensemble member, one per line.
+func serverStats(client *goffkv_zk.Client, args []string) error {
+    if len(args) != 0 {
+        return fmt.Errorf("stats: no argument expected")
+    }
+
+    for _, stats := range client.ServerStats() {
+        if stats.Err != nil {
+            fmt.Printf("%s\terror=%v\n", stats.Server, stats.Err)
+            continue
+        }
+        fmt.Printf("%s\tmode=%s\toutstanding=%d\tlatency=%v/%v/%v\tconnections=%d\tznodes=%d\twatches=%d\n",
+            stats.Server, stats.Mode, stats.Outstanding, stats.MinLatency, stats.AvgLatency, stats.MaxLatency,
+            stats.Connections, stats.NodeCount, stats.WatchCount)
+    }
+    return nil
+}
+
+func main() {
+    servers := flag.String("servers", "", "comma-separated ensemble members")
+    prefix := flag.String("prefix", "", "goffkv prefix")
+    flag.Usage = usage
+    flag.Parse()
+
+    if *servers == "" || flag.NArg() == 0 {
+        usage()
+        os.Exit(2)
+    }
+    cmd, ok := commands[flag.Arg(0)]
+    if !ok {
+        usage()
+        os.Exit(2)
+    }
+
+    client, err := goffkv_zk.Connect(*servers, *prefix)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    defer client.Close()
+
+    err = cmd.run(client, flag.Args()[1:])
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        client.Close()
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,89 @@
+package goffkv_zk
+
+import (
+    zkapi "github.com/go-zookeeper/zk"
+    "golang.org/x/sync/singleflight"
+)
+
+type getResult struct {
+    data []byte
+    stat *zkapi.Stat
+}
+
+type existsResult struct {
+    exists bool
+    stat *zkapi.Stat
+}
+
+// WithReadCoalescing makes concurrent Get (and Exists) calls without a watch for the same key
+// share a single round trip, e.g. when many goroutines re-read a key after a watch has fired.
+// A read that joins one in flight may miss a write that completed after that read was sent.
+func WithReadCoalescing() Option {
+    return func(c *Client) {
+        c.reads = &singleflight.Group{}
+    }
+}
+
+// Reads path, reassembling chunked values.
+func (c *Client) get(path string) ([]byte, *zkapi.Stat, error) {
+    for {
+        data, stat, err := c.getRaw(path)
+        if err != nil {
+            return nil, nil, err
+        }
+        value, err := c.decodeValue(c.keyOf(path), data)
+        if err == ErrValueChanged {
+            continue
+        }
+        if err != nil {
+            return nil, nil, err
+        }
+        return value, stat, nil
+    }
+}
+
+func (c *Client) getRaw(path string) ([]byte, *zkapi.Stat, error) {
+    err := c.syncRead(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    if c.reads == nil || c.linearizable {
+        return c.hedgedGet(path)
+    }
+
+    result, err, shared := c.reads.Do("get:" + path, func() (interface{}, error) {
+        data, stat, err := c.hedgedGet(path)
+        return getResult{data, stat}, err
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+
+    r := result.(getResult)
+    if shared {
+        // Callers own the values they get.
+        r.data = append([]byte{}, r.data...)
+    }
+    return r.data, r.stat, nil
+}
+
+func (c *Client) exists(path string) (bool, *zkapi.Stat, error) {
+    err := c.syncRead(path)
+    if err != nil {
+        return false, nil, err
+    }
+    if c.reads == nil || c.linearizable {
+        return c.hedgedExists(path)
+    }
+
+    result, err, _ := c.reads.Do("exists:" + path, func() (interface{}, error) {
+        exists, stat, err := c.hedgedExists(path)
+        return existsResult{exists, stat}, err
+    })
+    if err != nil {
+        return false, nil, err
+    }
+
+    r := result.(existsResult)
+    return r.exists, r.stat, nil
+}
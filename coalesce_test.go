@@ -0,0 +1,78 @@
+package goffkv_zk
+
+import (
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestReadCoalescing(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithReadCoalescing())
+    defer c.Close()
+
+    zk.Put("/test/k", []byte("v"))
+    zk.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            time.Sleep(50 * time.Millisecond)
+        }
+        return nil
+    })
+
+    const readers = 8
+    values := make([][]byte, readers)
+    var wg sync.WaitGroup
+    reads := zk.Requests(fzGetData)
+    for i := 0; i < readers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            _, values[i], _, _ = c.Get("/k", false)
+        }(i)
+    }
+    wg.Wait()
+    if n := zk.Requests(fzGetData) - reads; n >= readers {
+        t.Errorf("%d requests for %d concurrent reads", n, readers)
+    }
+
+    // Every caller gets a value of its own.
+    values[0][0] = 'x'
+    for i, value := range values[1:] {
+        if string(value) != "v" {
+            t.Errorf("reader %d got %q", i + 1, value)
+        }
+    }
+}
+
+// A shared empty value is copied as an empty value, not nil, for the callers that don't go
+// through valueOf.
+func TestReadCoalescingEmpty(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithReadCoalescing())
+    defer c.Close()
+
+    zk.Put("/test/k", nil)
+    zk.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            time.Sleep(50 * time.Millisecond)
+        }
+        return nil
+    })
+    values := make([][]byte, 4)
+    var wg sync.WaitGroup
+    for i := range values {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            values[i], _, _ = c.getRaw("/test/k")
+        }(i)
+    }
+    wg.Wait()
+    for i, value := range values {
+        if value == nil {
+            t.Errorf("reader %d got nil", i)
+        }
+    }
+}
@@ -0,0 +1,146 @@
+package goffkv_zk
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "io/ioutil"
+)
+
+var (
+    // Starts a compressed value; followed by the name of the codec and a zero byte.
+    codecMagic = []byte("\x00goffkv-codec\x00")
+
+    GzipCodec Codec = gzipCodec{}
+)
+
+// A compression scheme for values. Name is stored with every compressed value, so that any client
+// knowing the codec can read it back.
+type Codec interface {
+    Name() string
+    NewWriter(w io.Writer) io.WriteCloser
+    NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+    return "gzip"
+}
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser {
+    return gzip.NewWriter(w)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+    return gzip.NewReader(r)
+}
+
+// WithCompression compresses values of at least minSize bytes with codec before storing them
+// (and before splitting them in chunks, see WithChunking). Compressed values are recognized by
+// a header and decompressed on read; values written without compression are read as they are.
+// Gzip values can be read by every client; other codecs have to be passed to WithCodecs.
+func WithCompression(codec Codec, minSize int) Option {
+    return func(c *Client) {
+        c.compression = codec
+        c.compressMinSize = minSize
+        c.codecs[codec.Name()] = codec
+    }
+}
+
+// WithCodecs lets the client read values compressed with codecs (by other clients).
+func WithCodecs(codecs ...Codec) Option {
+    return func(c *Client) {
+        for _, codec := range codecs {
+            c.codecs[codec.Name()] = codec
+        }
+    }
+}
+
+// Returns value encoded with codec, behind a header naming it.
+func encodeWith(codec Codec, value []byte) ([]byte, error) {
+    var result bytes.Buffer
+    result.Write(codecMagic)
+    result.WriteString(codec.Name())
+    result.WriteByte(0)
+
+    w := codec.NewWriter(&result)
+    _, err := w.Write(value)
+    if closeErr := w.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return nil, err
+    }
+    return result.Bytes(), nil
+}
+
+// Wraps r (a stored value) with decoding readers as long as it starts with a codec header:
+// an encrypted value may be compressed too.
+func (c *Client) decompressReader(r io.Reader) (io.Reader, error) {
+    for {
+        br := bufio.NewReader(r)
+        magic, _ := br.Peek(len(codecMagic))
+        if !bytes.Equal(magic, codecMagic) {
+            return br, nil
+        }
+
+        br.Discard(len(codecMagic))
+        name, err := br.ReadString(0)
+        if err != nil {
+            return nil, err
+        }
+        name = name[:len(name) - 1]
+        codec, ok := c.codecs[name]
+        if !ok {
+            return nil, fmt.Errorf("value encoded with unknown codec %q", name)
+        }
+        r, err = codec.NewReader(br)
+        if err != nil {
+            return nil, err
+        }
+    }
+}
+
+func (c *Client) decompress(data []byte) ([]byte, error) {
+    if !bytes.HasPrefix(data, codecMagic) {
+        return data, nil
+    }
+
+    r, err := c.decompressReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    return ioutil.ReadAll(r)
+}
+
+// Returns what to store in the node of key (a normalized key) for value: compressed, then
+// encrypted, then chunked, each step if enabled.
+func (c *Client) encodeValue(key string, value []byte) ([]byte, error) {
+    data := value
+    var err error
+    if c.compression != nil && len(value) >= c.compressMinSize {
+        data, err = encodeWith(c.compression, data)
+        if err != nil {
+            return nil, err
+        }
+    }
+    if c.encryption != nil {
+        data, err = encodeWith(c.encryption, data)
+        if err != nil {
+            return nil, err
+        }
+    }
+    return c.chunkValue(key, data)
+}
+
+// Returns the value of key (a normalized key) from what is stored in its node.
+func (c *Client) decodeValue(key string, data []byte) ([]byte, error) {
+    data, err := c.unchunkValue(key, data)
+    if err != nil {
+        return nil, err
+    }
+    return c.decompress(data)
+}
@@ -0,0 +1,46 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestCompression(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithCompression(GzipCodec, 100))
+    defer c.Close()
+
+    big := []byte(strings.Repeat("compressible ", 100))
+    if _, err := c.Set("/big", big); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/small", []byte("tiny")); err != nil {
+        t.Fatal(err)
+    }
+
+    stored, _, _ := zk.Node("/test/big")
+    if !bytes.HasPrefix(stored, codecMagic) || len(stored) >= len(big) {
+        t.Errorf("stored %d bytes of a %d bytes value, uncompressed", len(stored), len(big))
+    }
+    if stored, _, _ := zk.Node("/test/small"); string(stored) != "tiny" {
+        t.Errorf("value under the minimum size stored as %q", stored)
+    }
+
+    _, value, _, err := c.Get("/big", false)
+    if err != nil || !bytes.Equal(value, big) {
+        t.Fatalf("Get of a compressed value: %d bytes, %v", len(value), err)
+    }
+
+    // Any client reads gzip values, and values written without compression.
+    plain := newTestClient(t, zk)
+    defer plain.Close()
+    if _, value, _, err := plain.Get("/big", false); err != nil || !bytes.Equal(value, big) {
+        t.Errorf("Get by a client without compression: %d bytes, %v", len(value), err)
+    }
+    zk.Put("/test/raw", []byte("raw"))
+    if _, value, _, err := c.Get("/raw", false); err != nil || string(value) != "raw" {
+        t.Errorf("Get of an uncompressed value: %q, %v", value, err)
+    }
+}
@@ -0,0 +1,208 @@
+package goffkv_zk
+
+import (
+    "sort"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const defaultCompactBatchSize = 100
+
+// An entry of a history or journal subtree, i.e. a child of the compacted key.
+type HistoryEntry struct {
+    Key string
+    Created time.Time
+    // Size of the value as stored.
+    Size int
+    path string
+    czxid int64
+}
+
+// Chooses the entries to remove among all the entries of a subtree, oldest first.
+type CompactionPolicy interface {
+    Select(entries []HistoryEntry) []HistoryEntry
+}
+
+type CompactionPolicyFunc func(entries []HistoryEntry) []HistoryEntry
+
+func (f CompactionPolicyFunc) Select(entries []HistoryEntry) []HistoryEntry {
+    return f(entries)
+}
+
+// Keeps the newest entries within every limit (0 meaning no limit), and at least MinKeep.
+type RetentionPolicy struct {
+    MaxCount int
+    MaxAge time.Duration
+    MaxBytes int64
+    MinKeep int
+}
+
+func (p RetentionPolicy) Select(entries []HistoryEntry) []HistoryEntry {
+    now := time.Now()
+    var bytes int64
+    for i := len(entries) - 1; i >= 0; i-- {
+        kept := len(entries) - i
+        bytes += int64(entries[i].Size)
+        if kept <= p.MinKeep {
+            continue
+        }
+        if p.MaxCount > 0 && kept > p.MaxCount ||
+            p.MaxAge > 0 && now.Sub(entries[i].Created) > p.MaxAge ||
+            p.MaxBytes > 0 && bytes > p.MaxBytes {
+            // This one and everything older.
+            return entries[:i + 1]
+        }
+    }
+    return nil
+}
+
+type CompactOptions struct {
+    // Maximum number of deletes per second, 0 means unlimited.
+    Rate float64
+    // Deletes per transaction; defaults to 100.
+    BatchSize int
+    // Keys never removed, whatever the policy says.
+    Protect []string
+}
+
+// Compact removes the children of key selected by policy (given oldest first), e.g. to bound a
+// journal or the history of PublishAndFlip, in rate-limited batches. Returns how many entries
+// have been removed.
+func (c *Client) Compact(key string, policy CompactionPolicy, opts CompactOptions) (removed int, err error) {
+    err = c.runOp("compact", key, true, func() error {
+        n, err := c.compact(key, policy, opts, nil)
+        removed += n
+        return err
+    })
+    return
+}
+
+// CompactPublished works like Compact on the history of PublishAndFlip, but never removes the
+// child pointerKey points at, even if the pointer is flipped back (rolled back) meanwhile.
+func (c *Client) CompactPublished(dataKey string, pointerKey string, policy CompactionPolicy, opts CompactOptions) (removed int, err error) {
+    err = c.runOp("compact", dataKey, true, func() error {
+        n, err := c.compact(dataKey, policy, opts, &pointerKey)
+        removed += n
+        return err
+    })
+    return
+}
+
+func (c *Client) compact(key string, policy CompactionPolicy, opts CompactOptions, pointerKey *string) (int, error) {
+    if opts.BatchSize <= 0 {
+        opts.BatchSize = defaultCompactBatchSize
+    }
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+    path := c.assemblePath(segments)
+
+    var pointerPath string
+    if pointerKey != nil {
+        pointerSegments, err := c.disassembleKey(*pointerKey)
+        if err != nil {
+            return 0, err
+        }
+        pointerPath = c.assemblePath(pointerSegments)
+    }
+
+    limiter := &throttle{rate: opts.Rate}
+    removed := 0
+outermost:
+    for {
+        protected := make(map[string]bool, len(opts.Protect) + 1)
+        for _, key := range opts.Protect {
+            protected[key] = true
+        }
+        var guard *zkapi.CheckVersionRequest
+        if pointerKey != nil {
+            target, stat, err := c.get(pointerPath)
+            if err != nil && err != zkapi.ErrNoNode {
+                return removed, convertError(err)
+            }
+            if err == nil {
+                protected[string(target)] = true
+                guard = &zkapi.CheckVersionRequest{Path: pointerPath, Version: stat.Version}
+            }
+        }
+
+        names, _, err := c.conn.Children(path)
+        if err != nil {
+            return removed, convertError(err)
+        }
+        entries := []HistoryEntry{}
+        for _, name := range names {
+            exists, stat, err := c.conn.Exists(path + "/" + name)
+            if err != nil {
+                return removed, convertError(err)
+            }
+            if exists {
+                entries = append(entries, HistoryEntry{
+                    Key: key + "/" + name,
+                    Created: zkTime(stat.Ctime),
+                    Size: int(stat.DataLength),
+                    path: path + "/" + name,
+                    czxid: stat.Czxid,
+                })
+            }
+        }
+        sort.Slice(entries, func(i, j int) bool {
+            return entries[i].czxid < entries[j].czxid
+        })
+
+        selected := []HistoryEntry{}
+        for _, entry := range policy.Select(entries) {
+            if !protected[entry.Key] {
+                selected = append(selected, entry)
+            }
+        }
+
+        for len(selected) != 0 {
+            n := opts.BatchSize
+            if n > len(selected) {
+                n = len(selected)
+            }
+            limiter.wait(n)
+
+            ops := []interface{}{}
+            if guard != nil {
+                ops = append(ops, guard)
+            }
+            for _, entry := range selected[:n] {
+                ops = append(ops, &zkapi.DeleteRequest{Path: entry.path, Version: -1})
+            }
+
+            _, err := c.conn.Multi(ops...)
+            switch err {
+            case nil:
+                removed += n
+            case zkapi.ErrBadVersion:
+                // The pointer has moved: protect its new target.
+                continue outermost
+            case zkapi.ErrNoNode:
+                // Some entries are already gone; remove the others one by one.
+                for _, entry := range selected[:n] {
+                    if guard != nil {
+                        _, err = c.conn.Multi(guard, &zkapi.DeleteRequest{Path: entry.path, Version: -1})
+                    } else {
+                        err = c.conn.Delete(entry.path, -1)
+                    }
+                    switch err {
+                    case nil:
+                        removed++
+                    case zkapi.ErrNoNode:
+                    case zkapi.ErrBadVersion:
+                        continue outermost
+                    default:
+                        return removed, convertError(err)
+                    }
+                }
+            default:
+                return removed, convertError(err)
+            }
+            selected = selected[n:]
+        }
+        return removed, nil
+    }
+}
@@ -0,0 +1,71 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "sort"
+    "testing"
+)
+
+func TestCompact(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/journal", nil)
+    for i := 0; i < 10; i++ {
+        zk.Put(fmt.Sprintf("/test/journal/e%d", i), []byte("entry"))
+    }
+    removed, err := c.Compact("/journal", RetentionPolicy{MaxCount: 3}, CompactOptions{
+        BatchSize: 2,
+        Protect: []string{"/journal/e0"},
+    })
+    if err != nil || removed != 6 {
+        t.Fatalf("Compact: %d, %v, want 6 removed", removed, err)
+    }
+    for i := 0; i < 10; i++ {
+        _, _, ok := zk.Node(fmt.Sprintf("/test/journal/e%d", i))
+        if want := i == 0 || i >= 7; ok != want {
+            t.Errorf("e%d kept: %v, want %v", i, ok, want)
+        }
+    }
+
+    // Bytes count too, and MinKeep wins.
+    removed, err = c.Compact("/journal", RetentionPolicy{MaxBytes: 1, MinKeep: 2}, CompactOptions{})
+    if err != nil || removed != 2 {
+        t.Errorf("Compact by size: %d, %v, want 2 removed", removed, err)
+    }
+}
+
+func TestCompactPublished(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/data", nil)
+    for i := 0; i < 5; i++ {
+        if _, err := c.PublishAndFlip("/data", "/current", []byte(fmt.Sprint(i))); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // Rolled back to the first version.
+    children, _, err := c.Children("/data", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sort.Strings(children)
+    if _, err := c.Set("/current", []byte(children[0])); err != nil {
+        t.Fatal(err)
+    }
+
+    removed, err := c.CompactPublished("/data", "/current", RetentionPolicy{MaxCount: 1}, CompactOptions{})
+    if err != nil || removed != 3 {
+        t.Fatalf("CompactPublished: %d, %v, want 3 removed", removed, err)
+    }
+    left, _, _ := c.Children("/data", false)
+    sort.Strings(left)
+    if len(left) != 2 || left[0] != children[0] || left[1] != children[4] {
+        t.Errorf("left %v, want the target of the pointer and the newest", left)
+    }
+}
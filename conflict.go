@@ -0,0 +1,136 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "math/rand"
+    "sync/atomic"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const (
+    defaultConflictBackoff = 2 * time.Millisecond
+    defaultConflictMaxBackoff = 500 * time.Millisecond
+)
+
+var (
+    ErrTooManyConflicts = errors.New("too many concurrent modifications")
+)
+
+// How read-modify-write helpers (Update, Touch, counters...) back off when their Cas loses to a
+// concurrent write: after the n-th conflict in a row, they sleep for a random duration between 0
+// and min(Backoff * 2^(n-1), MaxBackoff), so that contenders spread out instead of livelocking.
+type ConflictBackoff struct {
+    // Defaults to 2ms and 500ms respectively.
+    Backoff time.Duration
+    MaxBackoff time.Duration
+    // Conflicts tolerated per call before failing with ErrTooManyConflicts; 0 means no limit.
+    MaxConflicts int
+}
+
+// Counters of the read-modify-write helpers since the client was created.
+type ConflictStats struct {
+    Attempts uint64
+    Conflicts uint64
+    // Calls that failed with ErrTooManyConflicts.
+    GaveUp uint64
+}
+
+// ConflictRate is the fraction of the attempts that lost to a concurrent write.
+func (s ConflictStats) ConflictRate() float64 {
+    if s.Attempts == 0 {
+        return 0
+    }
+    return float64(s.Conflicts) / float64(s.Attempts)
+}
+
+type conflictCounters struct {
+    attempts uint64
+    conflicts uint64
+    gaveUp uint64
+}
+
+// WithConflictBackoff replaces the default backoff of the read-modify-write helpers.
+func WithConflictBackoff(backoff ConflictBackoff) Option {
+    return func(c *Client) {
+        c.conflictBackoff = backoff
+    }
+}
+
+// ConflictStats returns how often the read-modify-write helpers of the client have conflicted.
+func (c *Client) ConflictStats() ConflictStats {
+    return ConflictStats{
+        Attempts: atomic.LoadUint64(&c.conflicts.attempts),
+        Conflicts: atomic.LoadUint64(&c.conflicts.conflicts),
+        GaveUp: atomic.LoadUint64(&c.conflicts.gaveUp),
+    }
+}
+
+// Calls attempt until it reports no conflict, backing off in between. Stops early if ctx is done
+// or the client is closed.
+func (c *Client) resolveConflicts(ctx context.Context, attempt func() (conflict bool, err error)) error {
+    backoff := c.conflictBackoff.Backoff
+    if backoff <= 0 {
+        backoff = defaultConflictBackoff
+    }
+    maxBackoff := c.conflictBackoff.MaxBackoff
+    if maxBackoff <= 0 {
+        maxBackoff = defaultConflictMaxBackoff
+    }
+
+    for conflicts := 0; ; {
+        atomic.AddUint64(&c.conflicts.attempts, 1)
+        conflict, err := attempt()
+        if err != nil || !conflict {
+            return err
+        }
+
+        atomic.AddUint64(&c.conflicts.conflicts, 1)
+        conflicts++
+        if c.conflictBackoff.MaxConflicts > 0 && conflicts >= c.conflictBackoff.MaxConflicts {
+            atomic.AddUint64(&c.conflicts.gaveUp, 1)
+            return ErrTooManyConflicts
+        }
+
+        timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff) + 1)))
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        case <-c.done:
+            timer.Stop()
+            return ErrClientClosed
+        }
+
+        backoff *= 2
+        if backoff > maxBackoff {
+            backoff = maxBackoff
+        }
+    }
+}
+
+// Update replaces the value of key with fn(old value), where exists tells whether key exists
+// (it is created otherwise), retrying with backoff (see ConflictBackoff) as long as a concurrent
+// write gets in between; fn may hence be called several times. Returns the new version.
+func (c *Client) Update(ctx context.Context, key string, fn func(value []byte, exists bool) ([]byte, error)) (goffkv.Version, error) {
+    var result goffkv.Version
+    err := c.resolveConflicts(ctx, func() (bool, error) {
+        ver, value, _, err := c.Get(key, false)
+        if err != nil && !errors.Is(err, goffkv.OpErrNoEntry) {
+            return false, err
+        }
+
+        value, err = fn(value, ver != 0)
+        if err != nil {
+            return false, err
+        }
+        result, err = c.Cas(key, value, ver)
+        return err == nil && result == 0, err
+    })
+    if err != nil {
+        return 0, err
+    }
+    return result, nil
+}
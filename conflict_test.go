@@ -0,0 +1,90 @@
+package goffkv_zk
+
+import (
+    "context"
+    "strconv"
+    "sync"
+    "testing"
+)
+
+func TestUpdateConflicts(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithConflictBackoff(ConflictBackoff{MaxConflicts: 3}))
+    defer c.Close()
+
+    // Another writer gets in between the first two reads and their Cas.
+    calls := 0
+    _, err := c.Update(context.Background(), "/k", func(value []byte, exists bool) ([]byte, error) {
+        calls++
+        if calls <= 2 {
+            zk.Put("/test/k", []byte("other"))
+        }
+        return append(value, '!'), nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/k"); calls != 3 || string(data) != "other!" {
+        t.Errorf("%d calls writing %q, want 3 writing \"other!\"", calls, data)
+    }
+    if stats := c.ConflictStats(); stats.Attempts != 3 || stats.Conflicts != 2 || stats.GaveUp != 0 {
+        t.Errorf("stats %+v", stats)
+    }
+
+    _, err = c.Update(context.Background(), "/k", func(value []byte, exists bool) ([]byte, error) {
+        zk.Put("/test/k", []byte("other"))
+        return value, nil
+    })
+    if err != ErrTooManyConflicts {
+        t.Errorf("Update always losing: %v, want ErrTooManyConflicts", err)
+    }
+    if stats := c.ConflictStats(); stats.GaveUp != 1 {
+        t.Errorf("stats %+v, want 1 given up", stats)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    _, err = c.Update(ctx, "/k", func(value []byte, exists bool) ([]byte, error) {
+        cancel()
+        zk.Put("/test/k", []byte("other"))
+        return value, nil
+    })
+    if err != context.Canceled {
+        t.Errorf("Update with a cancelled context: %v", err)
+    }
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    const workers, increments = 4, 10
+    var wg sync.WaitGroup
+    errs := make(chan error, workers)
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < increments; j++ {
+                _, err := c.Update(context.Background(), "/n", func(value []byte, exists bool) ([]byte, error) {
+                    n, _ := strconv.Atoi(string(value))
+                    return []byte(strconv.Itoa(n + 1)), nil
+                })
+                if err != nil {
+                    errs <- err
+                    return
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/n"); string(data) != strconv.Itoa(workers * increments) {
+        t.Errorf("%s after %d increments", data, workers * increments)
+    }
+}
@@ -0,0 +1,91 @@
+package goffkv_zk
+
+import (
+    "encoding/binary"
+    "net"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// The state of the connection of a client, as reported by the driver.
+type ConnInfo struct {
+    SessionID int64
+    // The ensemble member the client is attached to, empty if disconnected.
+    Server string
+    State zkapi.State
+    // The session timeout asked for by the client.
+    RequestedTimeout time.Duration
+    // The session timeout granted by the server, i.e. RequestedTimeout clamped to its min/max
+    // session timeout: ephemeral nodes, hence leases, outlive a lost client by up to this much.
+    // Zero until the first session is established.
+    NegotiatedTimeout time.Duration
+    // The protocol version of the last connect response.
+    ProtocolVersion int32
+}
+
+func (c *Client) ConnInfo() ConnInfo {
+    c.handshake.mu.Lock()
+    defer c.handshake.mu.Unlock()
+
+    return ConnInfo{
+        SessionID: c.conn.SessionID(),
+        Server: c.conn.Server(),
+        State: c.conn.State(),
+        RequestedTimeout: ttl,
+        NegotiatedTimeout: c.handshake.timeout,
+        ProtocolVersion: c.handshake.protocolVersion,
+    }
+}
+
+// What the last connect response of the main connection said. The driver keeps it to itself,
+// so it's read off the wire.
+type handshake struct {
+    mu sync.Mutex
+    protocolVersion int32
+    timeout time.Duration
+}
+
+// The connect response starts with its length, then protocolVersion int32, timeOut int32 and
+// sessionId int64.
+const handshakeHeadSize = 4 + 4 + 4 + 8
+
+// Makes conn dial through a connection which records its connect responses in c.handshake.
+func (c *Client) sniffHandshake(conn *zkapi.Conn) {
+    dial := c.dialer
+    if dial == nil {
+        dial = net.DialTimeout
+    }
+    zkapi.WithDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+        nc, err := dial(network, address, timeout)
+        if err != nil {
+            return nil, err
+        }
+        return &handshakeConn{Conn: nc, c: c}, nil
+    })(conn)
+}
+
+type handshakeConn struct {
+    net.Conn
+    c *Client
+    head []byte
+}
+
+func (hc *handshakeConn) Read(p []byte) (int, error) {
+    n, err := hc.Conn.Read(p)
+    if len(hc.head) < handshakeHeadSize {
+        take := handshakeHeadSize - len(hc.head)
+        if take > n {
+            take = n
+        }
+        hc.head = append(hc.head, p[:take]...)
+        // A response without a session id is a refusal, whose timeout is meaningless.
+        if len(hc.head) == handshakeHeadSize && binary.BigEndian.Uint64(hc.head[12:]) != 0 {
+            hc.c.handshake.mu.Lock()
+            hc.c.handshake.protocolVersion = int32(binary.BigEndian.Uint32(hc.head[4:]))
+            hc.c.handshake.timeout = time.Duration(int32(binary.BigEndian.Uint32(hc.head[8:]))) * time.Millisecond
+            hc.c.handshake.mu.Unlock()
+        }
+    }
+    return n, err
+}
@@ -0,0 +1,37 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestConnInfo(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    eventually(t, "the session", func() bool {
+        return c.ConnInfo().State == zkapi.StateHasSession
+    })
+    info := c.ConnInfo()
+    if info.SessionID == 0 || info.Server != zk.Addr() || info.RequestedTimeout != ttl || info.NegotiatedTimeout != ttl {
+        t.Errorf("ConnInfo %+v", info)
+    }
+}
+
+func TestConnInfoNegotiatedTimeout(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    zk.LimitTimeout(4 * time.Second)
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    eventually(t, "the session", func() bool {
+        return c.ConnInfo().State == zkapi.StateHasSession
+    })
+    if info := c.ConnInfo(); info.RequestedTimeout != ttl || info.NegotiatedTimeout != 4 * time.Second || info.ProtocolVersion != 0 {
+        t.Errorf("ConnInfo %+v", info)
+    }
+}
@@ -0,0 +1,37 @@
+package goffkv_zk
+
+import (
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// WithContainerParents creates the prefix, and the parents this client creates on the way to
+// its own nodes (locks, service registries, chunks, the reserved subtree and the parents of
+// imported subtrees), as container nodes (ZooKeeper 3.5.3+) instead of persistent ones, so
+// that the servers erase them once their last child is gone. Should that happen to the
+// prefix, creates of top-level keys recreate it.
+func WithContainerParents() Option {
+    return func(c *Client) {
+        c.containerParents = true
+    }
+}
+
+// Creates a childless parent node at path.
+func (c *Client) createParent(path string) (string, error) {
+    if c.containerParents {
+        return c.conn.CreateContainer(path, nil, zkapi.FlagContainer, c.acl)
+    }
+    return c.conn.Create(path, nil, 0, c.acl)
+}
+
+// Recreates the prefix if the servers have erased its container; reports whether it did.
+func (c *Client) restorePrefix() bool {
+    if !c.containerParents || len(c.prefixSegments) == 0 {
+        return false
+    }
+    exists, _, err := c.conn.Exists(c.assemblePath(nil))
+    if err != nil || exists {
+        return false
+    }
+    c.logger.Printf("prefix container was erased, recreating it")
+    return c.createEachPrefix(c.prefixSegments) == nil
+}
@@ -0,0 +1,54 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+func TestContainerParents(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithContainerParents())
+    defer c.Close()
+
+    _, stat, _ := zk.Node("/test")
+    if kind, _ := nodeKind(stat); kind != NodeContainer {
+        t.Fatalf("prefix is %v", kind)
+    }
+    if _, err := c.Create("/a", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    zk.Reap(time.Now())
+    if _, _, ok := zk.Node("/test"); !ok {
+        t.Fatal("non-empty prefix reaped")
+    }
+
+    if err := c.Erase("/a", 0); err != nil {
+        t.Fatal(err)
+    }
+    zk.Reap(time.Now())
+    if _, _, ok := zk.Node("/test"); ok {
+        t.Fatal("empty prefix not reaped")
+    }
+    if _, err := c.Create("/b", nil, false); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := c.Erase("/b", 0); err != nil {
+        t.Fatal(err)
+    }
+    zk.Reap(time.Now())
+    _, err := c.Commit(goffkv.Txn{Ops: []goffkv.Operation{{Key: "/c", What: goffkv.Create}}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, _, ok := zk.Node("/test/c"); !ok {
+        t.Error("commit didn't create /c")
+    }
+
+    _, stat, _ = zk.Node("/test/c")
+    if kind, _ := nodeKind(stat); kind != NodePersistent {
+        t.Errorf("key is %v", kind)
+    }
+}
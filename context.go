@@ -0,0 +1,306 @@
+package goffkv_zk
+
+import (
+    "context"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// ContextOnChange returns a context derived from parent that is cancelled as soon as the value
+// of key changes or key is erased (or the client is closed), e.g. to abort work based on a config
+// entry or a lock that is no longer current. It is cancelled at once if key doesn't exist or
+// can't be watched. Changes of the children of key don't count.
+func (c *Client) ContextOnChange(parent context.Context, key string) context.Context {
+    ctx, cancel := context.WithCancel(parent)
+
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        cancel()
+        return ctx
+    }
+    exists, _, ech, err := c.conn.ExistsW(c.assemblePath(segments))
+    if err != nil || !exists {
+        cancel()
+        return ctx
+    }
+
+    go func() {
+        defer cancel()
+        // Any event counts: a change, the erasure, or the loss of the watch with the session.
+        select {
+        case <-ech:
+        case <-ctx.Done():
+        case <-c.done:
+        }
+    }()
+    return ctx
+}
+
+// WatchUntil waits until the value of key satisfies pred (e.g. a "state" of READY), and returns
+// it with its version. pred is called with every value read, nil while key doesn't exist; values
+// replaced faster than they can be read are missed. Connection losses are waited out. Fails with
+// ctx.Err() once ctx is done.
+func (c *Client) WatchUntil(ctx context.Context, key string, pred func(value []byte) bool) (goffkv.Version, []byte, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    w := &Watcher{c: c, path: c.assemblePath(segments)}
+    for {
+        ver, value, _, ech, err := w.register()
+        switch {
+        case err == nil:
+            if pred(value) {
+                return ver, value, nil
+            }
+        case IsTransient(err):
+            ech = nil
+        default:
+            return 0, nil, convertError(err)
+        }
+
+        var retry <-chan time.Time
+        if ech == nil {
+            retry = time.After(watchRetryDelay)
+        }
+        select {
+        case <-ech:
+        case <-retry:
+        case <-ctx.Done():
+            return 0, nil, ctx.Err()
+        case <-c.done:
+            return 0, nil, ErrClientClosed
+        }
+    }
+}
+
+// Writes given up on by their caller but still in progress (see withContext).
+type abandonedWrites struct {
+    mu sync.Mutex
+    pending map[*commitTicket]struct{}
+}
+
+// Key of the context value holding the ticket of the write fn of withContext performs.
+type abandonKey struct{}
+
+func (a *abandonedWrites) add(t *commitTicket) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    if a.pending == nil {
+        a.pending = make(map[*commitTicket]struct{})
+    }
+    a.pending[t] = struct{}{}
+}
+
+func (a *abandonedWrites) remove(t *commitTicket) {
+    a.mu.Lock()
+    delete(a.pending, t)
+    a.mu.Unlock()
+    close(t.done)
+}
+
+// Called by writes of keys before they start: waits until the abandoned writes of related keys
+// (but the one running with ctx) are done, so that they can't overtake them, e.g. by a retry or
+// the second request of a Set. Gives up once ctx is done or the client is closed.
+func (c *Client) fence(ctx context.Context, keys ...string) {
+    self, _ := ctx.Value(abandonKey{}).(*commitTicket)
+
+    c.abandoned.mu.Lock()
+    waits := []chan struct{}{}
+    for t := range c.abandoned.pending {
+        if t == self {
+            continue
+        }
+    related:
+        for _, key := range keys {
+            for _, other := range t.keys {
+                if keysRelated(key, other) {
+                    waits = append(waits, t.done)
+                    break related
+                }
+            }
+        }
+    }
+    c.abandoned.mu.Unlock()
+
+    for _, ch := range waits {
+        select {
+        case <-ch:
+        case <-ctx.Done():
+            return
+        case <-c.done:
+            return
+        }
+    }
+}
+
+// Runs fn, which performs op on key, until it's done or ctx is. ZooKeeper has no way to withdraw
+// a request: one already sent when ctx is done is still processed; it keeps counting in Pressure
+// until its reply arrives, and its outcome is logged. fn gets ctx to make no further attempt.
+// writes lists the keys written by op, if any: until an abandoned write is done, later writes
+// of related keys wait for it (see fence), and the cached values of its keys are dropped.
+func (c *Client) withContext(ctx context.Context, op string, key string, writes []string, fn func(ctx context.Context) error) error {
+    if ctx.Done() == nil {
+        return fn(ctx)
+    }
+
+    var t *commitTicket
+    if len(writes) > 0 {
+        t = &commitTicket{keys: writes, done: make(chan struct{})}
+        ctx = context.WithValue(ctx, abandonKey{}, t)
+    }
+    done := make(chan error, 1)
+    go func() {
+        done <- fn(ctx)
+    }()
+    select {
+    case err := <-done:
+        return err
+    case <-ctx.Done():
+    }
+
+    if t != nil {
+        c.abandoned.add(t)
+        c.forgetCached(writes)
+    }
+    go func(start time.Time) {
+        err := <-done
+        if t != nil {
+            c.forgetCached(writes)
+            c.abandoned.remove(t)
+        }
+        if err != nil {
+            c.logger.Printf("%s %s: abandoned, failed %v later: %v", op, key, time.Since(start), err)
+        } else {
+            c.logger.Printf("%s %s: abandoned, succeeded %v later", op, key, time.Since(start))
+        }
+    }(time.Now())
+    return c.wrapError(op, key, ctx.Err())
+}
+
+// Drops what the client remembers of the values of keys, which an abandoned write may change
+// at any time.
+func (c *Client) forgetCached(keys []string) {
+    for _, key := range keys {
+        segments, err := c.disassembleKey(key)
+        if err != nil {
+            continue
+        }
+        if c.dedup != nil {
+            c.dedup.forget(c.assemblePath(segments))
+        }
+        if c.fallback != nil {
+            c.fallback.forget(normalizeKey(segments))
+        }
+    }
+}
+
+// CreateContext works like Create, but gives up once ctx is done, failing with ctx.Err(); so do
+// the other operations taking a context. A write given up on may still be applied (or not): the
+// request can't be withdrawn once sent. Retries (see WithRetryPolicy) stop too. Later writes of
+// the client to the same keys (or to their ancestors or descendants) wait until it's done, so
+// that it can't overwrite them.
+func (c *Client) CreateContext(ctx context.Context, key string, value []byte, lease bool) (goffkv.Version, error) {
+    var resultVer goffkv.Version
+    err := c.withContext(ctx, "create", key, []string{key}, func(ctx context.Context) (err error) {
+        resultVer, err = c.createContext(ctx, key, value, lease)
+        return
+    })
+    if err != nil {
+        return 0, err
+    }
+    return resultVer, nil
+}
+
+func (c *Client) SetContext(ctx context.Context, key string, value []byte) (goffkv.Version, error) {
+    var resultVer goffkv.Version
+    err := c.withContext(ctx, "set", key, []string{key}, func(ctx context.Context) (err error) {
+        resultVer, err = c.setContext(ctx, key, value)
+        return
+    })
+    if err != nil {
+        return 0, err
+    }
+    return resultVer, nil
+}
+
+func (c *Client) CasContext(ctx context.Context, key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    var resultVer goffkv.Version
+    err := c.withContext(ctx, "cas", key, []string{key}, func(ctx context.Context) (err error) {
+        resultVer, err = c.casContext(ctx, key, value, ver)
+        return
+    })
+    if err != nil {
+        return 0, err
+    }
+    return resultVer, nil
+}
+
+func (c *Client) EraseContext(ctx context.Context, key string, ver goffkv.Version) error {
+    return c.withContext(ctx, "erase", key, []string{key}, func(ctx context.Context) error {
+        _, err := c.eraseTreeContext(ctx, key, ver, EraseOptions{})
+        return err
+    })
+}
+
+func (c *Client) ExistsContext(ctx context.Context, key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    var (
+        ver goffkv.Version
+        resultWatch goffkv.Watch
+    )
+    err := c.withContext(ctx, "exists", key, nil, func(ctx context.Context) (err error) {
+        ver, resultWatch, err = c.existsContext(ctx, key, watch)
+        return
+    })
+    if err != nil {
+        return 0, nil, err
+    }
+    return ver, resultWatch, nil
+}
+
+func (c *Client) GetContext(ctx context.Context, key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    var (
+        ver goffkv.Version
+        value []byte
+        resultWatch goffkv.Watch
+    )
+    err := c.withContext(ctx, "get", key, nil, func(ctx context.Context) (err error) {
+        ver, value, resultWatch, err = c.getContext(ctx, key, watch)
+        return
+    })
+    if err != nil {
+        return 0, nil, nil, err
+    }
+    return ver, value, resultWatch, nil
+}
+
+func (c *Client) ChildrenContext(ctx context.Context, key string, watch bool) ([]string, goffkv.Watch, error) {
+    var (
+        children []string
+        resultWatch goffkv.Watch
+    )
+    err := c.withContext(ctx, "children", key, nil, func(ctx context.Context) (err error) {
+        children, resultWatch, err = c.childrenContext(ctx, key, watch)
+        return
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    return children, resultWatch, nil
+}
+
+func (c *Client) CommitContext(ctx context.Context, txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    var results []OpResult
+    t := c.commits.enter(txn)
+    err := c.withContext(ctx, "commit", "", txnKeys(txn), func(ctx context.Context) (err error) {
+        results, err = c.commitTicketed(ctx, txn, t)
+        return
+    })
+    if err != nil {
+        return nil, err
+    }
+    return txnResults(results, nil)
+}
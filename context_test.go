@@ -0,0 +1,185 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestContextOperations(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    ver, err := c.SetContext(context.Background(), "/k", []byte("a"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    zk.Fail(func(op int32, path string) error {
+        if op == fzSetData {
+            time.Sleep(100 * time.Millisecond)
+        }
+        return nil
+    })
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    if _, err := c.CasContext(ctx, "/k", []byte("b"), ver); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("CasContext past its deadline: %v", err)
+    }
+    if elapsed := time.Since(start); elapsed > 80 * time.Millisecond {
+        t.Errorf("CasContext gave up after %v", elapsed)
+    }
+    // The request can't be withdrawn.
+    eventually(t, "the abandoned write", func() bool {
+        data, _, _ := zk.Node("/test/k")
+        return string(data) == "b"
+    })
+
+    // Nothing is sent once ctx is done.
+    zk.Fail(nil)
+    gets := zk.Requests(fzGetData)
+    cancelled, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, _, _, err := c.GetContext(cancelled, "/k", false); !errors.Is(err, context.Canceled) {
+        t.Errorf("GetContext of a cancelled context: %v", err)
+    }
+    if zk.Requests(fzGetData) != gets {
+        t.Error("request sent for a cancelled context")
+    }
+}
+
+func TestContextOnChange(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+
+    select {
+    case <-c.ContextOnChange(context.Background(), "/missing").Done():
+    default:
+        t.Error("context of a missing key not cancelled")
+    }
+
+    if _, err := c.Set("/k", []byte("a")); err != nil {
+        t.Fatal(err)
+    }
+    ctx := c.ContextOnChange(context.Background(), "/k")
+    if _, err := c.Create("/k/child", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-ctx.Done():
+        t.Fatal("context cancelled by a new child")
+    case <-time.After(50 * time.Millisecond):
+    }
+    if _, err := c.Set("/k", []byte("b")); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-ctx.Done():
+    case <-time.After(time.Second):
+        t.Fatal("context not cancelled by a change")
+    }
+
+    closed := c.ContextOnChange(context.Background(), "/k")
+    c.Close()
+    select {
+    case <-closed.Done():
+    case <-time.After(time.Second):
+        t.Fatal("context not cancelled by Close")
+    }
+}
+
+func TestWatchUntil(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    type result struct {
+        value []byte
+        err error
+    }
+    results := make(chan result, 1)
+    go func() {
+        _, value, err := c.WatchUntil(context.Background(), "/state", func(value []byte) bool {
+            return string(value) == "READY"
+        })
+        results <- result{value, err}
+    }()
+    for _, state := range []string{"STARTING", "READY"} {
+        time.Sleep(20 * time.Millisecond)
+        if _, err := c.Set("/state", []byte(state)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    select {
+    case r := <-results:
+        if r.err != nil || string(r.value) != "READY" {
+            t.Errorf("WatchUntil: %q, %v", r.value, r.err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("WatchUntil didn't see the value")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+    defer cancel()
+    if _, _, err := c.WatchUntil(ctx, "/state", func(value []byte) bool { return value == nil }); err != context.DeadlineExceeded {
+        t.Errorf("WatchUntil past its deadline: %v", err)
+    }
+}
+
+// Writes wait for the abandoned writes of related keys.
+func TestContextAbandonedWritesFence(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithSetDedup())
+    defer c.Close()
+
+    if _, err := c.Set("/k", []byte("a")); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/k", []byte("a")); err != nil {
+        t.Fatal(err)
+    }
+    zk.Fail(func(op int32, path string) error {
+        if op == fzSetData {
+            time.Sleep(100 * time.Millisecond)
+        }
+        return nil
+    })
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+    defer cancel()
+    if _, err := c.SetContext(ctx, "/k", []byte("b")); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("SetContext past its deadline: %v", err)
+    }
+    c.dedup.mu.Lock()
+    _, remembered := c.dedup.entries["/test/k"]
+    c.dedup.mu.Unlock()
+    if remembered {
+        t.Error("value of an abandoned write still remembered")
+    }
+
+    fenced := make(chan struct{})
+    go func() {
+        c.fence(context.Background(), "/k/child")
+        close(fenced)
+    }()
+    c.fence(context.Background(), "/other")
+    select {
+    case <-fenced:
+        t.Fatal("write not fenced by an abandoned write of its parent")
+    case <-time.After(30 * time.Millisecond):
+    }
+    select {
+    case <-fenced:
+    case <-time.After(time.Second):
+        t.Fatal("fence not lifted once the abandoned write is done")
+    }
+    if data, _, _ := zk.Node("/test/k"); string(data) != "b" {
+        t.Errorf("value %q after the abandoned write", data)
+    }
+}
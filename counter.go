@@ -0,0 +1,158 @@
+package goffkv_zk
+
+import (
+    "context"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math/rand"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var (
+    ErrNotCounter = errors.New("value is not a counter")
+)
+
+// Distributed 64-bit counter. Values are stored as 8-byte big-endian integers, like Curator's
+// DistributedAtomicLong, so both can share a counter. A missing counter reads as 0.
+type Counter struct {
+    c *Client
+    key string
+    // Keys of the shards; just key for a plain counter.
+    shards []string
+}
+
+// Counter returns a handle of the counter at key. Updates are Cas loops backing off on conflicts
+// (see ConflictBackoff); for heavily contended counters, see ShardedCounter.
+func (c *Client) Counter(key string) (*Counter, error) {
+    _, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+    return &Counter{c: c, key: key, shards: []string{key}}, nil
+}
+
+// ShardedCounter returns a handle of a counter spread over shards children of key ("<key>/0",
+// "<key>/1"...): each update goes to a random shard, so that concurrent updates rarely conflict,
+// while Get sums all the shards at a single point in time. Every client must use the same number
+// of shards. Not compatible with Curator.
+func (c *Client) ShardedCounter(key string, shards int) (*Counter, error) {
+    if shards <= 0 {
+        return nil, errors.New("ShardedCounter: shards must be positive")
+    }
+    _, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &Counter{c: c, key: key}
+    for i := 0; i < shards; i++ {
+        result.shards = append(result.shards, fmt.Sprintf("%s/%d", key, i))
+    }
+    return result, nil
+}
+
+func decodeCounter(value []byte) (int64, error) {
+    switch len(value) {
+    case 0:
+        return 0, nil
+    case 8:
+        return int64(binary.BigEndian.Uint64(value)), nil
+    default:
+        return 0, ErrNotCounter
+    }
+}
+
+func encodeCounter(n int64) []byte {
+    result := make([]byte, 8)
+    binary.BigEndian.PutUint64(result, uint64(n))
+    return result
+}
+
+func (ctr *Counter) sharded() bool {
+    return len(ctr.shards) != 1 || ctr.shards[0] != ctr.key
+}
+
+// Add adds delta to the counter. Returns the new value, except for sharded counters, for which
+// it returns the new value of the updated shard only.
+func (ctr *Counter) Add(ctx context.Context, delta int64) (int64, error) {
+    shard := ctr.shards[rand.Intn(len(ctr.shards))]
+    var result int64
+    update := func(value []byte, exists bool) ([]byte, error) {
+        n, err := decodeCounter(value)
+        if err != nil {
+            return nil, err
+        }
+        result = n + delta
+        return encodeCounter(result), nil
+    }
+
+    _, err := ctr.c.Update(ctx, shard, update)
+    if errors.Is(err, goffkv.OpErrNoEntry) && ctr.sharded() {
+        // The first update of the counter.
+        _, err = ctr.c.Create(ctr.key, []byte{}, false)
+        if err != nil && !errors.Is(err, goffkv.OpErrEntryExists) {
+            return 0, err
+        }
+        _, err = ctr.c.Update(ctx, shard, update)
+    }
+    if err != nil {
+        return 0, err
+    }
+    return result, nil
+}
+
+func (ctr *Counter) Increment(ctx context.Context) (int64, error) {
+    return ctr.Add(ctx, 1)
+}
+
+func (ctr *Counter) Decrement(ctx context.Context) (int64, error) {
+    return ctr.Add(ctx, -1)
+}
+
+// Get returns the current value of the counter.
+func (ctr *Counter) Get() (int64, error) {
+    if !ctr.sharded() {
+        _, value, _, err := ctr.c.Get(ctr.key, false)
+        if errors.Is(err, goffkv.OpErrNoEntry) {
+            return 0, nil
+        }
+        if err != nil {
+            return 0, err
+        }
+        return decodeCounter(value)
+    }
+
+    for {
+        // Shards only appear when first updated.
+        existing := []string{}
+        for _, shard := range ctr.shards {
+            ver, _, err := ctr.c.Exists(shard, false)
+            if err != nil {
+                return 0, err
+            }
+            if ver != 0 {
+                existing = append(existing, shard)
+            }
+        }
+
+        entries, err := ctr.c.GetConsistent(existing)
+        if errors.Is(err, goffkv.OpErrNoEntry) {
+            // A shard has been erased in the meantime.
+            continue
+        }
+        if err != nil {
+            return 0, err
+        }
+
+        var result int64
+        for _, entry := range entries {
+            n, err := decodeCounter(entry.Value)
+            if err != nil {
+                return 0, err
+            }
+            result += n
+        }
+        return result, nil
+    }
+}
@@ -0,0 +1,93 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+)
+
+// Adds n increments to ctr from as many goroutines.
+func incrementConcurrently(t *testing.T, ctr *Counter, n int) {
+    var wg sync.WaitGroup
+    errs := make(chan error, n)
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := ctr.Increment(context.Background())
+            errs <- err
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func TestCounter(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+    other := newTestClient(t, zk)
+    defer other.Close()
+
+    ctr, err := c.Counter("/counter")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n, err := ctr.Get(); err != nil || n != 0 {
+        t.Fatalf("missing counter reads %d, %v", n, err)
+    }
+    otherCtr, err := other.Counter("/counter")
+    if err != nil {
+        t.Fatal(err)
+    }
+    incrementConcurrently(t, ctr, 10)
+    incrementConcurrently(t, otherCtr, 10)
+    if n, err := ctr.Decrement(context.Background()); err != nil || n != 19 {
+        t.Errorf("Decrement: %d, %v", n, err)
+    }
+    if data, _, _ := zk.Node("/test/counter"); len(data) != 8 || data[7] != 19 {
+        t.Errorf("stored as %v, want 8 big-endian bytes", data)
+    }
+
+    if _, err := c.Set("/text", []byte("text")); err != nil {
+        t.Fatal(err)
+    }
+    text, err := c.Counter("/text")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := text.Increment(context.Background()); !errors.Is(err, ErrNotCounter) {
+        t.Errorf("Increment of a non-counter: %v, want ErrNotCounter", err)
+    }
+}
+
+func TestShardedCounter(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    ctr, err := c.ShardedCounter("/counter", 4)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n, err := ctr.Get(); err != nil || n != 0 {
+        t.Fatalf("missing counter reads %d, %v", n, err)
+    }
+    incrementConcurrently(t, ctr, 20)
+    if n, err := ctr.Get(); err != nil || n != 20 {
+        t.Errorf("sum of the shards %d, %v, want 20", n, err)
+    }
+    for _, p := range zk.Paths("/test/counter") {
+        if len(p) > len("/test/counter/") && p[len("/test/counter/"):] > "3" {
+            t.Errorf("unexpected shard %s", p)
+        }
+    }
+}
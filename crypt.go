@@ -0,0 +1,167 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+)
+
+const dataKeySize = 32
+
+var (
+    ErrUndecryptable = errors.New("value can't be decrypted")
+)
+
+// Supplies the master keys (16, 24 or 32 bytes long, for AES-128, -192 or -256) of envelope
+// encryption, e.g. from a KMS or a secret store. Rotating keys only requires CurrentKey to
+// return a new one, as long as Key still returns the former ones.
+type KeyProvider interface {
+    // Returns the key to encrypt new values with, and its id.
+    CurrentKey() (id string, key []byte, err error)
+    // Returns the key with the given id, to decrypt values written with it.
+    Key(id string) ([]byte, error)
+}
+
+// Envelope encryption with AES-GCM: every value is encrypted with a random data key, which is
+// stored along, encrypted with a master key of the provider. The stored form is
+// <id length><id><nonce><encrypted data key><nonce><encrypted value>.
+type aesGCMCodec struct {
+    keys KeyProvider
+}
+
+// AESGCMCodec returns the codec used by WithEncryption, e.g. to pass to WithCodecs.
+func AESGCMCodec(keys KeyProvider) Codec {
+    return aesGCMCodec{keys}
+}
+
+// WithEncryption encrypts every value written by the client (after compression, see
+// WithCompression), so that it is never stored in clear in the snapshots and transaction logs
+// of the ensemble; encrypted values are decrypted on read. Keys and versions aren't encrypted.
+// Reading values written without encryption keeps working.
+func WithEncryption(keys KeyProvider) Option {
+    return func(c *Client) {
+        c.encryption = AESGCMCodec(keys)
+        c.codecs[c.encryption.Name()] = c.encryption
+    }
+}
+
+func (aesGCMCodec) Name() string {
+    return "aes-gcm"
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// Appends the nonce and the sealed plaintext to dst.
+func sealGCM(dst []byte, key []byte, plaintext []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    _, err = rand.Read(nonce)
+    if err != nil {
+        return nil, err
+    }
+    dst = append(dst, nonce...)
+    return gcm.Seal(dst, nonce, plaintext, nil), nil
+}
+
+// Opens a nonce and sealed data of size bytes (plus the overhead) at the start of data; returns
+// the plaintext and the rest of data. A negative size stands for the rest of data.
+func openGCM(key []byte, data []byte, size int) ([]byte, []byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, nil, err
+    }
+    end := len(data)
+    if size >= 0 {
+        end = gcm.NonceSize() + size + gcm.Overhead()
+    }
+    if len(data) < end || end < gcm.NonceSize() {
+        return nil, nil, ErrUndecryptable
+    }
+    plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():end], nil)
+    if err != nil {
+        return nil, nil, ErrUndecryptable
+    }
+    return plaintext, data[end:], nil
+}
+
+type encryptingWriter struct {
+    keys KeyProvider
+    w io.Writer
+    buf bytes.Buffer
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+    return w.buf.Write(p)
+}
+
+// GCM authenticates the value as a whole, hence it is encrypted only once complete.
+func (w *encryptingWriter) Close() error {
+    id, key, err := w.keys.CurrentKey()
+    if err != nil {
+        return err
+    }
+    if len(id) > 255 {
+        return fmt.Errorf("key id %q is too long", id)
+    }
+
+    dataKey := make([]byte, dataKeySize)
+    _, err = rand.Read(dataKey)
+    if err != nil {
+        return err
+    }
+
+    result := append([]byte{byte(len(id))}, id...)
+    result, err = sealGCM(result, key, dataKey)
+    if err != nil {
+        return err
+    }
+    result, err = sealGCM(result, dataKey, w.buf.Bytes())
+    if err != nil {
+        return err
+    }
+    _, err = w.w.Write(result)
+    return err
+}
+
+func (codec aesGCMCodec) NewWriter(w io.Writer) io.WriteCloser {
+    return &encryptingWriter{keys: codec.keys, w: w}
+}
+
+func (codec aesGCMCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    if len(data) == 0 || len(data) < 1 + int(data[0]) {
+        return nil, ErrUndecryptable
+    }
+
+    id := string(data[1:1 + data[0]])
+    key, err := codec.keys.Key(id)
+    if err != nil {
+        return nil, fmt.Errorf("key %q: %w", id, err)
+    }
+    dataKey, rest, err := openGCM(key, data[1 + len(id):], dataKeySize)
+    if err != nil {
+        return nil, err
+    }
+    value, _, err := openGCM(dataKey, rest, -1)
+    if err != nil {
+        return nil, err
+    }
+    return ioutil.NopCloser(bytes.NewReader(value)), nil
+}
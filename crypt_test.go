@@ -0,0 +1,68 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+type testKeys struct {
+    current string
+    keys map[string][]byte
+}
+
+func (k *testKeys) CurrentKey() (string, []byte, error) {
+    return k.current, k.keys[k.current], nil
+}
+
+func (k *testKeys) Key(id string) ([]byte, error) {
+    key, ok := k.keys[id]
+    if !ok {
+        return nil, fmt.Errorf("no key %q", id)
+    }
+    return key, nil
+}
+
+func TestEncryption(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    keys := &testKeys{"k1", map[string][]byte{
+        "k1": bytes.Repeat([]byte{1}, 32),
+        "k2": bytes.Repeat([]byte{2}, 16),
+    }}
+    c := newTestClient(t, zk, WithEncryption(keys), WithCompression(GzipCodec, 0))
+    defer c.Close()
+
+    secret := []byte(strings.Repeat("secret ", 20))
+    if _, err := c.Set("/old", secret); err != nil {
+        t.Fatal(err)
+    }
+    if stored, _, _ := zk.Node("/test/old"); bytes.Contains(stored, []byte("secret")) {
+        t.Fatal("value stored in clear")
+    }
+
+    // Rotation: values written with the former key stay readable.
+    keys.current = "k2"
+    if _, err := c.Set("/new", secret); err != nil {
+        t.Fatal(err)
+    }
+    for _, key := range []string{"/old", "/new"} {
+        if _, value, _, err := c.Get(key, false); err != nil || !bytes.Equal(value, secret) {
+            t.Errorf("Get %s: %q, %v", key, value, err)
+        }
+    }
+
+    zk.Put("/test/plain", []byte("plain"))
+    if _, value, _, err := c.Get("/plain", false); err != nil || string(value) != "plain" {
+        t.Errorf("Get of a value written without encryption: %q, %v", value, err)
+    }
+
+    stored, _, _ := zk.Node("/test/new")
+    stored[len(stored) - 1] ^= 1
+    zk.Put("/test/new", stored)
+    if _, _, _, err := c.Get("/new", false); !errors.Is(err, ErrUndecryptable) {
+        t.Errorf("Get of a tampered value: %v, want ErrUndecryptable", err)
+    }
+}
@@ -0,0 +1,108 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    dedupCacheSize = 4096
+)
+
+type dedupEntry struct {
+    ver goffkv.Version
+    czxid int64
+    mzxid int64
+    sum [sha256.Size]byte
+}
+
+// Last known versions and value hashes, used to skip writes that wouldn't change anything. The
+// zxids tell an entry apart from one erased and created again, whose version starts over.
+type dedupCache struct {
+    mu sync.Mutex
+    entries map[string]dedupEntry
+}
+
+// WithSetDedup makes Set skip the write (and return the current version) if the entry already
+// holds the same value, so that rewriting unchanged values doesn't bump versions. It saves the
+// write, not the round trip: each Set still checks the entry with Exists (or reads it, the first
+// time the key is set).
+func WithSetDedup() Option {
+    return func(c *Client) {
+        c.dedup = &dedupCache{
+            entries: make(map[string]dedupEntry),
+        }
+    }
+}
+
+func (d *dedupCache) remember(path string, stat *zkapi.Stat, value []byte) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    if len(d.entries) >= dedupCacheSize {
+        d.entries = make(map[string]dedupEntry)
+    }
+    d.entries[path] = dedupEntry{
+        ver: VersionOf(stat),
+        czxid: stat.Czxid,
+        mzxid: stat.Mzxid,
+        sum: sha256.Sum256(value),
+    }
+}
+
+func (d *dedupCache) forget(path string) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    delete(d.entries, path)
+}
+
+// Returns the current version if the entry at path already holds value, and 0 otherwise.
+func (c *Client) unchangedVersion(path string, value []byte) goffkv.Version {
+    c.dedup.mu.Lock()
+    entry, ok := c.dedup.entries[path]
+    c.dedup.mu.Unlock()
+
+    if ok {
+        if entry.sum != sha256.Sum256(value) {
+            return 0
+        }
+        exists, stat, err := c.conn.Exists(path)
+        if err != nil || !exists || stat.Czxid != entry.czxid || stat.Mzxid != entry.mzxid {
+            return 0
+        }
+        return entry.ver
+    }
+
+    // From the member the client is attached to, unlike c.get: a hedged read may be answered by
+    // a member lagging behind, and a stale match would drop the write.
+    data, stat, err := c.getPrimary(path)
+    if err != nil {
+        return 0
+    }
+    c.dedup.remember(path, stat, data)
+    if !bytes.Equal(data, value) {
+        return 0
+    }
+    return VersionOf(stat)
+}
+
+func (c *Client) getPrimary(path string) ([]byte, *zkapi.Stat, error) {
+    for {
+        data, stat, err := c.conn.Get(path)
+        if err != nil {
+            return nil, nil, err
+        }
+        value, err := c.decodeValue(c.keyOf(path), valueOf(data))
+        if err == ErrValueChanged {
+            continue
+        }
+        if err != nil {
+            return nil, nil, err
+        }
+        return value, stat, nil
+    }
+}
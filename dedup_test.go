@@ -0,0 +1,97 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestSetDedup(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithSetDedup())
+    defer c.Close()
+
+    ver, err := c.Set("/k", []byte("a"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    writes := zk.Requests(fzSetData)
+    for i := 0; i < 3; i++ {
+        again, err := c.Set("/k", []byte("a"))
+        if err != nil || again != ver {
+            t.Fatalf("unchanged Set: %v, %v, want version %v", again, err, ver)
+        }
+    }
+    if zk.Requests(fzSetData) != writes {
+        t.Error("unchanged values written")
+    }
+
+    // Written by someone else meanwhile.
+    zk.Put("/test/k", []byte("b"))
+    if _, err := c.Set("/k", []byte("a")); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/k"); string(data) != "a" {
+        t.Errorf("value %q after a Set over another client's write", data)
+    }
+
+    // Erased and created again by someone else: the version starts over at the remembered one.
+    for i := 0; i < 2; i++ {
+        if _, err := c.Set("/r", []byte("a")); err != nil {
+            t.Fatal(err)
+        }
+    }
+    other := newTestClient(t, zk)
+    defer other.Close()
+    if err := other.Erase("/r", 0); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := other.Create("/r", []byte("b"), false); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/r", []byte("a")); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/r"); string(data) != "a" {
+        t.Errorf("value %q after a Set over a recreated entry", data)
+    }
+}
+
+// The read deciding whether a Set can be skipped must not be answered by a lagging member.
+func TestSetDedupIgnoresHedgedReads(t *testing.T) {
+    zk1 := newFakeZK(t)
+    defer zk1.Close()
+    zk2 := newFakeZK(t)
+    defer zk2.Close()
+
+    c, err := Connect(zk1.Addr() + "," + zk2.Addr(), "/test", WithLogger(quietLogger), WithSetDedup(), WithReadFallback(time.Millisecond))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    eventually(t, "the secondary connection", func() bool {
+        return c.secondary.State() == zkapi.StateHasSession
+    })
+
+    primary, lagging := zk1, zk2
+    if c.conn.Server() == zk2.Addr() {
+        primary, lagging = zk2, zk1
+    }
+    primary.Put("/test/r", []byte("new"))
+    lagging.Put("/test/r", []byte("old"))
+    // Slow reads on the primary make the client hedge.
+    primary.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            time.Sleep(100 * time.Millisecond)
+        }
+        return nil
+    })
+
+    if _, err := c.Set("/r", []byte("old")); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := primary.Node("/test/r"); string(data) != "old" {
+        t.Errorf("Set skipped because of a stale read: value %q", data)
+    }
+}
@@ -0,0 +1,429 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+var (
+    ErrInvalidInstance = errors.New("service instance needs a name and an id")
+)
+
+// An instance of a service, in the JSON format of Curator's ServiceDiscovery (x-discovery), so
+// that Java services and consumers can share a registry.
+type ServiceInstance struct {
+    Name string `json:"name"`
+    ID string `json:"id"`
+    Address string `json:"address,omitempty"`
+    Port int `json:"port,omitempty"`
+    SSLPort int `json:"sslPort,omitempty"`
+    // Application-defined metadata, as JSON; null if empty, like Curator writes it.
+    Payload json.RawMessage `json:"payload"`
+    RegistrationTimeUTC int64 `json:"registrationTimeUTC"`
+    // "DYNAMIC" for instances registered by this package.
+    ServiceType string `json:"serviceType"`
+    URISpec json.RawMessage `json:"uriSpec"`
+}
+
+// Service registry laid out like Curator's: instance "<key>/<service name>/<instance id>" is an
+// ephemeral node holding the instance as JSON. Values are stored as is, without the codecs of
+// the client, so that other implementations can read them.
+type Registry struct {
+    c *Client
+    segments []string
+
+    mu sync.Mutex
+    registered map[string]ServiceInstance
+    stopWatching func()
+}
+
+// Registry returns a handle of the service registry at key.
+func (c *Client) Registry(key string) (*Registry, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+    return &Registry{
+        c: c,
+        segments: segments,
+        registered: make(map[string]ServiceInstance),
+    }, nil
+}
+
+func (r *Registry) servicePath(name string) string {
+    return r.c.assemblePath(append(append([]string{}, r.segments...), name))
+}
+
+func (r *Registry) create(instance ServiceInstance) error {
+    data, err := json.Marshal(instance)
+    if err != nil {
+        return err
+    }
+    err = r.c.createEachPrefix(append(append(append([]string{}, r.c.prefixSegments...), r.segments...), instance.Name))
+    if err != nil {
+        return err
+    }
+
+    path := r.servicePath(instance.Name) + "/" + instance.ID
+    for attempt := 1; ; attempt++ {
+        _, err = r.c.conn.Create(path, data, zkapi.FlagEphemeral, r.c.acl)
+        if err != zkapi.ErrNodeExists || attempt == 3 {
+            return err
+        }
+
+        exists, stat, err := r.c.conn.Exists(path)
+        if err != nil {
+            return err
+        }
+        if !exists {
+            continue
+        }
+        if stat.EphemeralOwner == r.c.conn.SessionID() {
+            // Ours, from before a lost reply.
+            _, err = r.c.conn.Set(path, data, -1)
+            return err
+        }
+        // Left by a previous session, which would take it along when it expires, or not
+        // ephemeral at all: replaced by a node of this session.
+        err = r.c.conn.Delete(path, stat.Version)
+        if err != nil && err != zkapi.ErrNoNode && err != zkapi.ErrBadVersion {
+            return err
+        }
+    }
+}
+
+// Register publishes instance until Unregister is called or the client is closed. It is
+// registered again whenever the session expires, like Curator does.
+func (r *Registry) Register(instance ServiceInstance) (err error) {
+    start := time.Now()
+    defer func() {
+        r.c.observe("register", normalizeKey(r.segments), start, err)
+    }()
+    if instance.Name == "" || instance.ID == "" {
+        return ErrInvalidInstance
+    }
+    if instance.RegistrationTimeUTC == 0 {
+        instance.RegistrationTimeUTC = time.Now().UnixNano() / int64(time.Millisecond)
+    }
+    if instance.ServiceType == "" {
+        instance.ServiceType = "DYNAMIC"
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    err = r.create(instance)
+    if err != nil {
+        return convertError(err)
+    }
+    r.registered[instance.Name + "/" + instance.ID] = instance
+    if r.stopWatching == nil {
+        r.stopWatching = r.c.OnSessionState(func(state SessionState) {
+            if state == SessionExpired {
+                go r.reregister()
+            }
+        })
+    }
+    return nil
+}
+
+func (r *Registry) reregister() {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for {
+        failed := false
+        for _, instance := range r.registered {
+            err := r.create(instance)
+            if err != nil {
+                r.c.logger.Printf("registry: re-registering %s/%s: %v", instance.Name, instance.ID, err)
+                failed = true
+            }
+        }
+        if !failed {
+            return
+        }
+
+        select {
+        case <-time.After(watchRetryDelay):
+        case <-r.c.done:
+            return
+        }
+    }
+}
+
+// Unregister removes an instance registered through this handle.
+func (r *Registry) Unregister(name string, id string) (err error) {
+    start := time.Now()
+    defer func() {
+        r.c.observe("unregister", normalizeKey(r.segments), start, err)
+    }()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    delete(r.registered, name + "/" + id)
+    if len(r.registered) == 0 && r.stopWatching != nil {
+        r.stopWatching()
+        r.stopWatching = nil
+    }
+
+    err = r.c.conn.Delete(r.servicePath(name) + "/" + id, -1)
+    if err != nil && err != zkapi.ErrNoNode {
+        return convertError(err)
+    }
+    return nil
+}
+
+// Services returns the names of the registered services, sorted.
+func (r *Registry) Services() (services []string, err error) {
+    start := time.Now()
+    defer func() {
+        r.c.observe("discover", normalizeKey(r.segments), start, err)
+    }()
+    names, _, err := r.c.conn.Children(r.c.assemblePath(r.segments))
+    if err == zkapi.ErrNoNode {
+        return []string{}, nil
+    }
+    if err != nil {
+        return nil, convertError(err)
+    }
+    sort.Strings(names)
+    return names, nil
+}
+
+// Instances returns the current instances of service name, sorted by id. Instances that can't be
+// parsed are skipped.
+func (r *Registry) Instances(name string) (instances []ServiceInstance, err error) {
+    start := time.Now()
+    defer func() {
+        r.c.observe("discover", normalizeKey(r.segments), start, err)
+    }()
+    ids, _, err := r.c.conn.Children(r.servicePath(name))
+    if err == zkapi.ErrNoNode {
+        return []ServiceInstance{}, nil
+    }
+    if err != nil {
+        return nil, convertError(err)
+    }
+
+    sort.Strings(ids)
+    result := []ServiceInstance{}
+    for _, id := range ids {
+        data, _, err := r.c.conn.Get(r.servicePath(name) + "/" + id)
+        if err == zkapi.ErrNoNode {
+            continue
+        }
+        if err != nil {
+            return nil, convertError(err)
+        }
+        var instance ServiceInstance
+        if json.Unmarshal(data, &instance) == nil {
+            result = append(result, instance)
+        }
+    }
+    return result, nil
+}
+
+// Called from the goroutine of a ServiceCache, in order; nil callbacks are skipped.
+type ServiceCallbacks struct {
+    Added func(ServiceInstance)
+    Removed func(ServiceInstance)
+    // An instance has been registered again with different data.
+    Updated func(ServiceInstance)
+}
+
+// Watch-maintained list of the instances of a service.
+type ServiceCache struct {
+    *gate
+    r *Registry
+    name string
+    path string
+    callbacks ServiceCallbacks
+    // Poked whenever a watch fires.
+    changed chan struct{}
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.Mutex
+    instances map[string]ServiceInstance
+    // Ids whose data watch is set, "" standing for the watch of the list.
+    watched map[string]bool
+}
+
+// Watch starts caching the instances of service name; callbacks are called for every change,
+// starting with the instances present initially.
+func (r *Registry) Watch(name string, callbacks ServiceCallbacks) (*ServiceCache, error) {
+    err := r.c.createEachPrefix(append(append(append([]string{}, r.c.prefixSegments...), r.segments...), name))
+    if err != nil {
+        return nil, convertError(err)
+    }
+
+    sc := &ServiceCache{
+        gate: newGate(),
+        r: r,
+        name: name,
+        path: r.servicePath(name),
+        callbacks: callbacks,
+        changed: make(chan struct{}, 1),
+        stop: make(chan struct{}),
+        instances: make(map[string]ServiceInstance),
+        watched: make(map[string]bool),
+    }
+    go sc.loop()
+    return sc, nil
+}
+
+// Forwards the firing of ech to changed.
+func (sc *ServiceCache) forward(ech <-chan zkapi.Event, id string) {
+    select {
+    case <-ech:
+    case <-sc.stop:
+        return
+    }
+    sc.mu.Lock()
+    delete(sc.watched, id)
+    sc.mu.Unlock()
+    select {
+    case sc.changed <- struct{}{}:
+    default:
+    }
+}
+
+// Lists the instances, setting the watch of the list unless it is set already.
+func (sc *ServiceCache) list() ([]string, error) {
+    if sc.watched[""] {
+        ids, _, err := sc.r.c.conn.Children(sc.path)
+        return ids, err
+    }
+
+    ids, _, ech, err := sc.r.c.conn.ChildrenW(sc.path)
+    if err == zkapi.ErrNoNode {
+        // The service has been erased altogether.
+        err = sc.r.c.createEachPrefix(append(append(append([]string{}, sc.r.c.prefixSegments...), sc.r.segments...), sc.name))
+        if err != nil {
+            return nil, err
+        }
+        ids, _, ech, err = sc.r.c.conn.ChildrenW(sc.path)
+    }
+    if err != nil {
+        return nil, err
+    }
+    sc.watched[""] = true
+    go sc.forward(ech, "")
+    return ids, nil
+}
+
+// Reloads the instances; returns the events to report.
+func (sc *ServiceCache) reload() ([]func(), error) {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+
+    ids, err := sc.list()
+    if err != nil {
+        return nil, err
+    }
+
+    events := []func(){}
+    present := make(map[string]bool, len(ids))
+    for _, id := range ids {
+        present[id] = true
+        if sc.watched[id] {
+            continue
+        }
+
+        data, _, ech, err := sc.r.c.conn.GetW(sc.path + "/" + id)
+        if err == zkapi.ErrNoNode {
+            delete(present, id)
+            continue
+        }
+        if err != nil {
+            return events, err
+        }
+        sc.watched[id] = true
+        go sc.forward(ech, id)
+
+        var instance ServiceInstance
+        if json.Unmarshal(data, &instance) != nil {
+            continue
+        }
+        old, existed := sc.instances[id]
+        sc.instances[id] = instance
+        switch {
+        case !existed && sc.callbacks.Added != nil:
+            events = append(events, func() { sc.callbacks.Added(instance) })
+        case existed && sc.callbacks.Updated != nil && !bytes.Equal(instanceJSON(old), instanceJSON(instance)):
+            events = append(events, func() { sc.callbacks.Updated(instance) })
+        }
+    }
+    for id, instance := range sc.instances {
+        if !present[id] {
+            delete(sc.instances, id)
+            delete(sc.watched, id)
+            if sc.callbacks.Removed != nil {
+                instance := instance
+                events = append(events, func() { sc.callbacks.Removed(instance) })
+            }
+        }
+    }
+    return events, nil
+}
+
+func instanceJSON(instance ServiceInstance) []byte {
+    data, _ := json.Marshal(instance)
+    return data
+}
+
+func (sc *ServiceCache) loop() {
+    for {
+        events, err := sc.reload()
+        for _, event := range events {
+            event()
+        }
+        if err == nil {
+            sc.markReady()
+        } else {
+            sc.r.c.logger.Printf("registry: reloading %s: %v", sc.name, err)
+            time.AfterFunc(watchRetryDelay, func() {
+                select {
+                case sc.changed <- struct{}{}:
+                default:
+                }
+            })
+        }
+
+        select {
+        case <-sc.changed:
+        case <-sc.stop:
+            return
+        case <-sc.r.c.done:
+            sc.fail(ErrClientClosed)
+            return
+        }
+    }
+}
+
+// Instances returns the cached instances, sorted by id.
+func (sc *ServiceCache) Instances() []ServiceInstance {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+
+    result := make([]ServiceInstance, 0, len(sc.instances))
+    for _, instance := range sc.instances {
+        result = append(result, instance)
+    }
+    sort.Slice(result, func(i, j int) bool {
+        return result[i].ID < result[j].ID
+    })
+    return result
+}
+
+func (sc *ServiceCache) Stop() {
+    sc.stopOnce.Do(func() {
+        close(sc.stop)
+    })
+}
@@ -0,0 +1,50 @@
+package goffkv_zk
+
+import (
+    "testing"
+)
+
+// An instance left by another session is taken over, so that it outlives that session.
+func TestRegisterReplacesStaleInstance(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+    stale := newTestClient(t, zk)
+
+    instance := ServiceInstance{Name: "api", ID: "1", Address: "10.0.0.1", Port: 80}
+    staleRegistry, err := stale.Registry("/services")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := staleRegistry.Register(instance); err != nil {
+        t.Fatal(err)
+    }
+
+    registry, err := c.Registry("/services")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := registry.Register(instance); err != nil {
+        t.Fatal(err)
+    }
+    _, stat, ok := zk.Node("/test/services/api/1")
+    if !ok || stat.EphemeralOwner != c.conn.SessionID() {
+        t.Fatalf("instance node owned by session %x, want %x", stat.EphemeralOwner, c.conn.SessionID())
+    }
+
+    // Registering again keeps the node of the session.
+    czxid := stat.Czxid
+    if err := registry.Register(instance); err != nil {
+        t.Fatal(err)
+    }
+    if _, stat, _ := zk.Node("/test/services/api/1"); stat.Czxid != czxid {
+        t.Error("own instance node recreated")
+    }
+
+    stale.Close()
+    instances, err := registry.Instances("api")
+    if err != nil || len(instances) != 1 {
+        t.Errorf("instances after the stale session is gone: %v, %v", instances, err)
+    }
+}
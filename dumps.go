@@ -0,0 +1,190 @@
+package goffkv_zk
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Internal nodes of the server (quotas, config), never imported.
+const zookeeperRoot = "/zookeeper"
+
+var zkPermNames = map[string]int32{
+    "READ": zkapi.PermRead,
+    "WRITE": zkapi.PermWrite,
+    "CREATE": zkapi.PermCreate,
+    "DELETE": zkapi.PermDelete,
+    "ADMIN": zkapi.PermAdmin,
+    "ALL": zkapi.PermAll,
+}
+
+// Permissions written either as a bit mask or as a list of names.
+type dumpPerms int32
+
+func (p *dumpPerms) UnmarshalJSON(data []byte) error {
+    var mask int32
+    if json.Unmarshal(data, &mask) == nil {
+        *p = dumpPerms(mask)
+        return nil
+    }
+    var names []string
+    err := json.Unmarshal(data, &names)
+    if err != nil {
+        return err
+    }
+    for _, name := range names {
+        perm, ok := zkPermNames[strings.ToUpper(name)]
+        if !ok {
+            return fmt.Errorf("unknown permission %q", name)
+        }
+        mask |= perm
+    }
+    *p = dumpPerms(mask)
+    return nil
+}
+
+// Collects the nodes of a dump, by ZooKeeper path.
+type dumpCollector struct {
+    root string
+    nodes map[string]ExportedNode
+}
+
+func newDumpCollector(root string) *dumpCollector {
+    return &dumpCollector{
+        root: strings.TrimSuffix(root, "/"),
+        nodes: make(map[string]ExportedNode),
+    }
+}
+
+// Adds the node at path, unless it is outside of the root or internal to the server.
+func (d *dumpCollector) add(path string, node ExportedNode) {
+    path = strings.TrimSuffix(path, "/")
+    if path == zookeeperRoot || strings.HasPrefix(path, zookeeperRoot + "/") {
+        return
+    }
+    if path != d.root && !strings.HasPrefix(path, d.root + "/") {
+        return
+    }
+    node.Key = path[len(d.root):]
+    d.nodes[node.Key] = node
+}
+
+// The nodes, parents first, with the parents missing from the dump (the root included) added as
+// empty nodes.
+func (d *dumpCollector) snapshot() Snapshot {
+    for key := range d.nodes {
+        for i := strings.LastIndexByte(key, '/'); i > 0; i = strings.LastIndexByte(key[:i], '/') {
+            if _, ok := d.nodes[key[:i]]; !ok {
+                d.nodes[key[:i]] = ExportedNode{Key: key[:i], Value: []byte{}}
+            }
+        }
+    }
+    if _, ok := d.nodes[""]; !ok && len(d.nodes) != 0 {
+        d.nodes[""] = ExportedNode{Value: []byte{}}
+    }
+
+    result := Snapshot{Nodes: make([]ExportedNode, 0, len(d.nodes))}
+    for _, node := range d.nodes {
+        result.Nodes = append(result.Nodes, node)
+    }
+    sort.Slice(result.Nodes, func(i, j int) bool {
+        a, b := result.Nodes[i].Key, result.Nodes[j].Key
+        if depthA, depthB := strings.Count(a, "/"), strings.Count(b, "/"); depthA != depthB {
+            return depthA < depthB
+        }
+        return a < b
+    })
+    return result
+}
+
+// The file written by zk-shell's "mirror" (or "cp") to a json:// URL.
+type zkShellNode struct {
+    // Base64.
+    Content string `json:"content"`
+    ACLs []struct {
+        ID struct {
+            Scheme string `json:"scheme"`
+            ID string `json:"id"`
+        } `json:"id"`
+        Perms dumpPerms `json:"perms"`
+    } `json:"acls"`
+    Ephemeral bool `json:"ephemeral"`
+}
+
+// ParseZKShell reads a JSON dump written by zk-shell ("mirror /path json://file"): an object
+// mapping ZooKeeper paths to their base64 content, ACLs and ephemeral flag. The nodes at or below
+// the ZooKeeper path root are returned for Import, relative to root; so the subtree at root is
+// imported at the key passed to Import, under the prefix of the client.
+func ParseZKShell(r io.Reader, root string) (Snapshot, error) {
+    var dump map[string]zkShellNode
+    err := json.NewDecoder(r).Decode(&dump)
+    if err != nil {
+        return Snapshot{}, err
+    }
+
+    d := newDumpCollector(root)
+    for path, node := range dump {
+        value, err := base64.StdEncoding.DecodeString(node.Content)
+        if err != nil {
+            return Snapshot{}, fmt.Errorf("%s: %v", path, err)
+        }
+        exported := ExportedNode{Value: value}
+        if node.Ephemeral {
+            exported.Kind = NodeEphemeral
+        }
+        for _, acl := range node.ACLs {
+            exported.ACL = append(exported.ACL, ExportedACL{acl.ID.Scheme, acl.ID.ID, int32(acl.Perms)})
+        }
+        d.add(path, exported)
+    }
+    return d.snapshot(), nil
+}
+
+// A node of a zkdump JSON dump, with its children nested, or listed flat with full paths.
+type zkDumpNode struct {
+    Path string `json:"path"`
+    // Text, as dumped.
+    Data *string `json:"data"`
+    Children []zkDumpNode `json:"children"`
+}
+
+func (d *dumpCollector) addZKDump(node zkDumpNode) {
+    value := []byte{}
+    if node.Data != nil {
+        value = []byte(*node.Data)
+    }
+    d.add(node.Path, ExportedNode{Value: value})
+    for _, child := range node.Children {
+        d.addZKDump(child)
+    }
+}
+
+// ParseZKDump reads a zkdump JSON dump: a tree of nodes with a "path", a text "data" and their
+// "children", or a flat array of such nodes. The nodes are mapped like ParseZKShell does.
+func ParseZKDump(r io.Reader, root string) (Snapshot, error) {
+    var raw json.RawMessage
+    err := json.NewDecoder(r).Decode(&raw)
+    if err != nil {
+        return Snapshot{}, err
+    }
+
+    var nodes []zkDumpNode
+    if json.Unmarshal(raw, &nodes) != nil {
+        var tree zkDumpNode
+        err = json.Unmarshal(raw, &tree)
+        if err != nil {
+            return Snapshot{}, err
+        }
+        nodes = []zkDumpNode{tree}
+    }
+
+    d := newDumpCollector(root)
+    for _, node := range nodes {
+        d.addZKDump(node)
+    }
+    return d.snapshot(), nil
+}
@@ -0,0 +1,87 @@
+package goffkv_zk
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Returns the keys and values of snapshot.
+func snapshotValues(snapshot Snapshot) map[string]string {
+    result := make(map[string]string)
+    for _, node := range snapshot.Nodes {
+        result[node.Key] = string(node.Value)
+    }
+    return result
+}
+
+func TestParseZKShell(t *testing.T) {
+    dump := `{
+        "/app/a": {"content": "YQ==", "acls": [{"id": {"scheme": "world", "id": "anyone"}, "perms": ["READ", "write"]}], "ephemeral": false},
+        "/app/b/c": {"content": "", "acls": [{"id": {"scheme": "world", "id": "anyone"}, "perms": 31}], "ephemeral": true},
+        "/application": {"content": "", "acls": [], "ephemeral": false},
+        "/zookeeper/quota": {"content": "", "acls": [], "ephemeral": false}
+    }`
+    snapshot, err := ParseZKShell(strings.NewReader(dump), "/app/")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]string{"": "", "/a": "a", "/b": "", "/b/c": ""}
+    if got := snapshotValues(snapshot); !reflect.DeepEqual(got, want) {
+        t.Fatalf("nodes %v, want %v", got, want)
+    }
+    // Parents first.
+    if snapshot.Nodes[0].Key != "" || snapshot.Nodes[len(snapshot.Nodes) - 1].Key != "/b/c" {
+        t.Errorf("order %+v", snapshot.Nodes)
+    }
+    for _, node := range snapshot.Nodes {
+        switch node.Key {
+        case "/a":
+            if len(node.ACL) != 1 || node.ACL[0].Perms != zkapi.PermRead | zkapi.PermWrite {
+                t.Errorf("ACL of /a: %+v", node.ACL)
+            }
+        case "/b/c":
+            if node.Kind != NodeEphemeral || node.ACL[0].Perms != zkapi.PermAll {
+                t.Errorf("/b/c: %+v", node)
+            }
+        }
+    }
+
+    if _, err := ParseZKShell(strings.NewReader(`{"/a": {"acls": [{"perms": ["FLY"]}]}}`), "/"); err == nil {
+        t.Error("unknown permission accepted")
+    }
+}
+
+func TestParseZKDump(t *testing.T) {
+    nested := `{"path": "/app", "data": "root", "children": [
+        {"path": "/app/a", "data": "a", "children": [{"path": "/app/a/b", "data": null}]}
+    ]}`
+    flat := `[{"path": "/app", "data": "root"}, {"path": "/app/a", "data": "a"}, {"path": "/app/a/b"}]`
+    want := map[string]string{"": "root", "/a": "a", "/a/b": ""}
+    for _, dump := range []string{nested, flat} {
+        snapshot, err := ParseZKDump(strings.NewReader(dump), "/app")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := snapshotValues(snapshot); !reflect.DeepEqual(got, want) {
+            t.Errorf("nodes %v, want %v", got, want)
+        }
+    }
+
+    // A dump taken at the root imports under the key passed to Import.
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+    snapshot, err := ParseZKDump(strings.NewReader(nested), "/")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Import("/restored", snapshot, ImportOverwrite); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/restored/app/a"); string(data) != "a" {
+        t.Errorf("imported value %q", data)
+    }
+}
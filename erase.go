@@ -0,0 +1,418 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    defaultEraseBatchSize = 100
+    // Upper bound of a Multi, a bit below the default jute.maxbuffer of the server.
+    maxMultiBytes = 1000 * 1000
+    // Estimated encoding overhead of a delete in a Multi, besides its path.
+    deleteOpBytes = 32
+    // How many times a subtree may change under an erase before it gives up.
+    maxEraseRestarts = 16
+)
+
+var (
+    ErrEraseContended = errors.New("subtree keeps changing during erase")
+)
+
+type EraseStrategy int
+
+const (
+    // EraseAtomic if the subtree fits in a single request, EraseBatches otherwise.
+    EraseAuto EraseStrategy = iota
+    // The whole subtree is erased by a single Multi: all or nothing, but big subtrees may exceed
+    // the maximum request size of the server.
+    EraseAtomic
+    // The subtree is erased bottom-up by Multis of at most BatchSize deletes; the version of the
+    // key is checked before the first batch and again by every batch, the last one removing the
+    // key itself.
+    EraseBatches
+    // Nodes are deleted one by one, bottom-up, ignoring the ones removed concurrently; the version
+    // of the key is only checked when the key itself is deleted, so its children may be gone even
+    // if that fails.
+    EraseStreaming
+)
+
+// Options of EraseTreeWith. The zero value erases small subtrees atomically, big ones in batches.
+type EraseOptions struct {
+    Strategy EraseStrategy
+    // Maximum number of deletes per Multi of EraseBatches; defaults to 100. Setting it selects
+    // EraseBatches if Strategy is left as EraseAuto. Unless the subtree is erased by a single Multi,
+    // concurrent readers may observe it partially erased.
+    BatchSize int
+    // Maximum number of batches of EraseBatches in flight; defaults to 1. Batches run
+    // concurrently only within a level of the subtree, deepest level first.
+    Parallelism int
+    // Maximum number of deletes per second, 0 means unlimited. Not used by EraseAtomic.
+    Rate float64
+}
+
+type throttle struct {
+    rate float64
+
+    mu sync.Mutex
+    next time.Time
+}
+
+func (t *throttle) wait(n int) {
+    time.Sleep(t.reserve(n))
+}
+
+// Reserves n units; returns how long to wait before using them.
+func (t *throttle) reserve(n int) time.Duration {
+    if t.rate <= 0 {
+        return 0
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    start := now
+    if t.next.After(now) {
+        start = t.next
+    }
+    t.next = start.Add(time.Duration(float64(n) / t.rate * float64(time.Second)))
+    return start.Sub(now)
+}
+
+func multiSize(ops []interface{}) int {
+    result := 0
+    for _, op := range ops {
+        switch op := op.(type) {
+        case *zkapi.DeleteRequest:
+            result += len(op.Path) + deleteOpBytes
+        case *zkapi.CheckVersionRequest:
+            result += len(op.Path) + deleteOpBytes
+        case *zkapi.CreateRequest:
+            result += len(op.Path) + len(op.Data) + createOpBytes
+            for _, entry := range op.Acl {
+                result += len(entry.Scheme) + len(entry.ID)
+            }
+        case *zkapi.SetDataRequest:
+            result += len(op.Path) + len(op.Data) + deleteOpBytes
+        }
+    }
+    return result
+}
+
+// Splits items (as listed by listSubtree) into levels, deepest first; the root is the last level.
+func eraseLevels(items []eraseItem) [][]eraseItem {
+    byDepth := make(map[int][]eraseItem)
+    depths := []int{}
+    for _, item := range items {
+        depth := strings.Count(item.path, "/")
+        if _, ok := byDepth[depth]; !ok {
+            depths = append(depths, depth)
+        }
+        byDepth[depth] = append(byDepth[depth], item)
+    }
+    sort.Sort(sort.Reverse(sort.IntSlice(depths)))
+
+    result := make([][]eraseItem, len(depths))
+    for i, depth := range depths {
+        result[i] = byDepth[depth]
+    }
+    return result
+}
+
+func (c *Client) eraseBatched(segments []string, ver goffkv.Version, opts EraseOptions) (EraseStats, error) {
+    path := c.assemblePath(segments)
+    limiter := &throttle{rate: opts.Rate}
+    if opts.BatchSize <= 0 {
+        opts.BatchSize = defaultEraseBatchSize
+    }
+    if opts.Parallelism <= 0 {
+        opts.Parallelism = 1
+    }
+
+    var (
+        stats EraseStats
+        statsMu sync.Mutex
+    )
+outermost:
+    for restarts := 0; ; restarts++ {
+        if restarts == maxEraseRestarts {
+            return stats, ErrEraseContended
+        }
+        if restarts > 0 {
+            c.logger.Printf("erase %s: subtree changed, restarting", path)
+        }
+
+        exists, stat, err := c.conn.Exists(path)
+        if err != nil {
+            return stats, convertError(err)
+        }
+        if !exists {
+            if stats.Nodes == 0 {
+                return stats, goffkv.OpErrNoEntry
+            }
+            // Somebody has finished the job for us.
+            return stats, nil
+        }
+        if ver != 0 && VersionOf(stat) != ver {
+            return stats, nil
+        }
+
+        items, err := c.listSubtree(nil, segments)
+        if err == zkapi.ErrNoNode {
+            continue outermost
+        }
+        if err != nil {
+            return stats, convertError(err)
+        }
+
+        levels := eraseLevels(items)
+        for _, level := range levels[:len(levels) - 1] {
+            batches := [][]eraseItem{}
+            for start := 0; start < len(level); start += opts.BatchSize {
+                end := start + opts.BatchSize
+                if end > len(level) {
+                    end = len(level)
+                }
+                batches = append(batches, level[start:end])
+            }
+
+            var (
+                wg sync.WaitGroup
+                errMu sync.Mutex
+                levelErr error
+            )
+            slots := make(chan struct{}, opts.Parallelism)
+            for _, batch := range batches {
+                slots <- struct{}{}
+                wg.Add(1)
+                go func(batch []eraseItem) {
+                    defer func() {
+                        <-slots
+                        wg.Done()
+                    }()
+
+                    // Every batch checks the version of the key, so that none goes on once it has
+                    // changed. The check op of ZooKeeper only compares data versions: children
+                    // created meanwhile are caught by ErrNotEmpty instead.
+                    ops := []interface{}{
+                        &zkapi.CheckVersionRequest{
+                            Path: path,
+                            Version: ToZKVersion(ver),
+                        },
+                    }
+                    for _, item := range batch {
+                        ops = append(ops, &zkapi.DeleteRequest{
+                            Path: item.path,
+                            Version: -1,
+                        })
+                    }
+
+                    limiter.wait(len(batch))
+                    _, err := c.conn.Multi(ops...)
+                    if err != nil {
+                        errMu.Lock()
+                        if levelErr == nil || levelErr == zkapi.ErrNoNode || levelErr == zkapi.ErrNotEmpty {
+                            levelErr = err
+                        }
+                        errMu.Unlock()
+                        return
+                    }
+
+                    statsMu.Lock()
+                    for _, item := range batch {
+                        stats.Nodes++
+                        stats.Bytes += int64(item.size)
+                    }
+                    statsMu.Unlock()
+                }(batch)
+            }
+            wg.Wait()
+
+            switch levelErr {
+            case nil:
+            case zkapi.ErrBadVersion:
+                return stats, nil
+            case zkapi.ErrNoNode, zkapi.ErrNotEmpty:
+                continue outermost
+            default:
+                return stats, convertError(levelErr)
+            }
+        }
+
+        root := levels[len(levels) - 1][0]
+        limiter.wait(1)
+        _, err = c.conn.Multi(
+            &zkapi.CheckVersionRequest{
+                Path: path,
+                Version: ToZKVersion(ver),
+            },
+            &zkapi.DeleteRequest{
+                Path: path,
+                Version: -1,
+            },
+        )
+        switch err {
+        case nil:
+            stats.Nodes++
+            stats.Bytes += int64(root.size)
+            return stats, nil
+        case zkapi.ErrBadVersion:
+            return stats, nil
+        case zkapi.ErrNoNode, zkapi.ErrNotEmpty:
+            continue outermost
+        default:
+            return stats, convertError(err)
+        }
+    }
+}
+
+func (c *Client) eraseStreaming(segments []string, ver goffkv.Version, opts EraseOptions) (EraseStats, error) {
+    path := c.assemblePath(segments)
+    limiter := &throttle{rate: opts.Rate}
+
+    var stats EraseStats
+outermost:
+    for restarts := 0; ; restarts++ {
+        if restarts == maxEraseRestarts {
+            return stats, ErrEraseContended
+        }
+        if restarts > 0 {
+            c.logger.Printf("erase %s: subtree changed, restarting", path)
+        }
+
+        exists, stat, err := c.conn.Exists(path)
+        if err != nil {
+            return stats, convertError(err)
+        }
+        if !exists {
+            if stats.Nodes == 0 {
+                return stats, goffkv.OpErrNoEntry
+            }
+            return stats, nil
+        }
+        if ver != 0 && VersionOf(stat) != ver {
+            return stats, nil
+        }
+
+        items, err := c.listSubtree(nil, segments)
+        if err == zkapi.ErrNoNode {
+            continue outermost
+        }
+        if err != nil {
+            return stats, convertError(err)
+        }
+
+        for _, item := range items {
+            version := int32(-1)
+            if item.path == path {
+                version = ToZKVersion(ver)
+            }
+
+            limiter.wait(1)
+            err = c.conn.Delete(item.path, version)
+            switch err {
+            case nil:
+                stats.Nodes++
+                stats.Bytes += int64(item.size)
+            case zkapi.ErrNoNode:
+            case zkapi.ErrBadVersion:
+                return stats, nil
+            case zkapi.ErrNotEmpty:
+                continue outermost
+            default:
+                return stats, convertError(err)
+            }
+        }
+        return stats, nil
+    }
+}
+
+// EraseChildren erases everything under key (atomically), but keeps key itself and its value.
+// Fails with ErrTxnTooLarge if the subtree doesn't fit in a single request; erase the children
+// one by one with EraseTreeWith then.
+func (c *Client) EraseChildren(key string) (err error) {
+    defer c.recoverPanic("erase", key, &err)
+    start := time.Now()
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return err
+    }
+
+    c.fence(context.Background(), key)
+    defer c.lockQueued(key)()
+    var erased []string
+    err = c.retry(context.Background(), true, func() (err error) {
+        erased, err = c.eraseChildren(segments)
+        return err
+    })
+    if err == nil {
+        for _, child := range erased {
+            childKey := normalizeKey(append(append([]string{}, segments...), child))
+            c.queue.drop(childKey, true)
+            if c.leases != nil {
+                c.leases.untrack(childKey)
+            }
+        }
+    }
+    err = c.wrapError("erase", key, err)
+    c.observe("erase", key, start, err)
+    return err
+}
+
+// Returns the children erased.
+func (c *Client) eraseChildren(segments []string) ([]string, error) {
+    err := c.checkErasable(segments)
+    if err != nil {
+        return nil, err
+    }
+
+    path := c.assemblePath(segments)
+outermost:
+    for restarts := 0; ; restarts++ {
+        if restarts == maxEraseRestarts {
+            return nil, ErrEraseContended
+        }
+        if restarts > 0 {
+            c.logger.Printf("erase %s: subtree changed, restarting", path)
+        }
+
+        children, _, err := c.conn.Children(path)
+        if err != nil {
+            return nil, convertError(err)
+        }
+        if len(children) == 0 {
+            return nil, nil
+        }
+
+        ops := []interface{}{}
+        for _, child := range children {
+            ops, err = c.makeEraseQuery(ops, append(append([]string{}, segments...), child), nil)
+            if err != nil && err != zkapi.ErrNoNode {
+                return nil, convertError(err)
+            }
+        }
+        if len(ops) == 0 {
+            continue outermost
+        }
+        if multiSize(ops) > maxMultiBytes {
+            return nil, ErrTxnTooLarge
+        }
+
+        _, err = c.conn.Multi(ops...)
+        switch err {
+        case nil:
+            return children, nil
+        case zkapi.ErrNotEmpty, zkapi.ErrNoNode:
+            continue outermost
+        default:
+            return nil, convertError(err)
+        }
+    }
+}
@@ -0,0 +1,226 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Creates /test/tree with n children, each with a child of its own.
+func putTree(zk *fakeZK, n int) {
+    zk.Put("/test/tree", []byte("root"))
+    for i := 0; i < n; i++ {
+        child := fmt.Sprintf("/test/tree/c%d", i)
+        zk.Put(child, []byte("ab"))
+        zk.Put(child + "/leaf", []byte("cde"))
+    }
+}
+
+func TestEraseStrategies(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    for _, opts := range []EraseOptions{
+        {},
+        {Strategy: EraseAtomic},
+        {Strategy: EraseBatches, BatchSize: 3},
+        {BatchSize: 2, Parallelism: 4},
+        {Strategy: EraseStreaming},
+    } {
+        putTree(zk, 5)
+        multis := zk.Requests(fzMulti)
+        stats, err := c.EraseTreeWith("/tree", 0, opts)
+        if err != nil {
+            t.Fatalf("%+v: %v", opts, err)
+        }
+        if stats.Nodes != 11 || stats.Bytes != 4 + 5 * 5 {
+            t.Errorf("%+v: erased %+v, want 11 nodes of 29 bytes", opts, stats)
+        }
+        if paths := zk.Paths("/test/tree"); len(paths) != 0 {
+            t.Errorf("%+v: left %v", opts, paths)
+        }
+
+        multis = zk.Requests(fzMulti) - multis
+        switch {
+        case opts.Strategy == EraseStreaming && multis != 0:
+            t.Errorf("%+v: %d multis", opts, multis)
+        case opts.Strategy == EraseAtomic && multis != 1:
+            t.Errorf("%+v: %d multis, want 1", opts, multis)
+        case opts.BatchSize > 0 && multis < 11 / opts.BatchSize:
+            t.Errorf("%+v: %d multis for 11 nodes", opts, multis)
+        }
+    }
+}
+
+// A version mismatch leaves the subtree alone, except for what EraseStreaming and EraseBatches
+// document they may remove.
+func TestEraseVersion(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    putTree(zk, 2)
+    _, stat, _ := zk.Node("/test/tree")
+    stale := VersionOf(stat) + 1
+    for _, opts := range []EraseOptions{{}, {Strategy: EraseAtomic}, {Strategy: EraseBatches}} {
+        if _, err := c.EraseTreeWith("/tree", stale, opts); err != nil {
+            t.Fatalf("%+v: %v", opts, err)
+        }
+        if _, _, ok := zk.Node("/test/tree"); !ok {
+            t.Fatalf("%+v: erased despite the version", opts)
+        }
+    }
+    if n := len(zk.Paths("/test/tree")); n != 5 {
+        t.Errorf("%d nodes left after checked erases, want 5", n)
+    }
+
+    if _, err := c.EraseTreeWith("/tree", VersionOf(stat), EraseOptions{Strategy: EraseStreaming}); err != nil {
+        t.Fatal(err)
+    }
+    if paths := zk.Paths("/test/tree"); len(paths) != 0 {
+        t.Errorf("left %v", paths)
+    }
+}
+
+// EraseBatches stops at the first batch after the key has changed.
+func TestEraseBatchesGuarded(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    putTree(zk, 5)
+    _, stat, _ := zk.Node("/test/tree")
+    leaves := 0
+    zk.Fail(func(op int32, path string) error {
+        if op == fzMulti && strings.HasSuffix(path, "/leaf") {
+            leaves++
+            if leaves == 2 {
+                zk.PutLocked("/test/tree", []byte("changed"))
+            }
+        }
+        return nil
+    })
+    stats, err := c.EraseTreeWith("/tree", VersionOf(stat), EraseOptions{Strategy: EraseBatches, BatchSize: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := len(zk.Paths("/test/tree")); stats.Nodes != 1 || n != 10 {
+        t.Errorf("erased %d nodes, left %d, want the first batch only", stats.Nodes, n)
+    }
+}
+
+func TestListSubtree(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    putTree(zk, 40)
+    zk.Put("/test/tree/c0/leaf/deeper", nil)
+    // Removed while listed, after its parent was.
+    zk.Fail(func(op int32, path string) error {
+        if op == fzGetChildren2 && path == "/test/tree/c1/leaf" {
+            return zkapi.ErrNoNode
+        }
+        return nil
+    })
+    items, err := c.listSubtree(nil, []string{"tree"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(items) != 81 || items[len(items) - 1].path != "/test/tree" {
+        t.Fatalf("listed %d items, the root last: %v", len(items), items[len(items) - 1])
+    }
+    listed := make(map[string]bool)
+    for _, item := range items {
+        for other := range listed {
+            if strings.HasPrefix(item.path, other + "/") {
+                t.Fatalf("%s listed before its descendant %s", other, item.path)
+            }
+        }
+        listed[item.path] = true
+    }
+    if listed["/test/tree/c1/leaf"] {
+        t.Error("removed node listed")
+    }
+}
+
+func TestEraseRate(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    putTree(zk, 2)
+    start := time.Now()
+    if _, err := c.EraseTreeWith("/tree", 0, EraseOptions{Strategy: EraseStreaming, Rate: 50}); err != nil {
+        t.Fatal(err)
+    }
+    // 5 deletes at 50 per second: the last one waits for 80ms.
+    if elapsed := time.Since(start); elapsed < 70 * time.Millisecond {
+        t.Errorf("erase at 50 deletes per second took %v", elapsed)
+    }
+}
+
+func TestEraseChildren(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    putTree(zk, 3)
+    if err := c.EraseChildren("/tree"); err != nil {
+        t.Fatal(err)
+    }
+    paths := zk.Paths("/test/tree")
+    if len(paths) != 1 || paths[0] != "/test/tree" {
+        t.Errorf("left %v, want only the parent", paths)
+    }
+    if data, _, _ := zk.Node("/test/tree"); string(data) != "root" {
+        t.Errorf("parent value %q", data)
+    }
+    // Nothing to erase.
+    if err := c.EraseChildren("/tree"); err != nil {
+        t.Error(err)
+    }
+
+    long := strings.Repeat("x", 500)
+    for i := 0; i < 2500; i++ {
+        zk.Put(fmt.Sprintf("/test/tree/%s%d", long, i), nil)
+    }
+    if err := c.EraseChildren("/tree"); !errors.Is(err, ErrTxnTooLarge) {
+        t.Errorf("EraseChildren of a big subtree: %v, want ErrTxnTooLarge", err)
+    }
+}
+
+func TestEraseChildrenLeases(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    r := &recorder{}
+    c := newTestClient(t, zk, WithInstrumentation(r), WithLeaseVerification(time.Hour, func(LeaseEvent) {}))
+    defer c.Close()
+
+    zk.Put("/test/p/q", nil)
+    if _, err := c.Create("/p/q/lease", nil, true); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.EraseChildren("/p"); err != nil {
+        t.Fatal(err)
+    }
+    c.leases.mu.Lock()
+    left := len(c.leases.keys)
+    c.leases.mu.Unlock()
+    if left != 0 {
+        t.Errorf("%d leases still tracked under erased children", left)
+    }
+    if got := r.observations(); len(got) != 2 || got[1].op != "erase" {
+        t.Errorf("observed %+v", got)
+    }
+}
@@ -0,0 +1,57 @@
+package goffkv_zk
+
+import (
+    "errors"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var (
+    // A broken invariant of the client or of the server's replies, reported instead of panicking.
+    ErrInternal = errors.New("internal error")
+)
+
+// A failed request, with the operation and the path it was about. The errors defined by goffkv
+// (OpError, TxnError and UsageError) are returned as they are, as the goffkv.Client contract
+// requires; everything else is wrapped. Use errors.Is and errors.As to inspect the cause.
+type Error struct {
+    Op string
+    Path string
+    Err error
+}
+
+func (e *Error) Error() string {
+    if e.Path == "" {
+        return e.Op + ": " + e.Err.Error()
+    }
+    return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+// Returns the path key maps to, or key itself if it is invalid.
+func (c *Client) pathOf(key string) string {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return key
+    }
+    return c.assemblePath(segments)
+}
+
+func (c *Client) wrapError(op string, key string, err error) error {
+    switch err.(type) {
+    case nil, goffkv.OpError, goffkv.TxnError, goffkv.UsageError, *Error:
+        return err
+    }
+
+    path := ""
+    if key != "" {
+        path = c.pathOf(key)
+    }
+    return &Error{
+        Op: op,
+        Path: path,
+        Err: err,
+    }
+}
@@ -0,0 +1,43 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestErrorContext(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            return zkapi.ErrNoAuth
+        }
+        return nil
+    })
+    _, _, _, err := c.Get("/a/b", false)
+    var zkErr *Error
+    if !errors.As(err, &zkErr) || zkErr.Op != "get" || zkErr.Path != "/test/a/b" {
+        t.Fatalf("Get failure: %#v, want an *Error of get /test/a/b", err)
+    }
+    if !errors.Is(err, zkapi.ErrNoAuth) {
+        t.Errorf("%v doesn't wrap zk.ErrNoAuth", err)
+    }
+    if err.Error() != "get /test/a/b: " + zkapi.ErrNoAuth.Error() {
+        t.Errorf("message %q", err.Error())
+    }
+
+    // The errors of goffkv are returned as they are.
+    zk.Fail(nil)
+    if _, _, _, err := c.Get("/missing", false); err != goffkv.OpErrNoEntry {
+        t.Errorf("Get of a missing key: %#v, want OpErrNoEntry", err)
+    }
+    _, err = c.Commit(goffkv.Txn{Checks: []goffkv.Check{{Key: "/missing", Ver: 1}}})
+    if _, ok := err.(goffkv.TxnError); !ok {
+        t.Errorf("failed Commit: %#v, want a TxnError", err)
+    }
+}
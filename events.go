@@ -0,0 +1,157 @@
+package goffkv_zk
+
+import (
+    "strings"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+type NodeEventType int
+
+const (
+    NodeCreated NodeEventType = iota + 1
+    NodeDeleted
+    NodeDataChanged
+    NodeChildrenChanged
+    // The watch has been dropped without a node event (e.g. the session has expired); see Err.
+    WatchLost
+)
+
+func (t NodeEventType) String() string {
+    switch t {
+    case NodeCreated:
+        return "created"
+    case NodeDeleted:
+        return "deleted"
+    case NodeDataChanged:
+        return "data changed"
+    case NodeChildrenChanged:
+        return "children changed"
+    case WatchLost:
+        return "watch lost"
+    default:
+        return "unknown"
+    }
+}
+
+// What has triggered a watch. The driver doesn't report the zxid of the change; read the key
+// again to learn its new version.
+type NodeEvent struct {
+    Type NodeEventType
+    Key string
+    Err error
+}
+
+// Converts a path assembled by assemblePath back to a key.
+func (c *Client) keyOf(path string) string {
+    return strings.TrimPrefix(path, c.assemblePath(nil))
+}
+
+// Delivers the (single) event of ech and closes the result.
+func (c *Client) translateEvents(ech <-chan zkapi.Event) <-chan NodeEvent {
+    result := make(chan NodeEvent, 1)
+    go func() {
+        defer close(result)
+
+        zkEvent, ok := <-ech
+        if !ok {
+            result <- NodeEvent{Type: WatchLost, Err: zkapi.ErrClosing}
+            return
+        }
+
+        event := NodeEvent{
+            Key: c.keyOf(zkEvent.Path),
+            Err: zkEvent.Err,
+        }
+        switch zkEvent.Type {
+        case zkapi.EventNodeCreated:
+            event.Type = NodeCreated
+        case zkapi.EventNodeDeleted:
+            event.Type = NodeDeleted
+        case zkapi.EventNodeDataChanged:
+            event.Type = NodeDataChanged
+        case zkapi.EventNodeChildrenChanged:
+            event.Type = NodeChildrenChanged
+        default:
+            event.Type = WatchLost
+        }
+        result <- event
+    }()
+    return result
+}
+
+// ExistsEvent works like Exists with a watch, but the watch tells what has happened.
+func (c *Client) ExistsEvent(key string) (ver goffkv.Version, events <-chan NodeEvent, err error) {
+    err = c.runOp("exists", key, false, func() (err error) {
+        ver, events, err = c.existsEventOnce(key)
+        return err
+    })
+    return
+}
+
+func (c *Client) existsEventOnce(key string) (goffkv.Version, <-chan NodeEvent, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    exists, stat, ech, err := c.conn.ExistsW(c.assemblePath(segments))
+    if err != nil {
+        return 0, nil, convertError(err)
+    }
+
+    var resultVer uint64
+    if exists {
+        resultVer = VersionOf(stat)
+    }
+    return resultVer, c.translateEvents(ech), nil
+}
+
+// GetEvent works like Get with a watch, but the watch tells what has happened.
+func (c *Client) GetEvent(key string) (ver goffkv.Version, value []byte, events <-chan NodeEvent, err error) {
+    err = c.runOp("get", key, false, func() (err error) {
+        ver, value, events, err = c.getEventOnce(key)
+        return err
+    })
+    return
+}
+
+func (c *Client) getEventOnce(key string) (goffkv.Version, []byte, <-chan NodeEvent, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, nil, nil, err
+    }
+
+    result, stat, ech, err := c.getW(c.assemblePath(segments))
+    if err != nil {
+        return 0, nil, nil, convertError(err)
+    }
+    return VersionOf(stat), valueOf(result), c.translateEvents(ech), nil
+}
+
+// ChildrenEvent works like Children with a watch, but the watch tells what has happened.
+func (c *Client) ChildrenEvent(key string) (children []string, events <-chan NodeEvent, err error) {
+    err = c.runOp("children", key, false, func() (err error) {
+        children, events, err = c.childrenEventOnce(key)
+        return err
+    })
+    return
+}
+
+func (c *Client) childrenEventOnce(key string) ([]string, <-chan NodeEvent, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    rawChildren, _, ech, err := c.conn.ChildrenW(c.assemblePath(segments))
+    if err != nil {
+        return nil, nil, convertError(err)
+    }
+
+    result := []string{}
+    for _, rawChild := range rawChildren {
+        result = append(result, key + "/" + rawChild)
+    }
+    return result, c.translateEvents(ech), nil
+}
@@ -0,0 +1,72 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+// Waits for the event of a watch.
+func nodeEvent(t *testing.T, events <-chan NodeEvent) NodeEvent {
+    t.Helper()
+    select {
+    case event := <-events:
+        return event
+    case <-time.After(5 * time.Second):
+        t.Fatal("no event")
+    }
+    return NodeEvent{}
+}
+
+func TestNodeEvents(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+
+    ver, created, err := c.ExistsEvent("/k")
+    if err != nil || ver != 0 {
+        t.Fatalf("ExistsEvent: %v, %v", ver, err)
+    }
+    if _, err := c.Create("/k", []byte("v"), false); err != nil {
+        t.Fatal(err)
+    }
+    if e := nodeEvent(t, created); e.Type != NodeCreated || e.Key != "/k" {
+        t.Errorf("event %+v, want created /k", e)
+    }
+
+    _, value, changed, err := c.GetEvent("/k")
+    if err != nil || string(value) != "v" {
+        t.Fatalf("GetEvent: %q, %v", value, err)
+    }
+    if _, err := c.Set("/k", []byte("w")); err != nil {
+        t.Fatal(err)
+    }
+    if e := nodeEvent(t, changed); e.Type != NodeDataChanged {
+        t.Errorf("event %+v, want data changed", e)
+    }
+    // go-zookeeper hands data changes to the children watches of the node as well.
+    _, children, err := c.ChildrenEvent("/k")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Create("/k/child", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if e := nodeEvent(t, children); e.Type != NodeChildrenChanged || e.Key != "/k" {
+        t.Errorf("event %+v, want children changed of /k", e)
+    }
+
+    _, _, deleted, _ := c.GetEvent("/k/child")
+    if err := c.Erase("/k/child", 0); err != nil {
+        t.Fatal(err)
+    }
+    if e := nodeEvent(t, deleted); e.Type != NodeDeleted || e.Key != "/k/child" {
+        t.Errorf("event %+v, want deleted /k/child", e)
+    }
+
+    // Watches left when the client closes are lost.
+    _, lost, _ := c.ExistsEvent("/k")
+    c.Close()
+    if e := nodeEvent(t, lost); e.Type != WatchLost || e.Err == nil {
+        t.Errorf("event %+v, want a lost watch", e)
+    }
+}
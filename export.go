@@ -0,0 +1,228 @@
+package goffkv_zk
+
+import (
+    "sort"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    defaultExportParallelism = 16
+
+    // Special ephemeral owners of ZooKeeper 3.5+ (see EphemeralType in the server).
+    containerOwner = -0x8000000000000000
+    ttlOwnerMask = -0x100000000000000 // 0xff00000000000000
+)
+
+// What Export records besides keys, values and versions.
+type ExportOptions struct {
+    // Record the ACL of every node.
+    ACLs bool
+    // Record the stat metadata of every node (times and secondary versions).
+    Metadata bool
+    // Nodes read concurrently (pipelined over the connection); defaults to 16.
+    Parallelism int
+}
+
+// How a node was created.
+type NodeKind string
+
+const (
+    NodePersistent NodeKind = ""
+    // Owned by a session (a lease); restored as a lease of the importing client.
+    NodeEphemeral NodeKind = "ephemeral"
+    // Removed by the server once its last child is gone.
+    NodeContainer NodeKind = "container"
+    // Removed by the server once it has been unmodified and childless for TTL.
+    NodeTTL NodeKind = "ttl"
+)
+
+type ExportedACL struct {
+    Scheme string `json:"scheme"`
+    ID string `json:"id"`
+    Perms int32 `json:"perms"`
+}
+
+type ExportedMeta struct {
+    Created time.Time `json:"created"`
+    Modified time.Time `json:"modified"`
+    Cversion int32 `json:"cversion"`
+    Aversion int32 `json:"aversion"`
+    // Session owning an ephemeral node.
+    Owner int64 `json:"owner,omitempty"`
+}
+
+// A subtree as exported. The keys of the nodes are relative to Key: "" for the root, "/a" for
+// its child "a", and so on; parents come before their children.
+type Snapshot struct {
+    Key string `json:"key"`
+    Nodes []ExportedNode `json:"nodes"`
+}
+
+// A node of an export. Ver is translated by the VersionTranslator of the exporting client.
+// Import restores nodes by Multis, which the driver can't make create container and TTL nodes:
+// they are restored as persistent nodes, but their kind is recorded so that the export stays
+// accurate.
+type ExportedNode struct {
+    Key string `json:"key"`
+    Value []byte `json:"value"`
+    Ver uint64 `json:"ver"`
+    Kind NodeKind `json:"kind,omitempty"`
+    TTL time.Duration `json:"ttl,omitempty"`
+    ACL []ExportedACL `json:"acl,omitempty"`
+    Meta *ExportedMeta `json:"meta,omitempty"`
+}
+
+func nodeKind(stat *zkapi.Stat) (NodeKind, time.Duration) {
+    switch {
+    case stat.EphemeralOwner == 0:
+        return NodePersistent, 0
+    case stat.EphemeralOwner == containerOwner:
+        return NodeContainer, 0
+    case stat.EphemeralOwner & ttlOwnerMask == ttlOwnerMask:
+        return NodeTTL, time.Duration(stat.EphemeralOwner &^ ttlOwnerMask) * time.Millisecond
+    default:
+        return NodeEphemeral, 0
+    }
+}
+
+func zkTime(ms int64) time.Time {
+    return time.Unix(0, ms * int64(time.Millisecond))
+}
+
+// Describes the node at path, with the given (decoded) value and stat, as exported for key.
+func (c *Client) exportNode(key string, path string, value []byte, stat *zkapi.Stat, opts ExportOptions) (ExportedNode, error) {
+    result := ExportedNode{
+        Key: key,
+        Value: valueOf(value),
+        Ver: c.ExportVersion(VersionOf(stat)),
+    }
+    result.Kind, result.TTL = nodeKind(stat)
+
+    if opts.ACLs {
+        acl, _, err := c.conn.GetACL(path)
+        if err != nil {
+            return ExportedNode{}, err
+        }
+        for _, entry := range acl {
+            result.ACL = append(result.ACL, ExportedACL{entry.Scheme, entry.ID, entry.Perms})
+        }
+    }
+    if opts.Metadata {
+        result.Meta = &ExportedMeta{
+            Created: zkTime(stat.Ctime),
+            Modified: zkTime(stat.Mtime),
+            Cversion: stat.Cversion,
+            Aversion: stat.Aversion,
+        }
+        if result.Kind == NodeEphemeral {
+            result.Meta.Owner = stat.EphemeralOwner
+        }
+    }
+    return result, nil
+}
+
+// The ACL to restore node with: its own if recorded, the client's otherwise.
+func (c *Client) importACL(node ExportedNode) []zkapi.ACL {
+    if len(node.ACL) == 0 {
+        return c.acl
+    }
+    result := make([]zkapi.ACL, 0, len(node.ACL))
+    for _, entry := range node.ACL {
+        result = append(result, zkapi.ACL{Scheme: entry.Scheme, ID: entry.ID, Perms: entry.Perms})
+    }
+    return result
+}
+
+// The flags to restore node with.
+func importFlags(node ExportedNode) int32 {
+    if node.Kind == NodeEphemeral {
+        return zkapi.FlagEphemeral
+    }
+    return 0
+}
+
+// Export reads the subtree at key (with key itself) into memory; see ExportTo.
+func (c *Client) Export(key string, opts ExportOptions) (Snapshot, error) {
+    result := Snapshot{Key: key, Nodes: []ExportedNode{}}
+    err := c.ExportTo(key, opts, func(node ExportedNode) error {
+        result.Nodes = append(result.Nodes, node)
+        return nil
+    })
+    if err != nil {
+        return Snapshot{}, err
+    }
+    return result, nil
+}
+
+// ExportTo walks the subtree at key level by level and passes every node to fn, parents first and
+// siblings in order, with keys relative to key (see Snapshot). The nodes of a level are read
+// concurrently. Nodes erased during the walk are skipped: the export isn't a point-in-time copy
+// unless the subtree is quiescent (see Freeze). An error of fn stops the walk and is returned.
+func (c *Client) ExportTo(key string, opts ExportOptions, fn func(ExportedNode) error) error {
+    if opts.Parallelism <= 0 {
+        opts.Parallelism = defaultExportParallelism
+    }
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return err
+    }
+    rootPath := c.assemblePath(segments)
+
+    type item struct {
+        node ExportedNode
+        children []string
+        err error
+    }
+
+    level := []string{rootPath}
+    for len(level) != 0 {
+        items := make([]item, len(level))
+        sem := make(chan struct{}, opts.Parallelism)
+        var wg sync.WaitGroup
+        for i, path := range level {
+            wg.Add(1)
+            sem <- struct{}{}
+            go func(i int, path string) {
+                defer wg.Done()
+                defer func() { <-sem }()
+
+                value, stat, err := c.get(path)
+                if err == nil {
+                    items[i].node, err = c.exportNode(path[len(rootPath):], path, value, stat, opts)
+                }
+                if err == nil {
+                    items[i].children, _, err = c.conn.Children(path)
+                }
+                items[i].err = err
+            }(i, path)
+        }
+        wg.Wait()
+
+        next := []string{}
+        for i, it := range items {
+            if it.err == zkapi.ErrNoNode && level[i] != rootPath {
+                continue
+            }
+            if it.err != nil {
+                return KeyError{key + level[i][len(rootPath):], convertError(it.err)}
+            }
+            err = fn(it.node)
+            if err != nil {
+                return err
+            }
+
+            sort.Strings(it.children)
+            for _, child := range it.children {
+                if level[i] == c.assemblePath(nil) && child == reservedSegment {
+                    // Service nodes of the client.
+                    continue
+                }
+                next = append(next, level[i] + "/" + child)
+            }
+        }
+        level = next
+    }
+    return nil
+}
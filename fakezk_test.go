@@ -0,0 +1,1129 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log"
+    "net"
+    "path"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// An in-process, single-member ZooKeeper speaking enough of the wire protocol for the driver:
+// sessions (with expiry), the data operations, multi, watches (restored with setWatches after a
+// reconnection) and the "ruok"/"mntr" four-letter words. Tests drive failures with Disconnect,
+// Stop/Start, Expire and Fail.
+
+const (
+    fzCreate = 1
+    fzDelete = 2
+    fzExists = 3
+    fzGetData = 4
+    fzSetData = 5
+    fzGetAcl = 6
+    fzSetAcl = 7
+    fzGetChildren = 8
+    fzSync = 9
+    fzPing = 11
+    fzGetChildren2 = 12
+    fzCheck = 13
+    fzMulti = 14
+    fzCreateContainer = 19
+    fzCreateTTL = 21
+    fzClose = -11
+    fzSetAuth = 100
+    fzSetWatches = 101
+    fzError = -1
+
+    // Requests above jute.maxbuffer make the server drop the connection.
+    fzMaxPacket = 0xfffff
+)
+
+var fzCodes = map[error]int32{
+    zkapi.ErrAPIError: -100,
+    zkapi.ErrNoNode: -101,
+    zkapi.ErrNoAuth: -102,
+    zkapi.ErrBadVersion: -103,
+    zkapi.ErrNoChildrenForEphemerals: -108,
+    zkapi.ErrNodeExists: -110,
+    zkapi.ErrNotEmpty: -111,
+    zkapi.ErrSessionExpired: -112,
+    zkapi.ErrInvalidACL: -114,
+    zkapi.ErrSessionMoved: -118,
+    zkapi.ErrBadArguments: -8,
+}
+
+// Returned by a Fail hook to drop the connection instead of answering (a lost reply).
+var errFakeDrop = errors.New("drop the connection")
+
+// Fakes a request failure: the hook sees each request before it is applied.
+type fakeHook func(op int32, path string) error
+
+type fakeNode struct {
+    data []byte
+    acl []zkapi.ACL
+    stat zkapi.Stat
+    children map[string]bool
+}
+
+type fakeSession struct {
+    id int64
+    timeout int32
+    conn *fakeConn
+    // Bumped on every disconnection, to expire only sessions that stayed disconnected.
+    generation int
+}
+
+type fakeConn struct {
+    conn net.Conn
+    session *fakeSession
+    dataWatches map[string]bool
+    childWatches map[string]bool
+}
+
+type fakeEvent struct {
+    kind zkapi.EventType
+    path string
+}
+
+type fakeZK struct {
+    t testing.TB
+    addr string
+
+    mu sync.Mutex
+    ln net.Listener
+    zxid int64
+    nodes map[string]*fakeNode
+    sessions map[int64]*fakeSession
+    lastSession int64
+    conns map[*fakeConn]bool
+    hook fakeHook
+    requests map[int32]int
+    // The maximum session timeout granted, in ms; 0 grants any.
+    maxTimeout int32
+}
+
+func newFakeZK(t testing.TB) *fakeZK {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    zk := &fakeZK{
+        t: t,
+        addr: ln.Addr().String(),
+        ln: ln,
+        nodes: make(map[string]*fakeNode),
+        sessions: make(map[int64]*fakeSession),
+        conns: make(map[*fakeConn]bool),
+        requests: make(map[int32]int),
+    }
+    zk.nodes["/"] = &fakeNode{acl: defaultAcl, children: make(map[string]bool)}
+    zk.nodes["/zookeeper"] = &fakeNode{acl: defaultAcl, children: make(map[string]bool)}
+    zk.nodes["/"].children["zookeeper"] = true
+    zk.nodes["/"].stat.NumChildren = 1
+    go zk.serve(ln)
+    return zk
+}
+
+func (zk *fakeZK) Addr() string {
+    return zk.addr
+}
+
+// Close stops the server for good.
+func (zk *fakeZK) Close() {
+    zk.Stop()
+}
+
+// Stop closes the listener and every connection, keeping the data and the sessions.
+func (zk *fakeZK) Stop() {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    if zk.ln != nil {
+        zk.ln.Close()
+        zk.ln = nil
+    }
+    zk.disconnectLocked()
+}
+
+// Start listens again on the same address after Stop.
+func (zk *fakeZK) Start() {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    if zk.ln != nil {
+        return
+    }
+    var (
+        ln net.Listener
+        err error
+    )
+    for attempt := 0; attempt < 50; attempt++ {
+        ln, err = net.Listen("tcp", zk.addr)
+        if err == nil {
+            break
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+    if err != nil {
+        zk.t.Fatal(err)
+    }
+    zk.ln = ln
+    go zk.serve(ln)
+}
+
+// Disconnect drops every connection; clients reconnect to their sessions.
+func (zk *fakeZK) Disconnect() {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    zk.disconnectLocked()
+}
+
+func (zk *fakeZK) disconnectLocked() {
+    for fc := range zk.conns {
+        zk.dropLocked(fc)
+    }
+}
+
+// Expire ends every session, as if their clients stayed away for longer than their timeout.
+func (zk *fakeZK) Expire() {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    for _, s := range zk.sessions {
+        zk.expireLocked(s)
+    }
+}
+
+// Reap runs the server's container manager as of now: it deletes childless TTL nodes left
+// unmodified for longer than their TTL, and containers whose last child is gone.
+func (zk *fakeZK) Reap(now time.Time) {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    var reaped []string
+    for p, node := range zk.nodes {
+        if len(node.children) != 0 {
+            continue
+        }
+        kind, ttl := nodeKind(&node.stat)
+        switch {
+        case kind == NodeTTL && zkTime(node.stat.Mtime).Add(ttl).Before(now):
+        case kind == NodeContainer && node.stat.Cversion > 0:
+        default:
+            continue
+        }
+        reaped = append(reaped, p)
+    }
+    if len(reaped) == 0 {
+        return
+    }
+    zk.zxid++
+    var events []fakeEvent
+    for _, p := range reaped {
+        events = zk.deleteNodeLocked(zk.nodes, p, events)
+    }
+    zk.fireLocked(events)
+}
+
+// LimitTimeout clamps the session timeouts granted to new sessions to max.
+func (zk *fakeZK) LimitTimeout(max time.Duration) {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    zk.maxTimeout = int32(max / time.Millisecond)
+}
+
+// Fail installs hook (nil removes it).
+func (zk *fakeZK) Fail(hook fakeHook) {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    zk.hook = hook
+}
+
+// Requests returns how many requests with opcode the server has received.
+func (zk *fakeZK) Requests(op int32) int {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    return zk.requests[op]
+}
+
+// Node returns the data of the node at path, and whether it exists.
+func (zk *fakeZK) Node(path string) ([]byte, *zkapi.Stat, bool) {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    node, ok := zk.nodes[path]
+    if !ok {
+        return nil, nil, false
+    }
+    stat := node.stat
+    return append([]byte(nil), node.data...), &stat, true
+}
+
+// Put sets the data of the node at path, creating it and its ancestors as needed, without
+// firing watches.
+func (zk *fakeZK) Put(p string, data []byte) {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    zk.PutLocked(p, data)
+}
+
+// PutLocked is Put, for hooks, which run with the server locked.
+func (zk *fakeZK) PutLocked(p string, data []byte) {
+    zk.zxid++
+    if parent := path.Dir(p); parent != p {
+        if _, ok := zk.nodes[parent]; !ok {
+            zk.PutLocked(parent, nil)
+        }
+    }
+    now := time.Now().UnixNano() / int64(time.Millisecond)
+    node, ok := zk.nodes[p]
+    if !ok {
+        node = &fakeNode{acl: defaultAcl, children: make(map[string]bool)}
+        node.stat.Czxid = zk.zxid
+        node.stat.Ctime = now
+        zk.nodes[p] = node
+        parent := zk.nodes[path.Dir(p)]
+        parent.children[path.Base(p)] = true
+        parent.stat.Cversion++
+        parent.stat.NumChildren++
+        parent.stat.Pzxid = zk.zxid
+    } else {
+        node.stat.Version++
+    }
+    node.data = data
+    node.stat.Mzxid = zk.zxid
+    node.stat.Mtime = now
+    node.stat.DataLength = int32(len(data))
+}
+
+// Paths returns the paths of all the nodes under (and including) root.
+func (zk *fakeZK) Paths(root string) []string {
+    zk.mu.Lock()
+    defer zk.mu.Unlock()
+
+    var result []string
+    for p := range zk.nodes {
+        if p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/") + "/") {
+            result = append(result, p)
+        }
+    }
+    return result
+}
+
+func (zk *fakeZK) serve(ln net.Listener) {
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            return
+        }
+        go zk.handle(conn)
+    }
+}
+
+func (zk *fakeZK) dropLocked(fc *fakeConn) {
+    if !zk.conns[fc] {
+        return
+    }
+    delete(zk.conns, fc)
+    fc.conn.Close()
+
+    s := fc.session
+    if s == nil || s.conn != fc {
+        return
+    }
+    s.conn = nil
+    s.generation++
+    generation := s.generation
+    time.AfterFunc(time.Duration(s.timeout) * time.Millisecond, func() {
+        zk.mu.Lock()
+        defer zk.mu.Unlock()
+        if zk.sessions[s.id] == s && s.conn == nil && s.generation == generation {
+            zk.expireLocked(s)
+        }
+    })
+}
+
+func (zk *fakeZK) expireLocked(s *fakeSession) {
+    delete(zk.sessions, s.id)
+    if s.conn != nil {
+        fc := s.conn
+        s.conn = nil
+        zk.dropLocked(fc)
+    }
+
+    var ephemerals []string
+    for p, node := range zk.nodes {
+        if node.stat.EphemeralOwner == s.id {
+            ephemerals = append(ephemerals, p)
+        }
+    }
+    if len(ephemerals) == 0 {
+        return
+    }
+    zk.zxid++
+    var events []fakeEvent
+    for _, p := range ephemerals {
+        events = zk.deleteNodeLocked(zk.nodes, p, events)
+    }
+    zk.fireLocked(events)
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+    var header [4]byte
+    _, err := io.ReadFull(r, header[:])
+    if err != nil {
+        return nil, err
+    }
+    n := binary.BigEndian.Uint32(header[:])
+    if n > fzMaxPacket {
+        return nil, fmt.Errorf("packet of %d bytes", n)
+    }
+    buf := make([]byte, n)
+    _, err = io.ReadFull(r, buf)
+    return buf, err
+}
+
+func (zk *fakeZK) writeLocked(fc *fakeConn, values ...interface{}) {
+    var buf bytes.Buffer
+    buf.Write([]byte{0, 0, 0, 0})
+    for _, v := range values {
+        juteEncode(&buf, reflect.ValueOf(v))
+    }
+    packet := buf.Bytes()
+    binary.BigEndian.PutUint32(packet, uint32(len(packet) - 4))
+    fc.conn.SetWriteDeadline(time.Now().Add(time.Second))
+    _, err := fc.conn.Write(packet)
+    if err != nil {
+        zk.dropLocked(fc)
+    }
+}
+
+func (zk *fakeZK) handle(conn net.Conn) {
+    var first [4]byte
+    _, err := io.ReadFull(conn, first[:])
+    if err != nil {
+        conn.Close()
+        return
+    }
+    if word := string(first[:]); word == "ruok" || word == "mntr" || word == "srvr" {
+        zk.fourLetterWord(conn, word)
+        return
+    }
+
+    n := binary.BigEndian.Uint32(first[:])
+    if n > fzMaxPacket {
+        conn.Close()
+        return
+    }
+    buf := make([]byte, n)
+    _, err = io.ReadFull(conn, buf)
+    if err != nil {
+        conn.Close()
+        return
+    }
+    var req struct {
+        ProtocolVersion int32
+        LastZxidSeen int64
+        TimeOut int32
+        SessionID int64
+        Passwd []byte
+    }
+    juteDecode(bytes.NewReader(buf), reflect.ValueOf(&req))
+
+    zk.mu.Lock()
+    fc := &fakeConn{
+        conn: conn,
+        dataWatches: make(map[string]bool),
+        childWatches: make(map[string]bool),
+    }
+    zk.conns[fc] = true
+    var s *fakeSession
+    if req.SessionID == 0 {
+        zk.lastSession++
+        s = &fakeSession{id: zk.lastSession, timeout: req.TimeOut}
+        if zk.maxTimeout != 0 && s.timeout > zk.maxTimeout {
+            s.timeout = zk.maxTimeout
+        }
+        zk.sessions[s.id] = s
+    } else {
+        s = zk.sessions[req.SessionID]
+    }
+    if s == nil {
+        // Expired: the driver starts over with a new session.
+        zk.writeLocked(fc, int32(0), int32(0), int64(0), make([]byte, 16))
+        zk.dropLocked(fc)
+        zk.mu.Unlock()
+        return
+    }
+    if s.conn != nil {
+        zk.dropLocked(s.conn)
+    }
+    s.conn = fc
+    fc.session = s
+    zk.writeLocked(fc, int32(0), s.timeout, s.id, make([]byte, 16))
+    zk.mu.Unlock()
+
+    for {
+        packet, err := readPacket(conn)
+        zk.mu.Lock()
+        if err != nil || !zk.conns[fc] {
+            zk.dropLocked(fc)
+            zk.mu.Unlock()
+            return
+        }
+        zk.requestLocked(fc, packet)
+        zk.mu.Unlock()
+    }
+}
+
+func (zk *fakeZK) fourLetterWord(conn net.Conn, word string) {
+    defer conn.Close()
+
+    zk.mu.Lock()
+    nodes := len(zk.nodes)
+    connections := len(zk.conns)
+    zk.mu.Unlock()
+
+    switch word {
+    case "ruok":
+        io.WriteString(conn, "imok")
+    case "mntr":
+        fmt.Fprintf(conn, "zk_version\t3.5.6-fake\nzk_server_state\tstandalone\n" +
+            "zk_avg_latency\t0.5\nzk_num_alive_connections\t%d\nzk_znode_count\t%d\n", connections, nodes)
+    case "srvr":
+        fmt.Fprintf(conn, "Zookeeper version: 3.5.6-fake\nMode: standalone\nNode count: %d\n", nodes)
+    }
+}
+
+func (zk *fakeZK) requestLocked(fc *fakeConn, packet []byte) {
+    r := bytes.NewReader(packet)
+    var header struct {
+        Xid int32
+        Opcode int32
+    }
+    juteDecode(r, reflect.ValueOf(&header))
+    zk.requests[header.Opcode]++
+
+    reply := func(err error, body ...interface{}) {
+        code := int32(0)
+        if err != nil {
+            var ok bool
+            code, ok = fzCodes[err]
+            if !ok {
+                code = fzCodes[zkapi.ErrAPIError]
+            }
+            body = nil
+        }
+        zk.writeLocked(fc, append([]interface{}{header.Xid, zk.zxid, code}, body...)...)
+    }
+
+    var path string
+    var request interface{}
+    switch header.Opcode {
+    case fzCreate, fzCreateContainer:
+        request = &zkapi.CreateRequest{}
+    case fzCreateTTL:
+        request = &zkapi.CreateTTLRequest{}
+    case fzDelete:
+        request = &zkapi.DeleteRequest{}
+    case fzSetData:
+        request = &zkapi.SetDataRequest{}
+    case fzCheck:
+        request = &zkapi.CheckVersionRequest{}
+    case fzExists, fzGetData, fzGetChildren, fzGetChildren2:
+        request = &struct {
+            Path string
+            Watch bool
+        }{}
+    case fzGetAcl, fzSync:
+        request = &struct {
+            Path string
+        }{}
+    case fzSetAcl:
+        request = &struct {
+            Path string
+            Acl []zkapi.ACL
+            Version int32
+        }{}
+    }
+    if request != nil {
+        juteDecode(r, reflect.ValueOf(request))
+        path = reflect.ValueOf(request).Elem().FieldByName("Path").String()
+    }
+
+    if zk.hook != nil && header.Opcode != fzPing && header.Opcode != fzClose {
+        if err := zk.hook(header.Opcode, path); err == errFakeDrop {
+            zk.dropLocked(fc)
+            return
+        } else if err != nil {
+            reply(err)
+            return
+        }
+    }
+
+    switch header.Opcode {
+    case fzPing, fzSetAuth:
+        reply(nil)
+
+    case fzClose:
+        reply(nil)
+        zk.expireLocked(fc.session)
+
+    case fzSync:
+        reply(nil, path)
+
+    case fzSetWatches:
+        var req struct {
+            RelativeZxid int64
+            DataWatches []string
+            ExistWatches []string
+            ChildWatches []string
+        }
+        juteDecode(r, reflect.ValueOf(&req))
+        zk.setWatchesLocked(fc, req.RelativeZxid, req.DataWatches, req.ExistWatches, req.ChildWatches)
+        reply(nil)
+
+    case fzExists:
+        node, ok := zk.nodes[path]
+        if request.(*struct{Path string; Watch bool}).Watch {
+            fc.dataWatches[path] = true
+        }
+        if !ok {
+            reply(zkapi.ErrNoNode)
+            return
+        }
+        reply(nil, node.stat)
+
+    case fzGetData:
+        node, ok := zk.nodes[path]
+        if !ok {
+            reply(zkapi.ErrNoNode)
+            return
+        }
+        if !allows(node.acl, zkapi.PermRead) {
+            reply(zkapi.ErrNoAuth)
+            return
+        }
+        if request.(*struct{Path string; Watch bool}).Watch {
+            fc.dataWatches[path] = true
+        }
+        reply(nil, node.data, node.stat)
+
+    case fzGetChildren, fzGetChildren2:
+        node, ok := zk.nodes[path]
+        if !ok {
+            reply(zkapi.ErrNoNode)
+            return
+        }
+        if request.(*struct{Path string; Watch bool}).Watch {
+            fc.childWatches[path] = true
+        }
+        children := make([]string, 0, len(node.children))
+        for child := range node.children {
+            children = append(children, child)
+        }
+        if header.Opcode == fzGetChildren {
+            reply(nil, children)
+        } else {
+            reply(nil, children, node.stat)
+        }
+
+    case fzGetAcl:
+        node, ok := zk.nodes[path]
+        if !ok {
+            reply(zkapi.ErrNoNode)
+            return
+        }
+        reply(nil, node.acl, node.stat)
+
+    case fzSetAcl:
+        req := request.(*struct{Path string; Acl []zkapi.ACL; Version int32})
+        node, ok := zk.nodes[path]
+        switch {
+        case !ok:
+            reply(zkapi.ErrNoNode)
+        case req.Version != -1 && req.Version != node.stat.Aversion:
+            reply(zkapi.ErrBadVersion)
+        default:
+            zk.zxid++
+            node.acl = req.Acl
+            node.stat.Aversion++
+            reply(nil, node.stat)
+        }
+
+    case fzCreate, fzCreateContainer, fzCreateTTL, fzDelete, fzSetData, fzCheck:
+        nodes := zk.nodes
+        result, events, err := zk.applyLocked(fc.session, nodes, header.Opcode, request)
+        if err != nil {
+            reply(err)
+            return
+        }
+        zk.fireLocked(events)
+        reply(nil, result...)
+
+    case fzMulti:
+        zk.multiLocked(fc, r, reply)
+
+    default:
+        reply(zkapi.ErrAPIError)
+    }
+}
+
+func allows(acl []zkapi.ACL, perm int32) bool {
+    for _, entry := range acl {
+        if entry.Perms & perm != 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// Applies a write to nodes; the zxid of the write must already be allocated.
+func (zk *fakeZK) applyLocked(s *fakeSession, nodes map[string]*fakeNode, op int32, request interface{}) ([]interface{}, []fakeEvent, error) {
+    now := time.Now().UnixNano() / int64(time.Millisecond)
+    if op != fzCheck {
+        zk.zxid++
+    }
+
+    switch op {
+    case fzCreateTTL:
+        req := request.(*zkapi.CreateTTLRequest)
+        if req.Ttl <= 0 || req.Flags != zkapi.FlagTTL && req.Flags != zkapi.FlagPersistentSequentialWithTTL {
+            return nil, nil, zkapi.ErrBadArguments
+        }
+        result, events, err := zk.applyLocked(s, nodes, fzCreate, &zkapi.CreateRequest{Path: req.Path, Data: req.Data, Acl: req.Acl, Flags: req.Flags})
+        if err == nil {
+            nodes[result[0].(string)].stat.EphemeralOwner = ttlOwnerMask | req.Ttl
+        }
+        return result, events, err
+
+    case fzCreateContainer:
+        req := request.(*zkapi.CreateRequest)
+        if req.Flags != zkapi.FlagContainer {
+            return nil, nil, zkapi.ErrBadArguments
+        }
+        result, events, err := zk.applyLocked(s, nodes, fzCreate, &zkapi.CreateRequest{Path: req.Path, Data: req.Data, Acl: req.Acl})
+        if err == nil {
+            nodes[result[0].(string)].stat.EphemeralOwner = containerOwner
+        }
+        return result, events, err
+
+    case fzCreate:
+        req := request.(*zkapi.CreateRequest)
+        parentPath := path.Dir(req.Path)
+        parent, ok := nodes[parentPath]
+        if !ok || req.Path == "/" || !strings.HasPrefix(req.Path, "/") {
+            return nil, nil, zkapi.ErrNoNode
+        }
+        if kind, _ := nodeKind(&parent.stat); kind == NodeEphemeral {
+            return nil, nil, zkapi.ErrNoChildrenForEphemerals
+        }
+        if !allows(parent.acl, zkapi.PermCreate) {
+            return nil, nil, zkapi.ErrNoAuth
+        }
+        if len(req.Acl) == 0 {
+            return nil, nil, zkapi.ErrInvalidACL
+        }
+        p := req.Path
+        if req.Flags == zkapi.FlagSequence || req.Flags == zkapi.FlagEphemeralSequential || req.Flags == zkapi.FlagPersistentSequentialWithTTL {
+            p += fmt.Sprintf("%010d", parent.stat.Cversion)
+        }
+        if _, exists := nodes[p]; exists {
+            return nil, nil, zkapi.ErrNodeExists
+        }
+        node := &fakeNode{
+            data: req.Data,
+            acl: req.Acl,
+            children: make(map[string]bool),
+        }
+        node.stat.Czxid = zk.zxid
+        node.stat.Mzxid = zk.zxid
+        node.stat.Pzxid = zk.zxid
+        node.stat.Ctime = now
+        node.stat.Mtime = now
+        node.stat.DataLength = int32(len(req.Data))
+        if req.Flags == zkapi.FlagEphemeral || req.Flags == zkapi.FlagEphemeralSequential {
+            node.stat.EphemeralOwner = s.id
+        }
+        nodes[p] = node
+        parent.children[path.Base(p)] = true
+        parent.stat.Cversion++
+        parent.stat.NumChildren++
+        parent.stat.Pzxid = zk.zxid
+        return []interface{}{p}, []fakeEvent{{zkapi.EventNodeCreated, p}, {zkapi.EventNodeChildrenChanged, parentPath}}, nil
+
+    case fzDelete:
+        req := request.(*zkapi.DeleteRequest)
+        node, ok := nodes[req.Path]
+        switch {
+        case !ok:
+            return nil, nil, zkapi.ErrNoNode
+        case req.Version != -1 && req.Version != node.stat.Version:
+            return nil, nil, zkapi.ErrBadVersion
+        case len(node.children) > 0:
+            return nil, nil, zkapi.ErrNotEmpty
+        }
+        return nil, zk.deleteNodeLocked(nodes, req.Path, nil), nil
+
+    case fzSetData:
+        req := request.(*zkapi.SetDataRequest)
+        node, ok := nodes[req.Path]
+        switch {
+        case !ok:
+            return nil, nil, zkapi.ErrNoNode
+        case req.Version != -1 && req.Version != node.stat.Version:
+            return nil, nil, zkapi.ErrBadVersion
+        case !allows(node.acl, zkapi.PermWrite):
+            return nil, nil, zkapi.ErrNoAuth
+        }
+        node.data = req.Data
+        node.stat.Version++
+        node.stat.Mzxid = zk.zxid
+        node.stat.Mtime = now
+        node.stat.DataLength = int32(len(req.Data))
+        return []interface{}{node.stat}, []fakeEvent{{zkapi.EventNodeDataChanged, req.Path}}, nil
+
+    case fzCheck:
+        req := request.(*zkapi.CheckVersionRequest)
+        node, ok := nodes[req.Path]
+        switch {
+        case !ok:
+            return nil, nil, zkapi.ErrNoNode
+        case req.Version != -1 && req.Version != node.stat.Version:
+            return nil, nil, zkapi.ErrBadVersion
+        }
+        return nil, nil, nil
+    }
+    return nil, nil, zkapi.ErrAPIError
+}
+
+func (zk *fakeZK) deleteNodeLocked(nodes map[string]*fakeNode, p string, events []fakeEvent) []fakeEvent {
+    delete(nodes, p)
+    parentPath := path.Dir(p)
+    if parent, ok := nodes[parentPath]; ok {
+        delete(parent.children, path.Base(p))
+        parent.stat.Cversion++
+        parent.stat.NumChildren--
+        parent.stat.Pzxid = zk.zxid
+    }
+    return append(events, fakeEvent{zkapi.EventNodeDeleted, p}, fakeEvent{zkapi.EventNodeChildrenChanged, parentPath})
+}
+
+func cloneNodes(nodes map[string]*fakeNode) map[string]*fakeNode {
+    result := make(map[string]*fakeNode, len(nodes))
+    for p, node := range nodes {
+        clone := *node
+        clone.children = make(map[string]bool, len(node.children))
+        for child := range node.children {
+            clone.children[child] = true
+        }
+        result[p] = &clone
+    }
+    return result
+}
+
+func (zk *fakeZK) multiLocked(fc *fakeConn, r io.Reader, reply func(error, ...interface{})) {
+    type multiHeader struct {
+        Type int32
+        Done bool
+        Err int32
+    }
+    var (
+        ops []int32
+        requests []interface{}
+    )
+    for {
+        var header multiHeader
+        juteDecode(r, reflect.ValueOf(&header))
+        if header.Done {
+            break
+        }
+        var request interface{}
+        switch header.Type {
+        case fzCreate:
+            request = &zkapi.CreateRequest{}
+        case fzDelete:
+            request = &zkapi.DeleteRequest{}
+        case fzSetData:
+            request = &zkapi.SetDataRequest{}
+        case fzCheck:
+            request = &zkapi.CheckVersionRequest{}
+        default:
+            reply(zkapi.ErrAPIError)
+            return
+        }
+        juteDecode(r, reflect.ValueOf(request))
+        ops = append(ops, header.Type)
+        requests = append(requests, request)
+    }
+
+    if zk.hook != nil {
+        for _, request := range requests {
+            err := zk.hook(fzMulti, reflect.ValueOf(request).Elem().FieldByName("Path").String())
+            if err == errFakeDrop {
+                zk.dropLocked(fc)
+                return
+            } else if err != nil {
+                reply(err)
+                return
+            }
+        }
+    }
+
+    // All the operations of a multi share a zxid.
+    zxid := zk.zxid
+    nodes := cloneNodes(zk.nodes)
+    var (
+        results [][]interface{}
+        events []fakeEvent
+        failed = -1
+        failure error
+    )
+    for i, op := range ops {
+        zk.zxid = zxid
+        result, opEvents, err := zk.applyLocked(fc.session, nodes, op, requests[i])
+        if err != nil {
+            failed = i
+            failure = err
+            break
+        }
+        results = append(results, result)
+        events = append(events, opEvents...)
+    }
+
+    var body []interface{}
+    if failed >= 0 {
+        zk.zxid = zxid
+        for i := range ops {
+            code := int32(0)
+            switch {
+            case i == failed:
+                code = fzCodes[failure]
+            case i > failed:
+                // Runtime inconsistency: not attempted.
+                code = -2
+            }
+            body = append(body, multiHeader{fzError, false, code}, code)
+        }
+    } else {
+        zk.zxid = zxid + 1
+        zk.nodes = nodes
+        for i, op := range ops {
+            body = append(body, multiHeader{op, false, 0})
+            body = append(body, results[i]...)
+        }
+        zk.fireLocked(events)
+    }
+    body = append(body, multiHeader{-1, true, -1})
+    reply(nil, body...)
+}
+
+func (zk *fakeZK) fireLocked(events []fakeEvent) {
+    for _, event := range events {
+        for fc := range zk.conns {
+            var fire bool
+            switch event.kind {
+            case zkapi.EventNodeCreated, zkapi.EventNodeDataChanged:
+                fire = fc.dataWatches[event.path]
+                delete(fc.dataWatches, event.path)
+            case zkapi.EventNodeDeleted:
+                fire = fc.dataWatches[event.path] || fc.childWatches[event.path]
+                delete(fc.dataWatches, event.path)
+                delete(fc.childWatches, event.path)
+            case zkapi.EventNodeChildrenChanged:
+                fire = fc.childWatches[event.path]
+                delete(fc.childWatches, event.path)
+            }
+            if fire {
+                zk.notifyLocked(fc, event)
+            }
+        }
+    }
+}
+
+func (zk *fakeZK) notifyLocked(fc *fakeConn, event fakeEvent) {
+    // State 3 is SyncConnected.
+    zk.writeLocked(fc, int32(-1), zk.zxid, int32(0), int32(event.kind), int32(3), event.path)
+}
+
+func (zk *fakeZK) setWatchesLocked(fc *fakeConn, relativeZxid int64, data []string, exist []string, child []string) {
+    for _, p := range data {
+        node, ok := zk.nodes[p]
+        switch {
+        case !ok:
+            zk.notifyLocked(fc, fakeEvent{zkapi.EventNodeDeleted, p})
+        case node.stat.Mzxid > relativeZxid:
+            zk.notifyLocked(fc, fakeEvent{zkapi.EventNodeDataChanged, p})
+        default:
+            fc.dataWatches[p] = true
+        }
+    }
+    for _, p := range exist {
+        if _, ok := zk.nodes[p]; ok {
+            zk.notifyLocked(fc, fakeEvent{zkapi.EventNodeCreated, p})
+        } else {
+            fc.dataWatches[p] = true
+        }
+    }
+    for _, p := range child {
+        node, ok := zk.nodes[p]
+        switch {
+        case !ok:
+            zk.notifyLocked(fc, fakeEvent{zkapi.EventNodeDeleted, p})
+        case node.stat.Pzxid > relativeZxid:
+            zk.notifyLocked(fc, fakeEvent{zkapi.EventNodeChildrenChanged, p})
+        default:
+            fc.childWatches[p] = true
+        }
+    }
+}
+
+// Jute, the serialization of ZooKeeper: big-endian integers, length-prefixed strings, buffers
+// (-1 for nil) and vectors, and structs as their fields in order.
+
+func juteEncode(buf *bytes.Buffer, v reflect.Value) {
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        juteEncode(buf, v.Elem())
+    case reflect.Bool:
+        if v.Bool() {
+            buf.WriteByte(1)
+        } else {
+            buf.WriteByte(0)
+        }
+    case reflect.Int32:
+        binary.Write(buf, binary.BigEndian, int32(v.Int()))
+    case reflect.Int64:
+        binary.Write(buf, binary.BigEndian, v.Int())
+    case reflect.String:
+        binary.Write(buf, binary.BigEndian, int32(v.Len()))
+        buf.WriteString(v.String())
+    case reflect.Slice:
+        if v.Type().Elem().Kind() == reflect.Uint8 {
+            if v.IsNil() {
+                binary.Write(buf, binary.BigEndian, int32(-1))
+                return
+            }
+            binary.Write(buf, binary.BigEndian, int32(v.Len()))
+            buf.Write(v.Bytes())
+            return
+        }
+        binary.Write(buf, binary.BigEndian, int32(v.Len()))
+        for i := 0; i < v.Len(); i++ {
+            juteEncode(buf, v.Index(i))
+        }
+    case reflect.Struct:
+        for i := 0; i < v.NumField(); i++ {
+            juteEncode(buf, v.Field(i))
+        }
+    default:
+        panic("jute: can't encode " + v.Type().String())
+    }
+}
+
+func juteDecode(r io.Reader, v reflect.Value) {
+    readInt32 := func() int32 {
+        var n int32
+        binary.Read(r, binary.BigEndian, &n)
+        return n
+    }
+
+    switch v.Kind() {
+    case reflect.Ptr:
+        juteDecode(r, v.Elem())
+    case reflect.Bool:
+        var b [1]byte
+        r.Read(b[:])
+        v.SetBool(b[0] != 0)
+    case reflect.Int32:
+        v.SetInt(int64(readInt32()))
+    case reflect.Int64:
+        var n int64
+        binary.Read(r, binary.BigEndian, &n)
+        v.SetInt(n)
+    case reflect.String:
+        b := make([]byte, readInt32())
+        io.ReadFull(r, b)
+        v.SetString(string(b))
+    case reflect.Slice:
+        n := readInt32()
+        if v.Type().Elem().Kind() == reflect.Uint8 {
+            if n < 0 {
+                v.SetBytes(nil)
+                return
+            }
+            b := make([]byte, n)
+            io.ReadFull(r, b)
+            v.SetBytes(b)
+            return
+        }
+        if n < 0 {
+            n = 0
+        }
+        slice := reflect.MakeSlice(v.Type(), int(n), int(n))
+        for i := 0; i < int(n); i++ {
+            juteDecode(r, slice.Index(i))
+        }
+        v.Set(slice)
+    case reflect.Struct:
+        for i := 0; i < v.NumField(); i++ {
+            juteDecode(r, v.Field(i))
+        }
+    default:
+        panic("jute: can't decode " + v.Type().String())
+    }
+}
+
+var quietLogger = log.New(ioutil.Discard, "", 0)
+
+// Connects a client to zk under the prefix "/test"; close it when done.
+func newTestClient(t testing.TB, zk *fakeZK, opts ...Option) *Client {
+    opts = append([]Option{WithLogger(quietLogger)}, opts...)
+    c, err := Connect(zk.Addr(), "/test", opts...)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+// Polls cond for up to five seconds.
+func eventually(t testing.TB, what string, cond func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for !cond() {
+        if time.Now().After(deadline) {
+            t.Fatalf("timed out waiting for %s", what)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// Tells whether w returns within timeout.
+func fired(w func(), timeout time.Duration) bool {
+    done := make(chan struct{})
+    go func() {
+        w()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return true
+    case <-time.After(timeout):
+        return false
+    }
+}
@@ -0,0 +1,404 @@
+package goffkv_zk
+
+import (
+    "bufio"
+    "bytes"
+    "container/list"
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    fallbackFlushInterval = time.Second
+    defaultFallbackEntries = 10000
+)
+
+// A value read by GetEntry. Stale entries come from the fallback cache and may be outdated.
+// The value of an existing key is never nil, even if empty; the zero Entry stands for a missing key.
+type Entry struct {
+    Ver goffkv.Version `json:"ver"`
+    Value []byte `json:"value"`
+    FetchedAt time.Time `json:"fetched_at"`
+    Stale bool `json:"-"`
+}
+
+// How long ago the entry was read from the ensemble.
+func (e Entry) Age() time.Duration {
+    return time.Since(e.FetchedAt)
+}
+
+// A line of the file of the fallback cache.
+type fallbackRecord struct {
+    Key string `json:"key"`
+    Entry
+    Erased bool `json:"erased,omitempty"`
+}
+
+type fallbackItem struct {
+    key string
+    entry Entry
+}
+
+// Last known values of up to maxEntries keys, the least recently read ones evicted first.
+// They are persisted (if file is set) so that they survive restarts during an outage: changes
+// are appended to the file as a journal of JSON lines, which is rewritten once it holds twice as
+// many records as the cache. Values are sealed with seal (if set) in the file, and opened on load.
+type fallbackCache struct {
+    file string
+    seal Codec
+    open func(data []byte) ([]byte, error)
+    // Serve entries up to this old without waiting while disconnected; 0 disables.
+    maxStaleness time.Duration
+    maxEntries int
+
+    mu sync.Mutex
+    entries map[string]*list.Element
+    // Of *fallbackItem, most recently read first.
+    lru *list.List
+    // Records not yet appended to file.
+    pending []fallbackRecord
+    // Records in file.
+    records int
+
+    // Serializes writes to file.
+    flushMu sync.Mutex
+}
+
+func newFallbackCache() *fallbackCache {
+    return &fallbackCache{
+        maxEntries: defaultFallbackEntries,
+        entries: make(map[string]*list.Element),
+        lru: list.New(),
+    }
+}
+
+// WithFallbackCache makes Get serve the last known value of a key from file when the
+// ensemble cannot be reached at all. Use GetEntry to tell such stale values apart. The file is
+// created readable by its owner only; with WithEncryption, the values in it are encrypted too.
+func WithFallbackCache(file string) Option {
+    return func(c *Client) {
+        if c.fallback == nil {
+            c.fallback = newFallbackCache()
+        }
+        c.fallback.file = file
+    }
+}
+
+// WithStaleReads makes Get and GetEntry answer from the last known values while the session
+// is disconnected, instead of blocking until it is restored, as long as the cached value is
+// at most maxStaleness old. Combine with WithFallbackCache to keep the values across restarts.
+func WithStaleReads(maxStaleness time.Duration) Option {
+    return func(c *Client) {
+        if c.fallback == nil {
+            c.fallback = newFallbackCache()
+        }
+        c.fallback.maxStaleness = maxStaleness
+    }
+}
+
+// WithFallbackEntries bounds the number of keys of the fallback cache (see WithFallbackCache and
+// WithStaleReads), 10000 by default; the least recently read ones are evicted first.
+func WithFallbackEntries(n int) Option {
+    return func(c *Client) {
+        if c.fallback == nil {
+            c.fallback = newFallbackCache()
+        }
+        if n > 0 {
+            c.fallback.maxEntries = n
+        }
+    }
+}
+
+func isUnreachable(err error) bool {
+    return errors.Is(err, zkapi.ErrNoServer) ||
+        errors.Is(err, zkapi.ErrConnectionClosed) ||
+        errors.Is(err, zkapi.ErrSessionExpired)
+}
+
+func (f *fallbackCache) load() error {
+    if f.file == "" {
+        return nil
+    }
+    file, err := os.Open(f.file)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    r := bufio.NewReader(file)
+    for {
+        line, err := r.ReadBytes('\n')
+        if len(line) != 0 {
+            f.records++
+            var record fallbackRecord
+            switch {
+            case json.Unmarshal(line, &record) != nil || record.Key == "":
+                // Torn by a crash while appending.
+            case record.Erased:
+                f.removeLocked(record.Key)
+            default:
+                value, err := f.openValue(record.Value)
+                if err != nil {
+                    // E.g. sealed with a key that has been retired since.
+                    f.removeLocked(record.Key)
+                    break
+                }
+                f.putLocked(record.Key, Entry{Ver: record.Ver, Value: valueOf(value), FetchedAt: record.FetchedAt})
+            }
+        }
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// Stores entry as the most recently read one, evicting the least recently read one if needed.
+// Called with mu held.
+func (f *fallbackCache) putLocked(key string, entry Entry) {
+    if e, ok := f.entries[key]; ok {
+        e.Value.(*fallbackItem).entry = entry
+        f.lru.MoveToFront(e)
+        return
+    }
+    f.entries[key] = f.lru.PushFront(&fallbackItem{key, entry})
+    if f.lru.Len() > f.maxEntries {
+        oldest := f.lru.Remove(f.lru.Back()).(*fallbackItem)
+        delete(f.entries, oldest.key)
+        f.pending = append(f.pending, fallbackRecord{Key: oldest.key, Erased: true})
+    }
+}
+
+// Called with mu held.
+func (f *fallbackCache) removeLocked(key string) bool {
+    e, ok := f.entries[key]
+    if ok {
+        f.lru.Remove(e)
+        delete(f.entries, key)
+    }
+    return ok
+}
+
+func (f *fallbackCache) lookup(key string) (Entry, bool) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    e, ok := f.entries[key]
+    if !ok {
+        return Entry{}, false
+    }
+    return e.Value.(*fallbackItem).entry, true
+}
+
+// Appends the pending records to file, or rewrites it if it has grown too much.
+func (f *fallbackCache) flush() {
+    if f.file == "" {
+        return
+    }
+    f.flushMu.Lock()
+    defer f.flushMu.Unlock()
+
+    f.mu.Lock()
+    if len(f.pending) == 0 {
+        f.mu.Unlock()
+        return
+    }
+    records := f.pending
+    compact := f.records + len(records) > 2 * f.maxEntries
+    if compact {
+        records = make([]fallbackRecord, 0, f.lru.Len())
+        for e := f.lru.Back(); e != nil; e = e.Prev() {
+            item := e.Value.(*fallbackItem)
+            records = append(records, fallbackRecord{Key: item.key, Entry: item.entry})
+        }
+        f.records = len(records)
+    } else {
+        f.records += len(records)
+    }
+    f.pending = nil
+    f.mu.Unlock()
+
+    var data bytes.Buffer
+    encoder := json.NewEncoder(&data)
+    for _, record := range records {
+        if !record.Erased && f.seal != nil {
+            sealed, err := encodeWith(f.seal, record.Value)
+            if err != nil {
+                continue
+            }
+            record.Value = sealed
+        }
+        if encoder.Encode(record) != nil {
+            return
+        }
+    }
+    if compact {
+        f.rewrite(data.Bytes())
+    } else {
+        f.append(data.Bytes())
+    }
+}
+
+func (f *fallbackCache) append(data []byte) {
+    file, err := os.OpenFile(f.file, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0600)
+    if err != nil {
+        return
+    }
+    file.Write(data)
+    file.Close()
+}
+
+func (f *fallbackCache) rewrite(data []byte) {
+    tmp, err := ioutil.TempFile(filepath.Dir(f.file), filepath.Base(f.file) + ".*")
+    if err != nil {
+        return
+    }
+    _, err = tmp.Write(data)
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(tmp.Name(), f.file)
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+    }
+}
+
+func (f *fallbackCache) openValue(data []byte) ([]byte, error) {
+    if f.open == nil {
+        return data, nil
+    }
+    return f.open(data)
+}
+
+// Records the value of key just read. Only new versions are journaled: the time they were read
+// at is refreshed in memory only.
+func (f *fallbackCache) store(key string, ver goffkv.Version, value []byte) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    entry := Entry{
+        Ver: ver,
+        Value: value,
+        FetchedAt: time.Now(),
+    }
+    e, known := f.entries[key]
+    if !known || e.Value.(*fallbackItem).entry.Ver != ver {
+        f.pending = append(f.pending, fallbackRecord{Key: key, Entry: entry})
+    }
+    f.putLocked(key, entry)
+}
+
+func (f *fallbackCache) forget(key string) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    if f.removeLocked(key) {
+        f.pending = append(f.pending, fallbackRecord{Key: key, Erased: true})
+    }
+}
+
+func (c *Client) flushFallback() {
+    ticker := time.NewTicker(fallbackFlushInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            c.fallback.flush()
+        case <-c.done:
+            return
+        }
+    }
+}
+
+// Returns the cached entry for key if err means that the ensemble is unreachable.
+func (c *Client) fallbackFor(key string, err error) (Entry, bool) {
+    if c.fallback == nil {
+        return Entry{}, false
+    }
+    if err == zkapi.ErrNoNode {
+        c.fallback.forget(key)
+        return Entry{}, false
+    }
+    if !isUnreachable(err) {
+        return Entry{}, false
+    }
+
+    entry, ok := c.fallback.lookup(key)
+    entry.Stale = true
+    return entry, ok
+}
+
+// Returns the cached entry for key if the session is disconnected and stale reads allow it.
+func (c *Client) staleRead(key string) (Entry, bool) {
+    if c.fallback == nil || c.fallback.maxStaleness == 0 || c.conn.State() == zkapi.StateHasSession {
+        return Entry{}, false
+    }
+
+    entry, ok := c.fallback.lookup(key)
+    if !ok || entry.Age() > c.fallback.maxStaleness {
+        return Entry{}, false
+    }
+    entry.Stale = true
+    return entry, true
+}
+
+// GetEntry works like Get without a watch, but tells whether the value came from the fallback cache.
+func (c *Client) GetEntry(key string) (entry Entry, err error) {
+    defer c.recoverPanic("get", key, &err)
+    start := time.Now()
+    err = c.retry(context.Background(), false, func() error {
+        entry, err = c.getEntryOnce(key)
+        return err
+    })
+    err = c.wrapError("get", key, err)
+    c.observe("get", key, start, err)
+    return
+}
+
+func (c *Client) getEntryOnce(key string) (Entry, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return Entry{}, err
+    }
+
+    if entry, ok := c.staleRead(key); ok {
+        return entry, nil
+    }
+    result, stat, err := c.get(c.assemblePath(segments))
+    if err != nil {
+        if entry, ok := c.fallbackFor(key, err); ok {
+            return entry, nil
+        }
+        return Entry{}, convertError(err)
+    }
+
+    ver := VersionOf(stat)
+    if c.fallback != nil {
+        c.fallback.store(key, ver, result)
+    }
+    return Entry{
+        Ver: ver,
+        Value: valueOf(result),
+        FetchedAt: time.Now(),
+    }, nil
+}
@@ -0,0 +1,185 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func fallbackLines(t *testing.T, file string) int {
+    data, err := ioutil.ReadFile(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return bytes.Count(data, []byte("\n"))
+}
+
+func TestFallbackCacheJournal(t *testing.T) {
+    dir, err := ioutil.TempDir("", "fallback")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    f := newFallbackCache()
+    f.file = filepath.Join(dir, "cache")
+    f.maxEntries = 3
+    f.store("/a", 1, []byte("a"))
+    f.flush()
+    if n := fallbackLines(t, f.file); n != 1 {
+        t.Fatalf("%d lines after one store", n)
+    }
+
+    // Reads of an unchanged version aren't written; new ones are appended.
+    f.store("/a", 1, []byte("a"))
+    f.flush()
+    if n := fallbackLines(t, f.file); n != 1 {
+        t.Errorf("%d lines after reading the same version again", n)
+    }
+    f.store("/b", 1, []byte("b"))
+    f.forget("/a")
+    f.flush()
+    if n := fallbackLines(t, f.file); n != 3 {
+        t.Errorf("%d lines after a store and an erase, want 3 appended", n)
+    }
+
+    // The journal is rewritten once it outgrows the cache.
+    for i := 0; i < 4; i++ {
+        f.store("/c", uint64(i + 1), []byte(fmt.Sprint(i)))
+    }
+    f.flush()
+    if n := fallbackLines(t, f.file); n != 2 {
+        t.Errorf("%d lines after compaction, want one per entry", n)
+    }
+
+    loaded := newFallbackCache()
+    loaded.file = f.file
+    if err := loaded.load(); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := loaded.lookup("/a"); ok {
+        t.Error("erased entry loaded")
+    }
+    if entry, ok := loaded.lookup("/c"); !ok || entry.Ver != 4 || string(entry.Value) != "3" {
+        t.Errorf("loaded entry %+v, %v", entry, ok)
+    }
+}
+
+func TestFallbackCacheBound(t *testing.T) {
+    f := newFallbackCache()
+    f.maxEntries = 2
+    f.store("/a", 1, nil)
+    f.store("/b", 1, nil)
+    f.store("/a", 1, nil)
+    f.store("/c", 1, nil)
+    if _, ok := f.lookup("/b"); ok {
+        t.Error("least recently read entry kept")
+    }
+    for _, key := range []string{"/a", "/c"} {
+        if _, ok := f.lookup(key); !ok {
+            t.Errorf("%s evicted", key)
+        }
+    }
+}
+
+func TestStaleReadsBounded(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithStaleReads(time.Minute), WithFallbackEntries(2))
+    defer c.Close()
+
+    for _, key := range []string{"/a", "/b", "/c"} {
+        zk.Put("/test" + key, []byte(key))
+        if _, _, _, err := c.Get(key, false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    zk.Stop()
+    eventually(t, "the disconnection", func() bool {
+        return c.conn.State() != zkapi.StateHasSession
+    })
+    entry, err := c.GetEntry("/c")
+    if err != nil || !entry.Stale || string(entry.Value) != "/c" {
+        t.Errorf("stale read: %+v, %v", entry, err)
+    }
+    if _, ok := c.staleRead("/a"); ok {
+        t.Error("evicted entry served")
+    }
+}
+
+// With encryption, the journal holds no value in clear and only its owner can read it.
+func TestFallbackCacheEncrypted(t *testing.T) {
+    dir, err := ioutil.TempDir("", "fallback")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    file := filepath.Join(dir, "cache")
+
+    zk := newFakeZK(t)
+    defer zk.Close()
+    keys := &testKeys{"k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+    c := newTestClient(t, zk, WithEncryption(keys), WithFallbackCache(file))
+    if _, err := c.Set("/k", []byte("secret")); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, _, err := c.Get("/k", false); err != nil {
+        t.Fatal(err)
+    }
+    c.Close()
+
+    info, err := os.Stat(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if mode := info.Mode().Perm(); mode != 0600 {
+        t.Errorf("journal created with mode %v", mode)
+    }
+    plain := newFallbackCache()
+    plain.file = file
+    if err := plain.load(); err != nil {
+        t.Fatal(err)
+    }
+    if entry, ok := plain.lookup("/k"); !ok || bytes.Contains(entry.Value, []byte("secret")) {
+        t.Errorf("journaled entry %q, %v, want it sealed", entry.Value, ok)
+    }
+
+    loaded := newFallbackCache()
+    loaded.file = file
+    loaded.open = c.decompress
+    if err := loaded.load(); err != nil {
+        t.Fatal(err)
+    }
+    if entry, ok := loaded.lookup("/k"); !ok || string(entry.Value) != "secret" {
+        t.Errorf("loaded entry %q, %v", entry.Value, ok)
+    }
+}
+
+func TestGetEntry(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    r := &recorder{}
+    c := newTestClient(t, zk, WithInstrumentation(r), WithStaleReads(time.Minute), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}))
+    defer c.Close()
+
+    zk.Put("/test/empty", nil)
+    if entry, err := c.GetEntry("/empty"); err != nil || entry.Value == nil || entry.Stale {
+        t.Errorf("GetEntry of an empty value: %+v, %v", entry, err)
+    }
+    failFirst(zk, fzGetData, 1)
+    if _, err := c.GetEntry("/empty"); err != nil {
+        t.Errorf("GetEntry not retried: %v", err)
+    }
+    if _, err := c.GetEntry("/missing"); err != goffkv.OpErrNoEntry {
+        t.Errorf("GetEntry of a missing key: %v", err)
+    }
+    if got := r.observations(); len(got) != 3 || got[0].op != "get" || got[2].err != goffkv.OpErrNoEntry {
+        t.Errorf("observed %+v", got)
+    }
+}
@@ -0,0 +1,187 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    // Service nodes of this package live under "<prefix>/.goffkv".
+    reservedSegment = ".goffkv"
+    frozenSegment = "frozen"
+)
+
+var (
+    ErrFrozen = errors.New("entry is frozen")
+)
+
+// Keys frozen by any client, kept up to date by a children watch on the marker node.
+type frozenSet struct {
+    mu sync.Mutex
+    watching bool
+    keys map[string]bool
+}
+
+// Applies a freeze of this client right away, rather than once the watch fires.
+func (f *frozenSet) update(key string, frozen bool) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    if !f.watching {
+        return
+    }
+    if frozen {
+        f.keys[key] = true
+    } else {
+        delete(f.keys, key)
+    }
+}
+
+func normalizeKey(segments []string) string {
+    return "/" + strings.Join(segments, "/")
+}
+
+func (c *Client) frozenPath() string {
+    return c.assemblePath([]string{reservedSegment, frozenSegment})
+}
+
+func (c *Client) loadFrozen() (<-chan zkapi.Event, error) {
+    path := c.frozenPath()
+    for {
+        children, _, ech, err := c.conn.ChildrenW(path)
+        if err == zkapi.ErrNoNode {
+            var exists bool
+            exists, _, ech, err = c.conn.ExistsW(path)
+            if err != nil {
+                return nil, err
+            }
+            if exists {
+                continue
+            }
+        } else if err != nil {
+            return nil, err
+        }
+
+        keys := make(map[string]bool)
+        for _, child := range children {
+            key, err := url.PathUnescape(child)
+            if err == nil {
+                keys[key] = true
+            }
+        }
+        c.frozen.keys = keys
+        return ech, nil
+    }
+}
+
+func (c *Client) watchFrozen(ech <-chan zkapi.Event) {
+    for {
+        select {
+        case <-ech:
+        case <-c.done:
+            return
+        }
+
+        c.frozen.mu.Lock()
+        var err error
+        ech, err = c.loadFrozen()
+        if err != nil {
+            c.frozen.watching = false
+            c.frozen.mu.Unlock()
+            return
+        }
+        c.frozen.mu.Unlock()
+    }
+}
+
+// Checks that the key of segments isn't frozen, nor (with subtree, before an erase) any key
+// below it.
+func (c *Client) checkFrozen(segments []string, subtree bool) error {
+    c.frozen.mu.Lock()
+    defer c.frozen.mu.Unlock()
+
+    if !c.frozen.watching {
+        ech, err := c.loadFrozen()
+        if err != nil {
+            return convertError(err)
+        }
+        c.frozen.watching = true
+        go c.watchFrozen(ech)
+    }
+
+    for i := 1; i <= len(segments); i++ {
+        if c.frozen.keys[normalizeKey(segments[:i])] {
+            return ErrFrozen
+        }
+    }
+    if subtree {
+        prefix := strings.TrimSuffix(normalizeKey(segments), "/") + "/"
+        for key := range c.frozen.keys {
+            if strings.HasPrefix(key, prefix) {
+                return ErrFrozen
+            }
+        }
+    }
+    return nil
+}
+
+// Freeze makes all cooperating clients reject writes to key and its descendants with ErrFrozen,
+// as well as erasing any of its ancestors.
+func (c *Client) Freeze(key string) (err error) {
+    defer c.recoverPanic("freeze", key, &err)
+    start := time.Now()
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return err
+    }
+
+    err = c.retry(context.Background(), true, func() error {
+        err := c.createEachPrefix(append(append([]string{}, c.prefixSegments...), reservedSegment, frozenSegment))
+        if err != nil {
+            return convertError(err)
+        }
+
+        marker := c.frozenPath() + "/" + url.PathEscape(normalizeKey(segments))
+        _, err = c.conn.Create(marker, nil, 0, c.acl)
+        if err != nil && err != zkapi.ErrNodeExists {
+            return convertError(err)
+        }
+        return nil
+    })
+    if err == nil {
+        c.frozen.update(normalizeKey(segments), true)
+    }
+    err = c.wrapError("freeze", key, err)
+    c.observe("freeze", key, start, err)
+    return err
+}
+
+// Unfreeze lifts a freeze previously set with Freeze.
+func (c *Client) Unfreeze(key string) (err error) {
+    defer c.recoverPanic("unfreeze", key, &err)
+    start := time.Now()
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return err
+    }
+
+    marker := c.frozenPath() + "/" + url.PathEscape(normalizeKey(segments))
+    err = c.retry(context.Background(), true, func() error {
+        err := c.conn.Delete(marker, -1)
+        if err != nil && err != zkapi.ErrNoNode {
+            return convertError(err)
+        }
+        return nil
+    })
+    if err == nil {
+        c.frozen.update(normalizeKey(segments), false)
+    }
+    err = c.wrapError("unfreeze", key, err)
+    c.observe("unfreeze", key, start, err)
+    return err
+}
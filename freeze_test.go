@@ -0,0 +1,114 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestFreezeRejectsWrites(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    for _, key := range []string{"/a", "/a/b", "/a/b/c"} {
+        if _, err := c.Create(key, nil, false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := c.Freeze("/a/b"); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, key := range []string{"/a/b", "/a/b/c", "/a/b/d"} {
+        if _, err := c.Set(key, []byte("x")); !errors.Is(err, ErrFrozen) {
+            t.Errorf("Set %s: %v, want ErrFrozen", key, err)
+        }
+    }
+    if _, err := c.Set("/a", []byte("x")); err != nil {
+        t.Errorf("Set of an ancestor: %v", err)
+    }
+
+    // Erasing an ancestor would remove the frozen key too.
+    if err := c.Erase("/a", 0); !errors.Is(err, ErrFrozen) {
+        t.Errorf("Erase of an ancestor: %v, want ErrFrozen", err)
+    }
+    if err := c.EraseChildren("/a"); !errors.Is(err, ErrFrozen) {
+        t.Errorf("EraseChildren of an ancestor: %v, want ErrFrozen", err)
+    }
+    _, err := c.Commit(goffkv.Txn{Ops: []goffkv.Operation{{What: goffkv.Erase, Key: "/a"}}})
+    if !errors.Is(err, ErrFrozen) {
+        t.Errorf("Commit erasing an ancestor: %v, want ErrFrozen", err)
+    }
+    if _, _, ok := zk.Node("/test/a/b/c"); !ok {
+        t.Fatal("frozen subtree erased")
+    }
+
+    if err := c.Unfreeze("/a/b"); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "unfreeze", func() bool {
+        return c.Erase("/a", 0) == nil
+    })
+}
+
+func TestFreezeSharedByClients(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c1 := newTestClient(t, zk)
+    defer c1.Close()
+    c2 := newTestClient(t, zk)
+    defer c2.Close()
+
+    if _, err := c2.Set("/k", []byte("x")); err != nil {
+        t.Fatal(err)
+    }
+    if err := c1.Freeze("/k"); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "the freeze to reach the other client", func() bool {
+        _, err := c2.Set("/k", []byte("y"))
+        return errors.Is(err, ErrFrozen)
+    })
+    if err := c1.Unfreeze("/k"); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "the unfreeze to reach the other client", func() bool {
+        _, err := c2.Set("/k", []byte("y"))
+        return err == nil
+    })
+}
+
+func TestFreezeRetriesAndWrapsErrors(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithRetryPolicy(RetryPolicy{MaxAttempts: 5, Writes: true}))
+    defer c.Close()
+
+    // The first attempt loses its connection.
+    dropped := false
+    zk.Fail(func(op int32, path string) error {
+        if op == fzCreate && path == "/test/.goffkv/frozen/%2Fk" && !dropped {
+            dropped = true
+            return errFakeDrop
+        }
+        return nil
+    })
+    if err := c.Freeze("/k"); err != nil {
+        t.Fatalf("Freeze with a retry policy: %v", err)
+    }
+    if _, _, ok := zk.Node("/test/.goffkv/frozen/%2Fk"); !ok {
+        t.Fatal("marker not created")
+    }
+
+    zk.Fail(func(op int32, path string) error {
+        return zkapi.ErrNoAuth
+    })
+    err := c.Unfreeze("/k")
+    var zkErr *Error
+    if !errors.As(err, &zkErr) || zkErr.Op != "unfreeze" || zkErr.Path != "/test/k" {
+        t.Fatalf("Unfreeze: %#v, want an *Error of op unfreeze", err)
+    }
+}
@@ -0,0 +1,58 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "sync"
+)
+
+var (
+    ErrClientClosed = errors.New("client closed")
+)
+
+// Implemented by long-lived helpers (watches, caches, recipes) so that embedding frameworks can
+// sequence startup: Ready is closed once the initial state is in place (or the helper has failed),
+// Err returns the error that has stopped the helper, if any.
+type Readiness interface {
+    Ready() <-chan struct{}
+    Err() error
+}
+
+type gate struct {
+    ready chan struct{}
+    readyOnce sync.Once
+
+    mu sync.Mutex
+    err error
+}
+
+func newGate() *gate {
+    return &gate{
+        ready: make(chan struct{}),
+    }
+}
+
+func (g *gate) markReady() {
+    g.readyOnce.Do(func() {
+        close(g.ready)
+    })
+}
+
+func (g *gate) fail(err error) {
+    g.mu.Lock()
+    if g.err == nil {
+        g.err = err
+    }
+    g.mu.Unlock()
+    g.markReady()
+}
+
+func (g *gate) Ready() <-chan struct{} {
+    return g.ready
+}
+
+func (g *gate) Err() error {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    return g.err
+}
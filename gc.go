@@ -0,0 +1,292 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    gcSegment = "gc"
+    defaultGCInterval = time.Minute
+    defaultGCGrace = 10 * time.Minute
+)
+
+var (
+    errGCStopped = errors.New("garbage collector stopped")
+)
+
+type GCOptions struct {
+    // Time between passes of StartGC; defaults to a minute.
+    Interval time.Duration
+    // Maximum number of deletes per second, 0 means unlimited.
+    Rate float64
+    // Auxiliary nodes younger than this are kept even if they look orphaned, as they may belong to
+    // a write in progress; defaults to 10 minutes.
+    Grace time.Duration
+    // Data keys of PublishAndFlip whose abandoned children are removed too: the ones created but
+    // never filled, as their publisher failed before flipping the pointer. The values flipped away
+    // from are history, kept for rollbacks; see CompactPublished.
+    Published []string
+}
+
+func (opts *GCOptions) setDefaults() {
+    if opts.Interval <= 0 {
+        opts.Interval = defaultGCInterval
+    }
+    if opts.Grace <= 0 {
+        opts.Grace = defaultGCGrace
+    }
+}
+
+// CollectGarbage makes a single pass over the leftovers of the prefix and removes them: the chunks
+// of chunked values whose key has been erased or overwritten, or whose write hasn't completed
+// within opts.Grace, and the children of opts.Published abandoned by PublishAndFlip. The other
+// metadata of the client needs no collection: session identities (WithIdentity) and lock
+// contenders are ephemeral, and Set deduplication is kept in memory; session-bound temporary
+// spaces are erased by CollectTempSpaces. Returns how many nodes have been removed.
+func (c *Client) CollectGarbage(opts GCOptions) (int, error) {
+    opts.setDefaults()
+
+    removed, err := c.collectChunks(opts)
+    if err != nil {
+        return removed, err
+    }
+    for _, key := range opts.Published {
+        n, err := c.collectPublished(key, opts)
+        removed += n
+        if err != nil {
+            return removed, err
+        }
+    }
+    return removed, nil
+}
+
+func (c *Client) collectChunks(opts GCOptions) (int, error) {
+    dirSegments := []string{reservedSegment, chunksSegment}
+    owners, _, err := c.conn.Children(c.assemblePath(dirSegments))
+    if err == zkapi.ErrNoNode {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, convertError(err)
+    }
+
+    removed := 0
+    eraseOpts := EraseOptions{Strategy: EraseStreaming, Rate: opts.Rate}
+    for _, owner := range owners {
+        key, err := url.PathUnescape(owner)
+        if err != nil {
+            continue
+        }
+        keySegments, err := goffkv.DisassembleKey(key)
+        if err != nil {
+            continue
+        }
+        ownerSegments := append(append([]string{}, dirSegments...), owner)
+
+        current := ""
+        data, _, err := c.conn.Get(c.assemblePath(keySegments))
+        switch err {
+        case nil:
+            if manifest, ok := parseManifest(data); ok {
+                current = manifest.Generation
+            }
+        case zkapi.ErrNoNode:
+        default:
+            return removed, convertError(err)
+        }
+
+        generations, _, err := c.conn.Children(c.assemblePath(ownerSegments))
+        if err == zkapi.ErrNoNode {
+            continue
+        }
+        if err != nil {
+            return removed, convertError(err)
+        }
+
+        kept := 0
+        for _, generation := range generations {
+            generationSegments := append(append([]string{}, ownerSegments...), generation)
+            exists, stat, err := c.conn.Exists(c.assemblePath(generationSegments))
+            if err != nil {
+                return removed, convertError(err)
+            }
+            if !exists {
+                continue
+            }
+            if generation == current || time.Since(time.Unix(0, stat.Ctime * int64(time.Millisecond))) < opts.Grace {
+                kept++
+                continue
+            }
+
+            stats, err := c.eraseTree(generationSegments, 0, eraseOpts)
+            removed += stats.Nodes
+            if err != nil && err != goffkv.OpErrNoEntry {
+                return removed, err
+            }
+        }
+
+        if kept == 0 {
+            // Fails harmlessly if a writer has added a generation in the meantime.
+            err = c.conn.Delete(c.assemblePath(ownerSegments), -1)
+            if err == nil {
+                removed++
+            }
+        }
+    }
+    return removed, nil
+}
+
+// Removes the children of key left empty by PublishAndFlip: a published child has been set by the
+// transaction that flipped the pointer, hence never has version 0.
+func (c *Client) collectPublished(key string, opts GCOptions) (int, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+    path := c.assemblePath(segments)
+    names, _, err := c.conn.Children(path)
+    if err == zkapi.ErrNoNode {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, convertError(err)
+    }
+
+    removed := 0
+    limiter := &throttle{rate: opts.Rate}
+    for _, name := range names {
+        if !strings.HasPrefix(name, publishNodeName) {
+            continue
+        }
+        exists, stat, err := c.conn.Exists(path + "/" + name)
+        if err != nil {
+            return removed, convertError(err)
+        }
+        if !exists || stat.Version != 0 || stat.NumChildren != 0 || time.Since(time.Unix(0, stat.Ctime * int64(time.Millisecond))) < opts.Grace {
+            continue
+        }
+
+        limiter.wait(1)
+        // Fails harmlessly if its publisher has filled it in the meantime.
+        err = c.conn.Delete(path + "/" + name, 0)
+        switch err {
+        case nil:
+            removed++
+        case zkapi.ErrNoNode, zkapi.ErrBadVersion, zkapi.ErrNotEmpty:
+        default:
+            return removed, convertError(err)
+        }
+    }
+    return removed, nil
+}
+
+// Runs CollectGarbage periodically on one client of the prefix at a time.
+type GarbageCollector struct {
+    *gate
+    c *Client
+    opts GCOptions
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.Mutex
+    removed int
+    lastErr error
+}
+
+// StartGC joins the election of the garbage collector of the prefix; the elected client runs
+// CollectGarbage every opts.Interval until it is stopped or loses its session. The collector is
+// ready once it has joined the election.
+func (c *Client) StartGC(opts GCOptions) *GarbageCollector {
+    opts.setDefaults()
+    g := &GarbageCollector{
+        gate: newGate(),
+        c: c,
+        opts: opts,
+        stop: make(chan struct{}),
+    }
+    go g.loop()
+    return g
+}
+
+func (g *GarbageCollector) loop() {
+    for {
+        err := g.lead()
+        switch err {
+        case errGCStopped:
+            return
+        case ErrClientClosed:
+            g.fail(err)
+            return
+        }
+
+        select {
+        case <-time.After(watchRetryDelay):
+        case <-g.stop:
+            return
+        case <-g.c.done:
+            g.fail(ErrClientClosed)
+            return
+        }
+    }
+}
+
+// Waits to be elected, then collects garbage until the session expires or the collector stops.
+func (g *GarbageCollector) lead() error {
+    node, err := g.c.enqueue([]string{reservedSegment, gcSegment}, lockNodeName, nil)
+    if err != nil {
+        return err
+    }
+    g.markReady()
+
+    err = g.c.waitTurn(node, func(string) bool { return true }, g.stop, errGCStopped)
+    if err != nil {
+        if err != errGCStopped {
+            g.c.conn.Delete(node, -1)
+        }
+        return err
+    }
+    defer g.c.conn.Delete(node, -1)
+
+    expired, stopWatching := g.c.sessionExpiry()
+    defer stopWatching()
+
+    ticker := time.NewTicker(g.opts.Interval)
+    defer ticker.Stop()
+    for {
+        removed, err := g.c.CollectGarbage(g.opts)
+        g.mu.Lock()
+        g.removed += removed
+        g.lastErr = err
+        g.mu.Unlock()
+
+        select {
+        case <-ticker.C:
+        case <-expired:
+            return zkapi.ErrSessionExpired
+        case <-g.stop:
+            return errGCStopped
+        case <-g.c.done:
+            return ErrClientClosed
+        }
+    }
+}
+
+// Stats returns how many nodes the collector has removed, and the error of its last pass.
+func (g *GarbageCollector) Stats() (int, error) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    return g.removed, g.lastErr
+}
+
+func (g *GarbageCollector) Stop() {
+    g.stopOnce.Do(func() {
+        close(g.stop)
+    })
+}
@@ -0,0 +1,112 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+// The chunks of an erased key go along with their directory.
+func TestCollectErasedOwner(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithChunking(4))
+    defer c.Close()
+
+    zk.Put("/test/.goffkv/chunks/%2Fgone/g1/0000000000", []byte("lost"))
+    zk.Put("/test/.goffkv/chunks/%2Fgone/g1/0000000001", []byte("lost"))
+    removed, err := c.CollectGarbage(GCOptions{Grace: time.Nanosecond})
+    if err != nil || removed != 4 {
+        t.Fatalf("CollectGarbage removed %d, %v; want 4", removed, err)
+    }
+    if paths := zk.Paths("/test/.goffkv/chunks/%2Fgone"); len(paths) != 0 {
+        t.Errorf("left %v", paths)
+    }
+}
+
+// Children of a published key that were never filled go; published values stay.
+func TestCollectAbandonedPublished(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/data", nil)
+    if _, err := c.PublishAndFlip("/data", "/current", []byte("v1")); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.PublishAndFlip("/data", "/current", nil); err != nil {
+        t.Fatal(err)
+    }
+    zk.Put("/test/data/v-0000000099", nil)
+    removed, err := c.CollectGarbage(GCOptions{Grace: time.Nanosecond, Published: []string{"/data"}})
+    if err != nil || removed != 1 {
+        t.Fatalf("CollectGarbage removed %d, %v; want 1", removed, err)
+    }
+    if paths := zk.Paths("/test/data"); len(paths) != 3 {
+        t.Errorf("left %v, want the published values", paths)
+    }
+}
+
+// Only the elected collector runs, and the other one takes over once it stops.
+func TestGarbageCollector(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c1 := newTestClient(t, zk, WithChunking(4))
+    defer c1.Close()
+    c2 := newTestClient(t, zk, WithChunking(4))
+    defer c2.Close()
+
+    opts := GCOptions{Interval: 10 * time.Millisecond, Grace: time.Nanosecond}
+    g1 := c1.StartGC(opts)
+    defer g1.Stop()
+    <-g1.Ready()
+    g2 := c2.StartGC(opts)
+    defer g2.Stop()
+    <-g2.Ready()
+
+    zk.Put("/test/.goffkv/chunks/%2Fa/g1/0000000000", []byte("lost"))
+    eventually(t, "the first collection", func() bool {
+        removed, _ := g1.Stats()
+        return removed == 3
+    })
+    if removed, _ := g2.Stats(); removed != 0 {
+        t.Fatalf("the collector not elected removed %d nodes", removed)
+    }
+
+    g1.Stop()
+    eventually(t, "the first collector to resign", func() bool {
+        return len(zk.Paths("/test/.goffkv/gc")) == 2
+    })
+    zk.Put("/test/.goffkv/chunks/%2Fb/g1/0000000000", []byte("lost"))
+    eventually(t, "the second collector", func() bool {
+        removed, _ := g2.Stats()
+        return removed == 3
+    })
+    if removed, err := g1.Stats(); removed != 3 || err != nil {
+        t.Errorf("stopped collector: %d, %v", removed, err)
+    }
+}
+
+func TestGarbageCollectorClosed(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+
+    holder := newTestClient(t, zk)
+    defer holder.Close()
+    h := holder.StartGC(GCOptions{})
+    defer h.Stop()
+    <-h.Ready()
+
+    // Closes the client once the collector waits for its turn: the driver never answers requests
+    // made after it's closed.
+    exists := zk.Requests(fzExists)
+    g := c.StartGC(GCOptions{})
+    eventually(t, "the collector to wait", func() bool {
+        return zk.Requests(fzExists) > exists
+    })
+    c.Close()
+    eventually(t, "the collector to fail", func() bool {
+        return g.Err() == ErrClientClosed
+    })
+}
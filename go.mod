@@ -1,8 +1,9 @@
 module github.com/offscale/goffkv-zk
 
-go 1.13
+go 1.20
 
 require (
-	github.com/offscale/goffkv v0.0.0-20200406121130-11b30fc5dc62 // indirect
-	github.com/samuel/go-zookeeper v0.0.0-20190923202752-2cc03de413da // indirect
+	github.com/go-zookeeper/zk v1.0.4
+	github.com/offscale/goffkv v0.0.0-20200406121130-11b30fc5dc62
+	golang.org/x/sync v0.1.0
 )
@@ -0,0 +1,109 @@
+package goffkv_zk
+
+import (
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// A key validated once (see Client.Handle). Its operations are those of the client, on its key.
+type Handle struct {
+    c *Client
+    key string
+    segments []string
+    path string
+}
+
+// Handles registered with a client, by key.
+type handleSet struct {
+    mu sync.RWMutex
+    handles map[string]*Handle
+}
+
+func (s *handleSet) lookup(key string) (*Handle, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    h, ok := s.handles[key]
+    return h, ok
+}
+
+func (s *handleSet) add(h *Handle) *Handle {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if existing, ok := s.handles[h.key]; ok {
+        return existing
+    }
+    if s.handles == nil {
+        s.handles = make(map[string]*Handle)
+    }
+    s.handles[h.key] = h
+    return h
+}
+
+// Handle validates key against goffkv's rules and the naming policy, and registers it: from then
+// on, the operations of the client on this very key (whether called on the handle or on the
+// client) skip the validation. Frequently used keys are best registered at startup, so that bad
+// keys are reported early. Registering the same key again returns the same handle.
+func (c *Client) Handle(key string) (*Handle, error) {
+    if h, ok := c.handles.lookup(key); ok {
+        return h, nil
+    }
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+    return c.handles.add(&Handle{
+        c: c,
+        key: key,
+        // Appending to the cached segments must not write into them.
+        segments: segments[:len(segments):len(segments)],
+        path: c.assemblePath(segments),
+    }), nil
+}
+
+// MustHandle works like Handle, but panics if key is invalid; for keys known when writing the code.
+func (c *Client) MustHandle(key string) *Handle {
+    h, err := c.Handle(key)
+    if err != nil {
+        panic(err)
+    }
+    return h
+}
+
+func (h *Handle) Key() string {
+    return h.key
+}
+
+// Path returns the ZooKeeper path of the key, with the prefix of the client.
+func (h *Handle) Path() string {
+    return h.path
+}
+
+func (h *Handle) Create(value []byte, lease bool) (goffkv.Version, error) {
+    return h.c.Create(h.key, value, lease)
+}
+
+func (h *Handle) Set(value []byte) (goffkv.Version, error) {
+    return h.c.Set(h.key, value)
+}
+
+func (h *Handle) Cas(value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    return h.c.Cas(h.key, value, ver)
+}
+
+func (h *Handle) Erase(ver goffkv.Version) error {
+    return h.c.Erase(h.key, ver)
+}
+
+func (h *Handle) Exists(watch bool) (goffkv.Version, goffkv.Watch, error) {
+    return h.c.Exists(h.key, watch)
+}
+
+func (h *Handle) Get(watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    return h.c.Get(h.key, watch)
+}
+
+func (h *Handle) Children(watch bool) ([]string, goffkv.Watch, error) {
+    return h.c.Children(h.key, watch)
+}
@@ -0,0 +1,50 @@
+package goffkv_zk
+
+import (
+    "testing"
+)
+
+func TestHandle(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    if _, err := c.Handle("no-slash"); err == nil {
+        t.Error("handle of an invalid key")
+    }
+    h, err := c.Handle("/a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if again := c.MustHandle("/a"); again != h {
+        t.Error("registering a key again returned another handle")
+    }
+    if h.Key() != "/a" || h.Path() != "/test/a" {
+        t.Errorf("handle of %s at %s", h.Key(), h.Path())
+    }
+
+    ver, err := h.Create([]byte("v"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Keys below a registered one reuse its segments without changing them.
+    for _, child := range []string{"/a/x", "/a/y"} {
+        if _, err := c.Create(child, nil, false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if children, _, err := h.Children(false); err != nil || len(children) != 2 {
+        t.Errorf("children %v, %v", children, err)
+    }
+    if got, value, _, err := h.Get(false); err != nil || got != ver || string(value) != "v" {
+        t.Errorf("Get: %v %q %v", got, value, err)
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Error("MustHandle of an invalid key didn't panic")
+        }
+    }()
+    c.MustHandle("/a/")
+}
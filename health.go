@@ -0,0 +1,42 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+)
+
+var (
+    ErrNotConnected = errors.New("session not connected")
+)
+
+// Health checks that the session is alive and that the ensemble member the client is attached
+// to answers a request, and returns the round-trip time of that request. Fails with
+// ErrNotConnected while the session isn't established (without waiting for it), or with
+// ctx.Err() if the member doesn't answer in time; suitable for readiness probes.
+func (c *Client) Health(ctx context.Context) (time.Duration, error) {
+    select {
+    case <-c.done:
+        return 0, ErrClientClosed
+    default:
+    }
+    if state := c.SessionState(); state != SessionConnected {
+        return 0, fmt.Errorf("%w: %v", ErrNotConnected, state)
+    }
+
+    // Answered by the member itself, whether the prefix exists or not.
+    path := c.assemblePath(nil)
+    if path == "" {
+        path = "/"
+    }
+    start := time.Now()
+    err := c.withContext(ctx, "health", "", nil, func(ctx context.Context) error {
+        _, _, err := c.conn.Exists(path)
+        return err
+    })
+    if err != nil {
+        return 0, convertError(err)
+    }
+    return time.Since(start), nil
+}
@@ -0,0 +1,47 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestHealth(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+
+    if rtt, err := c.Health(context.Background()); err != nil || rtt <= 0 {
+        t.Fatalf("Health: %v, %v", rtt, err)
+    }
+
+    zk.Fail(func(op int32, path string) error {
+        if op == fzExists {
+            time.Sleep(200 * time.Millisecond)
+        }
+        return nil
+    })
+    ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+    defer cancel()
+    if _, err := c.Health(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("Health of a slow member: %v, want context.DeadlineExceeded", err)
+    }
+    zk.Fail(nil)
+
+    zk.Stop()
+    eventually(t, "the disconnection", func() bool {
+        _, err := c.Health(context.Background())
+        return errors.Is(err, ErrNotConnected)
+    })
+    zk.Start()
+    eventually(t, "the reconnection", func() bool {
+        _, err := c.Health(context.Background())
+        return err == nil
+    })
+
+    c.Close()
+    if _, err := c.Health(context.Background()); err != ErrClientClosed {
+        t.Errorf("Health of a closed client: %v, want ErrClientClosed", err)
+    }
+}
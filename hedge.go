@@ -0,0 +1,144 @@
+package goffkv_zk
+
+import (
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+type hedgeResult struct {
+    value interface{}
+    err error
+}
+
+// WithReadFallback makes reads without a watch (Get, Exists, Children) that haven't completed
+// within timeout be sent again to another ensemble member, through a second connection kept
+// open for that purpose; the first answer wins. This cuts the latency of reads while the member
+// the client is attached to hiccups (GC pause, slow disk...), at the cost of a second session.
+// The other member may lag behind: a read answered by it may miss writes, including writes of
+// this client. Ignored with WithLinearizableReads, and with a single server.
+func WithReadFallback(timeout time.Duration) Option {
+    return func(c *Client) {
+        c.fallbackAfter = timeout
+    }
+}
+
+// Opens the secondary connection of WithReadFallback, to any member but the current one.
+func (c *Client) connectSecondary() error {
+    if c.fallbackAfter <= 0 || c.linearizable || len(c.servers) < 2 {
+        return nil
+    }
+
+    servers := []string{}
+    for _, server := range c.servers {
+        if server != c.conn.Server() {
+            servers = append(servers, server)
+        }
+    }
+    conn, _, err := zkapi.Connect(servers, ttl, c.configureConn)
+    if err != nil {
+        return err
+    }
+    for _, auth := range c.auths {
+        err = auth.Authenticate(conn)
+        if err != nil {
+            conn.Close()
+            return err
+        }
+    }
+    c.secondary = conn
+    return nil
+}
+
+// Runs read on the connection, and once more on the secondary one if it takes longer than the
+// fallback timeout or fails with a transient error; returns the first successful result, or the
+// last failure if both fail. An answer such as ErrNoNode counts as success.
+func (c *Client) hedge(read func(conn *zkapi.Conn) (interface{}, error)) (interface{}, error) {
+    if c.secondary == nil {
+        return read(c.conn)
+    }
+
+    results := make(chan hedgeResult, 2)
+    go func() {
+        value, err := read(c.conn)
+        results <- hedgeResult{value, err}
+    }()
+
+    timer := time.NewTimer(c.fallbackAfter)
+    defer timer.Stop()
+    pending, hedged := 1, false
+    for {
+        select {
+        case result := <-results:
+            pending--
+            if !IsTransient(result.err) {
+                return result.value, result.err
+            }
+            if !hedged {
+                hedged = c.hedgeOnSecondary(read, results, "read failed")
+                if hedged {
+                    pending++
+                }
+            }
+            if pending == 0 {
+                return result.value, result.err
+            }
+        case <-timer.C:
+            if !hedged {
+                hedged = c.hedgeOnSecondary(read, results, "read slower than " + c.fallbackAfter.String())
+                if hedged {
+                    pending++
+                }
+            }
+        }
+    }
+}
+
+// Sends read to the secondary connection, its result to results; false if that's pointless, as
+// both connections have ended up on the same member.
+func (c *Client) hedgeOnSecondary(read func(conn *zkapi.Conn) (interface{}, error), results chan<- hedgeResult, why string) bool {
+    server := c.secondary.Server()
+    if server == "" || server == c.conn.Server() {
+        return false
+    }
+    c.logger.Printf("%s on %s, falling back to %s", why, c.conn.Server(), server)
+    go func() {
+        value, err := read(c.secondary)
+        results <- hedgeResult{value, err}
+    }()
+    return true
+}
+
+func (c *Client) hedgedGet(path string) ([]byte, *zkapi.Stat, error) {
+    result, err := c.hedge(func(conn *zkapi.Conn) (interface{}, error) {
+        data, stat, err := conn.Get(path)
+        return getResult{valueOf(data), stat}, err
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    r := result.(getResult)
+    return r.data, r.stat, nil
+}
+
+func (c *Client) hedgedExists(path string) (bool, *zkapi.Stat, error) {
+    result, err := c.hedge(func(conn *zkapi.Conn) (interface{}, error) {
+        exists, stat, err := conn.Exists(path)
+        return existsResult{exists, stat}, err
+    })
+    if err != nil {
+        return false, nil, err
+    }
+    r := result.(existsResult)
+    return r.exists, r.stat, nil
+}
+
+func (c *Client) hedgedChildren(path string) ([]string, error) {
+    result, err := c.hedge(func(conn *zkapi.Conn) (interface{}, error) {
+        children, _, err := conn.Children(path)
+        return children, err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.([]string), nil
+}
@@ -0,0 +1,124 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Connects a client with a read fallback to two servers; returns the fake the client is attached
+// to first.
+func connectHedged(t *testing.T, zk1 *fakeZK, zk2 *fakeZK, opts ...Option) (*Client, *fakeZK, *fakeZK) {
+    opts = append([]Option{WithLogger(quietLogger), WithReadFallback(20 * time.Millisecond)}, opts...)
+    c, err := Connect(zk1.Addr() + "," + zk2.Addr(), "/test", opts...)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if c.conn.Server() == zk2.Addr() {
+        return c, zk2, zk1
+    }
+    return c, zk1, zk2
+}
+
+func TestReadFallback(t *testing.T) {
+    zk1 := newFakeZK(t)
+    defer zk1.Close()
+    zk2 := newFakeZK(t)
+    defer zk2.Close()
+    c, primary, other := connectHedged(t, zk1, zk2)
+    defer c.Close()
+    eventually(t, "the secondary connection", func() bool {
+        return c.secondary.State() == zkapi.StateHasSession
+    })
+
+    primary.Put("/test/k", []byte("primary"))
+    other.Put("/test/k", []byte("other"))
+    other.Put("/test/k/child", nil)
+    if _, value, _, err := c.Get("/k", false); err != nil || string(value) != "primary" {
+        t.Fatalf("fast Get: %q, %v", value, err)
+    }
+
+    primary.Fail(func(op int32, path string) error {
+        if op != fzPing {
+            time.Sleep(200 * time.Millisecond)
+        }
+        return nil
+    })
+    start := time.Now()
+    if _, value, _, err := c.Get("/k", false); err != nil || string(value) != "other" {
+        t.Fatalf("slow Get: %q, %v, want the value of the other member", value, err)
+    }
+    if elapsed := time.Since(start); elapsed > 150 * time.Millisecond {
+        t.Errorf("slow Get took %v", elapsed)
+    }
+    if children, _, err := c.Children("/k", false); err != nil || len(children) != 1 {
+        t.Errorf("slow Children: %v, %v", children, err)
+    }
+    if ver, _, err := c.Exists("/k/child", false); err != nil || ver == 0 {
+        t.Errorf("slow Exists: %v, %v", ver, err)
+    }
+    // Reads with a watch stay on the member the client is attached to.
+    if _, value, _, err := c.Get("/k", true); err != nil || string(value) != "primary" {
+        t.Errorf("slow Get with a watch: %q, %v", value, err)
+    }
+}
+
+func TestReadFallbackIgnored(t *testing.T) {
+    zk1 := newFakeZK(t)
+    defer zk1.Close()
+    zk2 := newFakeZK(t)
+    defer zk2.Close()
+
+    c, _, _ := connectHedged(t, zk1, zk2, WithLinearizableReads())
+    defer c.Close()
+    if c.secondary != nil {
+        t.Error("secondary connection with linearizable reads")
+    }
+    single := newTestClient(t, zk1, WithReadFallback(time.Millisecond))
+    defer single.Close()
+    if single.secondary != nil {
+        t.Error("secondary connection with a single server")
+    }
+}
+
+func TestReadFallbackFailure(t *testing.T) {
+    zk1 := newFakeZK(t)
+    defer zk1.Close()
+    zk2 := newFakeZK(t)
+    defer zk2.Close()
+    c, primary, other := connectHedged(t, zk1, zk2)
+    defer c.Close()
+    eventually(t, "the secondary connection", func() bool {
+        return c.secondary.State() == zkapi.StateHasSession
+    })
+    primary.Put("/test/k", []byte("primary"))
+    other.Put("/test/k", []byte("other"))
+
+    // The member the client is attached to fails after the other one was asked, which answers later.
+    primary.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            time.Sleep(40 * time.Millisecond)
+            return zkapi.ErrSessionMoved
+        }
+        return nil
+    })
+    other.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            time.Sleep(60 * time.Millisecond)
+        }
+        return nil
+    })
+    if _, value, _, err := c.Get("/k", false); err != nil || string(value) != "other" {
+        t.Errorf("Get failing on one member: %q, %v, want the value of the other", value, err)
+    }
+
+    other.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            return zkapi.ErrSessionMoved
+        }
+        return nil
+    })
+    if _, _, _, err := c.Get("/k", false); !IsTransient(err) {
+        t.Errorf("Get failing on both members: %v", err)
+    }
+}
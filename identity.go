@@ -0,0 +1,72 @@
+package goffkv_zk
+
+import (
+    "encoding/json"
+    "fmt"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    sessionsSegment = "sessions"
+)
+
+// Who is behind a session: stored in "<prefix>/.goffkv/sessions/<session id>" and prepended to log lines.
+type Identity struct {
+    Service string `json:"service"`
+    Instance string `json:"instance,omitempty"`
+    Build string `json:"build,omitempty"`
+}
+
+func (id Identity) String() string {
+    result := id.Service
+    if id.Instance != "" {
+        result += "/" + id.Instance
+    }
+    if id.Build != "" {
+        result += "@" + id.Build
+    }
+    return result
+}
+
+type identityLogger struct {
+    prefix string
+    logger Logger
+}
+
+func (l identityLogger) Printf(format string, args ...interface{}) {
+    l.logger.Printf("[%s] " + format, append([]interface{}{l.prefix}, args...)...)
+}
+
+// WithIdentity attaches id to the client's log lines and to an ephemeral info node of its session.
+func WithIdentity(id Identity) Option {
+    return func(c *Client) {
+        c.identity = &id
+    }
+}
+
+func (c *Client) Identity() (Identity, bool) {
+    if c.identity == nil {
+        return Identity{}, false
+    }
+    return *c.identity, true
+}
+
+func sessionSegment(sessionID int64) string {
+    return fmt.Sprintf("%016x", uint64(sessionID))
+}
+
+func (c *Client) registerIdentity() {
+    data, err := json.Marshal(c.identity)
+    if err != nil {
+        return
+    }
+
+    err = c.createEachPrefix(append(append([]string{}, c.prefixSegments...), reservedSegment, sessionsSegment))
+    if err == nil {
+        path := c.assemblePath([]string{reservedSegment, sessionsSegment, sessionSegment(c.conn.SessionID())})
+        _, err = c.conn.Create(path, data, zkapi.FlagEphemeral, c.acl)
+    }
+    if err != nil && err != zkapi.ErrNodeExists {
+        c.logger.Printf("failed to register session identity: %v", err)
+    }
+}
@@ -0,0 +1,69 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "encoding/json"
+    "log"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// A Logger keeping the log lines.
+type bufferLogger struct {
+    mu sync.Mutex
+    buf bytes.Buffer
+}
+
+func (l *bufferLogger) Printf(format string, args ...interface{}) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    log.New(&l.buf, "", 0).Printf(format, args...)
+}
+
+func (l *bufferLogger) String() string {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.buf.String()
+}
+
+func TestIdentity(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    logs := &bufferLogger{}
+    id := Identity{Service: "billing", Instance: "host-1", Build: "1.2"}
+    c := newTestClient(t, zk, WithLogger(logs), WithIdentity(id))
+    defer c.Close()
+
+    if got, ok := c.Identity(); !ok || got != id {
+        t.Errorf("Identity: %+v, %v", got, ok)
+    }
+    node := func() string {
+        return "/test/.goffkv/sessions/" + sessionSegment(c.ConnInfo().SessionID)
+    }
+    eventually(t, "the info node", func() bool {
+        _, _, ok := zk.Node(node())
+        return ok
+    })
+    data, stat, _ := zk.Node(node())
+    var stored Identity
+    if err := json.Unmarshal(data, &stored); err != nil || stored != id || stat.EphemeralOwner == 0 {
+        t.Errorf("info node %q, ephemeral owner %x", data, stat.EphemeralOwner)
+    }
+
+    // A new session registers again.
+    first := node()
+    zk.Expire()
+    eventually(t, "the info node of the new session", func() bool {
+        _, _, ok := zk.Node(node())
+        return node() != first && ok
+    })
+    if _, _, ok := zk.Node(first); ok {
+        t.Error("info node of the expired session left")
+    }
+
+    c.logger.Printf("test line")
+    if !strings.Contains(logs.String(), "[billing/host-1@1.2] test line") {
+        t.Errorf("log lines without the identity:\n%s", logs)
+    }
+}
@@ -0,0 +1,185 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "sort"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+var (
+    ErrImportConflict = errors.New("key of the snapshot exists already")
+)
+
+// What Import does with the keys of the snapshot that exist already.
+type ImportMode int
+
+const (
+    // Replace their values.
+    ImportOverwrite ImportMode = iota
+    // Leave them untouched.
+    ImportSkipExisting
+    // Write nothing and fail with ErrImportConflict (wrapped in a KeyError).
+    ImportFailOnConflict
+)
+
+// Outcome of Import: the keys of the snapshot, as imported, parents first.
+type ImportResult struct {
+    Created []string
+    Updated []string
+    Skipped []string
+}
+
+// Import recreates the nodes of snapshot (see Export) under key, parents before children, with
+// their recorded ACLs and kinds. It runs in as few Multis as the request size limit allows: every
+// Multi is atomic, but the import as a whole isn't, and a failed import can be run again. Values
+// are restored, versions can't be: restored keys get new versions. The parent of key is created
+// if needed.
+func (c *Client) Import(key string, snapshot Snapshot, mode ImportMode) (ImportResult, error) {
+    rootSegments, err := c.disassembleKey(key)
+    if err != nil {
+        return ImportResult{}, err
+    }
+
+    type item struct {
+        node ExportedNode
+        key string
+        segments []string
+        path string
+    }
+
+    items := make([]item, 0, len(snapshot.Nodes))
+    for _, node := range snapshot.Nodes {
+        segments, err := c.disassembleKey(key + node.Key)
+        if err != nil {
+            return ImportResult{}, KeyError{key + node.Key, err}
+        }
+        err = c.checkWritable(segments)
+        if err != nil {
+            return ImportResult{}, KeyError{key + node.Key, err}
+        }
+        items = append(items, item{node, key + node.Key, segments, c.assemblePath(segments)})
+    }
+    sort.SliceStable(items, func(i, j int) bool {
+        return len(items[i].segments) < len(items[j].segments)
+    })
+
+    parentSegments := append([]string{}, c.prefixSegments...)
+    if len(rootSegments) != 0 {
+        parentSegments = append(parentSegments, rootSegments[:len(rootSegments) - 1]...)
+    }
+    err = c.createEachPrefix(parentSegments)
+    if err != nil {
+        return ImportResult{}, convertError(err)
+    }
+
+    // Keys written by earlier attempts, by path; true for created ones.
+    written := make(map[string]bool)
+
+outermost:
+    for {
+        var result ImportResult
+        pending := []item{}
+        versions := []int32{}
+        for _, it := range items {
+            if created, ok := written[it.path]; ok {
+                if created {
+                    result.Created = append(result.Created, it.key)
+                } else {
+                    result.Updated = append(result.Updated, it.key)
+                }
+                continue
+            }
+
+            exists, stat, err := c.conn.Exists(it.path)
+            if err != nil {
+                return ImportResult{}, KeyError{it.key, convertError(err)}
+            }
+            switch {
+            case !exists:
+                pending = append(pending, it)
+                versions = append(versions, -1)
+            case mode == ImportOverwrite:
+                pending = append(pending, it)
+                versions = append(versions, stat.Version)
+            case mode == ImportSkipExisting:
+                result.Skipped = append(result.Skipped, it.key)
+            default:
+                return result, KeyError{it.key, ErrImportConflict}
+            }
+        }
+
+        // Batches follow the depth order, so that parents are created in an earlier batch or
+        // earlier in the same one.
+        for len(pending) != 0 {
+            ops := []interface{}{}
+            encoded := []encodedValue{}
+            size := 0
+            for i, it := range pending {
+                data, err := c.encodeValue(normalizeKey(it.segments), valueOf(it.node.Value))
+                if err != nil {
+                    c.discardAllChunks(encoded)
+                    return result, KeyError{it.key, convertError(err)}
+                }
+                acl := c.importACL(it.node)
+
+                opSize := len(it.path) + len(data) + createOpBytes
+                for _, entry := range acl {
+                    opSize += len(entry.Scheme) + len(entry.ID)
+                }
+                if len(ops) != 0 && size + opSize > maxMultiBytes {
+                    // Encoded again by the next batch.
+                    c.discardChunks(normalizeKey(it.segments), data)
+                    break
+                }
+                size += opSize
+                encoded = append(encoded, encodedValue{normalizeKey(it.segments), data})
+                if versions[i] < 0 {
+                    ops = append(ops, &zkapi.CreateRequest{
+                        Path: it.path,
+                        Data: data,
+                        Acl: acl,
+                        Flags: importFlags(it.node),
+                    })
+                } else {
+                    ops = append(ops, &zkapi.SetDataRequest{
+                        Path: it.path,
+                        Data: data,
+                        Version: versions[i],
+                    })
+                }
+            }
+
+            responses, err := c.conn.Multi(ops...)
+            if notWritten(err) {
+                c.discardAllChunks(encoded)
+            }
+            if err == zkapi.ErrNodeExists || err == zkapi.ErrBadVersion {
+                // Raced with another client: look at the keys again (and fail, if conflicts
+                // aren't allowed).
+                c.logger.Printf("import: key modified concurrently, retrying")
+                continue outermost
+            }
+            if err != nil {
+                // The ops after the failing one report errors too.
+                for i, response := range responses {
+                    if response.Error != nil {
+                        return result, KeyError{pending[i].key, convertError(response.Error)}
+                    }
+                }
+                return result, convertError(err)
+            }
+
+            for i, it := range pending[:len(ops)] {
+                written[it.path] = versions[i] < 0
+                if versions[i] < 0 {
+                    result.Created = append(result.Created, it.key)
+                } else {
+                    result.Updated = append(result.Updated, it.key)
+                }
+            }
+            pending = pending[len(ops):]
+            versions = versions[len(ops):]
+        }
+        return result, nil
+    }
+}
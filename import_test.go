@@ -0,0 +1,91 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestExportImport(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/src", []byte("root"))
+    zk.Put("/test/src/a", []byte("a"))
+    zk.Put("/test/src/a/b", []byte("b"))
+    zk.Put("/test/src/c", nil)
+
+    snapshot, err := c.Export("/src", ExportOptions{ACLs: true, Metadata: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    keys := []string{}
+    for _, node := range snapshot.Nodes {
+        keys = append(keys, node.Key)
+    }
+    if !reflect.DeepEqual(keys, []string{"", "/a", "/c", "/a/b"}) && !reflect.DeepEqual(keys, []string{"", "/a", "/a/b", "/c"}) {
+        t.Fatalf("exported %v", keys)
+    }
+    if node := snapshot.Nodes[0]; node.Meta == nil || len(node.ACL) == 0 {
+        t.Errorf("root exported without metadata or ACL: %+v", node)
+    }
+
+    result, err := c.Import("/dst", snapshot, ImportOverwrite)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result.Created) != 4 || result.Created[0] != "/dst" {
+        t.Errorf("created %v", result.Created)
+    }
+    for _, p := range []string{"", "/a", "/a/b", "/c"} {
+        want, _, _ := zk.Node("/test/src" + p)
+        if data, _, ok := zk.Node("/test/dst" + p); !ok || string(data) != string(want) {
+            t.Errorf("imported %s: %q, want %q", p, data, want)
+        }
+    }
+
+    zk.Put("/test/dst/a", []byte("changed"))
+    result, err = c.Import("/dst", snapshot, ImportSkipExisting)
+    if err != nil || len(result.Skipped) != 4 {
+        t.Fatalf("import over an existing copy: %+v, %v", result, err)
+    }
+    if data, _, _ := zk.Node("/test/dst/a"); string(data) != "changed" {
+        t.Errorf("ImportSkipExisting overwrote %q", data)
+    }
+
+    zk.Put("/test/partial", nil)
+    if _, err := c.Import("/partial", snapshot, ImportFailOnConflict); !errors.Is(err, ErrImportConflict) {
+        t.Errorf("ImportFailOnConflict: %v", err)
+    }
+    if paths := zk.Paths("/test/partial"); len(paths) != 1 {
+        t.Errorf("failed import wrote %v", paths)
+    }
+
+    if _, err := c.Import("/dst", snapshot, ImportOverwrite); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/dst/a"); string(data) != "a" {
+        t.Errorf("ImportOverwrite left %q", data)
+    }
+}
+
+// The recorded ACL is restored.
+func TestImportACL(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    snapshot := Snapshot{Key: "/src", Nodes: []ExportedNode{
+        {Key: "", Value: []byte("v"), ACL: []ExportedACL{{"world", "anyone", zkapi.PermRead}}},
+    }}
+    if _, err := c.Import("/ro", snapshot, ImportOverwrite); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/ro", []byte("w")); !errors.Is(err, zkapi.ErrNoAuth) {
+        t.Errorf("Set of a read-only import: %v, want zk.ErrNoAuth", err)
+    }
+}
@@ -0,0 +1,144 @@
+package goffkv_zk
+
+import (
+    "sort"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Rough size of the fixed part of a create request (flags, lengths, ACL entry headers).
+const createOpBytes = 64
+
+// A key of the layout created by InitTree.
+type TreeNode struct {
+    Key string
+    Value []byte
+    // The client's ACL (see WithACL) if nil.
+    ACL []zkapi.ACL
+    // Requests a container node, which the server removes once its last child is gone. The
+    // driver can't create container nodes (see the README), so it is created as a plain
+    // persistent node; the flag is kept so that layouts stay accurate once it can.
+    Container bool
+}
+
+// Outcome of InitTree: the keys of the spec, parents first.
+type InitTreeResult struct {
+    Created []string
+    Existing []string
+}
+
+// InitTree creates every key of spec that doesn't exist yet, parents before children, in as few
+// Multis as the request size limit allows; existing keys are left untouched, whatever their value.
+// Running it again (or concurrently) with the same spec is harmless. The parent of each key must
+// either be in spec or exist already.
+func (c *Client) InitTree(spec []TreeNode) (InitTreeResult, error) {
+    type item struct {
+        node TreeNode
+        segments []string
+        path string
+    }
+
+    items := make([]item, 0, len(spec))
+    for _, node := range spec {
+        segments, err := c.disassembleKey(node.Key)
+        if err != nil {
+            return InitTreeResult{}, KeyError{node.Key, err}
+        }
+        err = c.checkWritable(segments)
+        if err != nil {
+            return InitTreeResult{}, KeyError{node.Key, err}
+        }
+        items = append(items, item{node, segments, c.assemblePath(segments)})
+    }
+    sort.SliceStable(items, func(i, j int) bool {
+        return len(items[i].segments) < len(items[j].segments)
+    })
+
+    err := c.createEachPrefix(c.prefixSegments)
+    if err != nil {
+        return InitTreeResult{}, convertError(err)
+    }
+
+    // Keys created by earlier attempts, which exist when a retry checks them again.
+    created := make(map[string]bool)
+
+outermost:
+    for {
+        var result InitTreeResult
+        missing := []item{}
+        for _, it := range items {
+            exists, _, err := c.conn.Exists(it.path)
+            if err != nil {
+                return InitTreeResult{}, KeyError{it.node.Key, convertError(err)}
+            }
+            if exists && created[it.path] {
+                result.Created = append(result.Created, it.node.Key)
+            } else if exists {
+                result.Existing = append(result.Existing, it.node.Key)
+            } else {
+                missing = append(missing, it)
+            }
+        }
+
+        // Batches follow the depth order, so that parents are created in an earlier batch or
+        // earlier in the same one.
+        for len(missing) != 0 {
+            ops := []interface{}{}
+            encoded := []encodedValue{}
+            size := 0
+            for _, it := range missing {
+                data, err := c.encodeValue(normalizeKey(it.segments), valueOf(it.node.Value))
+                if err != nil {
+                    c.discardAllChunks(encoded)
+                    return result, KeyError{it.node.Key, convertError(err)}
+                }
+                acl := it.node.ACL
+                if acl == nil {
+                    acl = c.acl
+                }
+
+                opSize := len(it.path) + len(data) + createOpBytes
+                for _, entry := range acl {
+                    opSize += len(entry.Scheme) + len(entry.ID)
+                }
+                if len(ops) != 0 && size + opSize > maxMultiBytes {
+                    // Encoded again by the next batch.
+                    c.discardChunks(normalizeKey(it.segments), data)
+                    break
+                }
+                size += opSize
+                encoded = append(encoded, encodedValue{normalizeKey(it.segments), data})
+                ops = append(ops, &zkapi.CreateRequest{
+                    Path: it.path,
+                    Data: data,
+                    Acl: acl,
+                })
+            }
+
+            responses, err := c.conn.Multi(ops...)
+            if notWritten(err) {
+                c.discardAllChunks(encoded)
+            }
+            if err == zkapi.ErrNodeExists {
+                // Another client is initializing the same tree.
+                c.logger.Printf("inittree: key created concurrently, retrying")
+                continue outermost
+            }
+            if err != nil {
+                // The ops after the failing one report errors too.
+                for i, response := range responses {
+                    if response.Error != nil {
+                        return result, KeyError{missing[i].node.Key, convertError(response.Error)}
+                    }
+                }
+                return result, convertError(err)
+            }
+
+            for _, it := range missing[:len(ops)] {
+                created[it.path] = true
+                result.Created = append(result.Created, it.node.Key)
+            }
+            missing = missing[len(ops):]
+        }
+        return result, nil
+    }
+}
@@ -0,0 +1,79 @@
+package goffkv_zk
+
+import (
+    "reflect"
+    "sync"
+    "testing"
+)
+
+var testLayout = []TreeNode{
+    {Key: "/app/config", Value: []byte("{}")},
+    {Key: "/app"},
+    {Key: "/app/locks", Container: true},
+    {Key: "/app/config/limits", Value: []byte("10")},
+}
+
+func TestInitTree(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    // Creates /test/app too.
+    zk.Put("/test/app/locks", []byte("kept"))
+    result, err := c.InitTree(testLayout)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Parents first.
+    if !reflect.DeepEqual(result.Created, []string{"/app/config", "/app/config/limits"}) {
+        t.Errorf("created %v", result.Created)
+    }
+    if !reflect.DeepEqual(result.Existing, []string{"/app", "/app/locks"}) {
+        t.Errorf("existing %v", result.Existing)
+    }
+    if data, _, _ := zk.Node("/test/app/config/limits"); string(data) != "10" {
+        t.Errorf("value %q", data)
+    }
+    if data, _, _ := zk.Node("/test/app/locks"); string(data) != "kept" {
+        t.Errorf("existing key overwritten with %q", data)
+    }
+
+    result, err = c.InitTree(testLayout)
+    if err != nil || len(result.Created) != 0 || len(result.Existing) != 4 {
+        t.Errorf("second InitTree: %+v, %v", result, err)
+    }
+}
+
+func TestInitTreeConcurrent(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+
+    var wg sync.WaitGroup
+    results := make([]InitTreeResult, 4)
+    errs := make([]error, len(results))
+    for i := range results {
+        c := newTestClient(t, zk)
+        defer c.Close()
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            results[i], errs[i] = c.InitTree(testLayout)
+        }(i)
+    }
+    wg.Wait()
+
+    created := 0
+    for i, result := range results {
+        if errs[i] != nil {
+            t.Fatal(errs[i])
+        }
+        if len(result.Created) + len(result.Existing) != len(testLayout) {
+            t.Errorf("result %+v", result)
+        }
+        created += len(result.Created)
+    }
+    if created != len(testLayout) {
+        t.Errorf("%d keys reported created, want %d", created, len(testLayout))
+    }
+}
@@ -0,0 +1,162 @@
+package goffkv_zk
+
+import (
+    "math/rand"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    defaultKeyStatsTopN = 10
+    // Keys tracked at most per kind (reads, writes), as a multiple of TopN.
+    keyStatsCapacityFactor = 16
+)
+
+type KeyStatsOptions struct {
+    // Fraction of the operations sampled, in (0, 1]; 1 if 0.
+    SampleRate float64
+    // Keys matching one of these patterns (see WithLeasePatterns for the syntax) are counted
+    // under the pattern rather than individually, e.g. "/users/*/profile".
+    Patterns []string
+    // Number of keys reported by KeyStats; 10 if 0.
+    TopN int
+}
+
+// Operations counted for a key (or key pattern), estimated from the samples.
+type KeyCount struct {
+    Key string
+    Count uint64
+}
+
+// The most read and most written keys since Since, most frequent first.
+type KeyStatsReport struct {
+    Since time.Time
+    Reads []KeyCount
+    Writes []KeyCount
+}
+
+type keyStats struct {
+    opts KeyStatsOptions
+    patterns [][]string
+    capacity int
+
+    mu sync.Mutex
+    rng *rand.Rand
+    since time.Time
+    reads map[string]uint64
+    writes map[string]uint64
+}
+
+// WithKeyStats samples the operations of the client to find the most read and written keys,
+// as reported by KeyStats. Memory use is bounded: when too many distinct keys show up, rare ones
+// are evicted, so counts of keys outside the top are approximate.
+func WithKeyStats(opts KeyStatsOptions) Option {
+    return func(c *Client) {
+        if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+            opts.SampleRate = 1
+        }
+        if opts.TopN <= 0 {
+            opts.TopN = defaultKeyStatsTopN
+        }
+
+        s := &keyStats{
+            opts: opts,
+            capacity: opts.TopN * keyStatsCapacityFactor,
+            rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+            since: time.Now(),
+            reads: make(map[string]uint64),
+            writes: make(map[string]uint64),
+        }
+        for _, pattern := range opts.Patterns {
+            s.patterns = append(s.patterns, strings.Split(strings.TrimPrefix(pattern, "/"), "/"))
+        }
+        c.keyStats = s
+    }
+}
+
+func isReadOp(op string) bool {
+    return op == "exists" || op == "get" || op == "children"
+}
+
+func (s *keyStats) record(op string, key string) {
+    if s == nil || key == "" {
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.opts.SampleRate < 1 && s.rng.Float64() >= s.opts.SampleRate {
+        return
+    }
+
+    segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+    for i, pattern := range s.patterns {
+        if matchKeyPattern(pattern, segments) {
+            key = s.opts.Patterns[i]
+            break
+        }
+    }
+
+    counts := s.writes
+    if isReadOp(op) {
+        counts = s.reads
+    }
+    if _, ok := counts[key]; !ok && len(counts) >= s.capacity {
+        // Space-saving: the newcomer replaces the rarest key and inherits its count, which
+        // overestimates it rather than losing a key that might be hot.
+        var rarest string
+        var min uint64
+        for k, count := range counts {
+            if rarest == "" || count < min {
+                rarest, min = k, count
+            }
+        }
+        delete(counts, rarest)
+        counts[key] = min
+    }
+    counts[key]++
+}
+
+func (s *keyStats) top(counts map[string]uint64) []KeyCount {
+    result := make([]KeyCount, 0, len(counts))
+    for key, count := range counts {
+        result = append(result, KeyCount{key, uint64(float64(count) / s.opts.SampleRate)})
+    }
+    sort.Slice(result, func(i, j int) bool {
+        if result[i].Count != result[j].Count {
+            return result[i].Count > result[j].Count
+        }
+        return result[i].Key < result[j].Key
+    })
+    if len(result) > s.opts.TopN {
+        result = result[:s.opts.TopN]
+    }
+    return result
+}
+
+// KeyStats returns the hottest keys seen since the client was created or the stats were last
+// reset (if reset is set, they are reset now). Empty unless WithKeyStats is used.
+func (c *Client) KeyStats(reset bool) KeyStatsReport {
+    s := c.keyStats
+    if s == nil {
+        return KeyStatsReport{}
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    result := KeyStatsReport{
+        Since: s.since,
+        Reads: s.top(s.reads),
+        Writes: s.top(s.writes),
+    }
+    if reset {
+        s.since = time.Now()
+        s.reads = make(map[string]uint64)
+        s.writes = make(map[string]uint64)
+    }
+    return result
+}
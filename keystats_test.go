@@ -0,0 +1,58 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+)
+
+func TestKeyStats(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithKeyStats(KeyStatsOptions{TopN: 2, Patterns: []string{"/users/*"}}))
+    defer c.Close()
+
+    zk.Put("/test/users", nil)
+    for i := 0; i < 3; i++ {
+        c.Set(fmt.Sprint("/users/u", i), nil)
+    }
+    for i := 0; i < 5; i++ {
+        c.Get("/hot", false)
+    }
+    c.Get("/users/u0", false)
+    c.Exists("/cold", false)
+    c.Set("/config", nil)
+
+    report := c.KeyStats(true)
+    // Ties sorted by key.
+    if want := []KeyCount{{"/hot", 5}, {"/cold", 1}}; !reflect.DeepEqual(report.Reads, want) {
+        t.Errorf("reads %v, want %v", report.Reads, want)
+    }
+    if want := []KeyCount{{"/users/*", 3}, {"/config", 1}}; !reflect.DeepEqual(report.Writes, want) {
+        t.Errorf("writes %v, want %v", report.Writes, want)
+    }
+
+    if again := c.KeyStats(false); len(again.Reads) != 0 || len(again.Writes) != 0 || !again.Since.After(report.Since) {
+        t.Errorf("after a reset: %+v", again)
+    }
+}
+
+// Past its capacity, the tracker keeps the hot keys.
+func TestKeyStatsEviction(t *testing.T) {
+    s := &keyStats{
+        opts: KeyStatsOptions{SampleRate: 1, TopN: 1},
+        capacity: 4,
+        reads: make(map[string]uint64),
+        writes: make(map[string]uint64),
+    }
+    for i := 0; i < 100; i++ {
+        s.record("get", "/hot")
+        s.record("get", fmt.Sprint("/cold", i))
+    }
+    if top := s.top(s.reads); len(top) != 1 || top[0].Key != "/hot" || top[0].Count < 100 {
+        t.Errorf("top %v", top)
+    }
+    if len(s.reads) > 4 {
+        t.Errorf("%d keys tracked, capacity 4", len(s.reads))
+    }
+}
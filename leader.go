@@ -0,0 +1,150 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// The current leader of an election: the contender with the lowest sequence number.
+// Node is empty if there are no contenders.
+type Leader struct {
+    Node string
+    Value []byte
+}
+
+// Follows the leader of an election (any layout of sequential children, e.g. Curator's LeaderLatch
+// or LeaderSelector) without taking part in it.
+type LeaderObserver struct {
+    *gate
+    c *Client
+    path string
+    changes chan Leader
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.Mutex
+    current Leader
+}
+
+// ObserveLeader starts following the leader of the election at key.
+func (c *Client) ObserveLeader(key string) (*LeaderObserver, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    o := &LeaderObserver{
+        gate: newGate(),
+        c: c,
+        path: c.assemblePath(segments),
+        changes: make(chan Leader, watchBacklog),
+        stop: make(chan struct{}),
+    }
+
+    leader, cech, dech, err := o.load()
+    if err != nil {
+        return nil, convertError(err)
+    }
+    o.current = leader
+    o.markReady()
+
+    go o.loop(cech, dech)
+    return o, nil
+}
+
+// Returns the leader, a watch of the contenders and a watch of the leader's value (if any).
+func (o *LeaderObserver) load() (Leader, <-chan zkapi.Event, <-chan zkapi.Event, error) {
+    for {
+        children, _, cech, err := o.c.conn.ChildrenW(o.path)
+        if err != nil {
+            return Leader{}, nil, nil, err
+        }
+
+        sortChildren(children, BySequence)
+        if len(children) == 0 || sequenceOf(children[0]) < 0 {
+            return Leader{}, cech, nil, nil
+        }
+
+        value, _, dech, err := o.c.conn.GetW(o.path + "/" + children[0])
+        if err == zkapi.ErrNoNode {
+            // The leader has just resigned.
+            continue
+        }
+        if err != nil {
+            return Leader{}, nil, nil, err
+        }
+        return Leader{children[0], valueOf(value)}, cech, dech, nil
+    }
+}
+
+func (o *LeaderObserver) loop(cech <-chan zkapi.Event, dech <-chan zkapi.Event) {
+    defer close(o.changes)
+
+    for {
+        select {
+        case <-cech:
+        case <-dech:
+        case <-o.stop:
+            return
+        case <-o.c.done:
+            o.fail(ErrClientClosed)
+            return
+        }
+
+        var (
+            leader Leader
+            err error
+        )
+        for {
+            leader, cech, dech, err = o.load()
+            if err == nil {
+                break
+            }
+            select {
+            case <-time.After(watchRetryDelay):
+            case <-o.stop:
+                return
+            case <-o.c.done:
+                o.fail(ErrClientClosed)
+                return
+            }
+        }
+
+        o.mu.Lock()
+        changed := leader.Node != o.current.Node || !bytes.Equal(leader.Value, o.current.Value)
+        o.current = leader
+        o.mu.Unlock()
+
+        if !changed {
+            continue
+        }
+        select {
+        case o.changes <- leader:
+        case <-o.stop:
+            return
+        case <-o.c.done:
+            o.fail(ErrClientClosed)
+            return
+        }
+    }
+}
+
+func (o *LeaderObserver) Leader() Leader {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    return o.current
+}
+
+// Changes returns the channel of leader changes; it is closed once the observer is stopped.
+func (o *LeaderObserver) Changes() <-chan Leader {
+    return o.changes
+}
+
+func (o *LeaderObserver) Stop() {
+    o.stopOnce.Do(func() {
+        close(o.stop)
+    })
+}
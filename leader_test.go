@@ -0,0 +1,74 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+// Waits for the next leader change of o.
+func nextLeader(t *testing.T, o *LeaderObserver) Leader {
+    t.Helper()
+    select {
+    case leader, ok := <-o.Changes():
+        if !ok {
+            t.Fatal("Changes closed")
+        }
+        return leader
+    case <-time.After(5 * time.Second):
+        t.Fatal("no leader change")
+    }
+    return Leader{}
+}
+
+func TestObserveLeader(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/election", nil)
+    o, err := c.ObserveLeader("/election")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if leader := o.Leader(); leader.Node != "" {
+        t.Fatalf("leader %+v without contenders", leader)
+    }
+
+    // Put doesn't fire watches, contenders come and go through the client.
+    if _, err := c.Create("/election/_c_b-latch-0000000002", []byte("b"), false); err != nil {
+        t.Fatal(err)
+    }
+    if leader := nextLeader(t, o); leader.Node != "_c_b-latch-0000000002" || string(leader.Value) != "b" {
+        t.Fatalf("leader %+v, want b", leader)
+    }
+    // The lowest sequence number wins, whatever the prefix.
+    if _, err := c.Create("/election/_c_a-latch-0000000001", []byte("a"), false); err != nil {
+        t.Fatal(err)
+    }
+    if leader := nextLeader(t, o); string(leader.Value) != "a" {
+        t.Fatalf("leader %+v, want a", leader)
+    }
+    if _, err := c.Set("/election/_c_a-latch-0000000001", []byte("a2")); err != nil {
+        t.Fatal(err)
+    }
+    if leader := nextLeader(t, o); string(leader.Value) != "a2" {
+        t.Fatalf("leader %+v after its value changed", leader)
+    }
+
+    if err := c.Erase("/election/_c_a-latch-0000000001", 0); err != nil {
+        t.Fatal(err)
+    }
+    if leader := nextLeader(t, o); string(leader.Value) != "b" {
+        t.Fatalf("leader %+v after a resigned, want b", leader)
+    }
+    if o.Leader().Node != "_c_b-latch-0000000002" {
+        t.Errorf("Leader %+v", o.Leader())
+    }
+
+    o.Stop()
+    eventually(t, "Changes to close", func() bool {
+        _, ok := <-o.Changes()
+        return !ok
+    })
+}
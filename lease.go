@@ -0,0 +1,187 @@
+package goffkv_zk
+
+import (
+    "strings"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+type LeaseLossReason int
+
+const (
+    // The entry does not exist anymore.
+    LeaseErased LeaseLossReason = iota + 1
+    // The entry exists, but is owned by another session (or is not ephemeral).
+    LeaseForeign
+)
+
+// A leased entry created by this client that has disappeared without this client erasing it.
+type LeaseEvent struct {
+    Key string
+    Reason LeaseLossReason
+}
+
+// Leased entries created by this client, checked periodically.
+type leaseTracker struct {
+    interval time.Duration
+    onLoss func(LeaseEvent)
+
+    mu sync.Mutex
+    keys map[string]struct{}
+}
+
+// WithLeaseVerification makes the client check every interval that the leased entries it has
+// created still exist and belong to its session, and call onLoss (from a background goroutine)
+// for each one that doesn't. Lost entries are not checked anymore.
+func WithLeaseVerification(interval time.Duration, onLoss func(LeaseEvent)) Option {
+    return func(c *Client) {
+        c.leases = &leaseTracker{
+            interval: interval,
+            onLoss: onLoss,
+            keys: make(map[string]struct{}),
+        }
+    }
+}
+
+func (t *leaseTracker) track(key string) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.keys[key] = struct{}{}
+}
+
+// Forgets key and everything under it.
+func (t *leaseTracker) untrack(key string) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    for tracked := range t.keys {
+        if tracked == key || strings.HasPrefix(tracked, key + "/") {
+            delete(t.keys, tracked)
+        }
+    }
+}
+
+func (c *Client) verifyLeases() {
+    ticker := time.NewTicker(c.leases.interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+        case <-c.done:
+            return
+        }
+
+        c.leases.mu.Lock()
+        keys := make([]string, 0, len(c.leases.keys))
+        for key := range c.leases.keys {
+            keys = append(keys, key)
+        }
+        c.leases.mu.Unlock()
+
+        for _, key := range keys {
+            segments, err := c.disassembleKey(key)
+            if err != nil {
+                continue
+            }
+            // Background work, not reported to WithInstrumentation.
+            exists, stat, err := c.conn.Exists(c.assemblePath(segments))
+            if err != nil {
+                // Can't tell now; the next round will.
+                continue
+            }
+
+            var reason LeaseLossReason
+            switch {
+            case !exists:
+                reason = LeaseErased
+            case c.leaseTTL == 0 && stat.EphemeralOwner != c.conn.SessionID():
+                reason = LeaseForeign
+            default:
+                continue
+            }
+
+            c.leases.mu.Lock()
+            _, stillTracked := c.leases.keys[key]
+            delete(c.leases.keys, key)
+            c.leases.mu.Unlock()
+
+            if stillTracked && c.leases.onLoss != nil {
+                c.leases.onLoss(LeaseEvent{key, reason})
+            }
+        }
+    }
+}
+
+// WithLeasePatterns makes every entry whose key matches one of patterns be created as a lease,
+// whatever the caller passes. In a pattern, "*" matches a single segment, and a trailing "**"
+// matches one or more segments; e.g. "/presence/*" covers "/presence/host-1".
+func WithLeasePatterns(patterns ...string) Option {
+    return func(c *Client) {
+        for _, pattern := range patterns {
+            c.leasePatterns = append(c.leasePatterns, strings.Split(strings.TrimPrefix(pattern, "/"), "/"))
+        }
+    }
+}
+
+func matchKeyPattern(pattern []string, segments []string) bool {
+    for i, part := range pattern {
+        if part == "**" && i == len(pattern) - 1 {
+            return len(segments) > i
+        }
+        if i >= len(segments) || (part != "*" && part != segments[i]) {
+            return false
+        }
+    }
+    return len(segments) == len(pattern)
+}
+
+func (c *Client) leaseFlags(key string, lease bool) int32 {
+    if !lease && len(c.leasePatterns) != 0 {
+        segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+        for _, pattern := range c.leasePatterns {
+            if matchKeyPattern(pattern, segments) {
+                lease = true
+                break
+            }
+        }
+    }
+    switch {
+    case lease && c.leaseTTL > 0:
+        return zkapi.FlagTTL
+    case lease:
+        return zkapi.FlagEphemeral
+    }
+    return 0
+}
+
+// WithTTLLeases backs leases with TTL nodes (ZooKeeper 3.5.3+, with extendedTypesEnabled set on
+// the servers) instead of ephemeral ones: a leased entry outlives the session, so it survives a
+// restart of the client, and is erased by the servers once it has been left unmodified (and
+// without children) for ttl. Renew a lease by writing it, e.g. with Touch. The servers only
+// check now and then (every containerCheckIntervalMs), so a lease may outlive ttl by that much.
+// TTL leases can't be created by transactions (Commit fails with ErrTTLLeaseInTxn), and lease
+// verification only reports them erased, as they have no owning session.
+func WithTTLLeases(ttl time.Duration) Option {
+    return func(c *Client) {
+        c.leaseTTL = ttl
+    }
+}
+
+// Creates a node, with the TTL of leases if flags ask for one.
+func (c *Client) createNode(path string, data []byte, flags int32, acl []zkapi.ACL) (string, error) {
+    for {
+        var created string
+        var err error
+        if flags == zkapi.FlagTTL {
+            created, err = c.conn.CreateTTL(path, data, flags, acl, c.leaseTTL)
+        } else {
+            created, err = c.conn.Create(path, data, flags, acl)
+        }
+        if err != zkapi.ErrNoNode || !c.restorePrefix() {
+            return created, err
+        }
+    }
+}
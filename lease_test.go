@@ -0,0 +1,131 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+func TestLeaseVerification(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    events := make(chan LeaseEvent, 8)
+    c := newTestClient(t, zk, WithLeaseVerification(10 * time.Millisecond, func(e LeaseEvent) {
+        events <- e
+    }))
+    defer c.Close()
+    other := newTestClient(t, zk)
+    defer other.Close()
+
+    for _, key := range []string{"/erased", "/replaced", "/kept", "/released"} {
+        if _, err := c.Create(key, nil, true); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := c.Erase("/released", 0); err != nil {
+        t.Fatal(err)
+    }
+    if err := other.Erase("/erased", 0); err != nil {
+        t.Fatal(err)
+    }
+    if err := other.Erase("/replaced", 0); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := other.Create("/replaced", nil, true); err != nil {
+        t.Fatal(err)
+    }
+
+    lost := make(map[string]LeaseLossReason)
+    for len(lost) < 2 {
+        select {
+        case e := <-events:
+            if _, ok := lost[e.Key]; ok {
+                t.Fatalf("%s reported lost twice", e.Key)
+            }
+            lost[e.Key] = e.Reason
+        case <-time.After(5 * time.Second):
+            t.Fatalf("lost leases %v", lost)
+        }
+    }
+    if lost["/erased"] != LeaseErased || lost["/replaced"] != LeaseForeign {
+        t.Errorf("lost leases %v", lost)
+    }
+    select {
+    case e := <-events:
+        t.Errorf("unexpected %+v", e)
+    case <-time.After(50 * time.Millisecond):
+    }
+}
+
+func TestLeasePatterns(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithLeasePatterns("/presence/*", "/sessions/**"))
+    defer c.Close()
+
+    zk.Put("/test/presence", nil)
+    zk.Put("/test/sessions/a", nil)
+    for key, leased := range map[string]bool{
+        "/presence/h1": true,
+        "/sessions/a/b": true,
+        "/sessions/b": true,
+        "/other": false,
+    } {
+        if _, err := c.Create(key, nil, false); err != nil {
+            t.Fatalf("Create %s: %v", key, err)
+        }
+        _, stat, _ := zk.Node("/test" + key)
+        if got := stat.EphemeralOwner != 0; got != leased {
+            t.Errorf("%s leased: %v, want %v", key, got, leased)
+        }
+    }
+    if _, err := c.Set("/presence", nil); err != nil {
+        t.Fatal(err)
+    }
+    if _, stat, _ := zk.Node("/test/presence"); stat.EphemeralOwner != 0 {
+        t.Error("parent of a pattern leased")
+    }
+}
+
+func TestTTLLeases(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithTTLLeases(time.Minute))
+    defer c.Close()
+
+    if _, err := c.Create("/leased", []byte("v"), true); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Create("/kept", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if zk.Requests(fzCreateTTL) != 1 {
+        t.Fatalf("%d TTL creates", zk.Requests(fzCreateTTL))
+    }
+    _, stat, _ := zk.Node("/test/leased")
+    if kind, ttl := nodeKind(stat); kind != NodeTTL || ttl != time.Minute {
+        t.Fatalf("leased node is %v with TTL %v", kind, ttl)
+    }
+
+    zk.Expire()
+    if _, _, ok := zk.Node("/test/leased"); !ok {
+        t.Fatal("TTL lease ended with the session")
+    }
+    zk.Reap(time.Now())
+    if _, _, ok := zk.Node("/test/leased"); !ok {
+        t.Fatal("TTL lease reaped early")
+    }
+    zk.Reap(time.Now().Add(2 * time.Minute))
+    if _, _, ok := zk.Node("/test/leased"); ok {
+        t.Error("TTL lease outlived its TTL")
+    }
+    if _, _, ok := zk.Node("/test/kept"); !ok {
+        t.Error("persistent node reaped")
+    }
+
+    _, err := c.Commit(goffkv.Txn{Ops: []goffkv.Operation{{Key: "/txn", What: goffkv.Create, Lease: true}}})
+    if !errors.Is(err, ErrTTLLeaseInTxn) {
+        t.Errorf("leased create in a transaction: %v", err)
+    }
+}
@@ -0,0 +1,35 @@
+package goffkv_zk
+
+// WithLinearizableReads makes Exists, Get and Children (including ChildrenWith and GetEntry)
+// sync the server the client is attached to with the leader before reading, so that they
+// observe every write committed before the call. It costs an extra round trip per read, and
+// disables read coalescing.
+func WithLinearizableReads() Option {
+    return func(c *Client) {
+        c.linearizable = true
+    }
+}
+
+// Sync makes the following reads of key observe every write committed before the call, even if
+// the server the client is attached to lags behind the leader. Use it to get linearizable reads
+// per call rather than for the whole client.
+func (c *Client) Sync(key string) error {
+    return c.runOp("sync", key, false, func() error {
+        segments, err := c.disassembleKey(key)
+        if err != nil {
+            return err
+        }
+
+        _, err = c.conn.Sync(c.assemblePath(segments))
+        return convertError(err)
+    })
+}
+
+// Syncs path before a read if linearizable reads are enabled.
+func (c *Client) syncRead(path string) error {
+    if !c.linearizable {
+        return nil
+    }
+    _, err := c.conn.Sync(path)
+    return err
+}
@@ -0,0 +1,35 @@
+package goffkv_zk
+
+import (
+    "testing"
+)
+
+func TestLinearizableReads(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithLinearizableReads())
+    defer c.Close()
+    plain := newTestClient(t, zk)
+    defer plain.Close()
+
+    zk.Put("/test/k", []byte("v"))
+    syncs := zk.Requests(fzSync)
+    c.Exists("/k", false)
+    c.Get("/k", false)
+    c.Children("/k", false)
+    if n := zk.Requests(fzSync) - syncs; n != 3 {
+        t.Errorf("%d syncs for 3 linearizable reads", n)
+    }
+
+    syncs = zk.Requests(fzSync)
+    plain.Get("/k", false)
+    if zk.Requests(fzSync) != syncs {
+        t.Error("plain read synced")
+    }
+    if err := plain.Sync("/k"); err != nil {
+        t.Fatal(err)
+    }
+    if zk.Requests(fzSync) != syncs + 1 {
+        t.Error("Sync didn't sync")
+    }
+}
@@ -0,0 +1,367 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "path"
+    "sync"
+    "sync/atomic"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    lockNodeName = "lock-"
+)
+
+var (
+    ErrLockHeld = errors.New("lock is already held by this handle")
+    ErrNotLocked = errors.New("lock is not held by this handle")
+    ErrLockCancelled = errors.New("lock acquisition cancelled by Unlock")
+
+    errLockTimeout = errors.New("lock timeout")
+)
+
+type MutexOptions struct {
+    // If set, Lock on a handle that already holds the lock succeeds immediately and has to be
+    // matched by its own Unlock, like with Curator's InterProcessMutex. Otherwise it fails with
+    // ErrLockHeld instead of deadlocking.
+    Reentrant bool
+}
+
+// Distributed mutex using the layout of Curator's InterProcessMutex: contenders create protected
+// ephemeral sequential children "_c_<guid>-lock-<seq>" of the lock key, the lowest sequence wins.
+// The handle itself is safe for concurrent use. As a Readiness, it is ready once it has
+// acquired the lock for the first time (e.g. to serve only as the single active instance), and
+// fails with ErrClientClosed if the client is closed while a Lock waits.
+type Mutex struct {
+    *gate
+    c *Client
+    segments []string
+    opts MutexOptions
+    // Name of the contender nodes, and the predecessors this handle waits for.
+    nodeName string
+    blocks func(name string) bool
+
+    mu sync.Mutex
+    node string
+    // Copy of node, read by the blocks function of a read lock.
+    heldNode atomic.Value
+    holds int
+    lost chan struct{}
+    stopWatching func()
+    // Set while a Lock is waiting: closed once it is done, and closed by Unlock to cancel it.
+    pending chan struct{}
+    abort chan struct{}
+}
+
+// Mutex returns a handle of the lock at key; nothing is created until Lock is called.
+func (c *Client) Mutex(key string, opts MutexOptions) (*Mutex, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Mutex{
+        gate: newGate(),
+        c: c,
+        segments: segments,
+        opts: opts,
+        nodeName: lockNodeName,
+        blocks: func(string) bool { return true },
+    }, nil
+}
+
+// Creates a protected ephemeral sequential node "<name><seq>" under segments.
+// Returns its path.
+func (c *Client) enqueue(segments []string, name string, data []byte) (string, error) {
+    err := c.createEachPrefix(append(append([]string{}, c.prefixSegments...), segments...))
+    if err != nil {
+        return "", err
+    }
+    return c.conn.CreateProtectedEphemeralSequential(c.assemblePath(segments) + "/" + name, data, c.acl)
+}
+
+// Waits until no sibling of node for which blocks returns true has a lower sequence number.
+// If cancel is closed first, node is deleted and errCancelled is returned. Fails with
+// zk.ErrSessionExpired as soon as the session expires, since node is gone then.
+func (c *Client) waitTurn(node string, blocks func(name string) bool, cancel <-chan struct{}, errCancelled error) error {
+    expired, stopWatching := c.sessionExpiry()
+    defer stopWatching()
+
+    dir, name := path.Split(node)
+    dir = path.Clean(dir)
+    ourSeq := sequenceOf(name)
+
+    for {
+        children, _, err := c.conn.Children(dir)
+        if err != nil {
+            return err
+        }
+
+        var (
+            predecessor string
+            predecessorSeq int64 = -1
+            found bool
+        )
+        for _, child := range children {
+            if child == name {
+                found = true
+                continue
+            }
+            seq := sequenceOf(child)
+            if seq >= 0 && seq < ourSeq && seq > predecessorSeq && blocks(child) {
+                predecessor, predecessorSeq = child, seq
+            }
+        }
+        if !found {
+            // Our node is gone, most likely because the session has expired.
+            return zkapi.ErrNoNode
+        }
+        if predecessorSeq < 0 {
+            return nil
+        }
+
+        exists, _, ech, err := c.conn.ExistsW(dir + "/" + predecessor)
+        if err != nil {
+            return err
+        }
+        if !exists {
+            continue
+        }
+
+        select {
+        case <-ech:
+        case <-cancel:
+            c.conn.Delete(node, -1)
+            return errCancelled
+        case <-expired:
+            return zkapi.ErrSessionExpired
+        case <-c.done:
+            return ErrClientClosed
+        }
+    }
+}
+
+// Lock acquires the lock at key with a new non-reentrant handle, waiting as long as it takes.
+func (c *Client) Lock(key string) (*Mutex, error) {
+    m, err := c.Mutex(key, MutexOptions{})
+    if err != nil {
+        return nil, err
+    }
+    err = m.Lock()
+    if err != nil {
+        return nil, err
+    }
+    return m, nil
+}
+
+// TryLock acquires the lock at key with a new non-reentrant handle if it can within timeout
+// (at once if 0); returns nil if it can't.
+func (c *Client) TryLock(key string, timeout time.Duration) (*Mutex, error) {
+    m, err := c.Mutex(key, MutexOptions{})
+    if err != nil {
+        return nil, err
+    }
+    ok, err := m.TryLock(timeout)
+    if err != nil || !ok {
+        return nil, err
+    }
+    return m, nil
+}
+
+// Unlock releases a lock acquired by Client.Lock or Client.TryLock.
+func (c *Client) Unlock(m *Mutex) error {
+    return m.Unlock()
+}
+
+func (m *Mutex) Lock() error {
+    start := time.Now()
+    _, err := m.acquire(nil)
+    m.c.observe("lock", normalizeKey(m.segments), start, err)
+    return err
+}
+
+// TryLock works like Lock, but gives up after timeout (at once if 0), like Curator's
+// acquire(time, unit); it reports whether the lock has been acquired.
+func (m *Mutex) TryLock(timeout time.Duration) (bool, error) {
+    cancel := make(chan struct{})
+    if timeout <= 0 {
+        close(cancel)
+    } else {
+        timer := time.AfterFunc(timeout, func() {
+            close(cancel)
+        })
+        defer timer.Stop()
+    }
+    start := time.Now()
+    ok, err := m.acquire(cancel)
+    m.c.observe("lock", normalizeKey(m.segments), start, err)
+    return ok, err
+}
+
+// Waits for the lock until cancel is closed (forever if nil). mu is only held to inspect and
+// publish the state of the handle, so that Holds, Lost and Unlock don't wait for the acquisition.
+func (m *Mutex) acquire(cancel <-chan struct{}) (bool, error) {
+    m.mu.Lock()
+    for m.holds == 0 && m.pending != nil {
+        // Another Lock on the handle is waiting; its outcome decides.
+        pending := m.pending
+        m.mu.Unlock()
+        select {
+        case <-pending:
+        case <-cancel:
+            return false, nil
+        }
+        m.mu.Lock()
+    }
+    if m.holds > 0 {
+        defer m.mu.Unlock()
+        if !m.opts.Reentrant {
+            return false, ErrLockHeld
+        }
+        m.holds++
+        return true, nil
+    }
+    pending := make(chan struct{})
+    abort := make(chan struct{})
+    m.pending, m.abort = pending, abort
+    m.mu.Unlock()
+
+    stop := make(chan struct{})
+    go func() {
+        select {
+        case <-cancel:
+        case <-abort:
+        case <-pending:
+            return
+        }
+        close(stop)
+    }()
+
+    node, err := m.c.enqueue(m.segments, m.nodeName, nil)
+    if err == nil {
+        err = m.c.waitTurn(node, m.blocks, stop, errLockTimeout)
+        if err != nil && err != errLockTimeout {
+            m.c.conn.Delete(node, -1)
+        }
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.pending, m.abort = nil, nil
+    close(pending)
+
+    select {
+    case <-abort:
+        // Cancelled by Unlock, possibly after the lock has been acquired.
+        if err == nil {
+            go m.c.conn.Delete(node, -1)
+        }
+        return false, ErrLockCancelled
+    default:
+    }
+    if err == errLockTimeout {
+        return false, nil
+    }
+    if err != nil {
+        select {
+        case <-m.c.done:
+            m.fail(ErrClientClosed)
+        default:
+        }
+        return false, convertError(err)
+    }
+
+    m.node = node
+    m.heldNode.Store(node)
+    m.holds = 1
+    if m.nodeName != readLockNodeName {
+        m.c.heldLocks.add(normalizeKey(m.segments))
+    }
+    m.lost = make(chan struct{})
+    m.stopWatching = m.c.OnSessionState(func(state SessionState) {
+        if state == SessionExpired {
+            go m.loseLock(node)
+        }
+    })
+    m.markReady()
+    return true, nil
+}
+
+// Drops the lock held through node, whose session has expired.
+func (m *Mutex) loseLock(node string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if m.node != node {
+        return
+    }
+    m.release()
+}
+
+func (m *Mutex) release() {
+    // Read locks don't grant write access to namespaces.
+    if m.nodeName != readLockNodeName {
+        m.c.heldLocks.remove(normalizeKey(m.segments))
+    }
+    m.stopWatching()
+    close(m.lost)
+    m.node = ""
+    m.heldNode.Store("")
+    m.holds = 0
+}
+
+// Lost returns a channel closed once the lock currently held is released, either by Unlock or
+// because the session has expired (in which case Unlock fails with ErrNotLocked). Nil if the lock
+// isn't held.
+func (m *Mutex) Lost() <-chan struct{} {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if m.holds == 0 {
+        return nil
+    }
+    return m.lost
+}
+
+// Unlock releases the lock once it has been unlocked as many times as it has been locked. With
+// no lock held but a Lock of the handle pending, it cancels that Lock, which fails with
+// ErrLockCancelled.
+func (m *Mutex) Unlock() (err error) {
+    start := time.Now()
+    defer func() {
+        m.c.observe("unlock", normalizeKey(m.segments), start, err)
+    }()
+    m.mu.Lock()
+    if m.holds == 0 {
+        defer m.mu.Unlock()
+        if m.abort != nil {
+            close(m.abort)
+            m.abort = nil
+            return nil
+        }
+        return ErrNotLocked
+    }
+    m.holds--
+    if m.holds > 0 {
+        m.mu.Unlock()
+        return nil
+    }
+    node := m.node
+    m.release()
+    m.mu.Unlock()
+
+    err = m.c.conn.Delete(node, -1)
+    if err != nil && err != zkapi.ErrNoNode {
+        return convertError(err)
+    }
+    return nil
+}
+
+// Holds returns how many times the handle currently holds the lock.
+func (m *Mutex) Holds() int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    return m.holds
+}
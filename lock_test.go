@@ -0,0 +1,233 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+// Returns the contender nodes of the lock at /test/lock.
+func contenders(zk *fakeZK) []string {
+    var result []string
+    for _, p := range zk.Paths("/test/lock") {
+        if p != "/test/lock" {
+            result = append(result, p)
+        }
+    }
+    return result
+}
+
+func TestMutexExcludes(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    a, err := c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if b, err := c.TryLock("/lock", 50 * time.Millisecond); err != nil || b != nil {
+        t.Fatalf("TryLock of a held lock: %v, %v", b, err)
+    }
+    if n := len(contenders(zk)); n != 1 {
+        t.Fatalf("%d contenders after a TryLock timed out, want 1", n)
+    }
+
+    lost := a.Lost()
+    if err := a.Unlock(); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-lost:
+    default:
+        t.Error("Lost not closed by Unlock")
+    }
+    b, err := c.TryLock("/lock", time.Second)
+    if err != nil || b == nil {
+        t.Fatalf("TryLock of a released lock: %v, %v", b, err)
+    }
+    if err := a.Unlock(); err != ErrNotLocked {
+        t.Errorf("Unlock of a released handle: %v, want ErrNotLocked", err)
+    }
+}
+
+// A pending Lock doesn't block the other methods of its handle, and Unlock cancels it.
+func TestMutexPendingLock(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    if _, err := c.Lock("/lock"); err != nil {
+        t.Fatal(err)
+    }
+    m, err := c.Mutex("/lock", MutexOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    result := make(chan error, 1)
+    go func() {
+        result <- m.Lock()
+    }()
+    eventually(t, "the pending contender", func() bool {
+        return len(contenders(zk)) == 2
+    })
+
+    done := make(chan struct{})
+    go func() {
+        m.Holds()
+        m.Lost()
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("Holds and Lost block during a pending Lock")
+    }
+    if m.Holds() != 0 || m.Lost() != nil {
+        t.Errorf("pending handle: Holds %d, Lost %v", m.Holds(), m.Lost())
+    }
+
+    if err := m.Unlock(); err != nil {
+        t.Fatalf("Unlock of a pending Lock: %v", err)
+    }
+    select {
+    case err := <-result:
+        if err != ErrLockCancelled {
+            t.Errorf("cancelled Lock: %v, want ErrLockCancelled", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Unlock didn't cancel the pending Lock")
+    }
+    eventually(t, "the cancelled contender to go", func() bool {
+        return len(contenders(zk)) == 1
+    })
+}
+
+func TestMutexReentrant(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    holder, err := c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    m, err := c.Mutex("/lock", MutexOptions{Reentrant: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Both wait for the holder: the second one through the first one.
+    results := make(chan error, 2)
+    for i := 0; i < 2; i++ {
+        go func() {
+            results <- m.Lock()
+        }()
+    }
+    time.Sleep(50 * time.Millisecond)
+    if m.Holds() != 0 {
+        t.Fatalf("Holds %d before the lock is free", m.Holds())
+    }
+    if err := holder.Unlock(); err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < 2; i++ {
+        if err := <-results; err != nil {
+            t.Fatal(err)
+        }
+    }
+    if m.Holds() != 2 || len(contenders(zk)) != 1 {
+        t.Fatalf("Holds %d with %d contenders, want 2 with 1", m.Holds(), len(contenders(zk)))
+    }
+
+    m.Unlock()
+    if m.Holds() != 1 || len(contenders(zk)) != 1 {
+        t.Fatal("the first Unlock of two released the lock")
+    }
+    m.Unlock()
+    if m.Holds() != 0 || len(contenders(zk)) != 0 {
+        t.Fatal("the last Unlock didn't release the lock")
+    }
+
+    plain, err := c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ok, err := plain.TryLock(0); ok || err != ErrLockHeld {
+        t.Errorf("Lock of a held non-reentrant handle: %v, %v, want ErrLockHeld", ok, err)
+    }
+}
+
+func TestMutexLostWithSession(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    m, err := c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    lost := m.Lost()
+    zk.Expire()
+    select {
+    case <-lost:
+    case <-time.After(5 * time.Second):
+        t.Fatal("lock not lost with the session")
+    }
+    if err := m.Unlock(); err != ErrNotLocked {
+        t.Errorf("Unlock of a lost lock: %v, want ErrNotLocked", err)
+    }
+}
+
+func TestMutexReadiness(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+
+    holder, err := c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-holder.Ready():
+    default:
+        t.Fatal("not ready once acquired")
+    }
+    // Stays ready once released.
+    holder.Unlock()
+    select {
+    case <-holder.Ready():
+    default:
+        t.Fatal("not ready after Unlock")
+    }
+
+    if _, err := c.Lock("/lock"); err != nil {
+        t.Fatal(err)
+    }
+    m, err := c.Mutex("/lock", MutexOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    go m.Lock()
+    eventually(t, "the pending contender", func() bool {
+        return len(contenders(zk)) == 2
+    })
+    select {
+    case <-m.Ready():
+        t.Fatal("ready while waiting")
+    default:
+    }
+
+    c.Close()
+    select {
+    case <-m.Ready():
+    case <-time.After(time.Second):
+        t.Fatal("not ready once the client is closed")
+    }
+    if m.Err() != ErrClientClosed {
+        t.Errorf("Err: %v, want ErrClientClosed", m.Err())
+    }
+}
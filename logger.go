@@ -0,0 +1,14 @@
+package goffkv_zk
+
+// Receives the log lines of a client: connection events from the driver, retries, and restarts
+// of transactions and erases. Satisfied by *log.Logger; adapt structured loggers with a wrapper.
+type Logger interface {
+    Printf(format string, args ...interface{})
+}
+
+// WithLogger sends the log lines of the client to logger instead of the standard logger.
+func WithLogger(logger Logger) Option {
+    return func(c *Client) {
+        c.logger = logger
+    }
+}
@@ -0,0 +1,110 @@
+package goffkv_zk
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// Receives the outcome of every operation of a client (e.g. to feed Prometheus or statsd).
+// op is the name of the operation: "create", "set", "cas", "erase", "exists", "get", "children",
+// "commit", "batch" (see WithWriteBatching), "freeze", "unfreeze", "sync", "tree" (TreeVersion),
+// "count" (CountChildren), "acl" (HardenPrefix), "compact", "lock" (its latency includes the
+// wait), "unlock", "register", "unregister" or "discover" (Registry.Services and Instances);
+// latency includes retries. Long-lived watches report the lag of their events (see WatchStats)
+// as "watch" ops. Work the client does in the background (lease verification, watches being
+// set again, ServiceCache reloads, the chunks read by a GetStream reader) isn't reported.
+// Implementations must be safe for concurrent use and must not block.
+type Instrumentation interface {
+    Observe(op string, latency time.Duration, err error)
+}
+
+type InstrumentationFunc func(op string, latency time.Duration, err error)
+
+func (f InstrumentationFunc) Observe(op string, latency time.Duration, err error) {
+    f(op, latency, err)
+}
+
+// WithInstrumentation reports every operation to instr.
+func WithInstrumentation(instr Instrumentation) Option {
+    return func(c *Client) {
+        c.instr = instr
+    }
+}
+
+// Timings of the operations served by a single ensemble member.
+type ServerTiming struct {
+    Requests uint64
+    // Requests failed for reasons other than their outcome (missing keys, failed transactions...).
+    Errors uint64
+    TotalLatency time.Duration
+    MaxLatency time.Duration
+}
+
+func (t ServerTiming) AvgLatency() time.Duration {
+    if t.Requests == 0 {
+        return 0
+    }
+    return t.TotalLatency / time.Duration(t.Requests)
+}
+
+type serverTimings struct {
+    mu sync.Mutex
+    all map[string]ServerTiming
+}
+
+// Runs fn as op on key the way the basic operations run: panics are recovered, transient
+// failures retried (writes only if the retry policy says so), errors wrapped and the outcome
+// observed.
+func (c *Client) runOp(op string, key string, write bool, fn func() error) (err error) {
+    defer c.recoverPanic(op, key, &err)
+    start := time.Now()
+    err = c.retry(context.Background(), write, fn)
+    err = c.wrapError(op, key, err)
+    c.observe(op, key, start, err)
+    return
+}
+
+func (c *Client) observe(op string, key string, start time.Time, err error) {
+    latency := time.Since(start)
+    c.keyStats.record(op, key)
+    if c.instr != nil {
+        c.instr.Observe(op, latency, err)
+    }
+
+    // Attributed to the member the client is attached to by the end of the operation.
+    server := c.conn.Server()
+    if server == "" {
+        return
+    }
+
+    c.timings.mu.Lock()
+    defer c.timings.mu.Unlock()
+
+    if c.timings.all == nil {
+        c.timings.all = make(map[string]ServerTiming)
+    }
+    timing := c.timings.all[server]
+    timing.Requests++
+    if _, ok := err.(*Error); ok {
+        timing.Errors++
+    }
+    timing.TotalLatency += latency
+    if latency > timing.MaxLatency {
+        timing.MaxLatency = latency
+    }
+    c.timings.all[server] = timing
+}
+
+// ServerTimings returns the latency and error counts of the operations of the client, per
+// ensemble member, to spot a slow or flaky member.
+func (c *Client) ServerTimings() map[string]ServerTiming {
+    c.timings.mu.Lock()
+    defer c.timings.mu.Unlock()
+
+    result := make(map[string]ServerTiming, len(c.timings.all))
+    for server, timing := range c.timings.all {
+        result[server] = timing
+    }
+    return result
+}
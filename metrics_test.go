@@ -0,0 +1,140 @@
+package goffkv_zk
+
+import (
+    "sync"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+type observation struct {
+    op string
+    err error
+}
+
+type recorder struct {
+    mu sync.Mutex
+    all []observation
+}
+
+func (r *recorder) Observe(op string, latency time.Duration, err error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.all = append(r.all, observation{op, err})
+}
+
+func (r *recorder) observations() []observation {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    return append([]observation(nil), r.all...)
+}
+
+func TestInstrumentation(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    r := &recorder{}
+    c := newTestClient(t, zk, WithInstrumentation(r))
+    defer c.Close()
+
+    c.Create("/k", []byte("v"), false)
+    c.Get("/k", false)
+    c.Get("/missing", false)
+    c.Erase("/k", 0)
+    got := r.observations()
+    want := []string{"create", "get", "get", "erase"}
+    if len(got) != len(want) {
+        t.Fatalf("observed %+v, want %v", got, want)
+    }
+    for i, o := range got {
+        if o.op != want[i] {
+            t.Errorf("observation %d is %q, want %q", i, o.op, want[i])
+        }
+    }
+    if got[1].err != nil || got[2].err != goffkv.OpErrNoEntry {
+        t.Errorf("errors observed: %v and %v", got[1].err, got[2].err)
+    }
+
+    var funcs int
+    c2 := newTestClient(t, zk, WithInstrumentation(InstrumentationFunc(func(op string, latency time.Duration, err error) {
+        funcs++
+    })))
+    defer c2.Close()
+    c2.Exists("/k", false)
+    if funcs != 1 {
+        t.Errorf("InstrumentationFunc called %d times", funcs)
+    }
+}
+
+func TestServerTimings(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    c.Set("/k", []byte("v"))
+    // A missing key is the outcome of the operation, not a failure of the member.
+    c.Get("/missing", false)
+    zk.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            return zkapi.ErrSessionMoved
+        }
+        return nil
+    })
+    c.Get("/k", false)
+
+    timings := c.ServerTimings()
+    timing, ok := timings[zk.Addr()]
+    if len(timings) != 1 || !ok {
+        t.Fatalf("timings %+v, want those of %s", timings, zk.Addr())
+    }
+    if timing.Requests != 3 || timing.Errors != 1 {
+        t.Errorf("timing %+v, want 3 requests with 1 error", timing)
+    }
+    if timing.MaxLatency <= 0 || timing.AvgLatency() > timing.MaxLatency {
+        t.Errorf("latencies of %+v", timing)
+    }
+    if (ServerTiming{}).AvgLatency() != 0 {
+        t.Error("average latency of no requests")
+    }
+}
+
+func TestInstrumentationCoverage(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    r := &recorder{}
+    c := newTestClient(t, zk, WithInstrumentation(r))
+    defer c.Close()
+
+    zk.Put("/test/k/a", []byte("v"))
+    c.TreeVersion("/k")
+    c.CountChildren("/k", true)
+    c.Sync("/k")
+    c.ExistsEvent("/k")
+    c.GetEvent("/k")
+    c.ChildrenEvent("/k")
+    if stream, err := c.GetStream("/k/a"); err == nil {
+        stream.Close()
+    }
+    c.Compact("/k", RetentionPolicy{MaxCount: 1}, CompactOptions{})
+    if m, err := c.Lock("/lock"); err == nil {
+        c.Unlock(m)
+    }
+    if registry, err := c.Registry("/services"); err == nil {
+        registry.Register(ServiceInstance{Name: "api", ID: "1"})
+        registry.Services()
+    }
+
+    want := []string{"tree", "count", "sync", "exists", "get", "children", "get", "compact", "lock", "unlock", "register", "discover"}
+    got := r.observations()
+    if len(got) != len(want) {
+        t.Fatalf("observed %+v, want %v", got, want)
+    }
+    for i, o := range got {
+        if o.op != want[i] || o.err != nil {
+            t.Errorf("observation %d is %+v, want %q", i, o, want[i])
+        }
+    }
+}
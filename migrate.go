@@ -0,0 +1,113 @@
+package goffkv_zk
+
+import (
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "errors"
+    "hash"
+    "sort"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var (
+    ErrChecksumMismatch = errors.New("migrated subtree differs from the source")
+)
+
+// Outcome of Migrate. Checksum is the SHA-256 of the subtree (keys relative to the migrated key,
+// and values), as hex; it doesn't depend on the backend.
+type MigrateResult struct {
+    Keys int
+    Bytes int64
+    Checksum string
+}
+
+// Visits the subtree of client at key, parents first and siblings sorted, without watches. Keys
+// erased during the walk are skipped, but key itself must exist.
+func walkTree(client goffkv.Client, key string, fn func(key string, value []byte) error) error {
+    _, value, _, err := client.Get(key, false)
+    if err != nil {
+        return KeyError{key, err}
+    }
+    err = fn(key, value)
+    if err != nil {
+        return err
+    }
+
+    children, _, err := client.Children(key, false)
+    if err == goffkv.OpErrNoEntry {
+        return nil
+    }
+    if err != nil {
+        return KeyError{key, err}
+    }
+    // Backends don't agree on the order of children.
+    sort.Strings(children)
+    for _, child := range children {
+        err = walkTree(client, child, fn)
+        if keyErr, ok := err.(KeyError); ok && keyErr.Key == child && keyErr.Err == goffkv.OpErrNoEntry {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func hashNode(h hash.Hash, key string, value []byte) {
+    var size [8]byte
+    binary.BigEndian.PutUint64(size[:], uint64(len(key)))
+    h.Write(size[:])
+    h.Write([]byte(key))
+    binary.BigEndian.PutUint64(size[:], uint64(len(value)))
+    h.Write(size[:])
+    h.Write(value)
+}
+
+// Checksum returns the SHA-256 of the subtree of client at key, as computed by Migrate.
+func Checksum(client goffkv.Client, key string) (string, error) {
+    h := sha256.New()
+    err := walkTree(client, key, func(nodeKey string, value []byte) error {
+        hashNode(h, nodeKey[len(key):], value)
+        return nil
+    })
+    if err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Migrate copies the subtree at key from src to dst, which may be clients of different backends
+// (e.g. Consul and ZooKeeper), then checks that both subtrees have the same checksum. Keys are
+// written with Set, parents first, so existing keys of dst are overwritten; the parent of key must
+// exist in dst. Versions and leases aren't copied. The subtree of src should not change meanwhile,
+// and dst must not have other keys under key, otherwise the check fails with
+// ErrChecksumMismatch; the copy can be run again.
+func Migrate(src goffkv.Client, dst goffkv.Client, key string) (MigrateResult, error) {
+    var result MigrateResult
+    h := sha256.New()
+    err := walkTree(src, key, func(nodeKey string, value []byte) error {
+        _, err := dst.Set(nodeKey, value)
+        if err != nil {
+            return KeyError{nodeKey, err}
+        }
+        hashNode(h, nodeKey[len(key):], value)
+        result.Keys++
+        result.Bytes += int64(len(value))
+        return nil
+    })
+    if err != nil {
+        return result, err
+    }
+    result.Checksum = hex.EncodeToString(h.Sum(nil))
+
+    checksum, err := Checksum(dst, key)
+    if err != nil {
+        return result, err
+    }
+    if checksum != result.Checksum {
+        return result, ErrChecksumMismatch
+    }
+    return result, nil
+}
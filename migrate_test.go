@@ -0,0 +1,49 @@
+package goffkv_zk
+
+import (
+    "testing"
+)
+
+func TestMigrate(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/app", []byte("root"))
+    zk.Put("/test/app/b", []byte("bb"))
+    zk.Put("/test/app/a", nil)
+    zk.Put("/test/app/a/c", []byte("c"))
+
+    m := NewMock()
+    defer m.Close()
+    result, err := Migrate(c, m, "/app")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.Keys != 4 || result.Bytes != 7 {
+        t.Errorf("migrated %+v, want 4 keys of 7 bytes", result)
+    }
+    if _, value, _, err := m.Get("/app/a/c", false); err != nil || string(value) != "c" {
+        t.Errorf("migrated value %q, %v", value, err)
+    }
+
+    // The checksum doesn't depend on the backend, and catches extra keys.
+    if sum, err := Checksum(c, "/app"); err != nil || sum != result.Checksum {
+        t.Errorf("source checksum %s, %v, want %s", sum, err, result.Checksum)
+    }
+    if _, err := m.Create("/app/extra", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := Migrate(c, m, "/app"); err != ErrChecksumMismatch {
+        t.Errorf("Migrate onto extra keys: %v, want ErrChecksumMismatch", err)
+    }
+
+    // And back, extra key included.
+    if _, err := Migrate(m, c, "/app"); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, ok := zk.Node("/test/app/extra"); !ok {
+        t.Error("extra key not migrated back")
+    }
+}
@@ -0,0 +1,284 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var (
+    ErrMirrorConflict = errors.New("key modified on the mirror side")
+)
+
+// What a Mirror does with a key modified on the target since it last wrote it (or that it
+// didn't create).
+type MirrorConflictPolicy int
+
+const (
+    // The source wins: the key is overwritten (or erased).
+    MirrorOverwrite MirrorConflictPolicy = iota
+    // The target wins: the change is skipped, and so are later ones of the key.
+    MirrorSkip
+    // The mirror stops, with ErrMirrorConflict (wrapped in a KeyError) as its Err.
+    MirrorFail
+)
+
+// Versions of a mirrored key, as of its last replayed change.
+type MirroredVersions struct {
+    Source uint64 `json:"source"`
+    Target uint64 `json:"target"`
+}
+
+// What a Mirror has replayed, by key relative to the mirrored key ("" for the key itself). It
+// can be serialized as JSON, to resume mirroring later without copying everything again.
+type MirrorProgress struct {
+    Keys map[string]MirroredVersions `json:"keys"`
+}
+
+type MirrorOptions struct {
+    Conflict MirrorConflictPolicy
+    // Progress of a previous mirror of the same subtrees, to resume from.
+    Resume *MirrorProgress
+    // Called from the goroutine of the mirror for every conflict, whatever the policy.
+    OnConflict func(key string)
+}
+
+// Replays the changes of a subtree of a client (as seen by a TreeCache) to another goffkv client,
+// e.g. of another ensemble or backend. Changes are replayed in order, but intermediate values may
+// be skipped. Ready is closed once the initial copy is done.
+type Mirror struct {
+    *gate
+    src *Client
+    srcKey string
+    dst goffkv.Client
+    dstKey string
+    opts MirrorOptions
+    cache *TreeCache
+    changed chan struct{}
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.Mutex
+    queue []TreeEvent
+    progress map[string]MirroredVersions
+}
+
+// Mirror copies the subtree of c at key to dst at dstKey, and keeps replaying its changes until
+// Stop is called. The parent of dstKey must exist in dst.
+func (c *Client) Mirror(key string, dst goffkv.Client, dstKey string, opts MirrorOptions) (*Mirror, error) {
+    m := &Mirror{
+        gate: newGate(),
+        src: c,
+        srcKey: key,
+        dst: dst,
+        dstKey: dstKey,
+        opts: opts,
+        changed: make(chan struct{}, 1),
+        stop: make(chan struct{}),
+        progress: make(map[string]MirroredVersions),
+    }
+    if opts.Resume != nil {
+        for rel, versions := range opts.Resume.Keys {
+            m.progress[rel] = versions
+        }
+    }
+
+    cache, err := c.TreeCache(key, m.push)
+    if err != nil {
+        return nil, err
+    }
+    m.cache = cache
+    go m.loop()
+    return m, nil
+}
+
+func (m *Mirror) push(event TreeEvent) {
+    m.mu.Lock()
+    m.queue = append(m.queue, event)
+    m.mu.Unlock()
+    select {
+    case m.changed <- struct{}{}:
+    default:
+    }
+}
+
+// Queues the removal of the keys replayed before a restart which are gone from the source.
+func (m *Mirror) reconcile() {
+    m.mu.Lock()
+    gone := []string{}
+    for rel := range m.progress {
+        if _, _, ok := m.cache.Get(m.srcKey + rel); !ok {
+            gone = append(gone, rel)
+        }
+    }
+    m.mu.Unlock()
+
+    // Children first, like the removals of the cache.
+    sort.Sort(sort.Reverse(sort.StringSlice(gone)))
+    for _, rel := range gone {
+        m.push(TreeEvent{Type: TreeNodeRemoved, Key: m.srcKey + rel})
+    }
+}
+
+func (m *Mirror) conflict(key string) error {
+    if m.opts.OnConflict != nil {
+        m.opts.OnConflict(key)
+    }
+    if m.opts.Conflict == MirrorFail {
+        return KeyError{key, ErrMirrorConflict}
+    }
+    m.src.logger.Printf("mirror: %s modified on the target, skipped", key)
+    return nil
+}
+
+// Replays event. Errors other than conflicts (under MirrorFail) are worth a retry.
+func (m *Mirror) replay(event TreeEvent) error {
+    rel := strings.TrimPrefix(event.Key, m.srcKey)
+    key := m.dstKey + rel
+
+    m.mu.Lock()
+    record, known := m.progress[rel]
+    m.mu.Unlock()
+
+    if event.Type == TreeNodeRemoved {
+        if !known && m.opts.Conflict != MirrorOverwrite {
+            // Never replayed: whatever the target has isn't ours.
+            return nil
+        }
+        ver := goffkv.Version(0)
+        if m.opts.Conflict != MirrorOverwrite {
+            current, _, err := m.dst.Exists(key, false)
+            if err != nil {
+                return err
+            }
+            if current != 0 && current != record.Target {
+                return m.conflict(key)
+            }
+            ver = current
+        }
+        err := m.dst.Erase(key, ver)
+        if err != nil && err != goffkv.OpErrNoEntry {
+            return err
+        }
+
+        m.mu.Lock()
+        delete(m.progress, rel)
+        m.mu.Unlock()
+        return nil
+    }
+
+    if known && record.Source == event.Ver {
+        // Replayed before a restart.
+        return nil
+    }
+
+    var (
+        ver goffkv.Version
+        err error
+    )
+    if m.opts.Conflict == MirrorOverwrite {
+        ver, err = m.dst.Set(key, event.Value)
+    } else {
+        ver, err = m.dst.Cas(key, event.Value, record.Target)
+        if err == nil && ver == 0 || err == goffkv.OpErrNoEntry {
+            // Modified, or erased (along with the key or its parent), on the target.
+            return m.conflict(key)
+        }
+    }
+    if err != nil {
+        return err
+    }
+
+    m.mu.Lock()
+    m.progress[rel] = MirroredVersions{Source: event.Ver, Target: ver}
+    m.mu.Unlock()
+    return nil
+}
+
+func (m *Mirror) loop() {
+    defer m.cache.Stop()
+
+    select {
+    case <-m.cache.Ready():
+    case <-m.stop:
+        return
+    }
+    if m.cache.Err() != nil {
+        m.fail(m.cache.Err())
+        return
+    }
+    m.reconcile()
+
+    for {
+        for {
+            m.mu.Lock()
+            if len(m.queue) == 0 {
+                m.mu.Unlock()
+                break
+            }
+            event := m.queue[0]
+            m.mu.Unlock()
+
+            err := m.replay(event)
+            if errors.Is(err, ErrMirrorConflict) {
+                m.fail(err)
+                return
+            }
+            if err != nil {
+                m.src.logger.Printf("mirror: replaying %s: %v", event.Key, err)
+                select {
+                case <-time.After(watchRetryDelay):
+                    continue
+                case <-m.stop:
+                    return
+                case <-m.src.done:
+                    m.fail(ErrClientClosed)
+                    return
+                }
+            }
+
+            m.mu.Lock()
+            m.queue = m.queue[1:]
+            m.mu.Unlock()
+        }
+        m.markReady()
+
+        select {
+        case <-m.changed:
+        case <-m.stop:
+            return
+        case <-m.src.done:
+            m.fail(ErrClientClosed)
+            return
+        }
+    }
+}
+
+// Progress returns what has been replayed so far, to be saved for MirrorOptions.Resume.
+func (m *Mirror) Progress() MirrorProgress {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    result := MirrorProgress{Keys: make(map[string]MirroredVersions, len(m.progress))}
+    for rel, versions := range m.progress {
+        result.Keys[rel] = versions
+    }
+    return result
+}
+
+// Backlog returns the number of changes not replayed yet.
+func (m *Mirror) Backlog() int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    return len(m.queue)
+}
+
+func (m *Mirror) Stop() {
+    m.stopOnce.Do(func() {
+        close(m.stop)
+    })
+}
@@ -0,0 +1,83 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+// Waits until the value of key in m is value ("" for a missing key).
+func mirrored(t *testing.T, m *Mock, key string, value string) {
+    t.Helper()
+    eventually(t, key + " on the target", func() bool {
+        ver, data, _, _ := m.Get(key, false)
+        return value == "" && ver == 0 || ver != 0 && string(data) == value
+    })
+}
+
+func TestMirror(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+    dst := NewMock()
+    defer dst.Close()
+
+    zk.Put("/test/src", []byte("root"))
+    zk.Put("/test/src/a", []byte("a"))
+    mirror, err := c.Mirror("/src", dst, "/dst", MirrorOptions{Conflict: MirrorFail})
+    if err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-mirror.Ready():
+    case <-time.After(5 * time.Second):
+        t.Fatal("initial copy not done")
+    }
+    mirrored(t, dst, "/dst", "root")
+    mirrored(t, dst, "/dst/a", "a")
+
+    if _, err := c.Create("/src/b", []byte("b"), false); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Erase("/src/a", 0); err != nil {
+        t.Fatal(err)
+    }
+    mirrored(t, dst, "/dst/b", "b")
+    mirrored(t, dst, "/dst/a", "")
+    if keys := mirror.Progress().Keys; len(keys) != 2 {
+        t.Errorf("progress %v, want the root and b", keys)
+    }
+
+    // Resumed: nothing is copied again.
+    progress := mirror.Progress()
+    mirror.Stop()
+    bVer, _, _ := dst.Exists("/dst/b", false)
+    resumed, err := c.Mirror("/src", dst, "/dst", MirrorOptions{Conflict: MirrorFail, Resume: &progress})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resumed.Stop()
+    select {
+    case <-resumed.Ready():
+    case <-time.After(5 * time.Second):
+        t.Fatal("resumed mirror not ready")
+    }
+    if ver, _, _ := dst.Exists("/dst/b", false); ver != bVer {
+        t.Errorf("b copied again on resume: version %v, was %v", ver, bVer)
+    }
+
+    // Someone writes to the target.
+    if _, err := dst.Set("/dst/b", []byte("theirs")); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/src/b", []byte("ours")); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "the conflict", func() bool {
+        return errors.Is(resumed.Err(), ErrMirrorConflict)
+    })
+    if _, value, _, _ := dst.Get("/dst/b", false); string(value) != "theirs" {
+        t.Errorf("target value %q overwritten under MirrorFail", value)
+    }
+}
@@ -0,0 +1,483 @@
+package goffkv_zk
+
+import (
+    "math/rand"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+type mockNode struct {
+    value []byte
+    // Version as exposed by goffkv: the zk version plus one.
+    ver goffkv.Version
+    ephemeral bool
+    children map[string]bool
+}
+
+// In-memory goffkv.Client behaving like this backend: versions start at 1 and grow by one per
+// write, leased keys are ephemeral (and can't have children), erases take the whole subtree, and
+// transactions fail atomically with the same TxnError indices. Meant for unit tests.
+type Mock struct {
+    mu sync.Mutex
+    nodes map[string]*mockNode
+    dataWatches map[string][]chan struct{}
+    childWatches map[string][]chan struct{}
+    // Watches to fire once the transaction being applied succeeds.
+    deferred []func()
+    inTxn bool
+    closed bool
+
+    sessionID int64
+    expireWhen func(op string, key string) bool
+    subscribers sessionSubscribers
+    // Session transitions to report once mu is released.
+    pendingStates []SessionState
+}
+
+// NewMock returns an empty in-memory client.
+func NewMock() *Mock {
+    return &Mock{
+        sessionID: rand.Int63(),
+        nodes: map[string]*mockNode{
+            "": &mockNode{children: make(map[string]bool)},
+        },
+        dataWatches: make(map[string][]chan struct{}),
+        childWatches: make(map[string][]chan struct{}),
+    }
+}
+
+func mockParent(path string) (string, string) {
+    i := strings.LastIndexByte(path, '/')
+    return path[:i], path[i + 1:]
+}
+
+func (m *Mock) fire(watches map[string][]chan struct{}, path string) {
+    if m.inTxn {
+        m.deferred = append(m.deferred, func() {
+            m.fire(watches, path)
+        })
+        return
+    }
+    for _, ch := range watches[path] {
+        close(ch)
+    }
+    delete(watches, path)
+}
+
+func (m *Mock) watch(watches map[string][]chan struct{}, path string) goffkv.Watch {
+    ch := make(chan struct{})
+    watches[path] = append(watches[path], ch)
+    return func() {
+        <-ch
+    }
+}
+
+// Also runs the expiry script for op on key (unless op is empty).
+func (m *Mock) path(op string, key string) (string, error) {
+    if m.closed {
+        return "", ErrClientClosed
+    }
+    if op != "" && m.expireWhen != nil && m.expireWhen(op, key) {
+        m.expireSession()
+    }
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return "", err
+    }
+    return normalizeKey(segments), nil
+}
+
+func (m *Mock) create(path string, value []byte, lease bool) error {
+    if _, ok := m.nodes[path]; ok {
+        return goffkv.OpErrEntryExists
+    }
+    parentPath, name := mockParent(path)
+    parent, ok := m.nodes[parentPath]
+    if !ok {
+        return goffkv.OpErrNoEntry
+    }
+    if parent.ephemeral {
+        return goffkv.OpErrEphem
+    }
+
+    m.nodes[path] = &mockNode{
+        value: append([]byte{}, value...),
+        ver: 1,
+        ephemeral: lease,
+        children: make(map[string]bool),
+    }
+    parent.children[name] = true
+    m.fire(m.dataWatches, path)
+    m.fire(m.childWatches, parentPath)
+    return nil
+}
+
+func (m *Mock) set(path string, value []byte) (goffkv.Version, error) {
+    node, ok := m.nodes[path]
+    if !ok {
+        return 0, goffkv.OpErrNoEntry
+    }
+    node.value = append([]byte{}, value...)
+    node.ver++
+    m.fire(m.dataWatches, path)
+    return node.ver, nil
+}
+
+func (m *Mock) erase(path string) {
+    node := m.nodes[path]
+    for child := range node.children {
+        m.erase(path + "/" + child)
+    }
+
+    delete(m.nodes, path)
+    parentPath, name := mockParent(path)
+    delete(m.nodes[parentPath].children, name)
+    m.fire(m.dataWatches, path)
+    m.fire(m.childWatches, path)
+    m.fire(m.childWatches, parentPath)
+}
+
+func (m *Mock) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("create", key)
+    if err != nil {
+        return 0, err
+    }
+    err = m.create(path, value, lease)
+    if err != nil {
+        return 0, err
+    }
+    return 1, nil
+}
+
+func (m *Mock) Set(key string, value []byte) (goffkv.Version, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("set", key)
+    if err != nil {
+        return 0, err
+    }
+    if _, ok := m.nodes[path]; !ok {
+        err = m.create(path, value, false)
+        if err != nil {
+            return 0, err
+        }
+        return 1, nil
+    }
+    return m.set(path, value)
+}
+
+func (m *Mock) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("cas", key)
+    if err != nil {
+        return 0, err
+    }
+    if ver == 0 {
+        err = m.create(path, value, false)
+        if err == goffkv.OpErrEntryExists {
+            return 0, nil
+        }
+        if err != nil {
+            return 0, err
+        }
+        return 1, nil
+    }
+
+    node, ok := m.nodes[path]
+    if !ok {
+        return 0, goffkv.OpErrNoEntry
+    }
+    if node.ver != ver {
+        return 0, nil
+    }
+    return m.set(path, value)
+}
+
+func (m *Mock) Erase(key string, ver goffkv.Version) error {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("erase", key)
+    if err != nil {
+        return err
+    }
+    node, ok := m.nodes[path]
+    if !ok {
+        return goffkv.OpErrNoEntry
+    }
+    if ver != 0 && node.ver != ver {
+        return nil
+    }
+    m.erase(path)
+    return nil
+}
+
+func (m *Mock) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("exists", key)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    var resultWatch goffkv.Watch
+    if watch {
+        resultWatch = m.watch(m.dataWatches, path)
+    }
+    if node, ok := m.nodes[path]; ok {
+        return node.ver, resultWatch, nil
+    }
+    return 0, resultWatch, nil
+}
+
+func (m *Mock) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("get", key)
+    if err != nil {
+        return 0, nil, nil, err
+    }
+    node, ok := m.nodes[path]
+    if !ok {
+        return 0, nil, nil, goffkv.OpErrNoEntry
+    }
+
+    var resultWatch goffkv.Watch
+    if watch {
+        resultWatch = m.watch(m.dataWatches, path)
+    }
+    return node.ver, append([]byte{}, node.value...), resultWatch, nil
+}
+
+func (m *Mock) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("children", key)
+    if err != nil {
+        return nil, nil, err
+    }
+    node, ok := m.nodes[path]
+    if !ok {
+        return nil, nil, goffkv.OpErrNoEntry
+    }
+
+    result := []string{}
+    for child := range node.children {
+        result = append(result, key + "/" + child)
+    }
+    sort.Strings(result)
+
+    var resultWatch goffkv.Watch
+    if watch {
+        resultWatch = m.watch(m.childWatches, path)
+    }
+    return result, resultWatch, nil
+}
+
+func (m *Mock) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    if m.closed {
+        return nil, ErrClientClosed
+    }
+
+    for i, check := range txn.Checks {
+        path, err := m.path("commit", check.Key)
+        if err != nil {
+            return nil, err
+        }
+        node, ok := m.nodes[path]
+        if !ok || check.Ver != 0 && node.ver != check.Ver {
+            return nil, goffkv.TxnError{OpIndex: i}
+        }
+    }
+
+    paths := make([]string, len(txn.Ops))
+    for i, op := range txn.Ops {
+        path, err := m.path("commit", op.Key)
+        if err != nil {
+            return nil, err
+        }
+        paths[i] = path
+    }
+
+    // Applied to a copy, so that a failed transaction leaves no trace; watches fire only once
+    // the transaction has succeeded.
+    saved := m.nodes
+    m.nodes = make(map[string]*mockNode, len(saved))
+    for path, node := range saved {
+        copied := *node
+        copied.children = make(map[string]bool, len(node.children))
+        for child := range node.children {
+            copied.children[child] = true
+        }
+        m.nodes[path] = &copied
+    }
+    m.inTxn, m.deferred = true, nil
+    defer func() {
+        m.inTxn, m.deferred = false, nil
+    }()
+
+    result := []goffkv.TxnOpResult{}
+    var err error
+    for i, op := range txn.Ops {
+        switch op.What {
+        case goffkv.Create:
+            err = m.create(paths[i], op.Value, op.Lease)
+            if err == nil {
+                result = append(result, goffkv.TxnOpResult{What: goffkv.Create, Ver: 1})
+            }
+        case goffkv.Set:
+            var ver goffkv.Version
+            ver, err = m.set(paths[i], op.Value)
+            if err == nil {
+                result = append(result, goffkv.TxnOpResult{What: goffkv.Set, Ver: ver})
+            }
+        case goffkv.Erase:
+            if _, ok := m.nodes[paths[i]]; ok {
+                m.erase(paths[i])
+            } else {
+                err = goffkv.OpErrNoEntry
+            }
+        }
+        if err != nil {
+            m.nodes = saved
+            return nil, goffkv.TxnError{OpIndex: len(txn.Checks) + i}
+        }
+    }
+
+    m.inTxn = false
+    for _, fire := range m.deferred {
+        fire()
+    }
+    return result, nil
+}
+
+func (m *Mock) unlock() {
+    states := m.pendingStates
+    m.pendingStates = nil
+    m.mu.Unlock()
+
+    m.subscribers.mu.Lock()
+    subscribers := make([]func(SessionState), 0, len(m.subscribers.all))
+    for _, fn := range m.subscribers.all {
+        subscribers = append(subscribers, fn)
+    }
+    m.subscribers.mu.Unlock()
+
+    for _, state := range states {
+        for _, fn := range subscribers {
+            fn(state)
+        }
+    }
+}
+
+func (m *Mock) expireSession() {
+    for path, node := range m.nodes {
+        if node.ephemeral {
+            if _, ok := m.nodes[path]; ok {
+                m.erase(path)
+            }
+        }
+    }
+
+    // The watches of the session are gone too: they fire once, like with the real driver.
+    for path := range m.dataWatches {
+        m.fire(m.dataWatches, path)
+    }
+    for path := range m.childWatches {
+        m.fire(m.childWatches, path)
+    }
+
+    m.sessionID = rand.Int63()
+    m.pendingStates = append(m.pendingStates, SessionExpired, SessionConnected)
+}
+
+// ExpireSession simulates the expiry of the session: every leased key is erased, every watch
+// fires, subscribers (see OnSessionState) see SessionExpired then SessionConnected, and the mock
+// goes on with a new session ID.
+func (m *Mock) ExpireSession() {
+    m.mu.Lock()
+    defer m.unlock()
+
+    m.expireSession()
+}
+
+// ExpireWhen scripts session expiries: before each operation, fn is called with the name of the
+// operation (as reported to Instrumentation) and its key (once per key for "commit"), and the
+// session expires first if it returns true. Nil disables the script.
+func (m *Mock) ExpireWhen(fn func(op string, key string) bool) {
+    m.mu.Lock()
+    defer m.unlock()
+
+    m.expireWhen = fn
+}
+
+// ExpireAfter expires the session once d has elapsed.
+func (m *Mock) ExpireAfter(d time.Duration) {
+    time.AfterFunc(d, m.ExpireSession)
+}
+
+// FireWatches fires the data and child watches set on key without changing anything, like a
+// spurious or reordered event would, to exercise the re-read path of watch handlers.
+func (m *Mock) FireWatches(key string) error {
+    m.mu.Lock()
+    defer m.unlock()
+
+    path, err := m.path("", key)
+    if err != nil {
+        return err
+    }
+    m.fire(m.dataWatches, path)
+    m.fire(m.childWatches, path)
+    return nil
+}
+
+// OnSessionState works like Client.OnSessionState; fn is called once the triggering call returns.
+func (m *Mock) OnSessionState(fn func(SessionState)) (cancel func()) {
+    m.subscribers.mu.Lock()
+    defer m.subscribers.mu.Unlock()
+
+    if m.subscribers.all == nil {
+        m.subscribers.all = make(map[int]func(SessionState))
+    }
+    id := m.subscribers.next
+    m.subscribers.next++
+    m.subscribers.all[id] = fn
+
+    return func() {
+        m.subscribers.mu.Lock()
+        defer m.subscribers.mu.Unlock()
+
+        delete(m.subscribers.all, id)
+    }
+}
+
+// SessionID returns the ID of the current session; it changes whenever the session expires.
+func (m *Mock) SessionID() int64 {
+    m.mu.Lock()
+    defer m.unlock()
+
+    return m.sessionID
+}
+
+// Close makes every later call fail with ErrClientClosed.
+func (m *Mock) Close() {
+    m.mu.Lock()
+    defer m.unlock()
+
+    m.closed = true
+}
@@ -0,0 +1,121 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Runs the same operations against a client; returns what they returned.
+func mockScenario(kv goffkv.Client) []string {
+    var trace []string
+    record := func(results ...interface{}) {
+        trace = append(trace, fmt.Sprint(results...))
+    }
+
+    record(kv.Create("/a", []byte("1"), false))
+    record(kv.Create("/a", []byte("1"), false))
+    record(kv.Create("/missing/b", nil, false))
+    record(kv.Set("/a", []byte("2")))
+    record(kv.Cas("/a", []byte("3"), 1))
+    record(kv.Cas("/a", []byte("3"), 2))
+    record(kv.Cas("/new", []byte("x"), 0))
+    record(kv.Create("/a/b", nil, false))
+    record(kv.Create("/a/b/c", nil, false))
+    record(kv.Create("/lease", nil, true))
+    record(kv.Create("/lease/child", nil, true))
+
+    ver, value, _, err := kv.Get("/a", false)
+    record(ver, string(value), err)
+    children, _, err := kv.Children("/a", false)
+    record(children, err)
+
+    record(kv.Commit(goffkv.Txn{
+        Checks: []goffkv.Check{{Key: "/a", Ver: 3}},
+        Ops: []goffkv.Operation{
+            {What: goffkv.Set, Key: "/a", Value: []byte("4")},
+            {What: goffkv.Create, Key: "/a", Value: nil},
+        },
+    }))
+    record(kv.Commit(goffkv.Txn{
+        Checks: []goffkv.Check{{Key: "/a", Ver: 3}},
+        Ops: []goffkv.Operation{
+            {What: goffkv.Set, Key: "/a", Value: []byte("4")},
+            {What: goffkv.Create, Key: "/c", Value: []byte("c")},
+            {What: goffkv.Erase, Key: "/new"},
+        },
+    }))
+
+    record(kv.Erase("/a", 1))
+    record(kv.Erase("/a", 0))
+    record(kv.Exists("/a/b/c", false))
+    record(kv.Erase("/a", 0))
+    return trace
+}
+
+// The mock behaves like the client against a server.
+func TestMockParity(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+    m := NewMock()
+    defer m.Close()
+
+    want := mockScenario(c)
+    got := mockScenario(m)
+    if !reflect.DeepEqual(got, want) {
+        for i := range want {
+            if i >= len(got) || got[i] != want[i] {
+                t.Errorf("operation %d: mock %q, client %q", i, got[i], want[i])
+            }
+        }
+    }
+}
+
+func TestMockWatches(t *testing.T) {
+    m := NewMock()
+    defer m.Close()
+
+    if _, err := m.Create("/a", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    _, _, data, _ := m.Get("/a", true)
+    _, children, _ := m.Children("/a", true)
+
+    // A failed transaction fires nothing.
+    m.Commit(goffkv.Txn{Ops: []goffkv.Operation{
+        {What: goffkv.Set, Key: "/a", Value: []byte("x")},
+        {What: goffkv.Create, Key: "/a", Value: nil},
+    }})
+    if fired(data, 50 * time.Millisecond) {
+        t.Fatal("watch fired by a failed transaction")
+    }
+
+    if _, err := m.Create("/a/b", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if !fired(children, time.Second) {
+        t.Error("children watch not fired")
+    }
+    if _, err := m.Set("/a", []byte("y")); err != nil {
+        t.Fatal(err)
+    }
+    if !fired(data, time.Second) {
+        t.Error("data watch not fired")
+    }
+
+    if _, err := m.Create("/lease", nil, true); err != nil {
+        t.Fatal(err)
+    }
+    _, gone, _ := m.Exists("/lease", true)
+    m.ExpireSession()
+    if !fired(gone, time.Second) {
+        t.Error("lease not erased with the session")
+    }
+    if ver, _, _ := m.Exists("/lease", false); ver != 0 {
+        t.Error("lease left after the session expired")
+    }
+}
@@ -0,0 +1,97 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "strings"
+    "sync"
+)
+
+var (
+    ErrNamespaceLocked = errors.New("key is in a locked namespace whose lock isn't held by this client")
+)
+
+// A namespace covered by a lock, both as normalized keys.
+type namespaceLock struct {
+    lock string
+    namespace string
+}
+
+// Locks currently held by the Mutexes of the client, by normalized key.
+type heldLocks struct {
+    mu sync.Mutex
+    holds map[string]int
+}
+
+func (h *heldLocks) add(key string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    if h.holds == nil {
+        h.holds = make(map[string]int)
+    }
+    h.holds[key]++
+}
+
+func (h *heldLocks) remove(key string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.holds[key]--
+    if h.holds[key] <= 0 {
+        delete(h.holds, key)
+    }
+}
+
+func (h *heldLocks) held(key string) bool {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    return h.holds[key] > 0
+}
+
+// WithNamespaceLock makes the lock at lockKey (see Mutex) cover the namespace key: the client
+// rejects writes to namespace and its descendants with ErrNamespaceLocked unless one of its
+// Mutexes holds that lock. Like Freeze, this is cooperative: all the clients writing to the
+// namespace have to be created with the same option. The lock is checked locally before each
+// write; a lock lost to a session expiry is dropped, but writes already sent aren't fenced.
+func WithNamespaceLock(lockKey string, namespace string) Option {
+    return func(c *Client) {
+        c.namespaceLocks = append(c.namespaceLocks, namespaceLock{
+            lock: "/" + strings.Trim(lockKey, "/"),
+            namespace: "/" + strings.Trim(namespace, "/"),
+        })
+    }
+}
+
+func (c *Client) checkNamespaceLocks(segments []string) error {
+    if len(c.namespaceLocks) == 0 {
+        return nil
+    }
+
+    key := normalizeKey(segments)
+    for _, ns := range c.namespaceLocks {
+        covered := ns.namespace == "/" || key == ns.namespace || strings.HasPrefix(key, ns.namespace + "/")
+        if covered && !c.heldLocks.held(ns.lock) {
+            return ErrNamespaceLocked
+        }
+    }
+    return nil
+}
+
+// Checks that cooperating clients allow writing to the key of segments.
+func (c *Client) checkWritable(segments []string) error {
+    err := c.checkFrozen(segments, false)
+    if err != nil {
+        return err
+    }
+    return c.checkNamespaceLocks(segments)
+}
+
+// Like checkWritable, but for erasing the subtree of segments: no key below it may be frozen.
+func (c *Client) checkErasable(segments []string) error {
+    err := c.checkFrozen(segments, true)
+    if err != nil {
+        return err
+    }
+    return c.checkNamespaceLocks(segments)
+}
@@ -0,0 +1,61 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestNamespaceLock(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithNamespaceLock("/lock", "/ns"))
+    defer c.Close()
+
+    if _, err := c.Set("/ns", nil); !errors.Is(err, ErrNamespaceLocked) {
+        t.Errorf("Set without the lock: %v, want ErrNamespaceLocked", err)
+    }
+    if _, err := c.Set("/other", nil); err != nil {
+        t.Errorf("Set outside the namespace: %v", err)
+    }
+    if _, err := c.Set("/ns-sibling", nil); err != nil {
+        t.Errorf("Set of a sibling sharing the prefix: %v", err)
+    }
+
+    m, err := c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/ns", nil); err != nil {
+        t.Fatalf("Set with the lock: %v", err)
+    }
+    if _, err := c.Create("/ns/a", nil, false); err != nil {
+        t.Fatalf("Create below the namespace with the lock: %v", err)
+    }
+
+    if err := m.Unlock(); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Erase("/ns", 0); !errors.Is(err, ErrNamespaceLocked) {
+        t.Errorf("Erase once unlocked: %v, want ErrNamespaceLocked", err)
+    }
+    if _, _, ok := zk.Node("/test/ns/a"); !ok {
+        t.Error("namespace erased without the lock")
+    }
+
+    // A lock lost with the session stops covering the namespace.
+    m, err = c.Lock("/lock")
+    if err != nil {
+        t.Fatal(err)
+    }
+    lost := m.Lost()
+    zk.Expire()
+    select {
+    case <-lost:
+    case <-time.After(5 * time.Second):
+        t.Fatal("lock not lost with the session")
+    }
+    if _, err := c.Set("/ns", nil); !errors.Is(err, ErrNamespaceLocked) {
+        t.Errorf("Set after the lock was lost: %v, want ErrNamespaceLocked", err)
+    }
+}
@@ -0,0 +1,41 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "runtime/debug"
+)
+
+// A panic in the client (or in a codec, policy, or other callback it runs), recovered by
+// WithPanicRecovery. It is returned wrapped in an Error telling the operation and path.
+type PanicError struct {
+    Value interface{}
+    // Stack of the panicking goroutine.
+    Stack []byte
+}
+
+func (e *PanicError) Error() string {
+    return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// WithPanicRecovery makes operations return a PanicError instead of panicking, so that a bug in
+// the client doesn't take down the process. The stack is logged too. Background goroutines
+// (watches, recipes) aren't covered.
+func WithPanicRecovery() Option {
+    return func(c *Client) {
+        c.recoverPanics = true
+    }
+}
+
+// Deferred by operations: converts a panic in progress into *err, if recovery is enabled.
+func (c *Client) recoverPanic(op string, key string, err *error) {
+    if !c.recoverPanics {
+        return
+    }
+    r := recover()
+    if r == nil {
+        return
+    }
+    panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+    c.logger.Printf("%s %s: recovered %v\n%s", op, key, panicErr, panicErr.Stack)
+    *err = c.wrapError(op, key, panicErr)
+}
@@ -0,0 +1,61 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "io"
+    "testing"
+)
+
+// A codec with a bug.
+type panickyCodec struct{}
+
+func (panickyCodec) Name() string {
+    return "panicky"
+}
+
+func (panickyCodec) NewWriter(w io.Writer) io.WriteCloser {
+    panic("codec bug")
+}
+
+func (panickyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+    panic("codec bug")
+}
+
+func TestPanicRecovery(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithPanicRecovery(), WithCompression(panickyCodec{}, 0))
+    defer c.Close()
+
+    _, err := c.Set("/k", []byte("v"))
+    var panicErr *PanicError
+    if !errors.As(err, &panicErr) || panicErr.Value != "codec bug" || len(panicErr.Stack) == 0 {
+        t.Fatalf("Set with a panicking codec: %#v, want a PanicError", err)
+    }
+    var zkErr *Error
+    if !errors.As(err, &zkErr) || zkErr.Op != "set" || zkErr.Path != "/test/k" {
+        t.Errorf("%#v not wrapped in an Error of set /test/k", err)
+    }
+    if _, _, ok := zk.Node("/test/k"); ok {
+        t.Error("key written despite the panic")
+    }
+
+    // The client keeps working.
+    if _, _, err := c.Exists("/k", false); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestPanicWithoutRecovery(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithCompression(panickyCodec{}, 0))
+    defer c.Close()
+
+    defer func() {
+        if recover() != "codec bug" {
+            t.Error("panic not propagated")
+        }
+    }()
+    c.Set("/k", []byte("v"))
+}
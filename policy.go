@@ -0,0 +1,82 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Restrictions on key names on top of those of goffkv. Zero fields impose no restriction.
+type NamingPolicy struct {
+    MaxDepth int
+    MaxSegmentLength int
+    // Every segment must match this pattern entirely, e.g. `[a-z0-9-]+`.
+    Segment *regexp.Regexp
+    // Every key must be equal to or below one of these keys (e.g. one per team).
+    RequiredPrefixes []string
+}
+
+// A key rejected by the naming policy.
+type PolicyError struct {
+    Key string
+    Rule string
+}
+
+func (e PolicyError) Error() string {
+    return fmt.Sprintf("key %q violates naming policy: %s", e.Key, e.Rule)
+}
+
+// WithNamingPolicy makes every operation reject keys violating policy with a PolicyError.
+func WithNamingPolicy(policy NamingPolicy) Option {
+    return func(c *Client) {
+        if policy.Segment != nil {
+            policy.Segment = regexp.MustCompile("^(?:" + policy.Segment.String() + ")$")
+        }
+        c.policy = &policy
+    }
+}
+
+func (p *NamingPolicy) check(key string, segments []string) error {
+    if p.MaxDepth > 0 && len(segments) > p.MaxDepth {
+        return PolicyError{key, fmt.Sprintf("deeper than %d segments", p.MaxDepth)}
+    }
+
+    for _, segment := range segments {
+        if p.MaxSegmentLength > 0 && len(segment) > p.MaxSegmentLength {
+            return PolicyError{key, fmt.Sprintf("segment %q is longer than %d bytes", segment, p.MaxSegmentLength)}
+        }
+        if p.Segment != nil && !p.Segment.MatchString(segment) {
+            return PolicyError{key, fmt.Sprintf("segment %q does not match %s", segment, p.Segment)}
+        }
+    }
+
+    if len(p.RequiredPrefixes) == 0 {
+        return nil
+    }
+    for _, prefix := range p.RequiredPrefixes {
+        if key == prefix || strings.HasPrefix(key, prefix + "/") {
+            return nil
+        }
+    }
+    return PolicyError{key, "not under any of the allowed prefixes"}
+}
+
+func (c *Client) disassembleKey(key string) ([]string, error) {
+    if h, ok := c.handles.lookup(key); ok {
+        return h.segments, nil
+    }
+
+    segments, err := goffkv.DisassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    if c.policy != nil {
+        err = c.policy.check(key, segments)
+        if err != nil {
+            return nil, err
+        }
+    }
+    return segments, nil
+}
@@ -0,0 +1,43 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "regexp"
+    "testing"
+)
+
+func TestNamingPolicy(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithNamingPolicy(NamingPolicy{
+        MaxDepth: 3,
+        MaxSegmentLength: 8,
+        Segment: regexp.MustCompile(`[a-z0-9-]+`),
+        RequiredPrefixes: []string{"/team-a", "/team-b"},
+    }))
+    defer c.Close()
+
+    zk.Put("/test/team-b/x", nil)
+    for _, key := range []string{"/team-a", "/team-b/x/y", "/team-a/a-1"} {
+        if _, err := c.Set(key, nil); err != nil {
+            t.Errorf("Set %s: %v", key, err)
+        }
+    }
+    for key, rule := range map[string]string{
+        "/team-a/x/y/z": "deeper than 3 segments",
+        "/team-a/abcdefghi": `segment "abcdefghi" is longer than 8 bytes`,
+        // The pattern has to match whole segments.
+        "/team-a/Upper": `segment "Upper" does not match ^(?:[a-z0-9-]+)$`,
+        "/team-c": "not under any of the allowed prefixes",
+        "/team-ab": "not under any of the allowed prefixes",
+    } {
+        _, err := c.Set(key, nil)
+        var perr PolicyError
+        if !errors.As(err, &perr) || perr.Key != key || perr.Rule != rule {
+            t.Errorf("Set %s: %#v, want a PolicyError %q", key, err, rule)
+        }
+        if _, _, ok := zk.Node("/test" + key); ok {
+            t.Errorf("%s written despite the policy", key)
+        }
+    }
+}
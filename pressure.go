@@ -0,0 +1,128 @@
+package goffkv_zk
+
+import (
+    "sync"
+    "time"
+)
+
+const (
+    defaultPressureMaxInFlight = 1000
+    defaultPressureLatencyTarget = 10 * time.Millisecond
+    defaultPressureLatencyMax = time.Second
+    // Weight of the latest operation in the moving averages.
+    pressureSmoothing = 0.05
+)
+
+// Where the signals of Pressure saturate. Zero fields take the defaults.
+type PressureLimits struct {
+    // Operations in progress at which pressure is 1; defaults to 1000.
+    MaxInFlight int
+    // Average latency below which it doesn't add pressure, and at which pressure is 1; default
+    // to 10ms and 1s respectively.
+    LatencyTarget time.Duration
+    LatencyMax time.Duration
+}
+
+// WithPressureLimits tunes Pressure to the expected load of the client.
+func WithPressureLimits(limits PressureLimits) Option {
+    return func(c *Client) {
+        c.pressure.limits = limits
+    }
+}
+
+// The signals Pressure is derived from.
+type PressureReport struct {
+    InFlight int
+    // Moving average of the fraction of operations retried (see WithRetryPolicy).
+    RetryRate float64
+    // Moving average of the latency of operations, retries included.
+    Latency time.Duration
+    Connected bool
+    Pressure float64
+}
+
+type pressureGauge struct {
+    mu sync.Mutex
+    limits PressureLimits
+    inFlight int
+    retryRate float64
+    latency float64
+}
+
+func (g *pressureGauge) enter() {
+    g.mu.Lock()
+    g.inFlight++
+    g.mu.Unlock()
+}
+
+func (g *pressureGauge) leave(start time.Time, retried bool) {
+    sample := 0.0
+    if retried {
+        sample = 1
+    }
+    latency := float64(time.Since(start))
+
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    g.inFlight--
+    g.retryRate += pressureSmoothing * (sample - g.retryRate)
+    g.latency += pressureSmoothing * (latency - g.latency)
+}
+
+// Linear from 0 at low to 1 at high, clamped.
+func ramp(x float64, low float64, high float64) float64 {
+    switch {
+    case x <= low:
+        return 0
+    case x >= high:
+        return 1
+    default:
+        return (x - low) / (high - low)
+    }
+}
+
+// PressureReport returns Pressure along with the signals it is derived from.
+func (c *Client) PressureReport() PressureReport {
+    g := &c.pressure
+    g.mu.Lock()
+    limits := g.limits
+    report := PressureReport{
+        InFlight: g.inFlight,
+        RetryRate: g.retryRate,
+        Latency: time.Duration(g.latency),
+        Connected: c.SessionState() == SessionConnected,
+    }
+    g.mu.Unlock()
+
+    if limits.MaxInFlight <= 0 {
+        limits.MaxInFlight = defaultPressureMaxInFlight
+    }
+    if limits.LatencyTarget <= 0 {
+        limits.LatencyTarget = defaultPressureLatencyTarget
+    }
+    if limits.LatencyMax <= limits.LatencyTarget {
+        limits.LatencyMax = defaultPressureLatencyMax
+    }
+
+    report.Pressure = ramp(float64(report.InFlight), 0, float64(limits.MaxInFlight))
+    if report.RetryRate > report.Pressure {
+        report.Pressure = report.RetryRate
+    }
+    latency := ramp(float64(report.Latency), float64(limits.LatencyTarget), float64(limits.LatencyMax))
+    if latency > report.Pressure {
+        report.Pressure = latency
+    }
+    if !report.Connected {
+        report.Pressure = 1
+    }
+    return report
+}
+
+// Pressure tells how much the backend is struggling, from 0 (idle) to 1 (saturated or
+// unreachable): the worst of the operations in progress, the retry rate and the average latency,
+// each scaled linearly between its limits (see WithPressureLimits). Producers can poll it to
+// delay or shed writes before they start timing out.
+func (c *Client) Pressure() float64 {
+    return c.PressureReport().Pressure
+}
@@ -0,0 +1,78 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+func TestRamp(t *testing.T) {
+    for _, tc := range []struct{ x, want float64 }{{-1, 0}, {2, 0}, {3, 0.5}, {4, 1}, {9, 1}} {
+        if got := ramp(tc.x, 2, 4); got != tc.want {
+            t.Errorf("ramp(%v, 2, 4) = %v, want %v", tc.x, got, tc.want)
+        }
+    }
+}
+
+func TestPressure(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithPressureLimits(PressureLimits{MaxInFlight: 2, LatencyTarget: time.Millisecond, LatencyMax: 2 * time.Millisecond}))
+    defer c.Close()
+
+    if _, err := c.Set("/k", []byte("v")); err != nil {
+        t.Fatal(err)
+    }
+    if report := c.PressureReport(); report.Pressure != 0 || !report.Connected {
+        t.Fatalf("idle client: %+v", report)
+    }
+
+    // An operation in progress.
+    release := make(chan struct{})
+    zk.Fail(func(op int32, path string) error {
+        if op == fzGetData {
+            <-release
+        }
+        return nil
+    })
+    done := make(chan struct{})
+    go func() {
+        c.Get("/k", false)
+        close(done)
+    }()
+    eventually(t, "the operation in progress", func() bool {
+        return c.PressureReport().InFlight == 1
+    })
+    if p := c.Pressure(); p != 0.5 {
+        t.Errorf("pressure %v with 1 of 2 operations in flight, want 0.5", p)
+    }
+    time.Sleep(50 * time.Millisecond)
+    close(release)
+    <-done
+    // The 50ms it took brings the average latency past LatencyMax.
+    if report := c.PressureReport(); report.InFlight != 0 || report.Pressure != 1 {
+        t.Errorf("after a slow operation: %+v", report)
+    }
+
+    zk.Stop()
+    eventually(t, "the disconnection", func() bool {
+        report := c.PressureReport()
+        return !report.Connected && report.Pressure == 1
+    })
+    zk.Start()
+}
+
+func TestPressureRetryRate(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+    defer c.Close()
+
+    zk.Put("/test/k", nil)
+    failFirst(zk, fzGetData, 1)
+    if _, _, _, err := c.Get("/k", false); err != nil {
+        t.Fatal(err)
+    }
+    if report := c.PressureReport(); report.RetryRate != pressureSmoothing || report.Pressure < pressureSmoothing {
+        t.Errorf("after a retried operation: %+v", report)
+    }
+}
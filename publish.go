@@ -0,0 +1,78 @@
+package goffkv_zk
+
+import (
+    "context"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    publishNodeName = "v-"
+)
+
+// PublishAndFlip stores value in a new child of dataKey and points pointerKey at it (its value
+// becomes the key of the child) in a single transaction, so that readers following the pointer
+// never observe a missing or partially written value. dataKey must exist; pointerKey is created
+// if needed. The child is named by ZooKeeper ("v-" and a sequence number), hence publishers never
+// collide. Older children are kept for rollbacks. Returns the new version of pointerKey.
+func (c *Client) PublishAndFlip(dataKey string, pointerKey string, value []byte) (goffkv.Version, error) {
+    segments, err := c.disassembleKey(dataKey)
+    if err != nil {
+        return 0, err
+    }
+    childSegments := append(append([]string{}, segments...), publishNodeName)
+    err = c.checkWritable(childSegments)
+    if err != nil {
+        return 0, c.wrapError("create", dataKey, err)
+    }
+
+    // Created empty, and filled by the transaction flipping the pointer.
+    var path string
+    err = c.retry(context.Background(), true, func() (err error) {
+        path, err = c.conn.Create(c.assemblePath(childSegments), nil, zkapi.FlagSequence, c.acl)
+        return err
+    })
+    if err != nil {
+        return 0, c.wrapError("create", dataKey, convertError(err))
+    }
+    target := c.keyOf(path)
+
+    for {
+        pointerVer, _, _, err := c.Get(pointerKey, false)
+        if err != nil && err != goffkv.OpErrNoEntry {
+            return 0, err
+        }
+
+        txn := goffkv.Txn{
+            Ops: []goffkv.Operation{
+                {What: goffkv.Set, Key: target, Value: value},
+            },
+        }
+        if pointerVer == 0 {
+            txn.Ops = append(txn.Ops, goffkv.Operation{What: goffkv.Create, Key: pointerKey, Value: []byte(target)})
+        } else {
+            txn.Checks = append(txn.Checks, goffkv.Check{Key: pointerKey, Ver: pointerVer})
+            txn.Ops = append(txn.Ops, goffkv.Operation{What: goffkv.Set, Key: pointerKey, Value: []byte(target)})
+        }
+
+        results, err := c.Commit(txn)
+        if txnErr, ok := err.(goffkv.TxnError); ok {
+            // The pointer has been flipped (or created) concurrently.
+            pointerOp := len(txn.Checks) + 1
+            if pointerVer != 0 {
+                pointerOp = 0
+            }
+            if txnErr.OpIndex == pointerOp {
+                continue
+            }
+        }
+        if notWritten(err) {
+            // Nothing points at it.
+            c.conn.Delete(path, -1)
+        }
+        if err != nil {
+            return 0, err
+        }
+        return results[1].Ver, nil
+    }
+}
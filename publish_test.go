@@ -0,0 +1,67 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "sync"
+    "testing"
+)
+
+func TestPublishAndFlip(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    if _, err := c.Create("/data", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    var wg sync.WaitGroup
+    errs := make([]error, 5)
+    for i := range errs {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            _, errs[i] = c.PublishAndFlip("/data", "/current", []byte{byte('a' + i)})
+        }(i)
+    }
+    wg.Wait()
+    for _, err := range errs {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    children, _, err := c.Children("/data", false)
+    if err != nil || len(children) != 5 {
+        t.Fatalf("children %v, %v; want one per publish", children, err)
+    }
+    _, target, _, err := c.Get("/current", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, value, _, err := c.Get(string(target), false)
+    if err != nil || len(value) != 1 {
+        t.Errorf("published value %q, %v", value, err)
+    }
+}
+
+// A failed publish doesn't leave its child behind.
+func TestPublishAndFlipFailed(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    if _, err := c.Create("/data", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Freeze("/current"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.PublishAndFlip("/data", "/current", []byte("v")); !errors.Is(err, ErrFrozen) {
+        t.Fatalf("PublishAndFlip to a frozen pointer: %v, want ErrFrozen", err)
+    }
+    if children, _, _ := c.Children("/data", false); len(children) != 0 {
+        t.Errorf("children %v left by a failed publish", children)
+    }
+}
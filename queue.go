@@ -0,0 +1,270 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "sort"
+    "strings"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+)
+
+const (
+    defaultQueueCapacity = 1024
+)
+
+var (
+    ErrQueued = errors.New("write queued until the ensemble is reachable")
+    ErrQueueFull = errors.New("offline write queue is full")
+)
+
+type OfflineQueueOptions struct {
+    // Maximum number of distinct keys waiting for replay; defaults to 1024 if not positive.
+    Capacity int
+    // Called for every queued write that is lost: rejected because the queue is full,
+    // or failed during replay. Must not block.
+    OnLoss func(key string, err error)
+}
+
+type OfflineQueueStats struct {
+    // Writes waiting for replay right now.
+    Pending int
+    Replayed uint64
+    // Queued writes replaced by a later write to the same key before replay, queued or direct
+    // (a Set, Cas, Erase or Commit that succeeded).
+    Superseded uint64
+    Dropped uint64
+    Failed uint64
+}
+
+type queuedWrite struct {
+    value []byte
+    seq uint64
+}
+
+// Set operations made while the ensemble was unreachable; the last write per key wins.
+type offlineQueue struct {
+    opts OfflineQueueOptions
+
+    mu sync.Mutex
+    pending map[string]queuedWrite
+    order []string
+    seq uint64
+    replaying bool
+    // Keys being written, directly or by the replay.
+    writing map[string]*keyLock
+    stats OfflineQueueStats
+}
+
+type keyLock struct {
+    mu sync.Mutex
+    refs int
+}
+
+// WithOfflineQueue makes Set buffer writes while the ensemble is unreachable and replay them
+// after reconnection. Such a Set returns ErrQueued instead of a version. Only suitable for
+// telemetry-style keys where the last written value is all that matters. A direct write to a
+// key that succeeds drops the write queued for it, so that the replay never overwrites a newer
+// value.
+func WithOfflineQueue(opts OfflineQueueOptions) Option {
+    return func(c *Client) {
+        if opts.Capacity <= 0 {
+            opts.Capacity = defaultQueueCapacity
+        }
+        c.queue = &offlineQueue{
+            opts: opts,
+            pending: make(map[string]queuedWrite),
+            writing: make(map[string]*keyLock),
+        }
+    }
+}
+
+// Serializes the direct writes to keys with the replay of the writes queued for them, so that an
+// older, queued value can't land after a direct write. Returns the function releasing the keys.
+func (q *offlineQueue) lockKeys(keys ...string) func() {
+    keys = append([]string(nil), keys...)
+    sort.Strings(keys)
+    locked := keys[:0]
+
+    q.mu.Lock()
+    for i, key := range keys {
+        if i > 0 && key == keys[i - 1] {
+            continue
+        }
+        if q.writing[key] == nil {
+            q.writing[key] = &keyLock{}
+        }
+        q.writing[key].refs++
+        locked = append(locked, key)
+    }
+    locks := make([]*keyLock, len(locked))
+    for i, key := range locked {
+        locks[i] = q.writing[key]
+    }
+    q.mu.Unlock()
+
+    // In order, so that writes locking several keys can't deadlock.
+    for _, l := range locks {
+        l.mu.Lock()
+    }
+    return func() {
+        q.mu.Lock()
+        defer q.mu.Unlock()
+
+        for i, l := range locks {
+            l.mu.Unlock()
+            l.refs--
+            if l.refs == 0 {
+                delete(q.writing, locked[i])
+            }
+        }
+    }
+}
+
+// Locks keys for a direct write (see lockKeys); a no-op without an offline queue.
+func (c *Client) lockQueued(keys ...string) func() {
+    if c.queue == nil {
+        return func() {}
+    }
+    return c.queue.lockKeys(keys...)
+}
+
+// The keys written by txn.
+func txnKeys(txn goffkv.Txn) []string {
+    keys := make([]string, len(txn.Ops))
+    for i, op := range txn.Ops {
+        keys[i] = op.Key
+    }
+    return keys
+}
+
+// Drops the write queued for key (and the ones for its descendants with subtree), superseded by
+// a direct write that succeeded.
+func (q *offlineQueue) drop(key string, subtree bool) {
+    if q == nil {
+        return
+    }
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    dropped := func(k string) bool {
+        return k == key || subtree && strings.HasPrefix(k, key + "/")
+    }
+    for k := range q.pending {
+        if dropped(k) {
+            delete(q.pending, k)
+            q.stats.Superseded++
+        }
+    }
+    order := q.order[:0]
+    for _, k := range q.order {
+        if !dropped(k) {
+            order = append(order, k)
+        }
+    }
+    q.order = order
+}
+
+func (q *offlineQueue) lost(key string, err error) {
+    if q.opts.OnLoss != nil {
+        q.opts.OnLoss(key, err)
+    }
+}
+
+func (q *offlineQueue) push(key string, value []byte) error {
+    q.mu.Lock()
+    q.seq++
+    if _, ok := q.pending[key]; ok {
+        q.pending[key] = queuedWrite{value, q.seq}
+        q.stats.Superseded++
+        q.mu.Unlock()
+        return ErrQueued
+    }
+    if len(q.pending) >= q.opts.Capacity {
+        q.stats.Dropped++
+        q.mu.Unlock()
+        q.lost(key, ErrQueueFull)
+        return ErrQueueFull
+    }
+    q.pending[key] = queuedWrite{value, q.seq}
+    q.order = append(q.order, key)
+    q.mu.Unlock()
+    return ErrQueued
+}
+
+func (c *Client) replayQueue() {
+    q := c.queue
+    q.mu.Lock()
+    if q.replaying {
+        q.mu.Unlock()
+        return
+    }
+    q.replaying = true
+    q.mu.Unlock()
+
+    defer func() {
+        q.mu.Lock()
+        q.replaying = false
+        q.mu.Unlock()
+    }()
+
+    for {
+        q.mu.Lock()
+        if len(q.order) == 0 {
+            q.mu.Unlock()
+            return
+        }
+        key := q.order[0]
+        q.order = q.order[1:]
+        q.mu.Unlock()
+
+        unlock := q.lockKeys(key)
+        q.mu.Lock()
+        write, ok := q.pending[key]
+        q.mu.Unlock()
+        if !ok {
+            // Superseded by a direct write meanwhile.
+            unlock()
+            continue
+        }
+        _, err := c.set(key, write.value)
+
+        q.mu.Lock()
+        if isUnreachable(err) {
+            // Disconnected again; wait for the next session.
+            q.order = append([]string{key}, q.order...)
+            q.mu.Unlock()
+            unlock()
+            return
+        }
+        if q.pending[key].seq == write.seq {
+            delete(q.pending, key)
+        } else {
+            // Written again while being replayed; the newer value goes last.
+            q.order = append(q.order, key)
+        }
+        if err == nil {
+            q.stats.Replayed++
+        } else {
+            q.stats.Failed++
+        }
+        q.mu.Unlock()
+        unlock()
+
+        if err != nil {
+            q.lost(key, err)
+        }
+    }
+}
+
+func (c *Client) OfflineQueueStats() OfflineQueueStats {
+    if c.queue == nil {
+        return OfflineQueueStats{}
+    }
+
+    c.queue.mu.Lock()
+    defer c.queue.mu.Unlock()
+
+    result := c.queue.stats
+    result.Pending = len(c.queue.pending)
+    return result
+}
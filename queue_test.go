@@ -0,0 +1,100 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "testing"
+    "time"
+)
+
+func TestOfflineQueueDefaultCapacity(t *testing.T) {
+    c := &Client{}
+    WithOfflineQueue(OfflineQueueOptions{})(c)
+
+    for i := 0; i < defaultQueueCapacity; i++ {
+        if err := c.queue.push(fmt.Sprintf("/key%d", i), nil); err != ErrQueued {
+            t.Fatalf("push %d: %v", i, err)
+        }
+    }
+    if err := c.queue.push("/last", nil); err != ErrQueueFull {
+        t.Fatalf("push over capacity: %v", err)
+    }
+}
+
+func TestOfflineQueueReplay(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithOfflineQueue(OfflineQueueOptions{Capacity: 10}))
+    defer c.Close()
+
+    zk.Stop()
+    eventually(t, "disconnection", func() bool {
+        return c.SessionState() != SessionConnected
+    })
+    if _, err := c.Set("/key", []byte("old")); err != ErrQueued {
+        t.Fatalf("Set while unreachable: %v", err)
+    }
+    if _, err := c.Set("/key", []byte("new")); err != ErrQueued {
+        t.Fatalf("Set while unreachable: %v", err)
+    }
+
+    zk.Start()
+    eventually(t, "replay", func() bool {
+        return c.OfflineQueueStats().Replayed == 1
+    })
+    if data, _, _ := zk.Node("/test/key"); string(data) != "new" {
+        t.Fatalf("replayed %q, want the last queued value", data)
+    }
+    if stats := c.OfflineQueueStats(); stats.Pending != 0 || stats.Superseded != 1 {
+        t.Fatalf("stats after replay: %+v", stats)
+    }
+}
+
+// A replay must never overwrite a value written directly after the write was queued.
+func TestOfflineQueueDirectWritesSupersede(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithOfflineQueue(OfflineQueueOptions{Capacity: 10}))
+    defer c.Close()
+
+    c.queue.push("/set", []byte("queued"))
+    c.queue.push("/cas", []byte("queued"))
+    c.queue.push("/tree", []byte("queued"))
+    c.queue.push("/tree/child", []byte("queued"))
+    c.queue.push("/other", []byte("queued"))
+
+    if _, err := c.Set("/set", []byte("direct")); err != nil {
+        t.Fatal(err)
+    }
+    ver, err := c.Create("/cas", []byte("created"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Cas("/cas", []byte("direct"), ver); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Create("/tree", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Erase("/tree", 0); err != nil {
+        t.Fatal(err)
+    }
+    if stats := c.OfflineQueueStats(); stats.Pending != 1 {
+        t.Fatalf("pending after direct writes: %+v", stats)
+    }
+
+    // The reconnection replays what is left.
+    zk.Disconnect()
+    eventually(t, "replay", func() bool {
+        return c.OfflineQueueStats().Pending == 0
+    })
+    time.Sleep(50 * time.Millisecond)
+
+    for path, want := range map[string]string{"/test/set": "direct", "/test/cas": "direct", "/test/other": "queued"} {
+        if data, _, _ := zk.Node(path); string(data) != want {
+            t.Errorf("%s = %q, want %q", path, data, want)
+        }
+    }
+    if _, _, ok := zk.Node("/test/tree"); ok {
+        t.Errorf("a queued write resurrected an erased subtree")
+    }
+}
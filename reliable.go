@@ -0,0 +1,55 @@
+package goffkv_zk
+
+import (
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// WithReliableWatches makes the watches returned by Exists, Get and Children complete only on an
+// actual change of the node. Watches lost together with the session are set again, and complete
+// at once if the node has changed in the meantime.
+func WithReliableWatches() Option {
+    return func(c *Client) {
+        c.reliableWatches = true
+    }
+}
+
+// Returns a watch waiting for ech. rearm sets the watch again after it has been lost, and tells
+// whether the node has changed since it was first set.
+func (c *Client) watchOf(ech <-chan zkapi.Event, rearm func() (<-chan zkapi.Event, bool, error)) goffkv.Watch {
+    if !c.reliableWatches {
+        return func() {
+            <-ech
+        }
+    }
+
+    return func() {
+        for {
+            select {
+            case event, ok := <-ech:
+                if ok && event.Type != zkapi.EventNotWatching {
+                    return
+                }
+            case <-c.done:
+                return
+            }
+
+            for {
+                newEch, changed, err := rearm()
+                if err == nil {
+                    if changed {
+                        return
+                    }
+                    ech = newEch
+                    break
+                }
+                select {
+                case <-time.After(watchRetryDelay):
+                case <-c.done:
+                    return
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,103 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "math/rand"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    defaultRetryBackoff = 100 * time.Millisecond
+    defaultRetryMaxBackoff = 5 * time.Second
+)
+
+// How operations failing with transient errors are retried.
+type RetryPolicy struct {
+    // Attempts per operation, the first one included; 0 or 1 disables retries.
+    MaxAttempts int
+    // Delay before the first retry, doubled after each one up to MaxBackoff. Default to 100ms
+    // and 5s respectively.
+    Backoff time.Duration
+    MaxBackoff time.Duration
+    // Fraction of each delay that is randomized, between 0 and 1.
+    Jitter float64
+    // Tells which errors are worth a retry; defaults to IsTransient.
+    Retryable func(error) bool
+    // Retry writes too. A write whose reply has been lost may have been applied: its retry can
+    // then fail with goffkv.OpErrEntryExists (Create) or report a version mismatch (Cas).
+    Writes bool
+}
+
+// IsTransient tells whether err is caused by the connection rather than by the operation.
+func IsTransient(err error) bool {
+    return isUnreachable(err) || errors.Is(err, zkapi.ErrSessionMoved)
+}
+
+// WithRetryPolicy retries reads (and optionally writes) failing with transient errors.
+func WithRetryPolicy(policy RetryPolicy) Option {
+    return func(c *Client) {
+        if policy.Backoff <= 0 {
+            policy.Backoff = defaultRetryBackoff
+        }
+        if policy.MaxBackoff <= 0 {
+            policy.MaxBackoff = defaultRetryMaxBackoff
+        }
+        if policy.Retryable == nil {
+            policy.Retryable = IsTransient
+        }
+        c.retryPolicy = &policy
+    }
+}
+
+// Calls fn until it succeeds, fails with an error that isn't retryable, or runs out of attempts.
+// No attempt is made once ctx is done, so that abandoned operations stop loading the server.
+func (c *Client) retry(ctx context.Context, write bool, fn func() error) error {
+    c.pressure.enter()
+    retried := false
+    defer func(start time.Time) {
+        c.pressure.leave(start, retried)
+    }(time.Now())
+
+    if ctx.Err() != nil {
+        return ctx.Err()
+    }
+    // The driver never answers requests made after it's closed.
+    select {
+    case <-c.done:
+        return ErrClientClosed
+    default:
+    }
+    policy := c.retryPolicy
+    if policy == nil || write && !policy.Writes {
+        return fn()
+    }
+
+    backoff := policy.Backoff
+    for attempt := 1; ; attempt++ {
+        retried = attempt > 1
+        err := fn()
+        if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+            return err
+        }
+
+        delay := backoff
+        if policy.Jitter > 0 {
+            delay -= time.Duration(policy.Jitter * rand.Float64() * float64(delay))
+        }
+        c.logger.Printf("%v, retrying in %v", err, delay)
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            return err
+        case <-c.done:
+            return err
+        }
+
+        backoff *= 2
+        if backoff > policy.MaxBackoff {
+            backoff = policy.MaxBackoff
+        }
+    }
+}
@@ -0,0 +1,68 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Fails the first n requests of op with a transient error.
+func failFirst(zk *fakeZK, op int32, n int) {
+    failed := 0
+    zk.Fail(func(request int32, path string) error {
+        if request == op && failed < n {
+            failed++
+            return zkapi.ErrSessionMoved
+        }
+        return nil
+    })
+}
+
+func TestRetryPolicy(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+    defer c.Close()
+
+    zk.Put("/test/k", []byte("v"))
+    failFirst(zk, fzGetData, 2)
+    if _, value, _, err := c.Get("/k", false); err != nil || string(value) != "v" {
+        t.Fatalf("Get over two transient failures: %q, %v", value, err)
+    }
+
+    failFirst(zk, fzGetData, 3)
+    if _, _, _, err := c.Get("/k", false); !IsTransient(err) {
+        t.Errorf("Get past MaxAttempts: %v, want a transient error", err)
+    }
+
+    // Writes aren't retried unless asked.
+    failFirst(zk, fzSetData, 1)
+    if _, err := c.Set("/k", []byte("w")); !IsTransient(err) {
+        t.Errorf("Set failing once: %v, want a transient error", err)
+    }
+}
+
+func TestRetryWrites(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithRetryPolicy(RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond, Writes: true}))
+    defer c.Close()
+
+    failFirst(zk, fzSetData, 2)
+    zk.Put("/test/k", nil)
+    if _, err := c.Set("/k", []byte("w")); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test/k"); string(data) != "w" {
+        t.Errorf("value %q", data)
+    }
+
+    // Failures caused by the operation itself aren't retried.
+    creates := zk.Requests(fzCreate)
+    if _, err := c.Create("/k", nil, false); err == nil {
+        t.Fatal("Create of an existing key succeeded")
+    }
+    if n := zk.Requests(fzCreate) - creates; n != 1 {
+        t.Errorf("%d attempts of a failing Create", n)
+    }
+}
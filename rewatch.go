@@ -0,0 +1,98 @@
+package goffkv_zk
+
+import (
+    "math/rand"
+    "sync/atomic"
+    "time"
+)
+
+// Spreads the re-registration of long-lived watches lost at once (e.g. all of them when the
+// session expires), which would otherwise hit the ensemble in a single burst.
+type rewatchPacing struct {
+    // Accessed atomically (first for alignment).
+    reregistered uint64
+    pending int64
+    maxDelay time.Duration
+    limiter throttle
+}
+
+// Progress of the re-registration of lost watches.
+type RewatchProgress struct {
+    // Watches waiting for their turn.
+    Pending int
+    // Watches re-registered through pacing since the client was created.
+    Reregistered uint64
+}
+
+// WithRewatchPacing makes long-lived watches (see WatchKey) whose zk watch is lost rather than
+// fired wait a random delay up to maxDelay, then at most rate (per second, unlimited if 0) of them
+// are set again, instead of all at once. Changes in the meantime are delivered late, not lost.
+func WithRewatchPacing(maxDelay time.Duration, rate float64) Option {
+    return func(c *Client) {
+        c.rewatch = &rewatchPacing{
+            maxDelay: maxDelay,
+            limiter: throttle{rate: rate},
+        }
+    }
+}
+
+// RewatchProgress reports on the re-registration of lost watches (zero without WithRewatchPacing).
+func (c *Client) RewatchProgress() RewatchProgress {
+    if c.rewatch == nil {
+        return RewatchProgress{}
+    }
+    return RewatchProgress{
+        Pending: int(atomic.LoadInt64(&c.rewatch.pending)),
+        Reregistered: atomic.LoadUint64(&c.rewatch.reregistered),
+    }
+}
+
+// Waits for the turn of a lost watch; false if stop or the client is closed first. done must be
+// called once the watch is registered again.
+func (c *Client) awaitRewatch(stop <-chan struct{}) (ok bool, done func()) {
+    p := c.rewatch
+    if p == nil {
+        return true, func() {}
+    }
+
+    if atomic.AddInt64(&p.pending, 1) == 1 {
+        c.logger.Printf("rewatch: watches lost, re-registering them over up to %v", p.maxDelay)
+    }
+    finish := func() {
+        if atomic.AddInt64(&p.pending, -1) == 0 {
+            c.logger.Printf("rewatch: lost watches re-registered (%d so far)", atomic.LoadUint64(&p.reregistered))
+        }
+    }
+
+    var delay time.Duration
+    if p.maxDelay > 0 {
+        delay = time.Duration(rand.Int63n(int64(p.maxDelay)))
+    }
+    timer := time.NewTimer(delay)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+    case <-stop:
+        finish()
+        return false, nil
+    case <-c.done:
+        finish()
+        return false, nil
+    }
+
+    timer.Reset(p.limiter.reserve(1))
+    select {
+    case <-timer.C:
+    case <-stop:
+        finish()
+        return false, nil
+    case <-c.done:
+        finish()
+        return false, nil
+    }
+
+    return true, func() {
+        atomic.AddUint64(&p.reregistered, 1)
+        finish()
+    }
+}
@@ -0,0 +1,106 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "testing"
+    "time"
+)
+
+// Watches lost with the session are set again over the pacing delay, and deliver the changes made
+// in the meantime.
+func TestRewatchPacing(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithRewatchPacing(200 * time.Millisecond, 0))
+    defer c.Close()
+
+    const n = 5
+    var watchers []*Watcher
+    for i := 0; i < n; i++ {
+        key := fmt.Sprintf("/k%d", i)
+        if _, err := c.Set(key, []byte("a")); err != nil {
+            t.Fatal(err)
+        }
+        w, err := c.WatchKey(key)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer w.Stop()
+        watchers = append(watchers, w)
+    }
+
+    zk.Expire()
+    eventually(t, "the lost watches", func() bool {
+        return c.RewatchProgress().Pending > 0
+    })
+    zk.Put("/test/k0", []byte("b"))
+    eventually(t, "the watches set again", func() bool {
+        progress := c.RewatchProgress()
+        return progress.Pending == 0 && progress.Reregistered == n
+    })
+
+    select {
+    case event := <-watchers[0].Events():
+        if string(event.Value) != "b" {
+            t.Errorf("event %+v, want the change made while the watch was lost", event)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("change made while the watch was lost not delivered")
+    }
+    if _, err := c.Set("/k1", []byte("c")); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case event := <-watchers[1].Events():
+        if string(event.Value) != "c" {
+            t.Errorf("event %+v, want the value set", event)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("watch set again doesn't fire")
+    }
+}
+
+func TestRewatchWithoutPacing(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    if _, err := c.Set("/k", []byte("a")); err != nil {
+        t.Fatal(err)
+    }
+    w, err := c.WatchKey("/k")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer w.Stop()
+    expired := make(chan struct{}, 1)
+    cancel := c.OnSessionState(func(state SessionState) {
+        if state == SessionExpired {
+            select {
+            case expired <- struct{}{}:
+            default:
+            }
+        }
+    })
+    defer cancel()
+    zk.Expire()
+    <-expired
+    eventually(t, "the new session", func() bool {
+        return c.SessionState() == SessionConnected
+    })
+    if _, err := c.Set("/k", []byte("b")); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case event := <-w.Events():
+        if string(event.Value) != "b" {
+            t.Errorf("event %+v", event)
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("watch lost with the session not set again")
+    }
+    if progress := c.RewatchProgress(); progress != (RewatchProgress{}) {
+        t.Errorf("progress %+v without pacing", progress)
+    }
+}
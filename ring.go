@@ -0,0 +1,156 @@
+package goffkv_zk
+
+import (
+    "hash/fnv"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    ringReplicas = 64
+)
+
+type ringPoint struct {
+    hash uint64
+    member string
+}
+
+// Consistent-hash ring over the children of a key, updated as children come and go.
+type HashRing struct {
+    *gate
+    c *Client
+    path string
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.RWMutex
+    members []string
+    points []ringPoint
+}
+
+func ringHash(s string) uint64 {
+    h := fnv.New64a()
+    h.Write([]byte(s))
+    return h.Sum64()
+}
+
+// HashRing builds a ring of the current children of key (e.g. registered workers).
+func (c *Client) HashRing(key string) (*HashRing, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    r := &HashRing{
+        gate: newGate(),
+        c: c,
+        path: c.assemblePath(segments),
+        stop: make(chan struct{}),
+    }
+
+    ech, err := r.load()
+    if err != nil {
+        return nil, convertError(err)
+    }
+
+    r.markReady()
+    go r.loop(ech)
+    return r, nil
+}
+
+func (r *HashRing) load() (<-chan zkapi.Event, error) {
+    children, _, ech, err := r.c.conn.ChildrenW(r.path)
+    if err != nil {
+        return nil, err
+    }
+
+    sort.Strings(children)
+    points := make([]ringPoint, 0, len(children) * ringReplicas)
+    for _, child := range children {
+        for i := 0; i < ringReplicas; i++ {
+            points = append(points, ringPoint{
+                hash: ringHash(child + "#" + strconv.Itoa(i)),
+                member: child,
+            })
+        }
+    }
+    sort.Slice(points, func(i, j int) bool {
+        return points[i].hash < points[j].hash
+    })
+
+    r.mu.Lock()
+    r.members = children
+    r.points = points
+    r.mu.Unlock()
+    return ech, nil
+}
+
+func (r *HashRing) loop(ech <-chan zkapi.Event) {
+    for {
+        select {
+        case <-ech:
+        case <-r.stop:
+            return
+        case <-r.c.done:
+            r.fail(ErrClientClosed)
+            return
+        }
+
+        for {
+            var err error
+            ech, err = r.load()
+            if err == nil {
+                break
+            }
+            if err == zkapi.ErrNoNode {
+                r.mu.Lock()
+                r.members = nil
+                r.points = nil
+                r.mu.Unlock()
+            }
+            select {
+            case <-time.After(watchRetryDelay):
+            case <-r.stop:
+                return
+            case <-r.c.done:
+                r.fail(ErrClientClosed)
+                return
+            }
+        }
+    }
+}
+
+// Member maps an item to a member (child name); ok is false if the ring is empty.
+func (r *HashRing) Member(item string) (member string, ok bool) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    if len(r.points) == 0 {
+        return "", false
+    }
+    h := ringHash(item)
+    i := sort.Search(len(r.points), func(i int) bool {
+        return r.points[i].hash >= h
+    })
+    if i == len(r.points) {
+        i = 0
+    }
+    return r.points[i].member, true
+}
+
+// Members returns the sorted names of the current children.
+func (r *HashRing) Members() []string {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    return append([]string{}, r.members...)
+}
+
+func (r *HashRing) Close() {
+    r.stopOnce.Do(func() {
+        close(r.stop)
+    })
+}
@@ -0,0 +1,64 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "reflect"
+    "testing"
+)
+
+func TestHashRing(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/workers", nil)
+    r, err := c.HashRing("/workers")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer r.Close()
+    if _, ok := r.Member("item"); ok {
+        t.Fatal("member of an empty ring")
+    }
+
+    for _, name := range []string{"w1", "w2", "w3"} {
+        if _, err := c.Create("/workers/" + name, nil, false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    eventually(t, "the workers", func() bool {
+        return len(r.Members()) == 3
+    })
+    if !reflect.DeepEqual(r.Members(), []string{"w1", "w2", "w3"}) {
+        t.Errorf("members %v", r.Members())
+    }
+
+    const items = 300
+    before := make(map[string]string)
+    load := make(map[string]int)
+    for i := 0; i < items; i++ {
+        item := fmt.Sprint("item-", i)
+        before[item], _ = r.Member(item)
+        load[before[item]]++
+    }
+    for member, n := range load {
+        if n < items / 10 {
+            t.Errorf("%s owns only %d items of %d", member, n, items)
+        }
+    }
+
+    // Only the items of the member that left move.
+    if err := c.Erase("/workers/w2", 0); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "w2 to leave", func() bool {
+        return len(r.Members()) == 2
+    })
+    for item, owner := range before {
+        now, _ := r.Member(item)
+        if owner != "w2" && now != owner || now == "w2" {
+            t.Errorf("%s moved from %s to %s", item, owner, now)
+        }
+    }
+}
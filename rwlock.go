@@ -0,0 +1,57 @@
+package goffkv_zk
+
+import (
+    "path"
+    "strings"
+)
+
+const (
+    readLockNodeName = "__READ__"
+    writeLockNodeName = "__WRIT__"
+)
+
+// Distributed shared/exclusive lock using the layout of Curator's InterProcessReadWriteLock:
+// readers and writers are contenders "_c_<guid>-__READ__<seq>" and "_c_<guid>-__WRIT__<seq>" of
+// the lock key. A reader only waits for the writers before it, a writer waits for everybody
+// before it; readers arriving after a waiting writer queue behind it, so writers don't starve.
+// The read and write locks are Readiness gates of their own; the pair has no state to be ready.
+type RWMutex struct {
+    read *Mutex
+    write *Mutex
+}
+
+// RWMutex returns a handle of the read-write lock at key; nothing is created until one of its
+// locks is acquired. opts applies to both locks.
+func (c *Client) RWMutex(key string, opts MutexOptions) (*RWMutex, error) {
+    read, err := c.Mutex(key, opts)
+    if err != nil {
+        return nil, err
+    }
+    write, err := c.Mutex(key, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    read.nodeName = readLockNodeName
+    read.blocks = func(name string) bool {
+        if !strings.Contains(name, writeLockNodeName) {
+            return false
+        }
+        // Holding the write lock grants the read lock too.
+        held, _ := write.heldNode.Load().(string)
+        return held == "" || path.Base(held) != name
+    }
+    write.nodeName = writeLockNodeName
+    return &RWMutex{read, write}, nil
+}
+
+// ReadLock returns the shared lock; holding it through several handles is fine.
+func (rw *RWMutex) ReadLock() *Mutex {
+    return rw.read
+}
+
+// WriteLock returns the exclusive lock. As with Curator, the holder of the write lock can take
+// the read lock too (and keep it after releasing the write lock), but not the other way round.
+func (rw *RWMutex) WriteLock() *Mutex {
+    return rw.write
+}
@@ -0,0 +1,67 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+func newRWMutex(t *testing.T, c *Client) *RWMutex {
+    rw, err := c.RWMutex("/lock", MutexOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return rw
+}
+
+func TestRWMutex(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    r1, r2, w := newRWMutex(t, c), newRWMutex(t, c), newRWMutex(t, c)
+    if err := r1.ReadLock().Lock(); err != nil {
+        t.Fatal(err)
+    }
+    if ok, err := r2.ReadLock().TryLock(time.Second); !ok || err != nil {
+        t.Fatalf("second reader: %v, %v", ok, err)
+    }
+    if ok, err := w.WriteLock().TryLock(50 * time.Millisecond); ok || err != nil {
+        t.Fatalf("writer while read-locked: %v, %v", ok, err)
+    }
+
+    // A reader arriving after a waiting writer queues behind it.
+    written := make(chan error, 1)
+    go func() {
+        written <- w.WriteLock().Lock()
+    }()
+    eventually(t, "the waiting writer", func() bool {
+        return len(contenders(zk)) == 3
+    })
+    r3 := newRWMutex(t, c)
+    if ok, err := r3.ReadLock().TryLock(50 * time.Millisecond); ok || err != nil {
+        t.Fatalf("reader behind a waiting writer: %v, %v", ok, err)
+    }
+
+    r1.ReadLock().Unlock()
+    r2.ReadLock().Unlock()
+    select {
+    case err := <-written:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("writer not granted once the readers left")
+    }
+
+    // The writer may take the read lock too, and keep it.
+    if ok, err := w.ReadLock().TryLock(time.Second); !ok || err != nil {
+        t.Fatalf("read lock of the writer: %v, %v", ok, err)
+    }
+    if err := w.WriteLock().Unlock(); err != nil {
+        t.Fatal(err)
+    }
+    if ok, err := r3.ReadLock().TryLock(time.Second); !ok || err != nil {
+        t.Errorf("reader after the writer downgraded: %v, %v", ok, err)
+    }
+}
@@ -0,0 +1,131 @@
+package goffkv_zk
+
+import (
+    "sync"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+type SessionState int
+
+const (
+    // Looking for an ensemble member, or establishing a session with one.
+    SessionConnecting SessionState = iota + 1
+    SessionConnected
+    // The connection has been lost; the session (and its ephemeral keys) may still be alive.
+    SessionDisconnected
+    // The session has expired: all its ephemeral keys, leases, locks and watches are gone.
+    // The client goes on with a new session.
+    SessionExpired
+    SessionAuthFailed
+)
+
+func (s SessionState) String() string {
+    switch s {
+    case SessionConnecting:
+        return "connecting"
+    case SessionConnected:
+        return "connected"
+    case SessionDisconnected:
+        return "disconnected"
+    case SessionExpired:
+        return "expired"
+    case SessionAuthFailed:
+        return "auth failed"
+    default:
+        return "unknown"
+    }
+}
+
+func sessionStateOf(state zkapi.State) (SessionState, bool) {
+    switch state {
+    case zkapi.StateConnecting, zkapi.StateConnected:
+        return SessionConnecting, true
+    case zkapi.StateHasSession:
+        return SessionConnected, true
+    case zkapi.StateDisconnected:
+        return SessionDisconnected, true
+    case zkapi.StateExpired:
+        return SessionExpired, true
+    case zkapi.StateAuthFailed:
+        return SessionAuthFailed, true
+    default:
+        return 0, false
+    }
+}
+
+// Subscribers to session state transitions, added and removed at run time.
+type sessionSubscribers struct {
+    mu sync.Mutex
+    next int
+    all map[int]func(SessionState)
+}
+
+// OnSessionState calls fn on every session state transition until cancel is called. fn runs on the
+// goroutine handling connection events and must not block. Recipes use it to drop their state
+// (e.g. a held lock) as soon as the session has expired.
+func (c *Client) OnSessionState(fn func(SessionState)) (cancel func()) {
+    c.subscribers.mu.Lock()
+    defer c.subscribers.mu.Unlock()
+
+    if c.subscribers.all == nil {
+        c.subscribers.all = make(map[int]func(SessionState))
+    }
+    id := c.subscribers.next
+    c.subscribers.next++
+    c.subscribers.all[id] = fn
+
+    return func() {
+        c.subscribers.mu.Lock()
+        defer c.subscribers.mu.Unlock()
+
+        delete(c.subscribers.all, id)
+    }
+}
+
+// Returns a channel closed once the session expires, and a function to stop watching for it.
+func (c *Client) sessionExpiry() (<-chan struct{}, func()) {
+    expired := make(chan struct{})
+    var once sync.Once
+    cancel := c.OnSessionState(func(state SessionState) {
+        if state == SessionExpired {
+            once.Do(func() {
+                close(expired)
+            })
+        }
+    })
+    return expired, cancel
+}
+
+func (c *Client) notifySession(state SessionState) {
+    for _, listener := range c.sessionListeners {
+        listener(state)
+    }
+
+    c.subscribers.mu.Lock()
+    subscribers := make([]func(SessionState), 0, len(c.subscribers.all))
+    for _, fn := range c.subscribers.all {
+        subscribers = append(subscribers, fn)
+    }
+    c.subscribers.mu.Unlock()
+
+    for _, fn := range subscribers {
+        fn(state)
+    }
+}
+
+// WithSessionListener calls fn on every session state transition, in order. fn runs on the
+// goroutine handling connection events and must not block.
+func WithSessionListener(fn func(SessionState)) Option {
+    return func(c *Client) {
+        c.sessionListeners = append(c.sessionListeners, fn)
+    }
+}
+
+// SessionState returns the current state of the session.
+func (c *Client) SessionState() SessionState {
+    state, ok := sessionStateOf(c.conn.State())
+    if !ok {
+        return SessionConnecting
+    }
+    return state
+}
@@ -0,0 +1,79 @@
+package goffkv_zk
+
+import (
+    "sync"
+    "testing"
+)
+
+// Records session states.
+type stateLog struct {
+    mu sync.Mutex
+    states []SessionState
+}
+
+func (l *stateLog) add(state SessionState) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.states = append(l.states, state)
+}
+
+// Tells whether want has been recorded since the first from entries.
+func (l *stateLog) seen(from int, want SessionState) bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    for _, state := range l.states[from:] {
+        if state == want {
+            return true
+        }
+    }
+    return false
+}
+
+func (l *stateLog) len() int {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return len(l.states)
+}
+
+func TestSessionStates(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    listener := &stateLog{}
+    c := newTestClient(t, zk, WithSessionListener(listener.add))
+    defer c.Close()
+
+    eventually(t, "the session", func() bool {
+        return c.SessionState() == SessionConnected && listener.seen(0, SessionConnected)
+    })
+    subscriber := &stateLog{}
+    cancel := c.OnSessionState(subscriber.add)
+
+    mark := listener.len()
+    zk.Stop()
+    eventually(t, "the disconnection", func() bool {
+        return listener.seen(mark, SessionDisconnected) && subscriber.seen(0, SessionDisconnected)
+    })
+    if state := c.SessionState(); state == SessionConnected {
+        t.Errorf("state %v while the server is down", state)
+    }
+    zk.Start()
+    eventually(t, "the reconnection", func() bool {
+        return c.SessionState() == SessionConnected
+    })
+    if listener.seen(mark, SessionExpired) {
+        t.Error("session expired over a short disconnection")
+    }
+
+    cancel()
+    seen := subscriber.len()
+    zk.Expire()
+    eventually(t, "the expiry", func() bool {
+        return listener.seen(mark, SessionExpired)
+    })
+    eventually(t, "the new session", func() bool {
+        return c.SessionState() == SessionConnected
+    })
+    if subscriber.len() != seen {
+        t.Error("cancelled subscriber still called")
+    }
+}
@@ -0,0 +1,121 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// A collection of entries spread over a fixed number of sub-parents ("<key>/<shard>/<id>", shards
+// named in hex, e.g. "00".."ff"), so that no single node gets a huge number of children. Entries
+// are addressed by id; the shard of an id is derived from its hash.
+type Sharded struct {
+    c *Client
+    key string
+    shards int
+    width int
+}
+
+// Sharded returns the collection at key spread over shards sub-parents. Every client of the
+// collection must use the same number of shards.
+func (c *Client) Sharded(key string, shards int) (*Sharded, error) {
+    if _, err := c.disassembleKey(key); err != nil {
+        return nil, err
+    }
+    if shards < 1 {
+        shards = 1
+    }
+
+    return &Sharded{
+        c: c,
+        key: key,
+        shards: shards,
+        width: len(fmt.Sprintf("%x", shards - 1)),
+    }, nil
+}
+
+func (s *Sharded) shardKey(shard int) string {
+    return fmt.Sprintf("%s/%0*x", s.key, s.width, shard)
+}
+
+// Key returns the actual key of the entry id.
+func (s *Sharded) Key(id string) string {
+    return s.shardKey(int(ringHash(id) % uint64(s.shards))) + "/" + id
+}
+
+// Create works like Client.Create, creating the shard of id first if needed.
+func (s *Sharded) Create(id string, value []byte, lease bool) (goffkv.Version, error) {
+    key := s.Key(id)
+    for {
+        ver, err := s.c.Create(key, value, lease)
+        if err != goffkv.OpErrNoEntry {
+            return ver, err
+        }
+
+        _, err = s.c.Create(key[:strings.LastIndexByte(key, '/')], nil, false)
+        if err != nil && err != goffkv.OpErrEntryExists {
+            return 0, err
+        }
+    }
+}
+
+// Set works like Client.Set, creating the shard of id first if needed.
+func (s *Sharded) Set(id string, value []byte) (goffkv.Version, error) {
+    key := s.Key(id)
+    for {
+        ver, err := s.c.Set(key, value)
+        if err != goffkv.OpErrNoEntry {
+            return ver, err
+        }
+
+        _, err = s.c.Create(key[:strings.LastIndexByte(key, '/')], nil, false)
+        if err != nil && err != goffkv.OpErrEntryExists {
+            return 0, err
+        }
+    }
+}
+
+func (s *Sharded) Get(id string) (goffkv.Version, []byte, error) {
+    ver, value, _, err := s.c.Get(s.Key(id), false)
+    return ver, value, err
+}
+
+func (s *Sharded) Erase(id string, ver goffkv.Version) error {
+    return s.c.Erase(s.Key(id), ver)
+}
+
+// Walk calls fn with the id of every entry, shard by shard; it stops at the first error of fn.
+func (s *Sharded) Walk(fn func(id string) error) error {
+    for shard := 0; shard < s.shards; shard++ {
+        children, _, err := s.c.Children(s.shardKey(shard), false)
+        if err == goffkv.OpErrNoEntry {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+
+        for _, child := range children {
+            err = fn(child[strings.LastIndexByte(child, '/') + 1:])
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// IDs returns the ids of all entries, sorted.
+func (s *Sharded) IDs() ([]string, error) {
+    result := []string{}
+    err := s.Walk(func(id string) error {
+        result = append(result, id)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(result)
+    return result, nil
+}
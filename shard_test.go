@@ -0,0 +1,64 @@
+package goffkv_zk
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+)
+
+func TestSharded(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/items", nil)
+    s, err := c.Sharded("/items", 16)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ids := []string{}
+    for i := 0; i < 40; i++ {
+        id := fmt.Sprint("id-", i)
+        ids = append(ids, id)
+        if _, err := s.Create(id, []byte(id), false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    sort.Strings(ids)
+    if got, err := s.IDs(); err != nil || !reflect.DeepEqual(got, ids) {
+        t.Fatalf("IDs: %v, %v", got, err)
+    }
+
+    shards, _, err := c.Children("/items", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(shards) < 2 || len(shards) > 16 {
+        t.Errorf("%d shards for 40 entries", len(shards))
+    }
+    for _, shard := range shards {
+        // One hex digit for 16 shards.
+        if name := strings.TrimPrefix(shard, "/items/"); len(name) != 1 {
+            t.Errorf("shard %s", shard)
+        }
+    }
+
+    // Every client of the collection finds the same entries.
+    other, _ := c.Sharded("/items", 16)
+    if _, value, err := other.Get("id-7"); err != nil || string(value) != "id-7" {
+        t.Errorf("Get: %q, %v", value, err)
+    }
+    if _, err := other.Set("new", []byte("n")); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Erase("id-7", 0); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := s.IDs(); len(got) != 40 {
+        t.Errorf("%d ids after a Set and an Erase, want 40", len(got))
+    }
+}
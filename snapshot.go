@@ -0,0 +1,83 @@
+package goffkv_zk
+
+import (
+    "context"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// How many times GetConsistent reads the keys before it gives up.
+const maxSnapshotRestarts = 16
+
+// GetConsistent reads several keys as of a single point in time: the values are read one by one,
+// then validated with a Multi of version checks, which the ensemble applies atomically; if any key
+// has changed in between, everything is read again, backing off as described by ConflictBackoff.
+// Fails with ErrTooManyConflicts after 16 attempts. All keys must exist.
+func (c *Client) GetConsistent(keys []string) ([]Entry, error) {
+    return c.GetConsistentContext(context.Background(), keys)
+}
+
+// GetConsistentContext is GetConsistent, giving up rereading once ctx is done.
+func (c *Client) GetConsistentContext(ctx context.Context, keys []string) ([]Entry, error) {
+    if len(keys) == 0 {
+        return []Entry{}, nil
+    }
+
+    paths := make([]string, len(keys))
+    for i, key := range keys {
+        segments, err := c.disassembleKey(key)
+        if err != nil {
+            return nil, err
+        }
+        paths[i] = c.assemblePath(segments)
+    }
+
+    var result []Entry
+    restarts := 0
+    err := c.resolveConflicts(ctx, func() (bool, error) {
+        if restarts == maxSnapshotRestarts {
+            return false, ErrTooManyConflicts
+        }
+        restarts++
+
+        result = make([]Entry, len(keys))
+        ops := make([]interface{}, len(keys))
+        for i, path := range paths {
+            value, stat, err := c.get(path)
+            if err != nil {
+                return false, KeyError{keys[i], convertError(err)}
+            }
+            result[i] = Entry{
+                Ver: VersionOf(stat),
+                Value: valueOf(value),
+                FetchedAt: time.Now(),
+            }
+            ops[i] = &zkapi.CheckVersionRequest{
+                Path: path,
+                Version: stat.Version,
+            }
+        }
+
+        data, err := c.conn.Multi(ops...)
+        switch err {
+        case nil:
+            return false, nil
+        case zkapi.ErrBadVersion:
+            return true, nil
+        case zkapi.ErrNoNode:
+            for i, datum := range data {
+                if datum.Error == zkapi.ErrNoNode {
+                    return false, KeyError{keys[i], goffkv.OpErrNoEntry}
+                }
+            }
+            return false, goffkv.OpErrNoEntry
+        default:
+            return false, convertError(err)
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
+}
@@ -0,0 +1,60 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestGetConsistent(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    for _, key := range []string{"/a", "/b"} {
+        if _, err := c.Set(key, []byte(key)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    entries, err := c.GetConsistent([]string{"/a", "/b"})
+    if err != nil || len(entries) != 2 || string(entries[0].Value) != "/a" || string(entries[1].Value) != "/b" {
+        t.Fatalf("GetConsistent: %+v, %v", entries, err)
+    }
+    if _, err := c.GetConsistent([]string{"/a", "/missing"}); !errors.Is(err, goffkv.OpErrNoEntry) {
+        t.Errorf("GetConsistent of a missing key: %v, want OpErrNoEntry", err)
+    }
+}
+
+// Keys that keep changing make GetConsistent give up instead of spinning.
+func TestGetConsistentContended(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithConflictBackoff(ConflictBackoff{Backoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+    defer c.Close()
+
+    if _, err := c.Set("/a", nil); err != nil {
+        t.Fatal(err)
+    }
+    zk.Fail(func(op int32, path string) error {
+        if op == fzMulti {
+            return zkapi.ErrBadVersion
+        }
+        return nil
+    })
+    if _, err := c.GetConsistent([]string{"/a"}); err != ErrTooManyConflicts {
+        t.Errorf("GetConsistent of a contended key: %v, want ErrTooManyConflicts", err)
+    }
+    if n := zk.Requests(fzMulti); n != maxSnapshotRestarts {
+        t.Errorf("%d attempts, want %d", n, maxSnapshotRestarts)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err := c.GetConsistentContext(ctx, []string{"/a"}); err != context.Canceled {
+        t.Errorf("GetConsistentContext with a cancelled context: %v", err)
+    }
+}
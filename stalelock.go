@@ -0,0 +1,149 @@
+package goffkv_zk
+
+import (
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    flwTimeout = 5 * time.Second
+)
+
+type StaleReason int
+
+const (
+    // A contender node that isn't ephemeral, so it will never go away by itself.
+    StalePersistent StaleReason = iota + 1
+    // An ephemeral node whose owner session is not connected to any ensemble member.
+    StaleDeadOwner
+    // An ephemeral node older than StaleLockOptions.MaxAge: its owner might be stuck.
+    StaleOld
+)
+
+func (r StaleReason) String() string {
+    switch r {
+    case StalePersistent:
+        return "persistent"
+    case StaleDeadOwner:
+        return "dead owner"
+    case StaleOld:
+        return "old"
+    default:
+        return "unknown"
+    }
+}
+
+type StaleLock struct {
+    Key string
+    Owner int64
+    Created time.Time
+    Reason StaleReason
+    version int32
+}
+
+type StaleLockOptions struct {
+    // Report ephemeral contenders older than this; 0 disables the check.
+    MaxAge time.Duration
+    // Cross-check owners against the sessions listed by the "cons" four-letter word of every
+    // ensemble member. Skipped if any member doesn't answer, to avoid false positives.
+    CheckSessions bool
+}
+
+// FindStaleLocks scans the subtree at key for contender nodes (sequential children, as created
+// by locks, elections and queues) that look abandoned.
+func (c *Client) FindStaleLocks(key string, opts StaleLockOptions) ([]StaleLock, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    var live map[int64]bool
+    if opts.CheckSessions {
+        servers, ok := zkapi.FLWCons(c.servers, flwTimeout)
+        for _, server := range servers {
+            // A member lists at least the connection asking; an empty list isn't an answer.
+            ok = ok && len(server.Clients) != 0
+        }
+        if ok {
+            live = make(map[int64]bool)
+            for _, server := range servers {
+                for _, client := range server.Clients {
+                    live[client.SessionID] = true
+                }
+            }
+        }
+    }
+
+    result := []StaleLock{}
+    err = c.findStaleLocks(key, c.assemblePath(segments), opts, live, &result)
+    if err != nil {
+        return nil, convertError(err)
+    }
+    return result, nil
+}
+
+func (c *Client) findStaleLocks(key string, path string, opts StaleLockOptions, live map[int64]bool, result *[]StaleLock) error {
+    children, _, err := c.conn.Children(path)
+    if err != nil {
+        return err
+    }
+
+    for _, child := range children {
+        childKey, childPath := key + "/" + child, path + "/" + child
+        if sequenceOf(child) < 0 {
+            err = c.findStaleLocks(childKey, childPath, opts, live, result)
+            if err != nil && err != zkapi.ErrNoNode {
+                return err
+            }
+            continue
+        }
+
+        exists, stat, err := c.conn.Exists(childPath)
+        if err != nil {
+            return err
+        }
+        if !exists {
+            continue
+        }
+
+        lock := StaleLock{
+            Key: childKey,
+            Owner: stat.EphemeralOwner,
+            Created: time.Unix(0, stat.Ctime * int64(time.Millisecond)),
+            version: stat.Version,
+        }
+        switch {
+        case stat.EphemeralOwner == 0:
+            lock.Reason = StalePersistent
+        case live != nil && !live[stat.EphemeralOwner]:
+            lock.Reason = StaleDeadOwner
+        case opts.MaxAge > 0 && time.Since(lock.Created) > opts.MaxAge:
+            lock.Reason = StaleOld
+        default:
+            continue
+        }
+        *result = append(*result, lock)
+    }
+    return nil
+}
+
+// RemoveStaleLocks erases nodes found by FindStaleLocks, unless they have changed since.
+// Note that removing the node of a live owner takes the lock away from it.
+func (c *Client) RemoveStaleLocks(locks []StaleLock) error {
+    keys := make([]string, len(locks))
+    for i, lock := range locks {
+        keys[i] = lock.Key
+    }
+
+    return forEachKey(keys, func(i int, key string) error {
+        segments, err := c.disassembleKey(key)
+        if err != nil {
+            return err
+        }
+        err = c.conn.Delete(c.assemblePath(segments), locks[i].version)
+        if err == zkapi.ErrNoNode {
+            return nil
+        }
+        return convertError(err)
+    })
+}
@@ -0,0 +1,51 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+func TestStaleLocks(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    // Left behind by a buggy client: persistent contenders never go away.
+    zk.Put("/test/locks/a/_c_x-lock-0000000001", nil)
+    zk.Put("/test/locks/a/_c_y-lock-0000000002", nil)
+    if _, err := c.Lock("/locks/b"); err != nil {
+        t.Fatal(err)
+    }
+
+    // The fake server answers "cons" with an empty list: sessions can't be checked, so no owner
+    // is reported dead.
+    stale, err := c.FindStaleLocks("/locks", StaleLockOptions{CheckSessions: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(stale) != 2 || stale[0].Reason != StalePersistent || stale[1].Reason != StalePersistent {
+        t.Fatalf("stale locks %+v, want the two persistent ones", stale)
+    }
+
+    time.Sleep(20 * time.Millisecond)
+    old, err := c.FindStaleLocks("/locks/b", StaleLockOptions{MaxAge: 10 * time.Millisecond})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(old) != 1 || old[0].Reason != StaleOld || old[0].Owner != c.ConnInfo().SessionID {
+        t.Errorf("old locks %+v", old)
+    }
+
+    // Changed since found: kept.
+    zk.Put("/test" + stale[1].Key, []byte("changed"))
+    if err := c.RemoveStaleLocks(stale); err == nil {
+        t.Error("RemoveStaleLocks removed a changed node")
+    }
+    if _, _, ok := zk.Node("/test" + stale[0].Key); ok {
+        t.Errorf("%s left", stale[0].Key)
+    }
+    if _, _, ok := zk.Node("/test" + stale[1].Key); !ok {
+        t.Errorf("%s removed", stale[1].Key)
+    }
+}
@@ -0,0 +1,155 @@
+package goffkv_zk
+
+import (
+    "sort"
+    "sync"
+    "sync/atomic"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// A key watched by a long-lived watch, with the version of its last event.
+type WatchedKey struct {
+    Key string `json:"key"`
+    Ver uint64 `json:"ver"`
+}
+
+// The long-lived watches of a client (see WatchKey), as handed over to a standby client; it can
+// be serialized as JSON to cross process boundaries.
+type WatchSet struct {
+    Keys []WatchedKey `json:"keys"`
+}
+
+// WatchSet returns the keys of the active long-lived watches, sorted, each with the version of
+// its last queued event. A key watched several times is listed once, with its oldest version.
+func (c *Client) WatchSet() WatchSet {
+    c.watchers.mu.Lock()
+    watchers := make([]*Watcher, 0, len(c.watchers.all))
+    for w := range c.watchers.all {
+        watchers = append(watchers, w)
+    }
+    c.watchers.mu.Unlock()
+
+    versions := make(map[string]goffkv.Version)
+    for _, w := range watchers {
+        w.mu.Lock()
+        ver := w.ver
+        w.mu.Unlock()
+        if known, ok := versions[w.key]; !ok || ver < known {
+            versions[w.key] = ver
+        }
+    }
+
+    result := WatchSet{Keys: make([]WatchedKey, 0, len(versions))}
+    for key, ver := range versions {
+        result.Keys = append(result.Keys, WatchedKey{key, ver})
+    }
+    sort.Slice(result.Keys, func(i, j int) bool {
+        return result.Keys[i].Key < result.Keys[j].Key
+    })
+    return result
+}
+
+// A client connected ahead of time, with the watches of another one registered, ready to take
+// its place (see Swappable).
+type Standby struct {
+    c *Client
+    watchers map[string]*Watcher
+}
+
+// ConnectStandby connects a client like Connect (typically with new credentials or servers) and
+// registers a long-lived watch for every key of set. The watch of a key that has changed since
+// the version in set starts with an event for its current value, so that no change is lost in
+// the handover. Ephemeral keys, locks and other session state aren't transferred.
+func ConnectStandby(address string, prefix string, set WatchSet, opts ...Option) (*Standby, error) {
+    c, err := Connect(address, prefix, opts...)
+    if err != nil {
+        return nil, err
+    }
+
+    s := &Standby{c: c, watchers: make(map[string]*Watcher, len(set.Keys))}
+    for _, watched := range set.Keys {
+        ver := watched.Ver
+        w, err := c.watchKey(watched.Key, &ver)
+        if err != nil {
+            c.Close()
+            return nil, KeyError{watched.Key, err}
+        }
+        s.watchers[watched.Key] = w
+    }
+    return s, nil
+}
+
+func (s *Standby) Client() *Client {
+    return s.c
+}
+
+// Watcher returns the watch registered for key, or nil if key wasn't in the watch set.
+func (s *Standby) Watcher(key string) *Watcher {
+    return s.watchers[key]
+}
+
+// A goffkv.Client forwarding to a Client that can be replaced while in use, e.g. by a Standby.
+type Swappable struct {
+    current atomic.Value
+    // Serializes promotions.
+    mu sync.Mutex
+}
+
+func NewSwappable(c *Client) *Swappable {
+    s := &Swappable{}
+    s.current.Store(c)
+    return s
+}
+
+// Client returns the client operations are currently forwarded to.
+func (s *Swappable) Client() *Client {
+    return s.current.Load().(*Client)
+}
+
+// Promote atomically forwards all subsequent operations to the client of standby, and returns
+// the previous client. Operations in progress complete on the previous client, which the caller
+// closes once they are done (closing it stops its watches too).
+func (s *Swappable) Promote(standby *Standby) *Client {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    previous := s.Client()
+    s.current.Store(standby.c)
+    return previous
+}
+
+func (s *Swappable) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
+    return s.Client().Create(key, value, lease)
+}
+
+func (s *Swappable) Set(key string, value []byte) (goffkv.Version, error) {
+    return s.Client().Set(key, value)
+}
+
+func (s *Swappable) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    return s.Client().Cas(key, value, ver)
+}
+
+func (s *Swappable) Erase(key string, ver goffkv.Version) error {
+    return s.Client().Erase(key, ver)
+}
+
+func (s *Swappable) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    return s.Client().Exists(key, watch)
+}
+
+func (s *Swappable) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    return s.Client().Get(key, watch)
+}
+
+func (s *Swappable) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
+    return s.Client().Children(key, watch)
+}
+
+func (s *Swappable) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    return s.Client().Commit(txn)
+}
+
+func (s *Swappable) Close() {
+    s.Client().Close()
+}
@@ -0,0 +1,86 @@
+package goffkv_zk
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+)
+
+func TestStandbyHandover(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+
+    var vers []uint64
+    for _, key := range []string{"/b", "/a"} {
+        ver, err := c.Set(key, []byte("1"))
+        if err != nil {
+            t.Fatal(err)
+        }
+        vers = append(vers, ver)
+        w, err := c.WatchKey(key)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer w.Stop()
+    }
+    set := c.WatchSet()
+    if len(set.Keys) != 2 || set.Keys[0] != (WatchedKey{"/a", vers[1]}) || set.Keys[1] != (WatchedKey{"/b", vers[0]}) {
+        t.Fatalf("watch set %+v", set)
+    }
+
+    // The set crosses a process boundary while /a changes.
+    data, err := json.Marshal(set)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var handed WatchSet
+    if err := json.Unmarshal(data, &handed); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/a", []byte("2")); err != nil {
+        t.Fatal(err)
+    }
+
+    standby, err := ConnectStandby(zk.Addr(), "/test", handed, WithLogger(quietLogger))
+    if err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case event := <-standby.Watcher("/a").Events():
+        if string(event.Value) != "2" {
+            t.Errorf("event %+v, want the change made during the handover", event)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("change made during the handover lost")
+    }
+    select {
+    case event := <-standby.Watcher("/b").Events():
+        t.Errorf("event %+v of an unchanged key", event)
+    default:
+    }
+    if standby.Watcher("/c") != nil {
+        t.Error("watcher of a key not in the set")
+    }
+
+    s := NewSwappable(c)
+    if previous := s.Promote(standby); previous != c {
+        t.Fatal("Promote didn't return the previous client")
+    }
+    c.Close()
+    defer s.Close()
+    if s.Client() != standby.Client() {
+        t.Fatal("operations not forwarded to the standby")
+    }
+    if _, err := s.Set("/b", []byte("2")); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case event := <-standby.Watcher("/b").Events():
+        if string(event.Value) != "2" {
+            t.Errorf("event %+v", event)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("watch of the promoted client doesn't fire")
+    }
+}
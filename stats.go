@@ -0,0 +1,150 @@
+package goffkv_zk
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// State of an ensemble member, as reported by its "mntr" four-letter word, or by "srvr" where
+// mntr isn't whitelisted (4lw.commands.whitelist); fields srvr lacks are zero then.
+type ServerStats struct {
+    Server string
+    // "leader", "follower", "observer", "standalone" or "" if unknown.
+    Mode string
+    Version string
+    // Requests queued on the member.
+    Outstanding int64
+    MinLatency time.Duration
+    AvgLatency time.Duration
+    MaxLatency time.Duration
+    Connections int64
+    NodeCount int64
+    WatchCount int64
+    EphemeralCount int64
+    ApproximateDataSize int64
+    // Of a leader.
+    Followers int64
+    SyncedFollowers int64
+    // Every value reported by mntr, by name without the "zk_" prefix; nil with srvr.
+    Raw map[string]string
+    // Set if the member can't be queried; other fields are zero then.
+    Err error
+}
+
+// Sends a four-letter word to server, through the dialer of the client if any.
+func (c *Client) fourLetterWord(server string, command string) ([]byte, error) {
+    var (
+        conn net.Conn
+        err error
+    )
+    if c.dialer != nil {
+        conn, err = c.dialer("tcp", server, flwTimeout)
+    } else {
+        conn, err = net.DialTimeout("tcp", server, flwTimeout)
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
+
+    conn.SetDeadline(time.Now().Add(flwTimeout))
+    _, err = conn.Write([]byte(command))
+    if err != nil {
+        return nil, err
+    }
+    return ioutil.ReadAll(conn)
+}
+
+// Latencies are in milliseconds, integers before ZooKeeper 3.6.
+func parseMillis(s string) time.Duration {
+    ms, _ := strconv.ParseFloat(s, 64)
+    return time.Duration(ms * float64(time.Millisecond))
+}
+
+func parseMntr(server string, data []byte) (ServerStats, error) {
+    stats := ServerStats{Server: server, Raw: make(map[string]string)}
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    for scanner.Scan() {
+        fields := strings.SplitN(scanner.Text(), "\t", 2)
+        if len(fields) == 2 {
+            stats.Raw[strings.TrimPrefix(fields[0], "zk_")] = strings.TrimSpace(fields[1])
+        }
+    }
+    if len(stats.Raw) == 0 {
+        // E.g. "mntr is not executed because it is not in the whitelist."
+        return ServerStats{}, fmt.Errorf("mntr: %s", strings.TrimSpace(string(data)))
+    }
+
+    integer := func(name string) int64 {
+        n, _ := strconv.ParseInt(stats.Raw[name], 10, 64)
+        return n
+    }
+    stats.Mode = stats.Raw["server_state"]
+    stats.Version = stats.Raw["version"]
+    stats.Outstanding = integer("outstanding_requests")
+    stats.MinLatency = parseMillis(stats.Raw["min_latency"])
+    stats.AvgLatency = parseMillis(stats.Raw["avg_latency"])
+    stats.MaxLatency = parseMillis(stats.Raw["max_latency"])
+    stats.Connections = integer("num_alive_connections")
+    stats.NodeCount = integer("znode_count")
+    stats.WatchCount = integer("watch_count")
+    stats.EphemeralCount = integer("ephemerals_count")
+    stats.ApproximateDataSize = integer("approximate_data_size")
+    stats.Followers = integer("followers")
+    stats.SyncedFollowers = integer("synced_followers")
+    return stats, nil
+}
+
+func (c *Client) serverStats(server string) ServerStats {
+    if data, err := c.fourLetterWord(zkapi.FormatServers([]string{server})[0], "mntr"); err == nil {
+        if stats, err := parseMntr(server, data); err == nil {
+            return stats
+        }
+    }
+
+    srvr, ok := zkapi.FLWSrvr([]string{server}, flwTimeout)
+    if !ok {
+        return ServerStats{Server: server, Err: srvr[0].Error}
+    }
+    s := srvr[0]
+    mode := ""
+    if s.Mode != zkapi.ModeUnknown {
+        mode = s.Mode.String()
+    }
+    return ServerStats{
+        Server: server,
+        Mode: mode,
+        Version: s.Version,
+        Outstanding: s.Outstanding,
+        MinLatency: time.Duration(s.MinLatency) * time.Millisecond,
+        AvgLatency: time.Duration(s.AvgLatency) * time.Millisecond,
+        MaxLatency: time.Duration(s.MaxLatency) * time.Millisecond,
+        Connections: s.Connections,
+        NodeCount: s.NodeCount,
+    }
+}
+
+// ServerStats queries every ensemble member concurrently, in the order of the address of the
+// client. Members that can't be queried have their Err set.
+func (c *Client) ServerStats() []ServerStats {
+    result := make([]ServerStats, len(c.servers))
+
+    var wg sync.WaitGroup
+    for i, server := range c.servers {
+        wg.Add(1)
+        go func(i int, server string) {
+            defer wg.Done()
+            result[i] = c.serverStats(server)
+        }(i, server)
+    }
+    wg.Wait()
+    return result
+}
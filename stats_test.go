@@ -0,0 +1,60 @@
+package goffkv_zk
+
+import (
+    "net"
+    "testing"
+    "time"
+)
+
+func TestParseMntr(t *testing.T) {
+    stats, err := parseMntr("zk1", []byte("zk_version\t3.6.2\nzk_server_state\tleader\nzk_min_latency\t0.25\n" +
+        "zk_max_latency\t12\nzk_outstanding_requests\t3\nzk_followers\t2\nzk_synced_followers\t1\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if stats.Server != "zk1" || stats.Mode != "leader" || stats.Version != "3.6.2" || stats.Outstanding != 3 ||
+        stats.Followers != 2 || stats.SyncedFollowers != 1 {
+        t.Errorf("stats %+v", stats)
+    }
+    if stats.MinLatency != 250 * time.Microsecond || stats.MaxLatency != 12 * time.Millisecond {
+        t.Errorf("latencies %v and %v", stats.MinLatency, stats.MaxLatency)
+    }
+    if stats.Raw["followers"] != "2" {
+        t.Errorf("raw values %v", stats.Raw)
+    }
+
+    if _, err := parseMntr("zk1", []byte("mntr is not executed because it is not in the whitelist.\n")); err == nil {
+        t.Error("refusal parsed")
+    }
+}
+
+func TestServerStats(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+
+    // An address nothing listens on.
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    dead := ln.Addr().String()
+    ln.Close()
+
+    c, err := Connect(zk.Addr() + "," + dead, "/test", WithLogger(quietLogger))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+
+    stats := c.ServerStats()
+    if len(stats) != 2 || stats[0].Server != zk.Addr() || stats[1].Server != dead {
+        t.Fatalf("stats %+v, want those of both members in order", stats)
+    }
+    live := stats[0]
+    if live.Err != nil || live.Mode != "standalone" || live.AvgLatency != 500 * time.Microsecond || live.NodeCount == 0 {
+        t.Errorf("stats of the live member %+v", live)
+    }
+    if stats[1].Err == nil {
+        t.Errorf("stats of the dead member %+v", stats[1])
+    }
+}
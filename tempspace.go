@@ -0,0 +1,255 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "errors"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    tempSegment = "temp"
+    tempNamePrefix = "tmp-"
+)
+
+var (
+    ErrTempSpaceClosed = errors.New("temporary space closed")
+    // Value of the root of a session-bound space; other spaces have an empty one.
+    tempSessionTag = []byte("goffkv-zk:session-bound")
+)
+
+type TempSpaceOptions struct {
+    // Erase the space as soon as the session expires, like an ephemeral node (which can't have
+    // children). If the process dies, the space is left behind for CollectTempSpaces.
+    SessionBound bool
+}
+
+// A scratch subtree with a unique name, erased on Close. Its operations are those of goffkv, with
+// keys relative to the space ("/a" is "<space key>/a").
+type TempSpace struct {
+    c *Client
+    key string
+    // Owner marker of a session-bound space, or "".
+    marker string
+    stop chan struct{}
+
+    mu sync.Mutex
+    closed bool
+}
+
+// TempSpace creates a new space under key (e.g. one per job), which must exist.
+func (c *Client) TempSpace(key string, opts TempSpaceOptions) (*TempSpace, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    var value []byte
+    if opts.SessionBound {
+        value = tempSessionTag
+    }
+    data, err := c.encodeValue(normalizeKey(segments), value)
+    if err != nil {
+        return nil, convertError(err)
+    }
+    path, err := c.conn.Create(c.assemblePath(segments) + "/" + tempNamePrefix, data, zkapi.FlagSequence, c.acl)
+    if err != nil {
+        return nil, convertError(err)
+    }
+
+    ts := &TempSpace{
+        c: c,
+        key: c.keyOf(path),
+        stop: make(chan struct{}),
+    }
+    if !opts.SessionBound {
+        return ts, nil
+    }
+
+    err = c.createEachPrefix(append(append([]string{}, c.prefixSegments...), reservedSegment, tempSegment))
+    if err == nil {
+        ts.marker = c.tempMarkerPath(ts.key)
+        _, err = c.conn.Create(ts.marker, nil, zkapi.FlagEphemeral, c.acl)
+    }
+    if err != nil {
+        ts.Close()
+        return nil, convertError(err)
+    }
+
+    expired, cancel := c.sessionExpiry()
+    go func() {
+        defer cancel()
+        select {
+        case <-expired:
+            ts.Close()
+        case <-ts.stop:
+        case <-c.done:
+        }
+    }()
+    return ts, nil
+}
+
+func (c *Client) tempMarkerPath(key string) string {
+    return c.assemblePath([]string{reservedSegment, tempSegment}) + "/" + url.PathEscape(key)
+}
+
+// CollectTempSpaces erases the session-bound spaces under key whose owner is gone, e.g. because
+// its process has died; spaces younger than 10 minutes are left alone. Returns how many spaces
+// have been erased.
+func (c *Client) CollectTempSpaces(key string) (int, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+    names, _, err := c.conn.Children(c.assemblePath(segments))
+    if err != nil {
+        return 0, convertError(err)
+    }
+
+    removed := 0
+    for _, name := range names {
+        if !strings.HasPrefix(name, tempNamePrefix) {
+            continue
+        }
+        spaceKey := normalizeKey(segments) + "/" + name
+        value, stat, err := c.get(c.assemblePath(append(append([]string{}, segments...), name)))
+        if err == zkapi.ErrNoNode {
+            continue
+        }
+        if err != nil {
+            return removed, KeyError{spaceKey, convertError(err)}
+        }
+        if !bytes.Equal(value, tempSessionTag) || time.Since(zkTime(stat.Ctime)) < defaultGCGrace {
+            // Not session-bound, or possibly not marked yet.
+            continue
+        }
+
+        owned, _, err := c.conn.Exists(c.tempMarkerPath(spaceKey))
+        if err != nil {
+            return removed, convertError(err)
+        }
+        if owned {
+            continue
+        }
+        err = c.Erase(spaceKey, 0)
+        if err != nil && err != goffkv.OpErrNoEntry {
+            return removed, err
+        }
+        removed++
+    }
+    return removed, nil
+}
+
+// Key returns the key of the space, as seen by the client.
+func (ts *TempSpace) Key() string {
+    return ts.key
+}
+
+func (ts *TempSpace) check() error {
+    ts.mu.Lock()
+    defer ts.mu.Unlock()
+
+    if ts.closed {
+        return ErrTempSpaceClosed
+    }
+    return nil
+}
+
+func (ts *TempSpace) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
+    if err := ts.check(); err != nil {
+        return 0, err
+    }
+    return ts.c.Create(ts.key + key, value, lease)
+}
+
+func (ts *TempSpace) Set(key string, value []byte) (goffkv.Version, error) {
+    if err := ts.check(); err != nil {
+        return 0, err
+    }
+    return ts.c.Set(ts.key + key, value)
+}
+
+func (ts *TempSpace) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    if err := ts.check(); err != nil {
+        return 0, err
+    }
+    return ts.c.Cas(ts.key + key, value, ver)
+}
+
+func (ts *TempSpace) Erase(key string, ver goffkv.Version) error {
+    if err := ts.check(); err != nil {
+        return err
+    }
+    return ts.c.Erase(ts.key + key, ver)
+}
+
+func (ts *TempSpace) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    if err := ts.check(); err != nil {
+        return 0, nil, err
+    }
+    return ts.c.Exists(ts.key + key, watch)
+}
+
+func (ts *TempSpace) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    if err := ts.check(); err != nil {
+        return 0, nil, nil, err
+    }
+    return ts.c.Get(ts.key + key, watch)
+}
+
+func (ts *TempSpace) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
+    if err := ts.check(); err != nil {
+        return nil, nil, err
+    }
+    children, resultWatch, err := ts.c.Children(ts.key + key, watch)
+    for i, child := range children {
+        children[i] = strings.TrimPrefix(child, ts.key)
+    }
+    return children, resultWatch, err
+}
+
+func (ts *TempSpace) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    if err := ts.check(); err != nil {
+        return nil, err
+    }
+    scoped := goffkv.Txn{
+        Checks: make([]goffkv.Check, len(txn.Checks)),
+        Ops: make([]goffkv.Operation, len(txn.Ops)),
+    }
+    for i, check := range txn.Checks {
+        check.Key = ts.key + check.Key
+        scoped.Checks[i] = check
+    }
+    for i, op := range txn.Ops {
+        op.Key = ts.key + op.Key
+        scoped.Ops[i] = op
+    }
+    return ts.c.Commit(scoped)
+}
+
+// Close erases the space with everything in it; the client stays open. Closing again is harmless.
+func (ts *TempSpace) Close() {
+    ts.mu.Lock()
+    defer ts.mu.Unlock()
+
+    if ts.closed {
+        return
+    }
+    ts.closed = true
+    close(ts.stop)
+
+    err := ts.c.Erase(ts.key, 0)
+    if err != nil && err != goffkv.OpErrNoEntry {
+        ts.c.logger.Printf("temp space %s: erasing: %v", ts.key, err)
+    }
+    if ts.marker != "" {
+        err = ts.c.conn.Delete(ts.marker, -1)
+        if err != nil && err != zkapi.ErrNoNode {
+            ts.c.logger.Printf("temp space %s: removing the owner marker: %v", ts.key, err)
+        }
+    }
+}
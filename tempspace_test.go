@@ -0,0 +1,100 @@
+package goffkv_zk
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestTempSpace(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/jobs", nil)
+    ts, err := c.TempSpace("/jobs", TempSpaceOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(ts.Key(), "/jobs/" + tempNamePrefix) {
+        t.Fatalf("space key %s", ts.Key())
+    }
+    if _, err := ts.Create("/a", []byte("v"), false); err != nil {
+        t.Fatal(err)
+    }
+    if data, _, _ := zk.Node("/test" + ts.Key() + "/a"); string(data) != "v" {
+        t.Errorf("value %q in the space", data)
+    }
+    if children, _, err := ts.Children("", false); err != nil || len(children) != 1 || children[0] != "/a" {
+        t.Errorf("children %v, %v, want relative keys", children, err)
+    }
+
+    ts.Close()
+    ts.Close()
+    if paths := zk.Paths("/test" + ts.Key()); len(paths) != 0 {
+        t.Errorf("left %v", paths)
+    }
+    if _, err := ts.Set("/a", nil); err != ErrTempSpaceClosed {
+        t.Errorf("Set after Close: %v, want ErrTempSpaceClosed", err)
+    }
+}
+
+func TestTempSpaceSessionBound(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/jobs", nil)
+    ts, err := c.TempSpace("/jobs", TempSpaceOptions{SessionBound: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ts.Create("/a", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    zk.Expire()
+    eventually(t, "the space to go with the session", func() bool {
+        return len(zk.Paths("/test" + ts.Key())) == 0
+    })
+}
+
+func TestCollectTempSpaces(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    // Left behind by a dead process, and too young to tell.
+    zk.Put("/test/jobs/tmp-0000000101", tempSessionTag)
+    zk.Put("/test/jobs/tmp-0000000101/a", nil)
+    zk.Put("/test/jobs/tmp-0000000102", tempSessionTag)
+    zk.mu.Lock()
+    zk.nodes["/test/jobs/tmp-0000000101"].stat.Ctime -= int64(defaultGCGrace / time.Millisecond)
+    zk.mu.Unlock()
+
+    live, err := c.TempSpace("/jobs", TempSpaceOptions{SessionBound: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer live.Close()
+    plain, err := c.TempSpace("/jobs", TempSpaceOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer plain.Close()
+
+    removed, err := c.CollectTempSpaces("/jobs")
+    if err != nil || removed != 1 {
+        t.Fatalf("CollectTempSpaces: %d, %v, want 1", removed, err)
+    }
+    if _, _, ok := zk.Node("/test/jobs/tmp-0000000101"); ok {
+        t.Error("dead space left")
+    }
+    for _, key := range []string{"/jobs/tmp-0000000102", live.Key(), plain.Key()} {
+        if _, _, ok := zk.Node("/test" + key); !ok {
+            t.Errorf("%s collected", key)
+        }
+    }
+}
@@ -0,0 +1,120 @@
+package goffkv_zk
+
+import (
+    "context"
+    "path"
+    "sync"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    ticketNodeName = "ticket-"
+)
+
+// An ephemeral sequential node, as taken by locks, elections and queues: the building block of
+// custom coordination protocols.
+type Ticket struct {
+    c *Client
+    parent string
+    path string
+    // Key of the node, and its name ("_c_<guid>-ticket-<seq>", see Mutex) under its parent.
+    Key string
+    Name string
+    // The sequence number assigned by the server, increasing with every child of the parent.
+    Seq int64
+
+    lost chan struct{}
+    stop chan struct{}
+    stopOnce sync.Once
+}
+
+// Ticket creates an ephemeral sequential child of parentKey (and parentKey if needed) holding
+// payload as it is. The node survives connection losses, unlike session expiries.
+func (c *Client) Ticket(parentKey string, payload []byte) (*Ticket, error) {
+    segments, err := c.disassembleKey(parentKey)
+    if err != nil {
+        return nil, err
+    }
+    err = c.checkWritable(segments)
+    if err != nil {
+        return nil, err
+    }
+
+    node, err := c.enqueue(segments, ticketNodeName, payload)
+    if err != nil {
+        return nil, convertError(err)
+    }
+
+    name := path.Base(node)
+    t := &Ticket{
+        c: c,
+        parent: parentKey,
+        path: node,
+        Key: c.keyOf(node),
+        Name: name,
+        Seq: sequenceOf(name),
+        lost: make(chan struct{}),
+        stop: make(chan struct{}),
+    }
+    go t.watch()
+    return t, nil
+}
+
+// Closes lost once the node is gone.
+func (t *Ticket) watch() {
+    defer close(t.lost)
+    expired, stopWatching := t.c.sessionExpiry()
+    defer stopWatching()
+
+    for {
+        exists, _, ech, err := t.c.conn.ExistsW(t.path)
+        var retry <-chan time.Time
+        switch {
+        case err == zkapi.ErrSessionExpired:
+            return
+        case err != nil:
+            retry = time.After(watchRetryDelay)
+        case !exists:
+            return
+        }
+
+        select {
+        case <-ech:
+        case <-retry:
+        case <-expired:
+            return
+        case <-t.stop:
+            return
+        case <-t.c.done:
+            return
+        }
+    }
+}
+
+// Lost returns a channel closed once the node is gone: released, deleted by another client, or
+// removed with the session (or the client closed).
+func (t *Ticket) Lost() <-chan struct{} {
+    return t.lost
+}
+
+// Siblings returns the keys of the children of the parent, the ticket included, by sequence.
+func (t *Ticket) Siblings() ([]string, error) {
+    children, _, err := t.c.ChildrenWith(t.parent, false, ChildrenOptions{Order: BySequence})
+    return children, err
+}
+
+// Release deletes the node, retried per the retry policy of the client. Releasing a lost ticket
+// isn't an error; if the delete fails, the ticket is still held and watched.
+func (t *Ticket) Release() error {
+    err := t.c.retry(context.Background(), true, func() error {
+        return t.c.conn.Delete(t.path, -1)
+    })
+    if err != nil && err != zkapi.ErrNoNode {
+        return t.c.wrapError("erase", t.Key, convertError(err))
+    }
+    t.stopOnce.Do(func() {
+        close(t.stop)
+    })
+    return nil
+}
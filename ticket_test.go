@@ -0,0 +1,79 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestTicket(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    a, err := c.Ticket("/tickets", []byte("a"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    b, err := c.Ticket("/tickets", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if b.Seq <= a.Seq {
+        t.Errorf("sequence numbers %d then %d", a.Seq, b.Seq)
+    }
+    siblings, err := a.Siblings()
+    if err != nil || len(siblings) != 2 || siblings[0] != a.Key || siblings[1] != b.Key {
+        t.Errorf("siblings %v, %v", siblings, err)
+    }
+
+    // Deleted by someone else.
+    if err := c.Erase(b.Key, 0); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-b.Lost():
+    case <-time.After(5 * time.Second):
+        t.Fatal("ticket not lost with its node")
+    }
+    if err := b.Release(); err != nil {
+        t.Errorf("Release of a lost ticket: %v", err)
+    }
+}
+
+// A failed Release leaves the ticket held and watched; it is retried per the retry policy.
+func TestTicketRelease(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond, Writes: true}))
+    defer c.Close()
+
+    ticket, err := c.Ticket("/tickets", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    zk.Fail(func(op int32, path string) error {
+        if op == fzDelete {
+            return zkapi.ErrSessionMoved
+        }
+        return nil
+    })
+    if err := ticket.Release(); !errors.Is(err, zkapi.ErrSessionMoved) {
+        t.Fatalf("failed Release: %v", err)
+    }
+    if deletes := zk.Requests(fzDelete); deletes != 2 {
+        t.Errorf("%d deletes, want one retry", deletes)
+    }
+
+    zk.Fail(nil)
+    if err := c.Erase(ticket.Key, 0); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-ticket.Lost():
+    case <-time.After(5 * time.Second):
+        t.Fatal("ticket no longer watched after a failed Release")
+    }
+}
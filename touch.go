@@ -0,0 +1,25 @@
+package goffkv_zk
+
+import (
+    "context"
+    goffkv "github.com/offscale/goffkv"
+)
+
+// Touch bumps the version of an existing entry without changing its value, so that watchers
+// of the key get notified. Returns the new version.
+func (c *Client) Touch(key string) (goffkv.Version, error) {
+    var result goffkv.Version
+    err := c.resolveConflicts(context.Background(), func() (bool, error) {
+        ver, value, _, err := c.Get(key, false)
+        if err != nil {
+            return false, err
+        }
+
+        result, err = c.Cas(key, value, ver)
+        return err == nil && result == 0, err
+    })
+    if err != nil {
+        return 0, err
+    }
+    return result, nil
+}
@@ -0,0 +1,44 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+)
+
+func TestTouch(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    ver, err := c.Set("/k", []byte("v"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, _, watch, err := c.Get("/k", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    touched, err := c.Touch("/k")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if touched == ver {
+        t.Errorf("version %v unchanged by Touch", ver)
+    }
+    if data, _, _ := zk.Node("/test/k"); string(data) != "v" {
+        t.Errorf("value %q after Touch", data)
+    }
+    if !fired(watch, time.Second) {
+        t.Error("watch not fired by Touch")
+    }
+
+    if _, err := c.Touch("/missing"); err != goffkv.OpErrNoEntry {
+        t.Errorf("Touch of a missing key: %v, want OpErrNoEntry", err)
+    }
+    if _, _, ok := zk.Node("/test/missing"); ok {
+        t.Error("Touch created a missing key")
+    }
+}
@@ -0,0 +1,105 @@
+package goffkv_zk
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// TreeVersion returns a number that grows whenever anything under key (including key itself)
+// is created, changed or erased: the largest zxid of the last modification of a node's data
+// or children list across the subtree. ZooKeeper keeps no such number, so this reads every node
+// of the subtree; to check a subtree repeatedly, see TreeCache.Version.
+func (c *Client) TreeVersion(key string) (result int64, err error) {
+    err = c.runOp("tree", key, false, func() error {
+        segments, err := c.disassembleKey(key)
+        if err != nil {
+            return err
+        }
+
+        result, err = c.treeVersion(c.assemblePath(segments))
+        if err != nil {
+            return convertError(err)
+        }
+        return nil
+    })
+    return
+}
+
+func (c *Client) treeVersion(path string) (int64, error) {
+    children, stat, err := c.conn.Children(path)
+    if err != nil {
+        return 0, err
+    }
+
+    result := stat.Mzxid
+    if stat.Pzxid > result {
+        result = stat.Pzxid
+    }
+    for _, child := range children {
+        childResult, err := c.treeVersion(path + "/" + child)
+        if err != nil {
+            if err == zkapi.ErrNoNode {
+                // Erased concurrently; the parent's pzxid reflects that.
+                continue
+            }
+            return 0, err
+        }
+        if childResult > result {
+            result = childResult
+        }
+    }
+    return result, nil
+}
+
+// CountChildren returns the number of children of key without fetching their names, or, if
+// recursive, the number of all its descendants. The driver doesn't support getAllChildrenNumber
+// of ZooKeeper 3.6, so the recursive count walks the subtree.
+func (c *Client) CountChildren(key string, recursive bool) (result int, err error) {
+    err = c.runOp("count", key, false, func() (err error) {
+        result, err = c.countChildren(key, recursive)
+        return err
+    })
+    return
+}
+
+func (c *Client) countChildren(key string, recursive bool) (int, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+
+    path := c.assemblePath(segments)
+    if !recursive {
+        exists, stat, err := c.conn.Exists(path)
+        if err != nil {
+            return 0, convertError(err)
+        }
+        if !exists {
+            return 0, goffkv.OpErrNoEntry
+        }
+        return int(stat.NumChildren), nil
+    }
+
+    result, err := c.countDescendants(path)
+    if err != nil {
+        return 0, convertError(err)
+    }
+    return result, nil
+}
+
+func (c *Client) countDescendants(path string) (int, error) {
+    children, _, err := c.conn.Children(path)
+    if err != nil {
+        return 0, err
+    }
+
+    result := len(children)
+    for _, child := range children {
+        childResult, err := c.countDescendants(path + "/" + child)
+        if err != nil && err != zkapi.ErrNoNode {
+            return 0, err
+        }
+        result += childResult
+    }
+    return result, nil
+}
@@ -0,0 +1,135 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+func TestTreeVersion(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/tree/a/b", nil)
+    before, err := c.TreeVersion("/tree")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Set("/tree/a/b", []byte("v")); err != nil {
+        t.Fatal(err)
+    }
+    after, err := c.TreeVersion("/tree")
+    if err != nil || after <= before {
+        t.Fatalf("TreeVersion after a change deep down: %v (was %v), %v", after, before, err)
+    }
+    if again, _ := c.TreeVersion("/tree"); again != after {
+        t.Errorf("TreeVersion without changes: %v, then %v", after, again)
+    }
+}
+
+func TestTreeCacheVersion(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/tree/a", nil)
+    tc, err := c.TreeCache("/tree", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer tc.Stop()
+    <-tc.Ready()
+    loaded := tc.Version()
+    if loaded != 2 {
+        t.Fatalf("Version %d after loading two keys", loaded)
+    }
+    if _, value, ok := tc.Get("/tree/a"); !ok || value == nil {
+        t.Errorf("cached empty key: %v, %v", value, ok)
+    }
+
+    reads := zk.Requests(fzGetData)
+    for i := 0; i < 3; i++ {
+        if tc.Version() != loaded {
+            t.Fatal("Version changed without changes")
+        }
+    }
+    if zk.Requests(fzGetData) != reads {
+        t.Error("Version reads the ensemble")
+    }
+
+    if _, err := c.Create("/tree/a/b", nil, false); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "the new key", func() bool {
+        return tc.Version() > loaded
+    })
+    changed := tc.Version()
+    if err := c.Erase("/tree/a", 0); err != nil {
+        t.Fatal(err)
+    }
+    eventually(t, "the erase", func() bool {
+        return tc.Version() > changed
+    })
+}
+
+func TestTreeCache(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    events := make(chan TreeEvent, 16)
+    tc, err := c.TreeCache("/tree", func(e TreeEvent) {
+        events <- e
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer tc.Stop()
+    <-tc.Ready()
+    if _, _, ok := tc.Get("/tree"); ok {
+        t.Fatal("missing root cached")
+    }
+
+    next := func(want TreeEventType, key string, value string) {
+        t.Helper()
+        select {
+        case e := <-events:
+            if e.Type != want || e.Key != key || string(e.Value) != value {
+                t.Fatalf("event %+v, want %v of %s with %q", e, want, key, value)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("no event for %s", key)
+        }
+    }
+    if _, err := c.Create("/tree", []byte("r"), false); err != nil {
+        t.Fatal(err)
+    }
+    next(TreeNodeAdded, "/tree", "r")
+    if _, err := c.Create("/tree/a", []byte("1"), false); err != nil {
+        t.Fatal(err)
+    }
+    next(TreeNodeAdded, "/tree/a", "1")
+    if _, err := c.Set("/tree/a", []byte("2")); err != nil {
+        t.Fatal(err)
+    }
+    next(TreeNodeUpdated, "/tree/a", "2")
+
+    ver, value, ok := tc.Get("/tree/a")
+    if current, _, _, _ := c.Get("/tree/a", false); !ok || string(value) != "2" || ver != current {
+        t.Errorf("cached %v %q %v, want version %v", ver, value, ok, current)
+    }
+    if children, ok := tc.Children("/tree"); !ok || len(children) != 1 || children[0] != "/tree/a" {
+        t.Errorf("cached children %v", children)
+    }
+
+    if err := c.Erase("/tree/a", 0); err != nil {
+        t.Fatal(err)
+    }
+    next(TreeNodeRemoved, "/tree/a", "2")
+    if _, _, ok := tc.Get("/tree/a"); ok {
+        t.Error("erased key still cached")
+    }
+}
@@ -0,0 +1,297 @@
+package goffkv_zk
+
+import (
+    "sort"
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+type TreeEventType int
+
+const (
+    TreeNodeAdded TreeEventType = iota + 1
+    TreeNodeUpdated
+    TreeNodeRemoved
+)
+
+// A change of a key cached by a TreeCache. Value is the new value (the last one for removals).
+type TreeEvent struct {
+    Type TreeEventType
+    Key string
+    Ver goffkv.Version
+    Value []byte
+}
+
+type cachedNode struct {
+    ver goffkv.Version
+    value []byte
+    children map[string]bool
+}
+
+// What has to be read again for a path, after its watch has fired (or initially).
+type treeRefresh struct {
+    data bool
+    children bool
+}
+
+// In-memory copy of a subtree, kept up to date by watches, like Curator's TreeCache. Reads are
+// served from memory: they may lag behind the ensemble, but never go backwards.
+type TreeCache struct {
+    *gate
+    c *Client
+    rootPath string
+    onChange func(TreeEvent)
+    // Poked whenever a watch fires.
+    changed chan struct{}
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.Mutex
+    nodes map[string]*cachedNode
+    dirty map[string]treeRefresh
+    // Number of changes applied, see Version.
+    version uint64
+}
+
+// TreeCache loads the subtree at key (which may not exist yet) and keeps it in sync; onChange,
+// if not nil, is called from the goroutine of the cache for every change, starting with the
+// initial load. Ready is closed once the initial load is done.
+func (c *Client) TreeCache(key string, onChange func(TreeEvent)) (*TreeCache, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    tc := &TreeCache{
+        gate: newGate(),
+        c: c,
+        rootPath: c.assemblePath(segments),
+        onChange: onChange,
+        changed: make(chan struct{}, 1),
+        stop: make(chan struct{}),
+        nodes: make(map[string]*cachedNode),
+        dirty: make(map[string]treeRefresh),
+    }
+    tc.dirty[tc.rootPath] = treeRefresh{data: true, children: true}
+    go tc.loop()
+    return tc, nil
+}
+
+func (tc *TreeCache) poke() {
+    select {
+    case tc.changed <- struct{}{}:
+    default:
+    }
+}
+
+// Marks path dirty once ech fires.
+func (tc *TreeCache) forward(ech <-chan zkapi.Event, path string, refresh treeRefresh) {
+    select {
+    case <-ech:
+    case <-tc.stop:
+        return
+    }
+
+    tc.mu.Lock()
+    current := tc.dirty[path]
+    current.data = current.data || refresh.data
+    current.children = current.children || refresh.children
+    tc.dirty[path] = current
+    tc.mu.Unlock()
+    tc.poke()
+}
+
+// Drops path and its descendants.
+func (tc *TreeCache) remove(path string, events []TreeEvent) []TreeEvent {
+    node, ok := tc.nodes[path]
+    if !ok {
+        return events
+    }
+    for child := range node.children {
+        events = tc.remove(path + "/" + child, events)
+    }
+    delete(tc.nodes, path)
+    return append(events, TreeEvent{TreeNodeRemoved, tc.c.keyOf(path), node.ver, node.value})
+}
+
+// Reads path again as needed; called with mu held.
+func (tc *TreeCache) refresh(path string, refresh treeRefresh, events []TreeEvent) ([]TreeEvent, error) {
+    if refresh.data {
+        value, stat, ech, err := tc.c.getW(path)
+        if err == zkapi.ErrNoNode {
+            events = tc.remove(path, events)
+            if path == tc.rootPath {
+                // Wait for the root to be created.
+                exists, _, ech, err := tc.c.conn.ExistsW(path)
+                if err != nil {
+                    return events, err
+                }
+                if exists {
+                    tc.dirty[path] = treeRefresh{data: true, children: true}
+                } else {
+                    go tc.forward(ech, path, treeRefresh{data: true, children: true})
+                }
+            }
+            return events, nil
+        }
+        if err != nil {
+            return events, err
+        }
+        go tc.forward(ech, path, treeRefresh{data: true})
+
+        node, ok := tc.nodes[path]
+        ver := VersionOf(stat)
+        switch {
+        case !ok:
+            node = &cachedNode{ver: ver, value: value, children: make(map[string]bool)}
+            tc.nodes[path] = node
+            events = append(events, TreeEvent{TreeNodeAdded, tc.c.keyOf(path), ver, value})
+        case ver != node.ver:
+            node.ver, node.value = ver, value
+            events = append(events, TreeEvent{TreeNodeUpdated, tc.c.keyOf(path), ver, value})
+        }
+    }
+
+    node, ok := tc.nodes[path]
+    if !refresh.children || !ok {
+        return events, nil
+    }
+    names, _, ech, err := tc.c.conn.ChildrenW(path)
+    if err == zkapi.ErrNoNode {
+        // Its data watch will tell.
+        return events, nil
+    }
+    if err != nil {
+        return events, err
+    }
+    go tc.forward(ech, path, treeRefresh{children: true})
+
+    present := make(map[string]bool, len(names))
+    for _, name := range names {
+        if path == tc.c.assemblePath(nil) && name == reservedSegment {
+            // Service nodes of the client.
+            continue
+        }
+        present[name] = true
+        if !node.children[name] {
+            node.children[name] = true
+            tc.dirty[path + "/" + name] = treeRefresh{data: true, children: true}
+        }
+    }
+    for name := range node.children {
+        if !present[name] {
+            delete(node.children, name)
+            events = tc.remove(path + "/" + name, events)
+        }
+    }
+    return events, nil
+}
+
+func (tc *TreeCache) loop() {
+    for {
+        var (
+            events []TreeEvent
+            err error
+        )
+        tc.mu.Lock()
+        // Parents are refreshed before their new children, which are added as they are found.
+        for len(tc.dirty) != 0 && err == nil {
+            paths := make([]string, 0, len(tc.dirty))
+            for path := range tc.dirty {
+                paths = append(paths, path)
+            }
+            sort.Strings(paths)
+
+            for _, path := range paths {
+                refresh := tc.dirty[path]
+                delete(tc.dirty, path)
+                events, err = tc.refresh(path, refresh, events)
+                if err != nil {
+                    // Retried later.
+                    tc.dirty[path] = refresh
+                    break
+                }
+            }
+        }
+        tc.version += uint64(len(events))
+        tc.mu.Unlock()
+
+        if tc.onChange != nil {
+            for _, event := range events {
+                tc.onChange(event)
+            }
+        }
+        if err == nil {
+            tc.markReady()
+        } else {
+            tc.c.logger.Printf("tree cache %s: %v", tc.c.keyOf(tc.rootPath), err)
+            time.AfterFunc(watchRetryDelay, tc.poke)
+        }
+
+        select {
+        case <-tc.changed:
+        case <-tc.stop:
+            return
+        case <-tc.c.done:
+            tc.fail(ErrClientClosed)
+            return
+        }
+    }
+}
+
+// Get returns the cached version and value of key; ok is false if key isn't in the cache.
+func (tc *TreeCache) Get(key string) (ver goffkv.Version, value []byte, ok bool) {
+    segments, err := tc.c.disassembleKey(key)
+    if err != nil {
+        return 0, nil, false
+    }
+
+    tc.mu.Lock()
+    defer tc.mu.Unlock()
+
+    node, ok := tc.nodes[tc.c.assemblePath(segments)]
+    if !ok {
+        return 0, nil, false
+    }
+    return node.ver, append([]byte{}, node.value...), true
+}
+
+// Children returns the cached children of key, sorted, as Client.Children would.
+func (tc *TreeCache) Children(key string) ([]string, bool) {
+    segments, err := tc.c.disassembleKey(key)
+    if err != nil {
+        return nil, false
+    }
+
+    tc.mu.Lock()
+    defer tc.mu.Unlock()
+
+    node, ok := tc.nodes[tc.c.assemblePath(segments)]
+    if !ok {
+        return nil, false
+    }
+    result := make([]string, 0, len(node.children))
+    for name := range node.children {
+        result = append(result, key + "/" + name)
+    }
+    sort.Strings(result)
+    return result, true
+}
+
+// Version returns the number of changes (see TreeEvent) applied to the cache so far: it is
+// maintained as watches fire, so comparing it with a previous result tells whether anything
+// under the key has changed without reading the subtree again, unlike Client.TreeVersion.
+func (tc *TreeCache) Version() uint64 {
+    tc.mu.Lock()
+    defer tc.mu.Unlock()
+
+    return tc.version
+}
+
+func (tc *TreeCache) Stop() {
+    tc.stopOnce.Do(func() {
+        close(tc.stop)
+    })
+}
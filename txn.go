@@ -0,0 +1,182 @@
+package goffkv_zk
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "sync"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+var (
+    ErrTxnTooLarge = errors.New("transaction exceeds the request size limit: erase big subtrees " +
+        "beforehand (see EraseTreeWith), split the transaction, or see WithTxnSplitting")
+    // The driver can't put the creation of a TTL node in a Multi.
+    ErrTTLLeaseInTxn = errors.New("transactions can't create TTL-backed leases (see WithTTLLeases)")
+)
+
+// Outcome of a single op of CommitDetailed.
+type OpResult struct {
+    What goffkv.Action
+    // The new version of a created or set key.
+    Ver goffkv.Version
+    // The number of nodes removed by an erase: the key and its descendants.
+    Erased int
+}
+
+// Outcome of a single transaction of CommitMany.
+type CommitResult struct {
+    Results []goffkv.TxnOpResult
+    Err error
+}
+
+// Orders commits touching related keys (the same key, or a key and one of its descendants) by
+// submission, while unrelated commits run concurrently.
+type commitScheduler struct {
+    mu sync.Mutex
+    inflight map[*commitTicket]struct{}
+}
+
+type commitTicket struct {
+    keys []string
+    done chan struct{}
+    waits []chan struct{}
+}
+
+// WithOrderedCommits guarantees that commits touching related keys (the same key, or a key and
+// one of its descendants) are applied in the order they were submitted, even when issued from
+// different goroutines or by CommitMany; commits on unrelated keys are still pipelined.
+func WithOrderedCommits() Option {
+    return func(c *Client) {
+        c.commits = &commitScheduler{
+            inflight: make(map[*commitTicket]struct{}),
+        }
+    }
+}
+
+func keysRelated(a string, b string) bool {
+    return a == b || strings.HasPrefix(a, b + "/") || strings.HasPrefix(b, a + "/")
+}
+
+// Registers txn; the returned ticket waits for the related commits registered before it.
+// Returns nil (a ticket that never waits) if commits aren't ordered.
+func (s *commitScheduler) enter(txn goffkv.Txn) *commitTicket {
+    if s == nil {
+        return nil
+    }
+
+    t := &commitTicket{
+        done: make(chan struct{}),
+    }
+    for _, check := range txn.Checks {
+        t.keys = append(t.keys, check.Key)
+    }
+    for _, op := range txn.Ops {
+        t.keys = append(t.keys, op.Key)
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for other := range s.inflight {
+    related:
+        for _, key := range t.keys {
+            for _, otherKey := range other.keys {
+                if keysRelated(key, otherKey) {
+                    t.waits = append(t.waits, other.done)
+                    break related
+                }
+            }
+        }
+    }
+    s.inflight[t] = struct{}{}
+    return t
+}
+
+func (t *commitTicket) wait() {
+    if t == nil {
+        return
+    }
+    for _, ch := range t.waits {
+        <-ch
+    }
+}
+
+func (s *commitScheduler) leave(t *commitTicket) {
+    if t == nil {
+        return
+    }
+
+    s.mu.Lock()
+    delete(s.inflight, t)
+    s.mu.Unlock()
+    close(t.done)
+}
+
+// CommitMany commits independent transactions concurrently: their requests are pipelined on the
+// connection instead of waiting for each other. The results are positional. No ordering between
+// the transactions is guaranteed, unless the client has been created WithOrderedCommits.
+func (c *Client) CommitMany(txns []goffkv.Txn) []CommitResult {
+    result := make([]CommitResult, len(txns))
+
+    var wg sync.WaitGroup
+    for i, txn := range txns {
+        t := c.commits.enter(txn)
+        wg.Add(1)
+        go func(i int, txn goffkv.Txn) {
+            defer wg.Done()
+            result[i].Results, result[i].Err = txnResults(c.commitTicketed(context.Background(), txn, t))
+        }(i, txn)
+    }
+    wg.Wait()
+    return result
+}
+
+// WithTxnSplitting lets Commit handle transactions too large for a single request because of the
+// erase of big subtrees: the descendants of the erased keys are deleted beforehand, by as many
+// Multis as needed, each guarded by the checks of the transaction. The user-visible ops (and the
+// erased keys themselves) stay atomic, but the descendants may be gone even if the transaction
+// then fails. Without it, such transactions fail with ErrTxnTooLarge. Either way, a commit whose
+// erased subtrees keep changing gives up with ErrEraseContended.
+func WithTxnSplitting() Option {
+    return func(c *Client) {
+        c.splitTxns = true
+    }
+}
+
+// Deletes (children first) by Multis prefixed with checks, as many as the size limit requires.
+// Deletes of nodes gone or changed meanwhile only make the caller start over; a failed check
+// fails the transaction.
+func (c *Client) eraseAhead(deletes []interface{}, checks []interface{}) error {
+    for len(deletes) != 0 {
+        ops := append([]interface{}{}, checks...)
+        size := multiSize(checks)
+        n := 0
+        for n < len(deletes) {
+            opSize := multiSize(deletes[n:n + 1])
+            if n != 0 && size + opSize > maxMultiBytes {
+                break
+            }
+            size += opSize
+            ops = append(ops, deletes[n])
+            n++
+        }
+
+        data, err := c.conn.Multi(ops...)
+        if err != nil {
+            for i, datum := range data {
+                if i < len(checks) && datum.Error != nil {
+                    return goffkv.TxnError{OpIndex: i}
+                }
+            }
+            if err == zkapi.ErrNoNode || err == zkapi.ErrNotEmpty {
+                c.logger.Printf("commit: subtree of an erased key changed, retrying")
+                return nil
+            }
+            return convertError(err)
+        }
+        deletes = deletes[n:]
+    }
+    return nil
+}
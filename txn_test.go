@@ -0,0 +1,98 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// A commit erasing a subtree that keeps growing gives up instead of restarting forever.
+func TestCommitEraseContended(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    zk.Put("/test/tree/c", nil)
+    n := 0
+    zk.Fail(func(op int32, path string) error {
+        if op == fzMulti && path == "/test/tree/c" {
+            n++
+            zk.PutLocked(fmt.Sprintf("/test/tree/c/%d", n), nil)
+        }
+        return nil
+    })
+    _, err := c.Commit(goffkv.Txn{Ops: []goffkv.Operation{{Key: "/tree", What: goffkv.Erase}}})
+    if !errors.Is(err, ErrEraseContended) {
+        t.Fatalf("Commit erasing a growing subtree: %v, want ErrEraseContended", err)
+    }
+    if multis := zk.Requests(fzMulti); multis != maxEraseRestarts {
+        t.Errorf("%d attempts, want %d", multis, maxEraseRestarts)
+    }
+
+    zk.Fail(nil)
+    if _, err := c.Commit(goffkv.Txn{Ops: []goffkv.Operation{{Key: "/tree", What: goffkv.Erase}}}); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, ok := zk.Node("/test/tree"); ok {
+        t.Error("subtree left after the commit")
+    }
+}
+
+// Batched writes go through the retry policy and are observed.
+func TestWriteBatchRetried(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    var (
+        mu sync.Mutex
+        batches []error
+    )
+    c := newTestClient(t, zk,
+        WithWriteBatching(20 * time.Millisecond, 10),
+        WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Writes: true}),
+        WithInstrumentation(InstrumentationFunc(func(op string, latency time.Duration, err error) {
+            if op == "batch" {
+                mu.Lock()
+                batches = append(batches, err)
+                mu.Unlock()
+            }
+        })))
+    defer c.Close()
+
+    failed := false
+    zk.Fail(func(op int32, path string) error {
+        if op == fzMulti && !failed {
+            failed = true
+            return zkapi.ErrSessionMoved
+        }
+        return nil
+    })
+
+    var wg sync.WaitGroup
+    errs := make([]error, 3)
+    for i := range errs {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            _, errs[i] = c.Create(fmt.Sprintf("/k%d", i), nil, false)
+        }(i)
+    }
+    wg.Wait()
+    for _, err := range errs {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    if multis := zk.Requests(fzMulti); multis != 2 {
+        t.Errorf("%d Multis, want the batch and its retry", multis)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if len(batches) != 1 || batches[0] != nil {
+        t.Errorf("batches observed: %v, want one success", batches)
+    }
+}
@@ -0,0 +1,197 @@
+package goffkv_zk
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    goffkv "github.com/offscale/goffkv"
+)
+
+var (
+    // Starts a typed value; followed by its content type and a zero byte.
+    typedMagic = []byte("\x00goffkv-type\x00")
+
+    ErrContentType = errors.New("content type mismatch")
+
+    // Values as JSON (application/json).
+    JSONValues ValueCodec = jsonValueCodec{}
+    // Values as they are (application/octet-stream): marshals []byte, unmarshals into *[]byte.
+    RawValues ValueCodec = rawValueCodec{}
+)
+
+// Serializes the values of SetValue and GetValue. ContentType is stored with every value, and
+// checked before overwriting or decoding it.
+type ValueCodec interface {
+    ContentType() string
+    Marshal(v interface{}) ([]byte, error)
+    Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonValueCodec struct{}
+
+func (jsonValueCodec) ContentType() string {
+    return "application/json"
+}
+
+func (jsonValueCodec) Marshal(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (jsonValueCodec) Unmarshal(data []byte, v interface{}) error {
+    return json.Unmarshal(data, v)
+}
+
+type rawValueCodec struct{}
+
+func (rawValueCodec) ContentType() string {
+    return "application/octet-stream"
+}
+
+func (rawValueCodec) Marshal(v interface{}) ([]byte, error) {
+    data, ok := v.([]byte)
+    if !ok {
+        return nil, fmt.Errorf("raw value of type %T, not []byte", v)
+    }
+    return data, nil
+}
+
+func (rawValueCodec) Unmarshal(data []byte, v interface{}) error {
+    p, ok := v.(*[]byte)
+    if !ok {
+        return fmt.Errorf("raw value into %T, not *[]byte", v)
+    }
+    *p = append((*p)[:0], data...)
+    return nil
+}
+
+type funcValueCodec struct {
+    contentType string
+    marshal func(v interface{}) ([]byte, error)
+    unmarshal func(data []byte, v interface{}) error
+}
+
+// NewValueCodec makes a codec of the given content type out of functions, e.g. for protobuf:
+//  NewValueCodec("application/x-protobuf",
+//      func(v interface{}) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+//      func(data []byte, v interface{}) error { return proto.Unmarshal(data, v.(proto.Message)) })
+func NewValueCodec(contentType string, marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) ValueCodec {
+    return funcValueCodec{contentType, marshal, unmarshal}
+}
+
+func (f funcValueCodec) ContentType() string {
+    return f.contentType
+}
+
+func (f funcValueCodec) Marshal(v interface{}) ([]byte, error) {
+    return f.marshal(v)
+}
+
+func (f funcValueCodec) Unmarshal(data []byte, v interface{}) error {
+    return f.unmarshal(data, v)
+}
+
+// WithValueCodec sets the codec of SetValue and GetValue (JSONValues by default).
+func WithValueCodec(codec ValueCodec) Option {
+    return func(c *Client) {
+        c.valueCodec = codec
+    }
+}
+
+// ContentTypeOf returns the content type of a value written by SetValue, "" for other values.
+func ContentTypeOf(value []byte) string {
+    contentType, _ := splitTyped(value)
+    return contentType
+}
+
+// Returns the content type and the payload of value, or "" and value if it isn't typed.
+func splitTyped(value []byte) (string, []byte) {
+    if !bytes.HasPrefix(value, typedMagic) {
+        return "", value
+    }
+    rest := value[len(typedMagic):]
+    i := bytes.IndexByte(rest, 0)
+    if i < 0 {
+        return "", value
+    }
+    return string(rest[:i]), rest[i + 1:]
+}
+
+// MarshalValue returns v encoded with codec, behind a header naming its content type, as
+// SetValue stores it (e.g. for Commit).
+func MarshalValue(codec ValueCodec, v interface{}) ([]byte, error) {
+    payload, err := codec.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+
+    var result bytes.Buffer
+    result.Write(typedMagic)
+    result.WriteString(codec.ContentType())
+    result.WriteByte(0)
+    result.Write(payload)
+    return result.Bytes(), nil
+}
+
+// UnmarshalValue decodes a value written by SetValue into v, failing with ErrContentType if it
+// was written with another content type. Untyped values (written by Set...) are decoded as they
+// are.
+func UnmarshalValue(codec ValueCodec, value []byte, v interface{}) error {
+    contentType, payload := splitTyped(value)
+    if contentType != "" && contentType != codec.ContentType() {
+        return fmt.Errorf("%w: %s, expected %s", ErrContentType, contentType, codec.ContentType())
+    }
+    return codec.Unmarshal(payload, v)
+}
+
+func (c *Client) codecOr(codec ValueCodec) ValueCodec {
+    switch {
+    case codec != nil:
+        return codec
+    case c.valueCodec != nil:
+        return c.valueCodec
+    default:
+        return JSONValues
+    }
+}
+
+// SetValue stores v, encoded with the codec of the client, at key (created if needed). Fails
+// with ErrContentType, leaving it untouched, if key holds a value of another content type.
+func (c *Client) SetValue(key string, v interface{}) (goffkv.Version, error) {
+    return c.SetValueAs(key, v, nil)
+}
+
+// SetValueAs works like SetValue, with codec instead of the one of the client (unless nil).
+func (c *Client) SetValueAs(key string, v interface{}, codec ValueCodec) (goffkv.Version, error) {
+    codec = c.codecOr(codec)
+    data, err := MarshalValue(codec, v)
+    if err != nil {
+        return 0, err
+    }
+    return c.Update(context.Background(), key, func(value []byte, exists bool) ([]byte, error) {
+        if contentType := ContentTypeOf(value); contentType != "" && contentType != codec.ContentType() {
+            return nil, KeyError{key, fmt.Errorf("%w: %s, expected %s", ErrContentType, contentType, codec.ContentType())}
+        }
+        return data, nil
+    })
+}
+
+// GetValue decodes the value of key into v with the codec of the client (see UnmarshalValue),
+// and returns its version.
+func (c *Client) GetValue(key string, v interface{}) (goffkv.Version, error) {
+    return c.GetValueAs(key, v, nil)
+}
+
+// GetValueAs works like GetValue, with codec instead of the one of the client (unless nil).
+func (c *Client) GetValueAs(key string, v interface{}, codec ValueCodec) (goffkv.Version, error) {
+    ver, value, _, err := c.Get(key, false)
+    if err != nil {
+        return 0, err
+    }
+    err = UnmarshalValue(c.codecOr(codec), value, v)
+    if err != nil {
+        return 0, KeyError{key, err}
+    }
+    return ver, nil
+}
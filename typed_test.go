@@ -0,0 +1,49 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "testing"
+)
+
+type testConfig struct {
+    Name string `json:"name"`
+    Limit int `json:"limit"`
+}
+
+func TestTypedValues(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    want := testConfig{"a", 10}
+    if _, err := c.SetValue("/config", want); err != nil {
+        t.Fatal(err)
+    }
+    stored, _, _ := zk.Node("/test/config")
+    if ContentTypeOf(stored) != JSONValues.ContentType() {
+        t.Errorf("stored %q without the JSON content type", stored)
+    }
+    var got testConfig
+    if _, err := c.GetValue("/config", &got); err != nil || got != want {
+        t.Fatalf("GetValue: %+v, %v", got, err)
+    }
+
+    // Another content type is refused both ways, and the value kept.
+    if _, err := c.SetValueAs("/config", []byte("raw"), RawValues); !errors.Is(err, ErrContentType) {
+        t.Errorf("SetValueAs over JSON: %v, want ErrContentType", err)
+    }
+    if data, _, _ := zk.Node("/test/config"); string(data) != string(stored) {
+        t.Errorf("value replaced by %q", data)
+    }
+    var raw []byte
+    if _, err := c.GetValueAs("/config", &raw, RawValues); !errors.Is(err, ErrContentType) {
+        t.Errorf("GetValueAs of JSON: %v, want ErrContentType", err)
+    }
+
+    // Untyped values are decoded as they are.
+    zk.Put("/test/plain", []byte(`{"name": "b"}`))
+    if _, err := c.GetValue("/plain", &got); err != nil || got.Name != "b" {
+        t.Errorf("GetValue of an untyped value: %+v, %v", got, err)
+    }
+}
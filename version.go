@@ -0,0 +1,87 @@
+package goffkv_zk
+
+import (
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+// Converts versions of this backend (zk version + 1, 0 for missing keys) to the representation
+// of another system and back, so that versions held by applications keep working for Cas after
+// the data has been moved. Used by Export and Import.
+type VersionTranslator interface {
+    Export(ver goffkv.Version) uint64
+    Import(ver uint64) goffkv.Version
+}
+
+// A VersionTranslator made of two functions.
+type VersionFuncs struct {
+    ExportFunc func(goffkv.Version) uint64
+    ImportFunc func(uint64) goffkv.Version
+}
+
+func (f VersionFuncs) Export(ver goffkv.Version) uint64 {
+    return f.ExportFunc(ver)
+}
+
+func (f VersionFuncs) Import(ver uint64) goffkv.Version {
+    return f.ImportFunc(ver)
+}
+
+var (
+    // Keeps goffkv versions as they are; the default.
+    GoffkvVersions VersionTranslator = VersionFuncs{
+        ExportFunc: func(ver goffkv.Version) uint64 { return ver },
+        ImportFunc: func(ver uint64) goffkv.Version { return ver },
+    }
+    // Uses the raw zk dataVersion, as seen by zkCli or Curator; only for existing keys.
+    ZKVersions VersionTranslator = VersionFuncs{
+        ExportFunc: func(ver goffkv.Version) uint64 { return uint64(ToZKVersion(ver)) },
+        ImportFunc: func(ver uint64) goffkv.Version { return FromZKVersion(int32(ver)) },
+    }
+)
+
+// WithVersionTranslator sets how versions are represented outside of the client.
+func WithVersionTranslator(t VersionTranslator) Option {
+    return func(c *Client) {
+        c.versions = t
+    }
+}
+
+// ExportVersion converts a version of this client to its external representation.
+func (c *Client) ExportVersion(ver goffkv.Version) uint64 {
+    return c.versions.Export(ver)
+}
+
+// ImportVersion converts an external version back; see ExportVersion.
+func (c *Client) ImportVersion(ver uint64) goffkv.Version {
+    return c.versions.Import(ver)
+}
+
+// The version of a missing key: Cas with it creates the key, Erase with it ignores versions.
+const ZeroVersion goffkv.Version = 0
+
+// FromZKVersion converts the dataVersion of a zk node (0 once created) to the goffkv version
+// of its key, which is one more, so that existing keys never have ZeroVersion.
+func FromZKVersion(version int32) goffkv.Version {
+    return uint64(version) + 1
+}
+
+// ToZKVersion converts a goffkv version to a zk dataVersion; ZeroVersion becomes -1, which zk
+// takes as "any version".
+func ToZKVersion(ver goffkv.Version) int32 {
+    return int32(ver - 1)
+}
+
+// VersionOf returns the goffkv version of the node described by stat; ZeroVersion if nil.
+func VersionOf(stat *zkapi.Stat) goffkv.Version {
+    if stat == nil {
+        return ZeroVersion
+    }
+    return FromZKVersion(stat.Version)
+}
+
+// IsConflict tells whether the result of Cas means that the key has been modified (or created)
+// by someone else since ver was read: Cas reports that with ZeroVersion rather than an error.
+func IsConflict(ver goffkv.Version, err error) bool {
+    return err == nil && ver == ZeroVersion
+}
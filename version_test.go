@@ -0,0 +1,51 @@
+package goffkv_zk
+
+import (
+    "testing"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestZKVersions(t *testing.T) {
+    if FromZKVersion(0) != 1 || ToZKVersion(1) != 0 || ToZKVersion(ZeroVersion) != -1 {
+        t.Error("zk versions off by other than one")
+    }
+    if VersionOf(nil) != ZeroVersion || VersionOf(&zkapi.Stat{Version: 4}) != 5 {
+        t.Error("VersionOf")
+    }
+    if !IsConflict(ZeroVersion, nil) || IsConflict(3, nil) || IsConflict(ZeroVersion, zkapi.ErrNoNode) {
+        t.Error("IsConflict")
+    }
+}
+
+func TestVersionTranslator(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithVersionTranslator(ZKVersions))
+    defer c.Close()
+
+    c.Set("/k", []byte("a"))
+    ver, err := c.Set("/k", []byte("b"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    snapshot, err := c.Export("/k", ExportOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // As zkCli shows it.
+    if exported := snapshot.Nodes[0].Ver; exported != 1 || c.ExportVersion(ver) != 1 {
+        t.Fatalf("exported version %d of a node set twice, want its dataVersion", exported)
+    }
+    if imported := c.ImportVersion(snapshot.Nodes[0].Ver); imported != ver {
+        t.Fatalf("imported version %d, want %d", imported, ver)
+    }
+    if newVer, err := c.Cas("/k", []byte("c"), c.ImportVersion(1)); IsConflict(newVer, err) || err != nil {
+        t.Errorf("Cas with an imported version: %v, %v", newVer, err)
+    }
+
+    plain := newTestClient(t, zk)
+    defer plain.Close()
+    if plain.ExportVersion(ver) != ver || plain.ImportVersion(ver) != ver {
+        t.Error("default translator changes versions")
+    }
+}
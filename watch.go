@@ -0,0 +1,330 @@
+package goffkv_zk
+
+import (
+    "sync"
+    "time"
+    goffkv "github.com/offscale/goffkv"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    watchBacklog = 64
+    watchRetryDelay = time.Second
+)
+
+// A change of a watched key. Ver is 0 (and Value is nil) if the key has been erased.
+type WatchEvent struct {
+    Key string
+    Ver goffkv.Version
+    Value []byte
+    // Number of versions that have come and gone between the previous event and this one;
+    // only the latest value is delivered.
+    Missed uint64
+}
+
+// Counters of a long-lived watch since its registration.
+type WatchStats struct {
+    Since time.Time
+    // How many times the underlying zk watch has fired.
+    Fires uint64
+    // How many times the zk watch has been set again after firing or failing.
+    Reregistrations uint64
+    // How many times a version gap (i.e. missed changes) has been observed.
+    Resyncs uint64
+    // Events delivered but not yet received.
+    Backlog int
+    // Delay between the modification time of a node (as stamped by the server) and the
+    // delivery of the corresponding watch event; subject to clock skew. Each sample is also
+    // reported to the Instrumentation of the client, as a "watch" op.
+    LagSamples uint64
+    LastLag time.Duration
+    MaxLag time.Duration
+    TotalLag time.Duration
+}
+
+func (s WatchStats) AvgLag() time.Duration {
+    if s.LagSamples == 0 {
+        return 0
+    }
+    return s.TotalLag / time.Duration(s.LagSamples)
+}
+
+// Long-lived watch of a single key: unlike goffkv.Watch, it is re-registered automatically.
+type Watcher struct {
+    *gate
+    c *Client
+    key string
+    path string
+    events chan WatchEvent
+    stop chan struct{}
+    stopOnce sync.Once
+
+    mu sync.Mutex
+    stats WatchStats
+    // Version of the last event queued (or of the registration).
+    ver goffkv.Version
+}
+
+type watcherSet struct {
+    mu sync.Mutex
+    all map[*Watcher]struct{}
+}
+
+// WatchKey starts a long-lived watch of key; changes are delivered to Events() until Stop is called.
+func (c *Client) WatchKey(key string) (*Watcher, error) {
+    return c.watchKey(key, nil)
+}
+
+// Starts a long-lived watch of key. If since is not nil, the current version is delivered first
+// unless it is *since, as if the watch had been registered back then.
+func (c *Client) watchKey(key string, since *goffkv.Version) (*Watcher, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    w := &Watcher{
+        gate: newGate(),
+        c: c,
+        key: key,
+        path: c.assemblePath(segments),
+        events: make(chan WatchEvent, watchBacklog),
+        stop: make(chan struct{}),
+        stats: WatchStats{Since: time.Now()},
+    }
+
+    ver, value, _, ech, err := w.register()
+    if err != nil {
+        return nil, convertError(err)
+    }
+    w.ver = ver
+    if since != nil && ver != *since {
+        var missed uint64
+        if ver != 0 && *since != 0 && ver > *since + 1 {
+            missed = ver - *since - 1
+        }
+        w.events <- WatchEvent{Key: key, Ver: ver, Value: value, Missed: missed}
+    }
+
+    c.watchers.mu.Lock()
+    if c.watchers.all == nil {
+        c.watchers.all = make(map[*Watcher]struct{})
+    }
+    c.watchers.all[w] = struct{}{}
+    c.watchers.mu.Unlock()
+
+    w.markReady()
+    go w.loop(ver, ech)
+    return w, nil
+}
+
+func (w *Watcher) register() (goffkv.Version, []byte, *zkapi.Stat, <-chan zkapi.Event, error) {
+    for {
+        data, stat, ech, err := w.c.getW(w.path)
+        if err == nil {
+            return VersionOf(stat), valueOf(data), stat, ech, nil
+        }
+        if err != zkapi.ErrNoNode {
+            return 0, nil, nil, nil, err
+        }
+
+        exists, _, ech, err := w.c.conn.ExistsW(w.path)
+        if err != nil {
+            return 0, nil, nil, nil, err
+        }
+        if !exists {
+            return 0, nil, nil, ech, nil
+        }
+    }
+}
+
+func (w *Watcher) loop(lastVer goffkv.Version, ech <-chan zkapi.Event) {
+    defer func() {
+        w.c.watchers.mu.Lock()
+        delete(w.c.watchers.all, w)
+        w.c.watchers.mu.Unlock()
+        close(w.events)
+    }()
+
+    for {
+        var event zkapi.Event
+        select {
+        case event = <-ech:
+        case <-w.stop:
+            return
+        case <-w.c.done:
+            w.fail(ErrClientClosed)
+            return
+        }
+
+        firedAt := time.Now()
+        w.mu.Lock()
+        w.stats.Fires++
+        w.mu.Unlock()
+
+        rewatched := func() {}
+        if event.Type == zkapi.EventNotWatching {
+            // Lost along with many others, most likely.
+            var ok bool
+            ok, rewatched = w.c.awaitRewatch(w.stop)
+            if !ok {
+                select {
+                case <-w.c.done:
+                    w.fail(ErrClientClosed)
+                default:
+                }
+                return
+            }
+        }
+
+        var (
+            ver goffkv.Version
+            value []byte
+            stat *zkapi.Stat
+            err error
+        )
+        for {
+            ver, value, stat, ech, err = w.register()
+            if err == nil {
+                break
+            }
+            select {
+            case <-time.After(watchRetryDelay):
+            case <-w.stop:
+                rewatched()
+                return
+            case <-w.c.done:
+                rewatched()
+                w.fail(ErrClientClosed)
+                return
+            }
+        }
+        rewatched()
+
+        var missed uint64
+        if ver != 0 && lastVer != 0 && ver > lastVer + 1 {
+            missed = ver - lastVer - 1
+        }
+
+        lag := time.Duration(-1)
+        if stat != nil && ver != lastVer {
+            lag = firedAt.Sub(time.Unix(0, stat.Mtime * int64(time.Millisecond)))
+            if lag < 0 {
+                lag = 0
+            }
+        }
+
+        w.mu.Lock()
+        w.stats.Reregistrations++
+        if missed != 0 {
+            w.stats.Resyncs++
+        }
+        if lag >= 0 {
+            w.stats.LagSamples++
+            w.stats.LastLag = lag
+            w.stats.TotalLag += lag
+            if lag > w.stats.MaxLag {
+                w.stats.MaxLag = lag
+            }
+        }
+        w.mu.Unlock()
+        if lag >= 0 && w.c.instr != nil {
+            w.c.instr.Observe("watch", lag, nil)
+        }
+
+        if ver == lastVer {
+            continue
+        }
+        lastVer = ver
+
+        select {
+        case w.events <- WatchEvent{Key: w.key, Ver: ver, Value: value, Missed: missed}:
+        case <-w.stop:
+            return
+        case <-w.c.done:
+            w.fail(ErrClientClosed)
+            return
+        }
+        w.mu.Lock()
+        w.ver = ver
+        w.mu.Unlock()
+    }
+}
+
+// Rewatch re-arms a data watch on key after a previous one has fired, where lastVer is the version
+// seen before (0 if the key didn't exist). Changes made between the fire and the re-registration
+// don't trigger the new watch, so the returned watch fires right away if the key has changed since
+// lastVer. The watch is set on existence if the key doesn't exist.
+func (c *Client) Rewatch(key string, lastVer goffkv.Version) (goffkv.Version, []byte, goffkv.Watch, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, nil, nil, err
+    }
+
+    w := &Watcher{c: c, path: c.assemblePath(segments)}
+    ver, value, _, ech, err := w.register()
+    if err != nil {
+        return 0, nil, nil, convertError(err)
+    }
+    if ver != lastVer {
+        return ver, value, func() {}, nil
+    }
+    return ver, value, func() {
+        <-ech
+    }, nil
+}
+
+// Events returns the channel of changes; it is closed once the watch is stopped.
+func (w *Watcher) Events() <-chan WatchEvent {
+    return w.events
+}
+
+func (w *Watcher) Key() string {
+    return w.key
+}
+
+func (w *Watcher) Stats() WatchStats {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    result := w.stats
+    result.Backlog = len(w.events)
+    return result
+}
+
+func (w *Watcher) Stop() {
+    w.stopOnce.Do(func() {
+        close(w.stop)
+    })
+}
+
+// WatchStats returns statistics of all active long-lived watches, summed per key.
+func (c *Client) WatchStats() map[string]WatchStats {
+    c.watchers.mu.Lock()
+    watchers := make([]*Watcher, 0, len(c.watchers.all))
+    for w := range c.watchers.all {
+        watchers = append(watchers, w)
+    }
+    c.watchers.mu.Unlock()
+
+    result := make(map[string]WatchStats)
+    for _, w := range watchers {
+        stats := w.Stats()
+        if sum, ok := result[w.key]; ok {
+            if sum.Since.Before(stats.Since) {
+                stats.Since = sum.Since
+            }
+            stats.Fires += sum.Fires
+            stats.Reregistrations += sum.Reregistrations
+            stats.Resyncs += sum.Resyncs
+            stats.Backlog += sum.Backlog
+            stats.LagSamples += sum.LagSamples
+            stats.TotalLag += sum.TotalLag
+            if sum.MaxLag > stats.MaxLag {
+                stats.MaxLag = sum.MaxLag
+            }
+        }
+        result[w.key] = stats
+    }
+    return result
+}
@@ -0,0 +1,79 @@
+package goffkv_zk
+
+import (
+    "testing"
+    "time"
+)
+
+// The lag of watch events is reported to the instrumentation as it is measured.
+func TestWatchLagObserved(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    lags := make(chan time.Duration, 16)
+    c := newTestClient(t, zk, WithInstrumentation(InstrumentationFunc(func(op string, latency time.Duration, err error) {
+        if op == "watch" {
+            lags <- latency
+        }
+    })))
+    defer c.Close()
+
+    w, err := c.WatchKey("/k")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer w.Stop()
+    if _, err := c.Set("/k", []byte("v")); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case event := <-w.Events():
+        if string(event.Value) != "v" {
+            t.Fatalf("event %+v", event)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("no event")
+    }
+
+    select {
+    case lag := <-lags:
+        if stats := w.Stats(); stats.LagSamples != 1 || stats.LastLag != lag {
+            t.Errorf("observed lag %v, stats %+v", lag, stats)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("lag not observed")
+    }
+}
+
+// A change missed between two watches makes the new one fire right away.
+func TestRewatch(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    defer c.Close()
+
+    ver, err := c.Set("/k", []byte("a"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, value, watch, err := c.Rewatch("/k", ver)
+    if err != nil || string(value) != "a" {
+        t.Fatalf("Rewatch: %q, %v", value, err)
+    }
+    if fired(watch, 50 * time.Millisecond) {
+        t.Fatal("watch of an unchanged key fired")
+    }
+
+    if _, err := c.Set("/k", []byte("b")); err != nil {
+        t.Fatal(err)
+    }
+    if !fired(watch, time.Second) {
+        t.Fatal("watch didn't fire on a change")
+    }
+    newVer, _, watch, err := c.Rewatch("/k", ver)
+    if err != nil || newVer == ver {
+        t.Fatalf("Rewatch after a change: %v, %v", newVer, err)
+    }
+    if !fired(watch, 100 * time.Millisecond) {
+        t.Error("watch not fired for a change missed in between")
+    }
+}
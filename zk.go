@@ -1,14 +1,22 @@
 package goffkv_zk
 
 import (
+    "context"
+    "fmt"
     "time"
     "bytes"
+    "strings"
+    "sync"
     goffkv "github.com/offscale/goffkv"
-    zkapi "github.com/samuel/go-zookeeper/zk"
+    zkapi "github.com/go-zookeeper/zk"
+    "golang.org/x/sync/errgroup"
+    "golang.org/x/sync/singleflight"
 )
 
 const (
     ttl = time.Second * 10
+    // Maximum number of Children requests in flight while listing a subtree.
+    listConcurrency = 32
 )
 
 var (
@@ -21,12 +29,64 @@ var (
     }
 )
 
-type zkClient struct {
+type Client struct {
+    // Accessed atomically (first for alignment).
+    conflicts conflictCounters
     conn *zkapi.Conn
+    // Connection to another member, for WithReadFallback.
+    secondary *zkapi.Conn
+    fallbackAfter time.Duration
+    servers []string
     prefixSegments []string
+    acl []zkapi.ACL
+    frozen frozenSet
+    namespaceLocks []namespaceLock
+    heldLocks heldLocks
+    handles handleSet
+    dedup *dedupCache
+    identity *Identity
+    fallback *fallbackCache
+    queue *offlineQueue
+    policy *NamingPolicy
+    leases *leaseTracker
+    leasePatterns [][]string
+    auths []Authenticator
+    dialer zkapi.Dialer
+    watchers watcherSet
+    reads *singleflight.Group
+    linearizable bool
+    sessionListeners []func(SessionState)
+    subscribers sessionSubscribers
+    reliableWatches bool
+    retryPolicy *RetryPolicy
+    instr Instrumentation
+    timings serverTimings
+    pressure pressureGauge
+    keyStats *keyStats
+    rewatch *rewatchPacing
+    conflictBackoff ConflictBackoff
+    chunkSize int
+    compression Codec
+    compressMinSize int
+    encryption Codec
+    codecs map[string]Codec
+    commits *commitScheduler
+    leaseTTL time.Duration
+    handshake handshake
+    containerParents bool
+    abandoned abandonedWrites
+    logger Logger
+    versions VersionTranslator
+    recoverPanics bool
+    splitTxns bool
+    batcher *writeBatcher
+    maxResponseSize int
+    valueCodec ValueCodec
+    done chan struct{}
+    closeOnce sync.Once
 }
 
-func (c *zkClient) assemblePath(segments []string) string {
+func (c *Client) assemblePath(segments []string) string {
     var result bytes.Buffer
 
     for _, segment := range c.prefixSegments {
@@ -41,14 +101,23 @@ func (c *zkClient) assemblePath(segments []string) string {
     return result.String()
 }
 
-func createEachPrefix(conn *zkapi.Conn, segments []string) error {
+// Nodes created with nil data (e.g. by other clients) are read as nil by the driver; existing
+// keys always have a non-nil value, so that nil unambiguously means a missing key.
+func valueOf(data []byte) []byte {
+    if data == nil {
+        return []byte{}
+    }
+    return data
+}
+
+func (c *Client) createEachPrefix(segments []string) error {
     var prefix bytes.Buffer
 
     for _, segment := range segments {
         prefix.WriteByte('/')
         prefix.WriteString(segment)
 
-        _, err := conn.Create(prefix.String(), nil, 0, defaultAcl)
+        _, err := c.createParent(prefix.String())
         if err != nil && err != zkapi.ErrNodeExists {
             return err
         }
@@ -70,77 +139,303 @@ func convertError(err error) error {
     }
 }
 
-func New(address string, prefix string) (goffkv.Client, error) {
+// Address is a comma-separated list of ensemble members, e.g. "zk1:2181,zk2:2181,zk3:2181".
+func splitServers(address string) []string {
+    servers := []string{}
+    for _, server := range strings.Split(address, ",") {
+        server = strings.TrimSpace(server)
+        if server != "" {
+            servers = append(servers, server)
+        }
+    }
+    return servers
+}
+
+// Configures a Client created with Connect.
+type Option func(*Client)
+
+// Connect works like New, but accepts options and returns the concrete client.
+func Connect(address string, prefix string, opts ...Option) (*Client, error) {
     prefixSegments, err := goffkv.DisassemblePath(prefix)
     if err != nil {
         return nil, err
     }
 
-    conn, _, err := zkapi.Connect([]string{address}, ttl)
+    c := &Client{
+        prefixSegments: prefixSegments,
+        acl: defaultAcl,
+        logger: zkapi.DefaultLogger,
+        versions: GoffkvVersions,
+        codecs: map[string]Codec{
+            GzipCodec.Name(): GzipCodec,
+        },
+        done: make(chan struct{}),
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    if c.identity != nil {
+        c.logger = identityLogger{c.identity.String(), c.logger}
+    }
+
+    if c.fallback != nil {
+        c.fallback.seal = c.encryption
+        c.fallback.open = c.decompress
+        err = c.fallback.load()
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    c.servers = splitServers(address)
+    conn, events, err := zkapi.Connect(c.servers, ttl, c.configureConn, c.sniffHandshake)
+    if err != nil {
+        return nil, err
+    }
+    c.conn = conn
+
+    for _, auth := range c.auths {
+        err = auth.Authenticate(conn)
+        if err != nil {
+            conn.Close()
+            return nil, err
+        }
+    }
+
+    err = c.createEachPrefix(prefixSegments)
     if err != nil {
+        conn.Close()
         return nil, err
     }
 
-    err = createEachPrefix(conn, prefixSegments)
+    err = c.connectSecondary()
     if err != nil {
         conn.Close()
         return nil, err
     }
 
-    return &zkClient{
-        conn: conn,
-        prefixSegments: prefixSegments,
-    }, nil
+    go c.handleEvents(events)
+    if c.fallback != nil {
+        go c.flushFallback()
+    }
+    if c.leases != nil {
+        go c.verifyLeases()
+    }
+    return c, nil
+}
+
+// Applied to the underlying connection before it is started.
+func (c *Client) configureConn(conn *zkapi.Conn) {
+    if c.dialer != nil {
+        zkapi.WithDialer(c.dialer)(conn)
+    }
+    if c.maxResponseSize > 0 {
+        zkapi.WithMaxConnBufferSize(c.maxResponseSize)(conn)
+    }
+    conn.SetLogger(c.logger)
+}
+
+func (c *Client) handleEvents(events <-chan zkapi.Event) {
+    for event := range events {
+        if event.Type != zkapi.EventSession {
+            continue
+        }
+        if state, ok := sessionStateOf(event.State); ok {
+            c.notifySession(state)
+        }
+        if event.State == zkapi.StateHasSession {
+            if c.identity != nil {
+                c.registerIdentity()
+            }
+            if c.queue != nil {
+                go c.replayQueue()
+            }
+        }
+    }
 }
 
-func (c *zkClient) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
-    segments, err := goffkv.DisassembleKey(key)
+func New(address string, prefix string) (goffkv.Client, error) {
+    c, err := Connect(address, prefix)
+    if err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+func (c *Client) create(key string, value []byte, flags int32, acl []zkapi.ACL) (goffkv.Version, error) {
+    segments, err := c.disassembleKey(key)
     if err != nil {
         return 0, err
     }
 
-    var flags int32
-    if lease {
-        flags = zkapi.FlagEphemeral
+    err = c.checkWritable(segments)
+    if err != nil {
+        return 0, err
     }
 
-    _, err = c.conn.Create(c.assemblePath(segments), value, flags, defaultAcl)
+    data, err := c.encodeValue(normalizeKey(segments), value)
     if err != nil {
         return 0, convertError(err)
     }
+    _, err = c.createNode(c.assemblePath(segments), data, flags, acl)
+    if err != nil {
+        if notWritten(err) {
+            c.discardChunks(normalizeKey(segments), data)
+        }
+        return 0, convertError(err)
+    }
 
     return 1, nil
 }
 
-func (c *zkClient) Set(key string, value []byte) (goffkv.Version, error) {
-    segments, err := goffkv.DisassembleKey(key)
+func (c *Client) Create(key string, value []byte, lease bool) (goffkv.Version, error) {
+    return c.createContext(context.Background(), key, value, lease)
+}
+
+func (c *Client) createContext(ctx context.Context, key string, value []byte, lease bool) (goffkv.Version, error) {
+    return c.createWithAcl(ctx, key, value, lease, nil)
+}
+
+// Creates key with acl, or with the ACL of the client if nil.
+func (c *Client) createWithAcl(ctx context.Context, key string, value []byte, lease bool, acl []zkapi.ACL) (ver goffkv.Version, err error) {
+    defer c.recoverPanic("create", key, &err)
+    c.fence(ctx, key)
+    if c.batcher != nil {
+        return c.batcher.submit(c, goffkv.Operation{What: goffkv.Create, Key: key, Value: value, Lease: lease}, acl)
+    }
+    return c.createNow(ctx, key, value, lease, acl)
+}
+
+func (c *Client) createNow(ctx context.Context, key string, value []byte, lease bool, acl []zkapi.ACL) (ver goffkv.Version, err error) {
+    start := time.Now()
+    flags := c.leaseFlags(key, lease)
+    if acl == nil {
+        acl = c.acl
+    }
+    defer c.lockQueued(key)()
+    err = c.retry(ctx, true, func() (err error) {
+        ver, err = c.create(key, value, flags, acl)
+        return err
+    })
+    if err == nil {
+        c.queue.drop(key, false)
+    }
+    if err == nil && flags != 0 && c.leases != nil {
+        c.leases.track(key)
+    }
+    err = c.wrapError("create", key, err)
+    c.observe("create", key, start, err)
+    return ver, err
+}
+
+// CreateImmutable creates a write-once entry: its ACL lacks write and admin permissions,
+// so Set/Cas on it fail with zk.ErrNoAuth. It can still be erased.
+func (c *Client) CreateImmutable(key string, value []byte) (goffkv.Version, error) {
+    acl := make([]zkapi.ACL, 0, len(c.acl))
+    for _, entry := range c.acl {
+        entry.Perms &^= zkapi.PermWrite | zkapi.PermAdmin
+        acl = append(acl, entry)
+    }
+    return c.createWithAcl(context.Background(), key, value, false, acl)
+}
+
+func (c *Client) Set(key string, value []byte) (goffkv.Version, error) {
+    return c.setContext(context.Background(), key, value)
+}
+
+func (c *Client) setContext(ctx context.Context, key string, value []byte) (ver goffkv.Version, err error) {
+    defer c.recoverPanic("set", key, &err)
+    c.fence(ctx, key)
+    if c.batcher != nil {
+        return c.batcher.submit(c, goffkv.Operation{What: goffkv.Set, Key: key, Value: value}, nil)
+    }
+    return c.setNow(ctx, key, value)
+}
+
+func (c *Client) setNow(ctx context.Context, key string, value []byte) (ver goffkv.Version, err error) {
+    start := time.Now()
+    defer c.lockQueued(key)()
+    err = c.retry(ctx, true, func() (err error) {
+        ver, err = c.set(key, value)
+        return err
+    })
+    if err == nil {
+        c.queue.drop(key, false)
+    }
+    if err != nil && c.queue != nil && isUnreachable(err) {
+        err = c.queue.push(key, value)
+        c.observe("set", key, start, err)
+        return 0, err
+    }
+    err = c.wrapError("set", key, err)
+    c.observe("set", key, start, err)
+    return ver, err
+}
+
+func (c *Client) set(key string, value []byte) (goffkv.Version, error) {
+    segments, err := c.disassembleKey(key)
+    if err != nil {
+        return 0, err
+    }
+
+    err = c.checkWritable(segments)
     if err != nil {
         return 0, err
     }
 
-    _, err = c.conn.Create(c.assemblePath(segments), value, 0, defaultAcl)
+    if c.dedup != nil {
+        ver := c.unchangedVersion(c.assemblePath(segments), value)
+        if ver != 0 {
+            return ver, nil
+        }
+    }
+
+    data, err := c.encodeValue(normalizeKey(segments), value)
+    if err != nil {
+        return 0, convertError(err)
+    }
+
+    _, err = c.createNode(c.assemblePath(segments), data, c.leaseFlags(key, false), c.acl)
     if err == nil {
         return 1, nil
     }
 
     if err != zkapi.ErrNodeExists {
+        if notWritten(err) {
+            c.discardChunks(normalizeKey(segments), data)
+        }
         return 0, convertError(err)
     }
 
-    stat, err := c.conn.Set(c.assemblePath(segments), value, -1)
+    stat, err := c.conn.Set(c.assemblePath(segments), data, -1)
     if err == nil {
-        return uint64(stat.Version) + 1, nil
+        if c.dedup != nil {
+            c.dedup.remember(c.assemblePath(segments), stat, value)
+        }
+        return VersionOf(stat), nil
     }
 
+    if notWritten(err) {
+        c.discardChunks(normalizeKey(segments), data)
+    }
     if err == zkapi.ErrNoNode {
         return uint64(1) << 62, nil
     }
     return 0, convertError(err)
 }
 
-func (c *zkClient) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+func (c *Client) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Version, error) {
+    return c.casContext(context.Background(), key, value, ver)
+}
+
+func (c *Client) casContext(ctx context.Context, key string, value []byte, ver goffkv.Version) (resultVer goffkv.Version, err error) {
+    defer func(start time.Time) {
+        c.observe("cas", key, start, err)
+    }(time.Now())
+    defer c.recoverPanic("cas", key, &err)
+
     if ver == 0 {
-        resultVer, err := c.Create(key, value, false)
+        resultVer, err := c.createContext(ctx, key, value, false)
         if err == nil {
             return resultVer, nil
         }
@@ -150,84 +445,254 @@ func (c *zkClient) Cas(key string, value []byte, ver goffkv.Version) (goffkv.Ver
         return 0, err
     }
 
-    segments, err := goffkv.DisassembleKey(key)
+    segments, err := c.disassembleKey(key)
     if err != nil {
         return 0, err
     }
 
-    stat, err := c.conn.Set(c.assemblePath(segments), value, int32(ver - 1))
+    err = c.checkWritable(segments)
+    if err != nil {
+        return 0, c.wrapError("cas", key, err)
+    }
+
+    data, err := c.encodeValue(normalizeKey(segments), value)
+    if err != nil {
+        return 0, c.wrapError("cas", key, convertError(err))
+    }
+
+    var stat *zkapi.Stat
+    c.fence(ctx, key)
+    defer c.lockQueued(key)()
+    err = c.retry(ctx, true, func() (err error) {
+        stat, err = c.conn.Set(c.assemblePath(segments), data, ToZKVersion(ver))
+        return err
+    })
+    if notWritten(err) {
+        c.discardChunks(normalizeKey(segments), data)
+    }
     switch err {
     case nil:
-        return uint64(stat.Version) + 1, nil
+        c.queue.drop(key, false)
+        return VersionOf(stat), nil
     case zkapi.ErrBadVersion:
         return 0, nil
     default:
-        return 0, convertError(err)
+        return 0, c.wrapError("cas", key, convertError(err))
+    }
+}
+
+// What an erase has removed. Bytes is the total data length of the removed nodes.
+type EraseStats struct {
+    Nodes int
+    Bytes int64
+}
+
+type eraseItem struct {
+    path string
+    size int32
+}
+
+// Lists the subtree rooted at segments children-first, so that deleting the items in order is valid:
+// level by level, deepest first, the root last. The Children requests of a level are sent
+// concurrently, up to listConcurrency at a time, and pipelined on the connection, so the listing
+// takes about one round trip per level rather than per node; it still takes one request per node.
+func (c *Client) listSubtree(items []eraseItem, segments []string) ([]eraseItem, error) {
+    type node struct {
+        segments []string
+        item eraseItem
+        children []string
+        err error
+    }
+
+    root := &node{segments: segments}
+    levels := [][]*node{{root}}
+    for level := levels[0]; len(level) > 0; {
+        var g errgroup.Group
+        g.SetLimit(listConcurrency)
+        for _, n := range level {
+            n := n
+            g.Go(func() error {
+                path := c.assemblePath(n.segments)
+                children, stat, err := c.conn.Children(path)
+                if err != nil {
+                    n.err = err
+                    return nil
+                }
+                n.children = children
+                n.item = eraseItem{
+                    path: path,
+                    size: stat.DataLength,
+                }
+                return nil
+            })
+        }
+        g.Wait()
+
+        if root.err != nil {
+            return items, root.err
+        }
+        next := []*node{}
+        for _, n := range level {
+            // Removed meanwhile: so is its subtree.
+            if n.err == zkapi.ErrNoNode {
+                continue
+            }
+            if n.err != nil {
+                return items, n.err
+            }
+            for _, child := range n.children {
+                next = append(next, &node{segments: append(append([]string{}, n.segments...), child)})
+            }
+        }
+        levels = append(levels, next)
+        level = next
+    }
+
+    for i := len(levels) - 1; i >= 0; i-- {
+        for _, n := range levels[i] {
+            if n.err == nil {
+                items = append(items, n.item)
+            }
+        }
     }
+    return items, nil
 }
 
-func (c *zkClient) makeEraseQuery(ops []interface{}, segments []string) ([]interface{}, error) {
-    path := c.assemblePath(segments)
-    children, _, err := c.conn.Children(path)
+func (c *Client) makeEraseQuery(ops []interface{}, segments []string, stats *EraseStats) ([]interface{}, error) {
+    items, err := c.listSubtree(nil, segments)
     if err != nil {
         return ops, err
     }
 
-    for _, child := range children {
-        ops, err = c.makeEraseQuery(ops, append(segments, child))
-        if err != nil && err != zkapi.ErrNoNode {
-            return ops, err
+    for _, item := range items {
+        ops = append(ops, &zkapi.DeleteRequest{
+            Path: item.path,
+            Version: -1,
+        })
+        if stats != nil {
+            stats.Nodes++
+            stats.Bytes += int64(item.size)
         }
     }
-    ops = append(ops, &zkapi.DeleteRequest{
-        Path: path,
-        Version: -1,
-    })
     return ops, nil
 }
 
-func (c *zkClient) Erase(key string, ver goffkv.Version) error {
-    segments, err := goffkv.DisassembleKey(key)
+func (c *Client) Erase(key string, ver goffkv.Version) error {
+    _, err := c.EraseTree(key, ver)
+    return err
+}
+
+// EraseTree works like Erase, but also reports how many nodes (and bytes of data) were removed.
+func (c *Client) EraseTree(key string, ver goffkv.Version) (EraseStats, error) {
+    return c.EraseTreeWith(key, ver, EraseOptions{})
+}
+
+// EraseTreeWith works like EraseTree, but lets the caller choose how to erase a big subtree.
+func (c *Client) EraseTreeWith(key string, ver goffkv.Version, opts EraseOptions) (EraseStats, error) {
+    return c.eraseTreeContext(context.Background(), key, ver, opts)
+}
+
+func (c *Client) eraseTreeContext(ctx context.Context, key string, ver goffkv.Version, opts EraseOptions) (stats EraseStats, err error) {
+    defer c.recoverPanic("erase", key, &err)
+    start := time.Now()
+    segments, err := c.disassembleKey(key)
     if err != nil {
+        return EraseStats{}, err
+    }
+
+    c.fence(ctx, key)
+    defer c.lockQueued(key)()
+    err = c.retry(ctx, true, func() (err error) {
+        stats, err = c.eraseTree(segments, ver, opts)
         return err
+    })
+    if err == nil {
+        c.queue.drop(key, true)
+    }
+    if err == nil && c.leases != nil {
+        c.leases.untrack(normalizeKey(segments))
+    }
+    err = c.wrapError("erase", key, err)
+    c.observe("erase", key, start, err)
+    return stats, err
+}
+
+func (c *Client) eraseTree(segments []string, ver goffkv.Version, opts EraseOptions) (EraseStats, error) {
+    err := c.checkErasable(segments)
+    if err != nil {
+        return EraseStats{}, err
+    }
+
+    switch {
+    case opts.Strategy == EraseStreaming:
+        return c.eraseStreaming(segments, ver, opts)
+    case opts.Strategy == EraseBatches, opts.Strategy == EraseAuto && opts.BatchSize > 0:
+        return c.eraseBatched(segments, ver, opts)
     }
 
 outermost:
-    for {
+    for restarts := 0; ; restarts++ {
+        if restarts == maxEraseRestarts {
+            return EraseStats{}, ErrEraseContended
+        }
+        if restarts > 0 {
+            c.logger.Printf("erase %s: subtree changed, restarting", c.assemblePath(segments))
+        }
+
+        var stats EraseStats
         ops := []interface{}{
             &zkapi.CheckVersionRequest{
                 Path: c.assemblePath(segments),
-                Version: int32(ver) - 1,
+                Version: ToZKVersion(ver),
             },
         }
 
-        ops, err = c.makeEraseQuery(ops, segments)
+        ops, err = c.makeEraseQuery(ops, segments, &stats)
         if err != nil {
-            return convertError(err)
+            return EraseStats{}, convertError(err)
+        }
+        if opts.Strategy == EraseAuto && multiSize(ops) > maxMultiBytes {
+            return c.eraseBatched(segments, ver, opts)
         }
 
         data, err := c.conn.Multi(ops...)
         switch err {
         case nil:
-            return nil
+            return stats, nil
         case zkapi.ErrBadVersion:
-            return nil
+            return EraseStats{}, nil
         case zkapi.ErrNotEmpty:
             continue outermost
         case zkapi.ErrNoNode:
             if data[0].Error != nil {
-                return goffkv.OpErrNoEntry
+                return EraseStats{}, goffkv.OpErrNoEntry
             } else {
                 continue outermost
             }
         default:
-            return convertError(err)
+            return EraseStats{}, convertError(err)
         }
     }
 }
 
-func (c *zkClient) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
-    segments, err := goffkv.DisassembleKey(key)
+func (c *Client) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    return c.existsContext(context.Background(), key, watch)
+}
+
+func (c *Client) existsContext(ctx context.Context, key string, watch bool) (ver goffkv.Version, resultWatch goffkv.Watch, err error) {
+    defer c.recoverPanic("exists", key, &err)
+    start := time.Now()
+    err = c.retry(ctx, false, func() error {
+        ver, resultWatch, err = c.existsOnce(key, watch)
+        return err
+    })
+    err = c.wrapError("exists", key, err)
+    c.observe("exists", key, start, err)
+    return
+}
+
+func (c *Client) existsOnce(key string, watch bool) (goffkv.Version, goffkv.Watch, error) {
+    segments, err := c.disassembleKey(key)
     if err != nil {
         return 0, nil, err
     }
@@ -240,16 +705,23 @@ func (c *zkClient) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch,
 
     if watch {
         var ech <-chan zkapi.Event
-        exists, stat, ech, err = c.conn.ExistsW(c.assemblePath(segments))
+        err = c.syncRead(c.assemblePath(segments))
+        if err == nil {
+            exists, stat, ech, err = c.conn.ExistsW(c.assemblePath(segments))
+        }
         if err != nil {
             return 0, nil, convertError(err)
         }
-        resultWatch = func() {
-            <-ech
-        }
+        resultWatch = c.watchOf(ech, func() (<-chan zkapi.Event, bool, error) {
+            nowExists, nowStat, ech, err := c.conn.ExistsW(c.assemblePath(segments))
+            if err != nil {
+                return nil, false, err
+            }
+            return ech, nowExists != exists || exists && (nowStat.Czxid != stat.Czxid || nowStat.Version != stat.Version), nil
+        })
 
     } else {
-        exists, stat, err = c.conn.Exists(c.assemblePath(segments))
+        exists, stat, err = c.exists(c.assemblePath(segments))
         if err != nil {
             return 0, nil, convertError(err)
         }
@@ -257,45 +729,81 @@ func (c *zkClient) Exists(key string, watch bool) (goffkv.Version, goffkv.Watch,
 
     var resultVer uint64
     if exists {
-        resultVer = uint64(stat.Version) + 1
+        resultVer = VersionOf(stat)
     }
     return resultVer, resultWatch, nil
 }
 
-func (c *zkClient) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
-    segments, err := goffkv.DisassembleKey(key)
+func (c *Client) Get(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    return c.getContext(context.Background(), key, watch)
+}
+
+func (c *Client) getContext(ctx context.Context, key string, watch bool) (ver goffkv.Version, value []byte, resultWatch goffkv.Watch, err error) {
+    defer c.recoverPanic("get", key, &err)
+    start := time.Now()
+    err = c.retry(ctx, false, func() error {
+        ver, value, resultWatch, err = c.getOnce(key, watch)
+        return err
+    })
+    err = c.wrapError("get", key, err)
+    c.observe("get", key, start, err)
+    return
+}
+
+func (c *Client) getOnce(key string, watch bool) (goffkv.Version, []byte, goffkv.Watch, error) {
+    if !watch {
+        entry, err := c.getEntryOnce(key)
+        return entry.Ver, entry.Value, nil, err
+    }
+
+    segments, err := c.disassembleKey(key)
     if err != nil {
         return 0, nil, nil, err
     }
 
-    var (
-        result []byte
-        stat *zkapi.Stat
-        resultWatch goffkv.Watch
-    )
-
-    if watch {
-        var ech <-chan zkapi.Event
-        result, stat, ech, err = c.conn.GetW(c.assemblePath(segments))
-        if err != nil {
-            return 0, nil, nil, convertError(err)
-        }
-        resultWatch = func() {
-            <-ech
+    err = c.syncRead(c.assemblePath(segments))
+    if err != nil {
+        return 0, nil, nil, convertError(err)
+    }
+    result, stat, ech, err := c.getW(c.assemblePath(segments))
+    if err != nil {
+        return 0, nil, nil, convertError(err)
+    }
+    resultWatch := c.watchOf(ech, func() (<-chan zkapi.Event, bool, error) {
+        _, nowStat, ech, err := c.conn.GetW(c.assemblePath(segments))
+        if err == zkapi.ErrNoNode {
+            return nil, true, nil
         }
-
-    } else {
-        result, stat, err = c.conn.Get(c.assemblePath(segments))
         if err != nil {
-            return 0, nil, nil, convertError(err)
+            return nil, false, err
         }
+        return ech, nowStat.Czxid != stat.Czxid || nowStat.Version != stat.Version, nil
+    })
+
+    if c.fallback != nil {
+        c.fallback.store(key, VersionOf(stat), result)
     }
+    return VersionOf(stat), valueOf(result), resultWatch, nil
+}
+
+func (c *Client) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
+    return c.childrenContext(context.Background(), key, watch)
+}
 
-    return uint64(stat.Version) + 1, result, resultWatch, nil
+func (c *Client) childrenContext(ctx context.Context, key string, watch bool) (children []string, resultWatch goffkv.Watch, err error) {
+    defer c.recoverPanic("children", key, &err)
+    start := time.Now()
+    err = c.retry(ctx, false, func() error {
+        children, resultWatch, err = c.childrenOnce(key, watch)
+        return err
+    })
+    err = c.wrapError("children", key, err)
+    c.observe("children", key, start, err)
+    return
 }
 
-func (c *zkClient) Children(key string, watch bool) ([]string, goffkv.Watch, error) {
-    segments, err := goffkv.DisassembleKey(key)
+func (c *Client) childrenOnce(key string, watch bool) ([]string, goffkv.Watch, error) {
+    segments, err := c.disassembleKey(key)
     if err != nil {
         return nil, nil, err
     }
@@ -306,17 +814,33 @@ func (c *zkClient) Children(key string, watch bool) ([]string, goffkv.Watch, err
     )
 
     if watch {
-        var ech <-chan zkapi.Event
-        rawChildren, _, ech, err = c.conn.ChildrenW(c.assemblePath(segments))
+        var (
+            stat *zkapi.Stat
+            ech <-chan zkapi.Event
+        )
+        err = c.syncRead(c.assemblePath(segments))
+        if err == nil {
+            rawChildren, stat, ech, err = c.conn.ChildrenW(c.assemblePath(segments))
+        }
         if err != nil {
             return nil, nil, convertError(err)
         }
-        resultWatch = func() {
-            <-ech
-        }
+        resultWatch = c.watchOf(ech, func() (<-chan zkapi.Event, bool, error) {
+            _, nowStat, ech, err := c.conn.ChildrenW(c.assemblePath(segments))
+            if err == zkapi.ErrNoNode {
+                return nil, true, nil
+            }
+            if err != nil {
+                return nil, false, err
+            }
+            return ech, nowStat.Czxid != stat.Czxid || nowStat.Cversion != stat.Cversion, nil
+        })
 
     } else {
-        rawChildren, _, err = c.conn.Children(c.assemblePath(segments))
+        err = c.syncRead(c.assemblePath(segments))
+        if err == nil {
+            rawChildren, err = c.hedgedChildren(c.assemblePath(segments))
+        }
         if err != nil {
             return nil, nil, convertError(err)
         }
@@ -345,22 +869,94 @@ func toUserOpIndex(boundaries []int, op int) int {
     return -1
 }
 
-func (c *zkClient) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+func (c *Client) Commit(txn goffkv.Txn) ([]goffkv.TxnOpResult, error) {
+    return txnResults(c.CommitDetailed(txn))
+}
+
+// Converts the results of CommitDetailed into the ones of Commit.
+func txnResults(results []OpResult, err error) ([]goffkv.TxnOpResult, error) {
+    if err != nil {
+        return nil, err
+    }
+
+    result := []goffkv.TxnOpResult{}
+    for _, r := range results {
+        if r.What != goffkv.Erase {
+            result = append(result, goffkv.TxnOpResult{
+                What: r.What,
+                Ver: r.Ver,
+            })
+        }
+    }
+    return result, nil
+}
+
+// CommitDetailed works like Commit, but returns a result for every op, erases included, so that
+// results line up with txn.Ops.
+func (c *Client) CommitDetailed(txn goffkv.Txn) ([]OpResult, error) {
+    return c.commitTicketed(context.Background(), txn, c.commits.enter(txn))
+}
+
+// Commits txn once the commits it has to wait for (per t) are done.
+func (c *Client) commitTicketed(ctx context.Context, txn goffkv.Txn, t *commitTicket) (result []OpResult, err error) {
+    t.wait()
+    defer c.commits.leave(t)
+    defer c.recoverPanic("commit", "", &err)
+
+    start := time.Now()
+    c.fence(ctx, txnKeys(txn)...)
+    unlock := c.lockQueued(txnKeys(txn)...)
+    err = c.retry(ctx, true, func() error {
+        result, err = c.commitOnce(txn)
+        return err
+    })
+    if err == nil {
+        for _, op := range txn.Ops {
+            c.queue.drop(op.Key, op.What == goffkv.Erase)
+        }
+    }
+    unlock()
+    err = c.wrapError("commit", "", err)
+    for _, op := range txn.Ops {
+        c.keyStats.record("commit", op.Key)
+    }
+    c.observe("commit", "", start, err)
+    return
+}
+
+func (c *Client) commitOnce(txn goffkv.Txn) (results []OpResult, err error) {
+    // The values of the current attempt.
+    var encoded []encodedValue
+    defer func() {
+        if notWritten(err) {
+            c.discardAllChunks(encoded)
+        }
+    }()
+
 outermost:
-    for {
+    for restarts := 0; ; restarts++ {
+        // The previous attempt has failed.
+        c.discardAllChunks(encoded)
+        encoded = nil
+        if restarts == maxEraseRestarts {
+            return nil, ErrEraseContended
+        }
+
         boundaries := []int{}
         ops := []interface{}{}
         rks := []resultKind{}
+        // Deletes of the descendants of erased keys.
+        auxDeletes := []interface{}{}
 
         for _, check := range txn.Checks {
-            segments, err := goffkv.DisassembleKey(check.Key)
+            segments, err := c.disassembleKey(check.Key)
             if err != nil {
                 return nil, err
             }
 
             ops = append(ops, &zkapi.CheckVersionRequest{
                 Path: c.assemblePath(segments),
-                Version: int32(check.Ver) - 1,
+                Version: ToZKVersion(check.Ver),
             })
 
             boundaries = append(boundaries, len(ops) - 1)
@@ -368,21 +964,39 @@ outermost:
         }
 
         for _, op := range txn.Ops {
-            segments, err := goffkv.DisassembleKey(op.Key)
+            segments, err := c.disassembleKey(op.Key)
             if err != nil {
                 return nil, err
             }
 
+            if op.What == goffkv.Erase {
+                err = c.checkErasable(segments)
+            } else {
+                err = c.checkWritable(segments)
+            }
+            if err != nil {
+                return nil, err
+            }
+
+            value := op.Value
+            if op.What != goffkv.Erase {
+                value, err = c.encodeValue(normalizeKey(segments), op.Value)
+                if err != nil {
+                    return nil, convertError(err)
+                }
+                encoded = append(encoded, encodedValue{normalizeKey(segments), value})
+            }
+
             switch op.What {
             case goffkv.Create:
-                var flags int32
-                if op.Lease {
-                    flags = zkapi.FlagEphemeral
+                flags := c.leaseFlags(op.Key, op.Lease)
+                if flags == zkapi.FlagTTL {
+                    return nil, ErrTTLLeaseInTxn
                 }
                 ops = append(ops, &zkapi.CreateRequest{
                     Path: c.assemblePath(segments),
-                    Data: op.Value,
-                    Acl: defaultAcl,
+                    Data: value,
+                    Acl: c.acl,
                     Flags: flags,
                 })
                 rks = append(rks, rkCreate)
@@ -390,14 +1004,14 @@ outermost:
             case goffkv.Set:
                 ops = append(ops, &zkapi.SetDataRequest{
                     Path: c.assemblePath(segments),
-                    Data: op.Value,
+                    Data: value,
                     Version: -1,
                 })
                 rks = append(rks, rkSet)
 
             case goffkv.Erase:
                 oldNops := len(ops)
-                ops, err = c.makeEraseQuery(ops, segments)
+                ops, err = c.makeEraseQuery(ops, segments, nil)
                 if err != nil {
                     if err != zkapi.ErrNoNode {
                         return nil, convertError(err)
@@ -410,50 +1024,91 @@ outermost:
                 for i := oldNops; i < len(ops); i++ {
                     rks = append(rks, rkAux)
                 }
+                auxDeletes = append(auxDeletes, ops[oldNops:len(ops) - 1]...)
             }
 
             boundaries = append(boundaries, len(ops) - 1)
         }
 
+        if multiSize(ops) > maxMultiBytes {
+            if !c.splitTxns || len(auxDeletes) == 0 {
+                return nil, ErrTxnTooLarge
+            }
+            err := c.eraseAhead(auxDeletes, ops[:len(txn.Checks)])
+            if err != nil {
+                return nil, err
+            }
+            continue outermost
+        }
+
         data, err := c.conn.Multi(ops...)
         // Note: err is checked later.
 
-        result := []goffkv.TxnOpResult{}
         for i, datum := range data {
             if datum.Error != nil {
                 userIndex := toUserOpIndex(boundaries, i)
                 if userIndex < 0 {
-                    panic("txn failed on non-existing op")
+                    return nil, fmt.Errorf("%w: txn failed on op %d, past the last one", ErrInternal, i)
                 }
                 if boundaries[userIndex] != i {
+                    c.logger.Printf("commit: subtree of an erased key changed, retrying")
+                    continue outermost
+                }
+                if _, ok := ops[i].(*zkapi.CreateRequest); ok && datum.Error == zkapi.ErrNoNode && c.restorePrefix() {
                     continue outermost
                 }
-                return nil, goffkv.TxnError{userIndex}
+                return nil, goffkv.TxnError{OpIndex: userIndex}
             }
+        }
+
+        if err != nil {
+            return nil, convertError(err)
+        }
+        if len(data) != len(ops) {
+            return nil, fmt.Errorf("%w: %d results for %d ops", ErrInternal, len(data), len(ops))
+        }
 
-            switch rks[i] {
+        result := make([]OpResult, len(txn.Ops))
+        prev := len(txn.Checks) - 1
+        for j, op := range txn.Ops {
+            last := boundaries[len(txn.Checks) + j]
+            result[j].What = op.What
+            switch rks[last] {
             case rkCreate:
-                result = append(result, goffkv.TxnOpResult{
-                    goffkv.Create,
-                    1,
-                })
+                result[j].Ver = 1
             case rkSet:
-                result = append(result, goffkv.TxnOpResult{
-                    goffkv.Set,
-                    uint64(datum.Stat.Version) + 1,
-                })
+                result[j].Ver = VersionOf(data[last].Stat)
+            default:
+                result[j].Erased = last - prev
             }
+            prev = last
         }
-
-        if err != nil {
-            return nil, convertError(err)
+        if c.leases != nil {
+            for _, op := range txn.Ops {
+                switch {
+                case op.What == goffkv.Create && c.leaseFlags(op.Key, op.Lease) != 0:
+                    c.leases.track(op.Key)
+                case op.What == goffkv.Erase:
+                    c.leases.untrack(op.Key)
+                }
+            }
         }
         return result, nil
     }
 }
 
-func (c *zkClient) Close() {
-    c.conn.Close()
+// Close is safe to call more than once; later calls do nothing.
+func (c *Client) Close() {
+    c.closeOnce.Do(func() {
+        close(c.done)
+        c.conn.Close()
+        if c.secondary != nil {
+            c.secondary.Close()
+        }
+        if c.fallback != nil {
+            c.fallback.flush()
+        }
+    })
 }
 
 func init() {
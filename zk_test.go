@@ -0,0 +1,119 @@
+package goffkv_zk
+
+import (
+    "errors"
+    "sync"
+    "testing"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+func TestCreateImmutable(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    var (
+        mu sync.Mutex
+        ops []string
+    )
+    c := newTestClient(t, zk, WithInstrumentation(InstrumentationFunc(func(op string, latency time.Duration, err error) {
+        mu.Lock()
+        ops = append(ops, op)
+        mu.Unlock()
+    })))
+    defer c.Close()
+
+    ver, err := c.CreateImmutable("/k", []byte("v"))
+    if err != nil || ver != 1 {
+        t.Fatalf("CreateImmutable: %v, %v", ver, err)
+    }
+    if _, err := c.Set("/k", []byte("w")); !errors.Is(err, zkapi.ErrNoAuth) {
+        t.Errorf("Set of an immutable entry: %v, want zk.ErrNoAuth", err)
+    }
+    if _, err := c.Cas("/k", []byte("w"), ver); !errors.Is(err, zkapi.ErrNoAuth) {
+        t.Errorf("Cas of an immutable entry: %v, want zk.ErrNoAuth", err)
+    }
+    if err := c.Erase("/k", 0); err != nil {
+        t.Errorf("Erase of an immutable entry: %v", err)
+    }
+
+    mu.Lock()
+    observed := len(ops) > 0 && ops[0] == "create"
+    mu.Unlock()
+    if !observed {
+        t.Errorf("CreateImmutable not observed: %v", ops)
+    }
+
+    // Like Create, it honors freezes and wraps errors.
+    if err := c.Freeze("/frozen"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.CreateImmutable("/frozen/k", nil); !errors.Is(err, ErrFrozen) {
+        t.Errorf("CreateImmutable under a frozen key: %v, want ErrFrozen", err)
+    }
+    zk.Fail(func(op int32, path string) error {
+        return zkapi.ErrInvalidACL
+    })
+    _, err = c.CreateImmutable("/other", nil)
+    var zkErr *Error
+    if !errors.As(err, &zkErr) || zkErr.Op != "create" {
+        t.Errorf("CreateImmutable failure: %#v, want an *Error of op create", err)
+    }
+}
+
+func TestCreateImmutableBatched(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk, WithWriteBatching(20 * time.Millisecond, 10))
+    defer c.Close()
+
+    var wg sync.WaitGroup
+    errs := make([]error, 2)
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        _, errs[0] = c.CreateImmutable("/immutable", nil)
+    }()
+    go func() {
+        defer wg.Done()
+        _, errs[1] = c.Create("/mutable", nil, false)
+    }()
+    wg.Wait()
+    if errs[0] != nil || errs[1] != nil {
+        t.Fatal(errs)
+    }
+
+    if _, err := c.Set("/immutable", []byte("x")); !errors.Is(err, zkapi.ErrNoAuth) {
+        t.Errorf("Set of a batched immutable entry: %v, want zk.ErrNoAuth", err)
+    }
+    if _, err := c.Set("/mutable", []byte("x")); err != nil {
+        t.Errorf("Set of a batched mutable entry: %v", err)
+    }
+}
+
+// Calls after Close fail instead of waiting for a reply of the closed driver, and Close can be
+// called again.
+func TestClosedClient(t *testing.T) {
+    zk := newFakeZK(t)
+    defer zk.Close()
+    c := newTestClient(t, zk)
+    c.Close()
+    // Typically deferred as well.
+    c.Close()
+
+    done := make(chan error, 1)
+    go func() {
+        _, err := c.Set("/k", []byte("v"))
+        done <- err
+    }()
+    select {
+    case err := <-done:
+        if !errors.Is(err, ErrClientClosed) {
+            t.Errorf("Set: %v, want ErrClientClosed", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Set of a closed client hangs")
+    }
+    if _, _, _, err := c.Get("/k", false); !errors.Is(err, ErrClientClosed) {
+        t.Errorf("Get: %v, want ErrClientClosed", err)
+    }
+}
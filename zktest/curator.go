@@ -0,0 +1,141 @@
+package zktest
+
+import (
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+)
+
+const (
+    DefaultJBangImage = "jbangdev/jbang-action"
+    curatorPeerFile = "CuratorPeer.java"
+)
+
+// Java counterpart of the recipes of goffkv-zk, run with jbang (which fetches Curator). Usage:
+//
+//   CuratorPeer CONNECT lock PATH WAIT_MS HOLD_MS
+//   CuratorPeer CONNECT leader PATH ID HOLD_MS
+//   CuratorPeer CONNECT register BASE NAME ID PORT HOLD_MS
+//   CuratorPeer CONNECT instances BASE NAME
+//
+// It prints a line as each step completes ("acquired", "timeout", "released", "leader",
+// "registered", or "<id> <address> <port>" per instance), so that callers can synchronize on it.
+const curatorPeer = `///usr/bin/env jbang "$0" "$@" ; exit $?
+//DEPS org.apache.curator:curator-recipes:5.5.0
+//DEPS org.apache.curator:curator-x-discovery:5.5.0
+//DEPS org.slf4j:slf4j-nop:1.7.36
+
+import java.util.concurrent.TimeUnit;
+import org.apache.curator.framework.CuratorFramework;
+import org.apache.curator.framework.CuratorFrameworkFactory;
+import org.apache.curator.framework.recipes.leader.LeaderLatch;
+import org.apache.curator.framework.recipes.locks.InterProcessMutex;
+import org.apache.curator.retry.ExponentialBackoffRetry;
+import org.apache.curator.x.discovery.ServiceDiscovery;
+import org.apache.curator.x.discovery.ServiceDiscoveryBuilder;
+import org.apache.curator.x.discovery.ServiceInstance;
+
+public class CuratorPeer {
+    static void say(String line) {
+        System.out.println(line);
+        System.out.flush();
+    }
+
+    public static void main(String[] args) throws Exception {
+        CuratorFramework client = CuratorFrameworkFactory.newClient(args[0], new ExponentialBackoffRetry(100, 3));
+        client.start();
+        client.blockUntilConnected();
+
+        switch (args[1]) {
+        case "lock": {
+            InterProcessMutex mutex = new InterProcessMutex(client, args[2]);
+            if (!mutex.acquire(Long.parseLong(args[3]), TimeUnit.MILLISECONDS)) {
+                say("timeout");
+                break;
+            }
+            say("acquired");
+            Thread.sleep(Long.parseLong(args[4]));
+            mutex.release();
+            say("released");
+            break;
+        }
+        case "leader": {
+            LeaderLatch latch = new LeaderLatch(client, args[2], args[3]);
+            latch.start();
+            latch.await();
+            say("leader");
+            Thread.sleep(Long.parseLong(args[4]));
+            latch.close();
+            break;
+        }
+        case "register": {
+            ServiceInstance<Void> instance = ServiceInstance.<Void>builder()
+                .name(args[3]).id(args[4]).address("127.0.0.1").port(Integer.parseInt(args[5])).build();
+            ServiceDiscovery<Void> discovery = ServiceDiscoveryBuilder.builder(Void.class)
+                .client(client).basePath(args[2]).thisInstance(instance).build();
+            discovery.start();
+            say("registered");
+            Thread.sleep(Long.parseLong(args[6]));
+            discovery.close();
+            break;
+        }
+        case "instances": {
+            ServiceDiscovery<Void> discovery = ServiceDiscoveryBuilder.builder(Void.class)
+                .client(client).basePath(args[2]).build();
+            discovery.start();
+            for (ServiceInstance<Void> instance : discovery.queryForInstances(args[3])) {
+                say(instance.getId() + " " + instance.getAddress() + " " + instance.getPort());
+            }
+            discovery.close();
+            break;
+        }
+        default:
+            throw new IllegalArgumentException("unknown mode " + args[1]);
+        }
+        client.close();
+    }
+}
+`
+
+// A Java program using Apache Curator, to check that the recipes of goffkv-zk interoperate
+// with their Curator counterparts. Needs docker; the first run downloads Curator.
+type Curator struct {
+    // Defaults to DefaultJBangImage.
+    Image string
+    dir string
+}
+
+// NewCurator writes the Java counterpart to a temporary directory; Close removes it.
+func NewCurator() (*Curator, error) {
+    dir, err := ioutil.TempDir("", "goffkv-zk-curator")
+    if err != nil {
+        return nil, err
+    }
+    err = ioutil.WriteFile(filepath.Join(dir, curatorPeerFile), []byte(curatorPeer), 0644)
+    if err != nil {
+        os.RemoveAll(dir)
+        return nil, err
+    }
+    return &Curator{dir: dir}, nil
+}
+
+// Command returns the command running the Java counterpart against the ensemble with args
+// (see curatorPeer for the modes). ZooKeeper paths are absolute, i.e. include the goffkv prefix.
+// The container shares the network of the host, to reach the published client ports.
+func (cur *Curator) Command(e *Ensemble, args ...string) *exec.Cmd {
+    image := cur.Image
+    if image == "" {
+        image = DefaultJBangImage
+    }
+    dockerArgs := []string{
+        "run", "--rm", "--network", "host",
+        "-v", cur.dir + ":/src:ro",
+        image, "/src/" + curatorPeerFile, e.Address(),
+    }
+    return exec.Command("docker", append(dockerArgs, args...)...)
+}
+
+func (cur *Curator) Close() error {
+    return os.RemoveAll(cur.dir)
+}
@@ -0,0 +1,183 @@
+//go:build interop
+// +build interop
+
+// Checks that the recipes of goffkv-zk (lock, election, service discovery) interoperate with
+// their Apache Curator counterparts, against a ZooKeeper server and a Java peer run in docker
+// containers; run with "go test -tags interop".
+package zktest
+
+import (
+    "bufio"
+    "io"
+    "os"
+    "strings"
+    "testing"
+    "time"
+    goffkv_zk "github.com/offscale/goffkv-zk"
+)
+
+const (
+    interopPrefix = "/interop"
+    // The first run of the peer downloads Curator.
+    peerTimeout = 5 * time.Minute
+)
+
+type interop struct {
+    e *Ensemble
+    curator *Curator
+    client *goffkv_zk.Client
+}
+
+// A running Java peer, read line by line.
+type peer struct {
+    t *testing.T
+    lines chan string
+    wait func() error
+}
+
+func (env *interop) start(t *testing.T, args ...string) *peer {
+    cmd := env.curator.Command(env.e, args...)
+    cmd.Stderr = os.Stderr
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = cmd.Start()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    p := &peer{t: t, lines: make(chan string, 16), wait: cmd.Wait}
+    go func(r io.Reader) {
+        defer close(p.lines)
+        scanner := bufio.NewScanner(r)
+        for scanner.Scan() {
+            p.lines <- scanner.Text()
+        }
+    }(stdout)
+    return p
+}
+
+// Waits for the next line of the peer, which must be want.
+func (p *peer) expect(want string) {
+    p.t.Helper()
+    select {
+    case line, ok := <-p.lines:
+        if !ok {
+            p.t.Fatalf("peer exited before printing %q", want)
+        }
+        if line != want {
+            p.t.Fatalf("peer printed %q, expected %q", line, want)
+        }
+    case <-time.After(peerTimeout):
+        p.t.Fatalf("peer did not print %q in time", want)
+    }
+}
+
+func TestCuratorInterop(t *testing.T) {
+    e, err := Start(Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer e.Close()
+
+    curator, err := NewCurator()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer curator.Close()
+
+    client, err := goffkv_zk.Connect(e.Address(), interopPrefix)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+
+    env := &interop{e, curator, client}
+    t.Run("lock", env.testLock)
+    t.Run("election", env.testElection)
+    t.Run("discovery", env.testDiscovery)
+}
+
+// A lock held by Curator excludes goffkv-zk and the other way round.
+func (env *interop) testLock(t *testing.T) {
+    p := env.start(t, "lock", interopPrefix + "/locks/a", "0", "3000")
+    p.expect("acquired")
+    m, err := env.client.TryLock("/locks/a", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if m != nil {
+        t.Fatal("acquired a lock held by Curator")
+    }
+    p.expect("released")
+    p.wait()
+
+    m, err = env.client.TryLock("/locks/a", 10 * time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if m == nil {
+        t.Fatal("couldn't acquire a lock released by Curator")
+    }
+    defer m.Unlock()
+
+    p = env.start(t, "lock", interopPrefix + "/locks/a", "500", "0")
+    defer p.wait()
+    p.expect("timeout")
+}
+
+// The leader elected by Curator's LeaderLatch is seen by ObserveLeader.
+func (env *interop) testElection(t *testing.T) {
+    p := env.start(t, "leader", interopPrefix + "/election", "java-peer", "3000")
+    defer p.wait()
+    p.expect("leader")
+
+    o, err := env.client.ObserveLeader("/election")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer o.Stop()
+    leader := o.Leader()
+    if string(leader.Value) != "java-peer" {
+        t.Fatalf("leader %q has value %q, expected the id of the peer", leader.Node, leader.Value)
+    }
+}
+
+// Instances registered on either side are listed by the other.
+func (env *interop) testDiscovery(t *testing.T) {
+    p := env.start(t, "register", interopPrefix + "/services", "api", "java-1", "8080", "5000")
+    defer p.wait()
+    p.expect("registered")
+
+    registry, err := env.client.Registry("/services")
+    if err != nil {
+        t.Fatal(err)
+    }
+    instances, err := registry.Instances("api")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(instances) != 1 || instances[0].ID != "java-1" || instances[0].Address != "127.0.0.1" || instances[0].Port != 8080 {
+        t.Fatalf("instances registered by Curator read as %+v", instances)
+    }
+
+    err = registry.Register(goffkv_zk.ServiceInstance{Name: "api", ID: "go-1", Address: "127.0.0.1", Port: 9090})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer registry.Unregister("api", "go-1")
+
+    q := env.start(t, "instances", interopPrefix + "/services", "api")
+    defer q.wait()
+    found := []string{}
+    for line := range q.lines {
+        found = append(found, line)
+    }
+    for _, line := range found {
+        if line == "go-1 127.0.0.1 9090" {
+            return
+        }
+    }
+    t.Fatalf("Curator lists %s", strings.Join(found, "; "))
+}
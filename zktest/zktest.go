@@ -0,0 +1,199 @@
+// Package zktest runs ZooKeeper in docker containers for integration tests of goffkv-zk, and the
+// goffkv conformance suite against them. It needs the docker CLI (and, for the suite, the go tool).
+package zktest
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "time"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    DefaultImage = "zookeeper:3.5"
+    clientPort = "2181/tcp"
+    readyTimeout = time.Minute
+    readyPoll = 500 * time.Millisecond
+    ruokTimeout = time.Second
+)
+
+var (
+    ErrNotReady = errors.New("zookeeper did not become ready in time")
+)
+
+type Options struct {
+    // Defaults to DefaultImage.
+    Image string
+    // Port of the host the client port of the first member is published on; random if 0. The
+    // goffkv conformance suite expects 2181.
+    HostPort int
+}
+
+// A running ZooKeeper ensemble; a single member unless started with StartEnsemble.
+type Ensemble struct {
+    network string
+    containers []string
+    addresses []string
+}
+
+func docker(args ...string) (string, error) {
+    var stderr bytes.Buffer
+    cmd := exec.Command("docker", args...)
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    if err != nil {
+        return "", fmt.Errorf("docker %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+    }
+    return strings.TrimSpace(string(out)), nil
+}
+
+// Start runs a standalone ZooKeeper server and waits until it serves requests.
+func Start(opts Options) (*Ensemble, error) {
+    return StartEnsemble(1, opts)
+}
+
+// StartEnsemble runs an ensemble of n members on a dedicated docker network and waits until every
+// member serves requests.
+func StartEnsemble(n int, opts Options) (*Ensemble, error) {
+    if opts.Image == "" {
+        opts.Image = DefaultImage
+    }
+
+    suffix := fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+    e := &Ensemble{}
+    if n > 1 {
+        e.network = "goffkv-zk-" + suffix
+        _, err := docker("network", "create", e.network)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    servers := []string{}
+    for i := 1; i <= n; i++ {
+        servers = append(servers, fmt.Sprintf("server.%d=zk%d-%s:2888:3888;2181", i, i, suffix))
+    }
+
+    for i := 1; i <= n; i++ {
+        name := fmt.Sprintf("zk%d-%s", i, suffix)
+        publish := "127.0.0.1::2181"
+        if i == 1 && opts.HostPort != 0 {
+            publish = fmt.Sprintf("127.0.0.1:%d:2181", opts.HostPort)
+        }
+
+        args := []string{"run", "-d", "--name", name, "--hostname", name, "-p", publish}
+        if n > 1 {
+            args = append(args,
+                "--network", e.network,
+                "-e", fmt.Sprintf("ZOO_MY_ID=%d", i),
+                "-e", "ZOO_SERVERS=" + strings.Join(servers, " "),
+            )
+        }
+        args = append(args, opts.Image)
+
+        container, err := docker(args...)
+        if err != nil {
+            e.Close()
+            return nil, err
+        }
+        e.containers = append(e.containers, container)
+
+        address, err := docker("port", container, clientPort)
+        if err != nil {
+            e.Close()
+            return nil, err
+        }
+        // "docker port" may list several bindings, one per line.
+        e.addresses = append(e.addresses, strings.SplitN(address, "\n", 2)[0])
+    }
+
+    err := e.waitReady(e.addresses)
+    if err != nil {
+        e.Close()
+        return nil, err
+    }
+    return e, nil
+}
+
+func (e *Ensemble) waitReady(addresses []string) error {
+    deadline := time.Now().Add(readyTimeout)
+    for time.Now().Before(deadline) {
+        ok := true
+        for _, healthy := range zkapi.FLWRuok(addresses, ruokTimeout) {
+            ok = ok && healthy
+        }
+        if ok {
+            return nil
+        }
+        time.Sleep(readyPoll)
+    }
+    return ErrNotReady
+}
+
+// Address returns the comma-separated client addresses of the members, as accepted by goffkv_zk.Connect.
+func (e *Ensemble) Address() string {
+    return strings.Join(e.addresses, ",")
+}
+
+// URL returns the goffkv URL of the ensemble.
+func (e *Ensemble) URL() string {
+    return "zk://" + e.Address()
+}
+
+// StopMember stops the i-th member (from 0), e.g. to test failover.
+func (e *Ensemble) StopMember(i int) error {
+    _, err := docker("stop", e.containers[i])
+    return err
+}
+
+// StartMember restarts a member stopped by StopMember and waits until it serves requests again.
+func (e *Ensemble) StartMember(i int) error {
+    _, err := docker("start", e.containers[i])
+    if err != nil {
+        return err
+    }
+    return e.waitReady([]string{e.addresses[i]})
+}
+
+// PauseMember freezes the i-th member without closing its connections, simulating a partition.
+func (e *Ensemble) PauseMember(i int) error {
+    _, err := docker("pause", e.containers[i])
+    return err
+}
+
+func (e *Ensemble) UnpauseMember(i int) error {
+    _, err := docker("unpause", e.containers[i])
+    return err
+}
+
+// Close removes the containers and the network of the ensemble.
+func (e *Ensemble) Close() error {
+    var firstErr error
+    for _, container := range e.containers {
+        _, err := docker("rm", "-f", container)
+        if err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    if e.network != "" {
+        _, err := docker("network", "rm", e.network)
+        if err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
+
+// ConformanceCommand returns the command running the goffkv conformance suite against this
+// backend. The suite connects to localhost:2181, so the ensemble must have been started with
+// Options.HostPort set to 2181.
+func ConformanceCommand() *exec.Cmd {
+    cmd := exec.Command("go", "test", "-count=1", "-run", "TestZk", "github.com/offscale/goffkv")
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    return cmd
+}
@@ -0,0 +1,147 @@
+//go:build zktest
+// +build zktest
+
+// Integration tests against ZooKeeper ensembles in docker; run with "go test -tags zktest". The
+// conformance suite is run by ConformanceCommand, so its imports have to resolve from the
+// directory of the test.
+package zktest
+
+import (
+    "fmt"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+    goffkv_zk "github.com/offscale/goffkv-zk"
+    zkapi "github.com/go-zookeeper/zk"
+)
+
+const (
+    // Lets the suite connect before a member goes away.
+    suiteWarmup = 5 * time.Second
+    memberDowntime = 10 * time.Second
+)
+
+// Returns the index of a follower other than the first member, which the suite connects to.
+func pickFollower(t *testing.T, e *Ensemble) int {
+    stats, _ := zkapi.FLWSrvr(e.addresses, ruokTimeout)
+    for i := 1; i < len(stats); i++ {
+        if stats[i].Error == nil && stats[i].Mode == zkapi.ModeFollower {
+            return i
+        }
+    }
+    t.Fatal("no follower besides the first member")
+    return -1
+}
+
+// Restarts member i after memberDowntime, reporting failures to errs.
+func bounceMember(e *Ensemble, i int, errs chan<- error) {
+    err := e.StopMember(i)
+    if err == nil {
+        time.Sleep(memberDowntime)
+        err = e.StartMember(i)
+    }
+    errs <- err
+}
+
+func TestConformanceWithFailover(t *testing.T) {
+    e, err := StartEnsemble(3, Options{HostPort: 2181})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer e.Close()
+
+    cmd := ConformanceCommand()
+    err = cmd.Start()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The ensemble keeps its quorum while a follower is down; the suite must not notice.
+    time.Sleep(suiteWarmup)
+    bounced := make(chan error, 1)
+    go bounceMember(e, pickFollower(t, e), bounced)
+
+    err = cmd.Wait()
+    if err != nil {
+        t.Errorf("conformance suite: %v", err)
+    }
+    if err := <-bounced; err != nil {
+        t.Errorf("member restart: %v", err)
+    }
+}
+
+// A client with a retry policy rides out the loss of the member it is attached to.
+func TestClientFailover(t *testing.T) {
+    e, err := StartEnsemble(3, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer e.Close()
+
+    c, err := goffkv_zk.Connect(e.Address(), "/failover", goffkv_zk.WithRetryPolicy(goffkv_zk.RetryPolicy{
+        MaxAttempts: 50,
+        Backoff: 100 * time.Millisecond,
+        MaxBackoff: time.Second,
+        Writes: true,
+    }))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    if _, err := c.Set("/counter", []byte("0")); err != nil {
+        t.Fatal(err)
+    }
+
+    attached := -1
+    for i, address := range e.addresses {
+        if c.ConnInfo().Server == address {
+            attached = i
+        }
+    }
+    if attached < 0 {
+        t.Fatalf("client attached to %q, not a member of %v", c.ConnInfo().Server, e.addresses)
+    }
+
+    var (
+        writes int64
+        stop = make(chan struct{})
+        failed = make(chan error, 1)
+    )
+    go func() {
+        for n := 1; ; n++ {
+            select {
+            case <-stop:
+                failed <- nil
+                return
+            default:
+            }
+            if _, err := c.Set("/counter", []byte(fmt.Sprint(n))); err != nil {
+                failed <- fmt.Errorf("write %d: %v", n, err)
+                return
+            }
+            atomic.StoreInt64(&writes, int64(n))
+        }
+    }()
+
+    bounced := make(chan error, 1)
+    bounceMember(e, attached, bounced)
+    if err := <-bounced; err != nil {
+        t.Fatal(err)
+    }
+    close(stop)
+    if err := <-failed; err != nil {
+        t.Fatal(err)
+    }
+
+    _, value, _, err := c.Get("/counter", false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if last := atomic.LoadInt64(&writes); strings.TrimSpace(string(value)) != fmt.Sprint(last) {
+        t.Errorf("counter is %s after %d writes", value, last)
+    }
+    if server := c.ConnInfo().Server; server == "" {
+        t.Error("client not reattached after the failover")
+    }
+}